@@ -5,6 +5,7 @@ cd $GOPATH/src/github.com/nokia/danm/pkg
 glide install
 go get -d github.com/vishvananda/netlink
 go get github.com/golang/groupcache/lru
+go get github.com/prometheus/client_golang/prometheus
 go get k8s.io/code-generator/cmd/deepcopy-gen
 go get k8s.io/code-generator/cmd/client-gen
 go get k8s.io/code-generator/cmd/lister-gen
@@ -17,3 +18,6 @@ go install -a -ldflags '-extldflags "-static"' github.com/nokia/danm/pkg/danm
 go install -a -ldflags '-extldflags "-static"' github.com/nokia/danm/pkg/netwatcher
 go install -a -ldflags '-extldflags "-static"' github.com/nokia/danm/pkg/fakeipam
 go install -a -ldflags '-extldflags "-static"' github.com/nokia/danm/pkg/svcwatcher
+go install -a -ldflags '-extldflags "-static"' github.com/nokia/danm/pkg/danmctl
+go install -a -ldflags '-extldflags "-static"' github.com/nokia/danm/pkg/nadexporter
+go install -a -ldflags '-extldflags "-static"' github.com/nokia/danm/pkg/danmwatcher
@@ -0,0 +1,186 @@
+package allocmigration
+
+import (
+  "crypto/sha256"
+  "encoding/hex"
+  "errors"
+  "sort"
+  "strings"
+  danmtypes "github.com/nokia/danm/pkg/crd/apis/danm/v1"
+  "github.com/nokia/danm/pkg/bitarray"
+)
+
+const (
+  // FormatAnnotation stores the version of the encoding used for the allocation record of a DanmNet
+  // DanmNets without this annotation are encoded with the original, BitArray based format
+  FormatAnnotation = "danm.k8s.io/alloc-format"
+  // ChecksumAnnotation stores the format independent checksum of the allocations at the time of the last migration
+  ChecksumAnnotation = "danm.k8s.io/alloc-checksum"
+  // BackupAnnotation stores the allocation record as it was before the last migration
+  BackupAnnotation = "danm.k8s.io/alloc-backup"
+  // BackupFormatAnnotation stores the version of the encoding used for the backup
+  BackupFormatAnnotation = "danm.k8s.io/alloc-backup-format"
+  // BitArrayFormat is the original allocation format: Base64 encoded BitArray
+  BitArrayFormat = "1"
+  // CurrentFormat is the allocation format used by this version of DANM
+  CurrentFormat = BitArrayFormat
+)
+
+// Format converts the allocation record of a DanmNet between its encoded, and its canonical in-memory representation
+// Regardless of the encoding, the canonical representation is a BitArray indexed with the offset of the IP address inside the CIDR
+type Format interface {
+  Decode(alloc string) (*bitarray.BitArray, error)
+  Encode(arr *bitarray.BitArray) (string, error)
+}
+
+type bitArrayFormat struct {}
+
+func (bitArrayFormat) Decode(alloc string) (*bitarray.BitArray, error) {
+  arr := bitarray.NewBitArrayFromBase64(alloc)
+  if arr.Len() == 0 {
+    return nil, errors.New("allocation record is not a valid Base64 encoded BitArray")
+  }
+  return arr, nil
+}
+
+func (bitArrayFormat) Encode(arr *bitarray.BitArray) (string, error) {
+  return arr.Encode(), nil
+}
+
+var formats = map[string]Format {
+  BitArrayFormat: bitArrayFormat{},
+}
+
+// RegisterFormat makes a new allocation format available for migrations
+// Every new encoding shall register itself here, so existing DanmNets can be converted to it without recreating them
+func RegisterFormat(version string, format Format) {
+  formats[version] = format
+}
+
+// SupportedFormats returns the versions of all the registered allocation formats
+func SupportedFormats() []string {
+  var versions []string
+  for version := range formats {
+    versions = append(versions, version)
+  }
+  sort.Strings(versions)
+  return versions
+}
+
+// GetFormat returns the version of the encoding used for the allocation record of the DanmNet
+func GetFormat(dnet *danmtypes.DanmNet) string {
+  if version, ok := dnet.ObjectMeta.Annotations[FormatAnnotation]; ok && version != "" {
+    return version
+  }
+  return BitArrayFormat
+}
+
+// IsFormatSupported returns true if this version of DANM can interpret the allocation record of the DanmNet
+// IP allocation shall not be attempted for networks already migrated to a format unknown to the running binary
+func IsFormatSupported(dnet *danmtypes.DanmNet) bool {
+  _, ok := formats[GetFormat(dnet)]
+  return ok
+}
+
+// Checksum returns a format independent fingerprint of the allocations
+func Checksum(arr *bitarray.BitArray) string {
+  sum := sha256.Sum256([]byte(arr.Encode()))
+  return hex.EncodeToString(sum[:])
+}
+
+// Migrate converts the allocation record of the DanmNet in place to the target format
+// The allocations are decoded, re-encoded, and decoded again; the migration is only accepted if the checksums of the old and new records match
+// The original record is kept in the annotations of the DanmNet, so the migration can be rolled back
+// Returns true if the DanmNet was modified, and needs to be updated in the API server
+func Migrate(dnet *danmtypes.DanmNet, target string) (bool, error) {
+  if dnet.Spec.Options.Alloc == "" {
+    return false, nil
+  }
+  source := GetFormat(dnet)
+  if source == target && dnet.ObjectMeta.Annotations[ChecksumAnnotation] != "" {
+    return false, nil
+  }
+  arr, err := decode(source, dnet.Spec.Options.Alloc)
+  if err != nil {
+    return false, err
+  }
+  newAlloc, checksum, err := convert(arr, target)
+  if err != nil {
+    return false, err
+  }
+  if source != target {
+    setAnnotation(dnet, BackupAnnotation, dnet.Spec.Options.Alloc)
+    setAnnotation(dnet, BackupFormatAnnotation, source)
+  }
+  setAnnotation(dnet, FormatAnnotation, target)
+  setAnnotation(dnet, ChecksumAnnotation, checksum)
+  dnet.Spec.Options.Alloc = newAlloc
+  return true, nil
+}
+
+// Rollback restores the allocation record of the DanmNet to the format it had before the last migration
+// If no allocation happened since the migration the backup is restored verbatim,
+// otherwise the current allocations are converted back to the original format so no IP gets lost
+// Returns true if the DanmNet was modified, and needs to be updated in the API server
+func Rollback(dnet *danmtypes.DanmNet) (bool, error) {
+  backup, isBackupPresent := dnet.ObjectMeta.Annotations[BackupAnnotation]
+  if !isBackupPresent {
+    return false, nil
+  }
+  backupFormat := dnet.ObjectMeta.Annotations[BackupFormatAnnotation]
+  if backupFormat == "" {
+    backupFormat = BitArrayFormat
+  }
+  arr, err := decode(GetFormat(dnet), dnet.Spec.Options.Alloc)
+  if err != nil {
+    return false, errors.New("current allocation record cannot be decoded because:" + err.Error())
+  }
+  newAlloc := backup
+  if Checksum(arr) != dnet.ObjectMeta.Annotations[ChecksumAnnotation] {
+    newAlloc, _, err = convert(arr, backupFormat)
+    if err != nil {
+      return false, err
+    }
+  }
+  dnet.Spec.Options.Alloc = newAlloc
+  setAnnotation(dnet, FormatAnnotation, backupFormat)
+  delete(dnet.ObjectMeta.Annotations, ChecksumAnnotation)
+  delete(dnet.ObjectMeta.Annotations, BackupAnnotation)
+  delete(dnet.ObjectMeta.Annotations, BackupFormatAnnotation)
+  return true, nil
+}
+
+func decode(version, alloc string) (*bitarray.BitArray, error) {
+  format, ok := formats[version]
+  if !ok {
+    return nil, errors.New("allocation format:" + version + " is not supported, supported formats are:" + strings.Join(SupportedFormats(), ","))
+  }
+  return format.Decode(alloc)
+}
+
+func convert(arr *bitarray.BitArray, target string) (string, string, error) {
+  format, ok := formats[target]
+  if !ok {
+    return "", "", errors.New("target allocation format:" + target + " is not supported, supported formats are:" + strings.Join(SupportedFormats(), ","))
+  }
+  newAlloc, err := format.Encode(arr)
+  if err != nil {
+    return "", "", errors.New("allocations cannot be encoded to format:" + target + " because:" + err.Error())
+  }
+  verification, err := format.Decode(newAlloc)
+  if err != nil {
+    return "", "", errors.New("converted allocations cannot be decoded from format:" + target + " because:" + err.Error())
+  }
+  checksum := Checksum(arr)
+  if Checksum(verification) != checksum {
+    return "", "", errors.New("checksum mismatch after converting allocations to format:" + target)
+  }
+  return newAlloc, checksum, nil
+}
+
+func setAnnotation(dnet *danmtypes.DanmNet, key, value string) {
+  if dnet.ObjectMeta.Annotations == nil {
+    dnet.ObjectMeta.Annotations = make(map[string]string)
+  }
+  dnet.ObjectMeta.Annotations[key] = value
+}
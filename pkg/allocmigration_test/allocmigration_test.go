@@ -0,0 +1,111 @@
+package allocmigration_test
+
+import (
+  "encoding/base64"
+  "encoding/hex"
+  "testing"
+  meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+  danmtypes "github.com/nokia/danm/pkg/crd/apis/danm/v1"
+  "github.com/nokia/danm/pkg/allocmigration"
+  "github.com/nokia/danm/pkg/bitarray"
+)
+
+const (
+  hexFormat = "test-hex"
+)
+
+type hexEncoding struct {}
+
+func (hexEncoding) Decode(alloc string) (*bitarray.BitArray, error) {
+  data, err := hex.DecodeString(alloc)
+  if err != nil {
+    return nil, err
+  }
+  return bitarray.NewBitArrayFromBase64(base64.StdEncoding.EncodeToString(data)), nil
+}
+
+func (hexEncoding) Encode(arr *bitarray.BitArray) (string, error) {
+  data, err := base64.StdEncoding.DecodeString(arr.Encode())
+  return hex.EncodeToString(data), err
+}
+
+func newTestNet() danmtypes.DanmNet {
+  arr, _ := bitarray.NewBitArray(256)
+  arr.Set(10)
+  arr.Set(255)
+  return danmtypes.DanmNet{Spec: danmtypes.DanmNetSpec{NetworkID: "test", Options: danmtypes.DanmNetOption{Alloc: arr.Encode()}}}
+}
+
+func TestMigrateToSameFormat(t *testing.T) {
+  dnet := newTestNet()
+  wasModified, err := allocmigration.Migrate(&dnet, allocmigration.BitArrayFormat)
+  if err != nil || !wasModified {
+    t.Fatalf("Stamping the format of a legacy network failed, modified:%t, error:%v", wasModified, err)
+  }
+  if dnet.ObjectMeta.Annotations[allocmigration.ChecksumAnnotation] == "" || dnet.ObjectMeta.Annotations[allocmigration.BackupAnnotation] != "" {
+    t.Errorf("Annotations:%v are not set as expected", dnet.ObjectMeta.Annotations)
+  }
+  wasModified, err = allocmigration.Migrate(&dnet, allocmigration.BitArrayFormat)
+  if err != nil || wasModified {
+    t.Errorf("Already migrated network was modified again, modified:%t, error:%v", wasModified, err)
+  }
+}
+
+func TestMigrateToUnknownFormat(t *testing.T) {
+  dnet := newTestNet()
+  original := dnet.Spec.Options.Alloc
+  _, err := allocmigration.Migrate(&dnet, "hululululu")
+  if err == nil {
+    t.Errorf("Migration to an unknown format was expected to fail")
+  }
+  if dnet.Spec.Options.Alloc != original || len(dnet.ObjectMeta.Annotations) != 0 {
+    t.Errorf("Failed migration modified the network")
+  }
+}
+
+func TestMigrateAndRollback(t *testing.T) {
+  allocmigration.RegisterFormat(hexFormat, hexEncoding{})
+  dnet := newTestNet()
+  original := dnet.Spec.Options.Alloc
+  wasModified, err := allocmigration.Migrate(&dnet, hexFormat)
+  if err != nil || !wasModified {
+    t.Fatalf("Migration failed, modified:%t, error:%v", wasModified, err)
+  }
+  if allocmigration.GetFormat(&dnet) != hexFormat || dnet.ObjectMeta.Annotations[allocmigration.BackupAnnotation] != original {
+    t.Errorf("Annotations:%v are not set as expected", dnet.ObjectMeta.Annotations)
+  }
+  wasModified, err = allocmigration.Rollback(&dnet)
+  if err != nil || !wasModified {
+    t.Fatalf("Rollback failed, modified:%t, error:%v", wasModified, err)
+  }
+  if dnet.Spec.Options.Alloc != original || allocmigration.GetFormat(&dnet) != allocmigration.BitArrayFormat {
+    t.Errorf("Rollback did not restore the original allocation record")
+  }
+}
+
+func TestRollbackKeepsNewAllocations(t *testing.T) {
+  allocmigration.RegisterFormat(hexFormat, hexEncoding{})
+  dnet := newTestNet()
+  allocmigration.Migrate(&dnet, hexFormat)
+  arr, _ := hexEncoding{}.Decode(dnet.Spec.Options.Alloc)
+  arr.Set(20)
+  dnet.Spec.Options.Alloc, _ = hexEncoding{}.Encode(arr)
+  _, err := allocmigration.Rollback(&dnet)
+  if err != nil {
+    t.Fatalf("Rollback failed with error:%v", err)
+  }
+  rolledBack := bitarray.NewBitArrayFromBase64(dnet.Spec.Options.Alloc)
+  if !rolledBack.Get(10) || !rolledBack.Get(20) || !rolledBack.Get(255) {
+    t.Errorf("Allocations made after the migration were lost during rollback")
+  }
+}
+
+func TestIsFormatSupported(t *testing.T) {
+  dnet := danmtypes.DanmNet{ObjectMeta: meta_v1.ObjectMeta{Annotations: map[string]string{allocmigration.FormatAnnotation: "999"}}}
+  if allocmigration.IsFormatSupported(&dnet) {
+    t.Errorf("Unknown allocation format was reported as supported")
+  }
+  if !allocmigration.IsFormatSupported(&danmtypes.DanmNet{}) {
+    t.Errorf("Legacy network without format annotation was reported as unsupported")
+  }
+}
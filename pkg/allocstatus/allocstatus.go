@@ -0,0 +1,212 @@
+package allocstatus
+
+import (
+  "errors"
+  "net"
+  "strconv"
+  "time"
+  corev1 "k8s.io/api/core/v1"
+  apierrors "k8s.io/apimachinery/pkg/api/errors"
+  meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+  "k8s.io/client-go/kubernetes"
+  danmtypes "github.com/nokia/danm/pkg/crd/apis/danm/v1"
+  danmclientset "github.com/nokia/danm/pkg/crd/client/clientset/versioned"
+  "github.com/nokia/danm/pkg/bitarray"
+  "github.com/nokia/danm/pkg/danmnet"
+)
+
+const (
+  // NetworkLabel selects the status ConfigMaps of a DanmNet, its value is the name of the DanmNet
+  NetworkLabel = "danm.k8s.io/allocation-network"
+  // PageAnnotation stores the index of the page, and the number of pages in "index/count" format
+  PageAnnotation = "danm.k8s.io/allocation-page"
+  // AllocatedAnnotation stores the number of allocated addresses of the whole allocation pool
+  AllocatedAnnotation = "danm.k8s.io/allocated"
+  // PoolSizeAnnotation stores the number of addresses in the allocation pool
+  PoolSizeAnnotation = "danm.k8s.io/pool-size"
+  // GeneratedAtAnnotation stores the time the status was generated at, in RFC3339 format
+  GeneratedAtAnnotation = "danm.k8s.io/generated-at"
+  // DefaultPageSize keeps the status ConfigMaps well below the size limit of K8s objects
+  DefaultPageSize = 2000
+  // HolderUnknown is the holder of allocated addresses neither a DanmEp, nor a DanmIPReservation claims, e.g. leaked addresses
+  HolderUnknown = "unknown"
+  configMapPrefix = "danm-allocations-"
+)
+
+// Allocation is one allocated IPv4 address of the allocation pool, and its holder
+// The holder is "pod:<Pod name>", "reservation:<DanmIPReservation name>", or HolderUnknown
+type Allocation struct {
+  Address string
+  Holder string
+}
+
+// Status is the decoded allocation state of a DanmNet
+type Status struct {
+  PoolSize int
+  Allocations []Allocation
+}
+
+// GetStatus decodes the allocation bitmap of the DanmNet, and resolves the holder of every allocated address of its allocation pool
+// The DanmEps, and DanmIPReservations can belong to any network, only the ones of the DanmNet are considered
+func GetStatus(dnet *danmtypes.DanmNet, eps []danmtypes.DanmEp, reservations []danmtypes.DanmIPReservation) Status {
+  _, ipnet, err := net.ParseCIDR(dnet.Spec.Options.Cidr)
+  if err != nil || dnet.Spec.Options.Alloc == "" {
+    return Status{}
+  }
+  start := net.ParseIP(dnet.Spec.Options.Pool.Start)
+  end := net.ParseIP(dnet.Spec.Options.Pool.End)
+  if start == nil || end == nil {
+    return Status{}
+  }
+  holders := make(map[string]string)
+  for _, res := range reservations {
+    if res.ObjectMeta.Namespace == dnet.ObjectMeta.Namespace && res.Spec.NetworkID == dnet.Spec.NetworkID {
+      holders[getIp(res.Spec.Address)] = "reservation:" + res.ObjectMeta.Name
+    }
+  }
+  for _, ep := range eps {
+    if ep.ObjectMeta.Namespace == dnet.ObjectMeta.Namespace && ep.Spec.NetworkID == dnet.Spec.NetworkID {
+      holders[getIp(ep.Spec.Iface.Address)] = "pod:" + ep.Spec.Pod
+    }
+  }
+  ba := bitarray.NewBitArrayFromBase64(dnet.Spec.Options.Alloc)
+  base := danmnet.Ip2int(ipnet.IP)
+  first, last := danmnet.Ip2int(start), danmnet.Ip2int(end)
+  status := Status{PoolSize: int(last - first) + 1}
+  for ipInt := first; ipInt <= last && int(ipInt - base) < ba.Len(); ipInt++ {
+    if !ba.Get(ipInt - base) {
+      continue
+    }
+    address := danmnet.Int2ip(ipInt).String()
+    holder, ok := holders[address]
+    if !ok {
+      holder = HolderUnknown
+    }
+    status.Allocations = append(status.Allocations, Allocation{Address: address, Holder: holder})
+  }
+  return status
+}
+
+func getIp(address string) string {
+  ip, _, err := net.ParseCIDR(address)
+  if err != nil {
+    return ""
+  }
+  return ip.String()
+}
+
+// BuildConfigMaps pages the status of the DanmNet into ConfigMaps of at most pageSize addresses
+// The data of the ConfigMaps maps the addresses to their holders, and a DanmNet without allocations still gets one empty page
+func BuildConfigMaps(dnet *danmtypes.DanmNet, status Status, pageSize int) []corev1.ConfigMap {
+  if pageSize <= 0 {
+    pageSize = DefaultPageSize
+  }
+  numOfPages := (len(status.Allocations) + pageSize - 1) / pageSize
+  if numOfPages == 0 {
+    numOfPages = 1
+  }
+  generatedAt := time.Now().UTC().Format(time.RFC3339)
+  var configMaps []corev1.ConfigMap
+  for page := 0; page < numOfPages; page++ {
+    cm := corev1.ConfigMap {
+      ObjectMeta: meta_v1.ObjectMeta {
+        Name: GetConfigMapName(dnet, page),
+        Namespace: dnet.ObjectMeta.Namespace,
+        Labels: map[string]string{NetworkLabel: dnet.ObjectMeta.Name},
+        //The pages are garbage collected together with the DanmNet
+        OwnerReferences: []meta_v1.OwnerReference{{APIVersion: danmtypes.SchemeGroupVersion.String(), Kind: "DanmNet", Name: dnet.ObjectMeta.Name, UID: dnet.ObjectMeta.UID}},
+        Annotations: map[string]string {
+          PageAnnotation: strconv.Itoa(page) + "/" + strconv.Itoa(numOfPages),
+          AllocatedAnnotation: strconv.Itoa(len(status.Allocations)),
+          PoolSizeAnnotation: strconv.Itoa(status.PoolSize),
+          GeneratedAtAnnotation: generatedAt,
+        },
+      },
+      Data: make(map[string]string),
+    }
+    for i := page * pageSize; i < len(status.Allocations) && i < (page + 1) * pageSize; i++ {
+      cm.Data[status.Allocations[i].Address] = status.Allocations[i].Holder
+    }
+    configMaps = append(configMaps, cm)
+  }
+  return configMaps
+}
+
+// GetConfigMapName returns the name of the given page of the status of the DanmNet
+func GetConfigMapName(dnet *danmtypes.DanmNet, page int) string {
+  return configMapPrefix + dnet.ObjectMeta.Name + "-" + strconv.Itoa(page)
+}
+
+// Publish refreshes the status ConfigMaps of all DanmNets with an allocation pool, and deletes the pages which are not needed anymore
+func Publish(danmClient danmclientset.Interface, kubeClient kubernetes.Interface, pageSize int) error {
+  nets, err := danmClient.DanmV1().DanmNets("").List(meta_v1.ListOptions{})
+  if err != nil {
+    return errors.New("DanmNets cannot be listed because:" + err.Error())
+  }
+  eps, err := danmClient.DanmV1().DanmEps("").List(meta_v1.ListOptions{})
+  if err != nil {
+    return errors.New("DanmEps cannot be listed because:" + err.Error())
+  }
+  reservations, err := danmClient.DanmV1().DanmIPReservations("").List(meta_v1.ListOptions{})
+  if err != nil {
+    return errors.New("DanmIPReservations cannot be listed because:" + err.Error())
+  }
+  var failures string
+  for i := range nets.Items {
+    dnet := &nets.Items[i]
+    if dnet.Spec.Options.SeparateAllocation && dnet.Spec.Options.Cidr != "" {
+      record, err := danmClient.DanmV1().DanmNetAllocations(dnet.ObjectMeta.Namespace).Get(dnet.ObjectMeta.Name, meta_v1.GetOptions{})
+      if err != nil {
+        failures += "allocation record of network:" + dnet.ObjectMeta.Namespace + "/" + dnet.ObjectMeta.Name + " cannot be read because:" + err.Error() + "; "
+        continue
+      }
+      dnet.Spec.Options.Alloc = record.Spec.Alloc
+    }
+    if dnet.Spec.Options.Alloc == "" {
+      continue
+    }
+    configMaps := BuildConfigMaps(dnet, GetStatus(dnet, eps.Items, reservations.Items), pageSize)
+    err = publishNetwork(kubeClient, dnet, configMaps)
+    if err != nil {
+      failures += "status of network:" + dnet.ObjectMeta.Namespace + "/" + dnet.ObjectMeta.Name + " cannot be published because:" + err.Error() + "; "
+    }
+  }
+  if failures != "" {
+    return errors.New(failures)
+  }
+  return nil
+}
+
+func publishNetwork(kubeClient kubernetes.Interface, dnet *danmtypes.DanmNet, configMaps []corev1.ConfigMap) error {
+  cmClient := kubeClient.CoreV1().ConfigMaps(dnet.ObjectMeta.Namespace)
+  published := make(map[string]bool)
+  for i := range configMaps {
+    cm := &configMaps[i]
+    existing, err := cmClient.Get(cm.ObjectMeta.Name, meta_v1.GetOptions{})
+    if apierrors.IsNotFound(err) {
+      _, err = cmClient.Create(cm)
+    } else if err == nil {
+      existing.ObjectMeta.Labels = cm.ObjectMeta.Labels
+      existing.ObjectMeta.Annotations = cm.ObjectMeta.Annotations
+      existing.Data = cm.Data
+      _, err = cmClient.Update(existing)
+    }
+    if err != nil {
+      return err
+    }
+    published[cm.ObjectMeta.Name] = true
+  }
+  stale, err := cmClient.List(meta_v1.ListOptions{LabelSelector: NetworkLabel + "=" + dnet.ObjectMeta.Name})
+  if err != nil {
+    return err
+  }
+  for _, cm := range stale.Items {
+    if !published[cm.ObjectMeta.Name] {
+      err = cmClient.Delete(cm.ObjectMeta.Name, &meta_v1.DeleteOptions{})
+      if err != nil && !apierrors.IsNotFound(err) {
+        return err
+      }
+    }
+  }
+  return nil
+}
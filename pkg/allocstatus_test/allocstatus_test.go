@@ -0,0 +1,93 @@
+package allocstatus_test
+
+import (
+  "testing"
+  meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+  danmtypes "github.com/nokia/danm/pkg/crd/apis/danm/v1"
+  "github.com/nokia/danm/pkg/allocstatus"
+  "github.com/nokia/danm/pkg/bitarray"
+)
+
+func newNet(allocated ...uint32) *danmtypes.DanmNet {
+  ba, _ := bitarray.NewBitArray(256)
+  //Network, and broadcast addresses are always reserved, but are outside the allocation pool
+  ba.Set(0)
+  ba.Set(255)
+  for _, pos := range allocated {
+    ba.Set(pos)
+  }
+  return &danmtypes.DanmNet {
+    ObjectMeta: meta_v1.ObjectMeta{Name: "oam", Namespace: "default"},
+    Spec: danmtypes.DanmNetSpec{NetworkID: "oam", Options: danmtypes.DanmNetOption {
+      Cidr: "10.0.0.0/24",
+      Pool: danmtypes.IP4Pool{Start: "10.0.0.10", End: "10.0.0.19"},
+      Alloc: ba.Encode(),
+    }},
+  }
+}
+
+func newEp(name, namespace, network, address string) danmtypes.DanmEp {
+  return danmtypes.DanmEp{ObjectMeta: meta_v1.ObjectMeta{Name: name, Namespace: namespace}, Spec: danmtypes.DanmEpSpec{NetworkID: network, Pod: name, Iface: danmtypes.DanmEpIface{Address: address}}}
+}
+
+func TestGetStatus(t *testing.T) {
+  eps := []danmtypes.DanmEp {
+    newEp("pod1", "default", "oam", "10.0.0.10/24"),
+    newEp("pod2", "other", "oam", "10.0.0.11/24"),
+    newEp("pod3", "default", "data", "10.0.0.12/24"),
+  }
+  reservations := []danmtypes.DanmIPReservation {
+    {ObjectMeta: meta_v1.ObjectMeta{Name: "vip", Namespace: "default"}, Spec: danmtypes.DanmIPReservationSpec{NetworkID: "oam", Address: "10.0.0.19/24"}},
+  }
+  status := allocstatus.GetStatus(newNet(10, 11, 19), eps, reservations)
+  if status.PoolSize != 10 {
+    t.Errorf("Pool size:%d does not match with expected:10", status.PoolSize)
+  }
+  expected := []allocstatus.Allocation {
+    {Address: "10.0.0.10", Holder: "pod:pod1"},
+    {Address: "10.0.0.11", Holder: allocstatus.HolderUnknown},
+    {Address: "10.0.0.19", Holder: "reservation:vip"},
+  }
+  if len(status.Allocations) != len(expected) {
+    t.Fatalf("Number of allocations:%d does not match with expected:%d", len(status.Allocations), len(expected))
+  }
+  for i := range expected {
+    if status.Allocations[i] != expected[i] {
+      t.Errorf("Allocation:%v does not match with expected:%v", status.Allocations[i], expected[i])
+    }
+  }
+}
+
+var pagingTcs = []struct {
+  tcName string
+  allocated []uint32
+  pageSize int
+  expectedPages int
+}{
+  {"noAllocations", nil, 2, 1},
+  {"fullPages", []uint32{10, 11, 12, 13}, 2, 2},
+  {"partialLastPage", []uint32{10, 11, 12, 13, 14}, 2, 3},
+  {"defaultPageSize", []uint32{10, 11, 12}, 0, 1},
+}
+
+func TestBuildConfigMaps(t *testing.T) {
+  for _, tc := range pagingTcs {
+    t.Run(tc.tcName, func(t *testing.T) {
+      dnet := newNet(tc.allocated...)
+      configMaps := allocstatus.BuildConfigMaps(dnet, allocstatus.GetStatus(dnet, nil, nil), tc.pageSize)
+      if len(configMaps) != tc.expectedPages {
+        t.Fatalf("Number of pages:%d does not match with expected:%d", len(configMaps), tc.expectedPages)
+      }
+      numOfAddresses := 0
+      for page, cm := range configMaps {
+        if cm.ObjectMeta.Name != allocstatus.GetConfigMapName(dnet, page) || cm.ObjectMeta.Labels[allocstatus.NetworkLabel] != "oam" {
+          t.Errorf("Page:%d is not identifiable, name:%s labels:%v", page, cm.ObjectMeta.Name, cm.ObjectMeta.Labels)
+        }
+        numOfAddresses += len(cm.Data)
+      }
+      if numOfAddresses != len(tc.allocated) {
+        t.Errorf("Number of published addresses:%d does not match with expected:%d", numOfAddresses, len(tc.allocated))
+      }
+    })
+  }
+}
@@ -0,0 +1,130 @@
+package apimetrics
+
+import (
+  "errors"
+  "net/http"
+  "net/url"
+  "strconv"
+  "strings"
+  "time"
+  "github.com/prometheus/client_golang/prometheus"
+  "k8s.io/client-go/rest"
+  "k8s.io/client-go/tools/metrics"
+)
+
+var (
+  requestLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts {
+    Name: "danm_rest_client_request_latency_seconds",
+    Help: "Latency of the requests sent to the K8s API server, per verb, and URL template.",
+    Buckets: prometheus.ExponentialBuckets(0.001, 2, 15),
+  }, []string{"verb", "url"})
+  requestResults = prometheus.NewCounterVec(prometheus.CounterOpts {
+    Name: "danm_rest_client_requests_total",
+    Help: "Number of requests sent to the K8s API server, per HTTP status code, method, and host.",
+  }, []string{"code", "method", "host"})
+  operations = prometheus.NewCounterVec(prometheus.CounterOpts {
+    Name: "danm_api_operations_total",
+    Help: "Number of K8s API operations per component, verb (e.g. get, list, watch, update, delete), resource (e.g. danmnets, danmeps), and result code.",
+  }, []string{"component", "verb", "resource", "code"})
+)
+
+type latencyAdapter struct {}
+
+func (latencyAdapter) Observe(verb string, u url.URL, latency time.Duration) {
+  requestLatency.WithLabelValues(verb, u.String()).Observe(latency.Seconds())
+}
+
+type resultAdapter struct {}
+
+func (resultAdapter) Increment(code, method, host string) {
+  requestResults.WithLabelValues(code, method, host).Inc()
+}
+
+// Register hooks the request latency, and result metrics of client-go into Prometheus
+// It shall be called once by every component, before its first K8s API client is created
+func Register() error {
+  for _, collector := range []prometheus.Collector{requestLatency, requestResults, operations} {
+    err := prometheus.Register(collector)
+    if err != nil {
+      if _, ok := err.(prometheus.AlreadyRegisteredError); !ok {
+        return errors.New("cannot register API metrics because:" + err.Error())
+      }
+    }
+  }
+  metrics.Register(latencyAdapter{}, resultAdapter{})
+  return nil
+}
+
+// InstrumentConfig makes every client built from the config count its K8s API operations in the name of the component
+func InstrumentConfig(component string, config *rest.Config) {
+  wrapped := config.WrapTransport
+  config.WrapTransport = func(rt http.RoundTripper) http.RoundTripper {
+    if wrapped != nil {
+      rt = wrapped(rt)
+    }
+    return &roundTripper{component: component, delegate: rt}
+  }
+}
+
+type roundTripper struct {
+  component string
+  delegate http.RoundTripper
+}
+
+func (rt *roundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+  verb, resource := GetOperation(req.Method, req.URL)
+  resp, err := rt.delegate.RoundTrip(req)
+  code := "error"
+  if err == nil {
+    code = strconv.Itoa(resp.StatusCode)
+  }
+  operations.WithLabelValues(rt.component, verb, resource, code).Inc()
+  return resp, err
+}
+
+// GetOperation tells which K8s API verb the request executes on which resource, e.g. "update", and "danmnets"
+// Subresources are appended to the resource, e.g. "pods/status"
+func GetOperation(method string, u *url.URL) (string, string) {
+  segments := strings.Split(strings.Trim(u.Path, "/"), "/")
+  switch {
+  case len(segments) >= 2 && segments[0] == "api":
+    segments = segments[2:]
+  case len(segments) >= 3 && segments[0] == "apis":
+    segments = segments[3:]
+  default:
+    return strings.ToLower(method), "unknown"
+  }
+  if len(segments) >= 3 && segments[0] == "namespaces" {
+    segments = segments[2:]
+  }
+  if len(segments) == 0 {
+    return strings.ToLower(method), "unknown"
+  }
+  resource := segments[0]
+  if len(segments) >= 3 {
+    resource += "/" + segments[2]
+  }
+  isNamed := len(segments) >= 2
+  switch method {
+  case http.MethodGet:
+    if u.Query().Get("watch") == "true" || u.Query().Get("watch") == "1" {
+      return "watch", resource
+    }
+    if isNamed {
+      return "get", resource
+    }
+    return "list", resource
+  case http.MethodPost:
+    return "create", resource
+  case http.MethodPut:
+    return "update", resource
+  case http.MethodPatch:
+    return "patch", resource
+  case http.MethodDelete:
+    if isNamed {
+      return "delete", resource
+    }
+    return "deletecollection", resource
+  }
+  return strings.ToLower(method), resource
+}
@@ -0,0 +1,39 @@
+package apimetrics_test
+
+import (
+  "net/url"
+  "testing"
+  "github.com/nokia/danm/pkg/apimetrics"
+)
+
+var operationTcs = []struct {
+  tcName string
+  method string
+  path string
+  expectedVerb string
+  expectedResource string
+}{
+  {"getDanmNet", "GET", "/apis/danm.k8s.io/v1/namespaces/default/danmnets/management", "get", "danmnets"},
+  {"listDanmEps", "GET", "/apis/danm.k8s.io/v1/danmeps?labelSelector=a%3Db", "list", "danmeps"},
+  {"watchDanmEps", "GET", "/apis/danm.k8s.io/v1/namespaces/default/danmeps?watch=true", "watch", "danmeps"},
+  {"updateAlloc", "PUT", "/apis/danm.k8s.io/v1/namespaces/default/danmnetallocations/management", "update", "danmnetallocations"},
+  {"createPod", "POST", "/api/v1/namespaces/default/pods", "create", "pods"},
+  {"patchPodStatus", "PATCH", "/api/v1/namespaces/default/pods/pod1/status", "patch", "pods/status"},
+  {"deleteDanmEp", "DELETE", "/apis/danm.k8s.io/v1/namespaces/default/danmeps/ep1", "delete", "danmeps"},
+  {"deleteDanmEps", "DELETE", "/apis/danm.k8s.io/v1/namespaces/default/danmeps", "deletecollection", "danmeps"},
+  {"getNamespace", "GET", "/api/v1/namespaces/default", "get", "namespaces"},
+  {"getNode", "GET", "/api/v1/nodes/node1", "get", "nodes"},
+  {"discovery", "GET", "/version", "get", "unknown"},
+}
+
+func TestGetOperation(t *testing.T) {
+  for _, tc := range operationTcs {
+    t.Run(tc.tcName, func(t *testing.T) {
+      u, _ := url.Parse(tc.path)
+      verb, resource := apimetrics.GetOperation(tc.method, u)
+      if verb != tc.expectedVerb || resource != tc.expectedResource {
+        t.Errorf("Operation was expected to be %s %s, got %s %s", tc.expectedVerb, tc.expectedResource, verb, resource)
+      }
+    })
+  }
+}
@@ -0,0 +1,72 @@
+package apiretry
+
+import (
+  "log"
+  "net"
+  "net/http"
+  "net/url"
+  "strconv"
+  "time"
+  apierrors "k8s.io/apimachinery/pkg/api/errors"
+  "k8s.io/apimachinery/pkg/util/wait"
+)
+
+// DefaultBackoff is used for retrying API operations executed during CNI operations
+// The total time spent with retrying stays well below the time DANM waits for the result of an interface creation
+var DefaultBackoff = wait.Backoff {
+  Duration: 100*time.Millisecond,
+  Factor: 2.0,
+  Jitter: 0.5,
+  Steps: 5,
+}
+
+// IsRetriable returns true if the error is a transient failure of the K8s API server, and the operation is worth retrying
+// Throttling (429), server side (500, 502, 503, 504), and network errors are considered transient
+// All other errors (e.g. conflicts, not found, forbidden, invalid objects) are considered fatal
+func IsRetriable(err error) bool {
+  if err == nil {
+    return false
+  }
+  if status, ok := err.(apierrors.APIStatus); ok {
+    switch status.Status().Code {
+      case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+        return true
+    }
+    return apierrors.IsServerTimeout(err) || apierrors.IsTimeout(err)
+  }
+  // client-go returns the errors of the HTTP client wrapped into the URL of the request
+  if urlErr, ok := err.(*url.Error); ok {
+    err = urlErr.Err
+  }
+  // Failed network operations, e.g. connection refused while the API server restarts, are retried even if they are not temporary
+  if _, ok := err.(*net.OpError); ok {
+    return true
+  }
+  if netErr, ok := err.(net.Error); ok {
+    return netErr.Timeout() || netErr.Temporary()
+  }
+  return false
+}
+
+// Do executes the operation, and retries it with jittered exponential backoff as long as it fails with a retriable error
+// A fatal error is returned immediately, otherwise the error of the last attempt is returned when all the steps are used up
+func Do(backoff wait.Backoff, operation func() error) error {
+  var lastErr error
+  attempt := 0
+  err := wait.ExponentialBackoff(backoff, func() (bool, error) {
+    attempt++
+    lastErr = operation()
+    if lastErr == nil {
+      return true, nil
+    }
+    if !IsRetriable(lastErr) {
+      return false, lastErr
+    }
+    log.Println("INFO: API operation failed with transient error:" + lastErr.Error() + " in attempt:" + strconv.Itoa(attempt) + ", retrying")
+    return false, nil
+  })
+  if err == wait.ErrWaitTimeout {
+    return lastErr
+  }
+  return err
+}
@@ -0,0 +1,81 @@
+package apiretry_test
+
+import (
+  "errors"
+  "net"
+  "net/url"
+  "syscall"
+  "testing"
+  "time"
+  "github.com/nokia/danm/pkg/apiretry"
+  apierrors "k8s.io/apimachinery/pkg/api/errors"
+  "k8s.io/apimachinery/pkg/runtime/schema"
+  "k8s.io/apimachinery/pkg/util/wait"
+)
+
+var (
+  testResource = schema.GroupResource{Group: "danm.k8s.io", Resource: "danmnets"}
+  testBackoff = wait.Backoff{Duration: time.Millisecond, Factor: 1.0, Steps: 3}
+)
+
+var retriableTcs = []struct {
+  tcName string
+  err error
+  isRetriable bool
+}{
+  {"noError", nil, false},
+  {"tooManyRequests", apierrors.NewTooManyRequests("throttled", 1), true},
+  {"internalError", apierrors.NewInternalError(errors.New("etcd")), true},
+  {"serviceUnavailable", apierrors.NewServiceUnavailable("starting"), true},
+  {"serverTimeout", apierrors.NewServerTimeout(testResource, "get", 1), true},
+  {"timeout", apierrors.NewTimeoutError("timeout", 1), true},
+  {"conflict", apierrors.NewConflict(testResource, "net", errors.New("conflict")), false},
+  {"notFound", apierrors.NewNotFound(testResource, "net"), false},
+  {"forbidden", apierrors.NewForbidden(testResource, "net", errors.New("rbac")), false},
+  {"genericError", errors.New("hululululu"), false},
+  {"connectionRefused", &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}, true},
+  {"wrappedConnectionRefused", &url.Error{Op: "Get", URL: "https://apiserver/apis/danm.k8s.io/v1/danmnets", Err: &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}}, true},
+  {"wrappedGenericError", &url.Error{Op: "Get", URL: "https://apiserver/apis/danm.k8s.io/v1/danmnets", Err: errors.New("hululululu")}, false},
+  {"dnsTimeout", &net.DNSError{Err: "timeout", Name: "apiserver", IsTimeout: true}, true},
+  {"dnsNotFound", &net.DNSError{Err: "no such host", Name: "apiserver"}, false},
+}
+
+func TestIsRetriable(t *testing.T) {
+  for _, tc := range retriableTcs {
+    t.Run(tc.tcName, func(t *testing.T) {
+      if apiretry.IsRetriable(tc.err) != tc.isRetriable {
+        t.Errorf("Retriability of error:%v does not match with expected:%t", tc.err, tc.isRetriable)
+      }
+    })
+  }
+}
+
+var doTcs = []struct {
+  tcName string
+  errs []error
+  expectedAttempts int
+  isErrorExpected bool
+}{
+  {"firstSuccess", []error{nil}, 1, false},
+  {"transientThenSuccess", []error{apierrors.NewTooManyRequests("throttled", 1), apierrors.NewServiceUnavailable("starting"), nil}, 3, false},
+  {"fatalIsNotRetried", []error{apierrors.NewNotFound(testResource, "net"), nil}, 1, true},
+  {"retriesUsedUp", []error{apierrors.NewInternalError(errors.New("etcd")), apierrors.NewInternalError(errors.New("etcd")), apierrors.NewInternalError(errors.New("etcd")), nil}, 3, true},
+}
+
+func TestDo(t *testing.T) {
+  for _, tc := range doTcs {
+    t.Run(tc.tcName, func(t *testing.T) {
+      attempts := 0
+      err := apiretry.Do(testBackoff, func() error {
+        attempts++
+        return tc.errs[attempts-1]
+      })
+      if (err != nil && !tc.isErrorExpected) || (err == nil && tc.isErrorExpected) {
+        t.Errorf("Received error:%v does not match with expectation", err)
+      }
+      if attempts != tc.expectedAttempts {
+        t.Errorf("Number of attempts:%d does not match with expected:%d", attempts, tc.expectedAttempts)
+      }
+    })
+  }
+}
@@ -0,0 +1,164 @@
+package arpproxy
+
+import (
+  "io/ioutil"
+  "log"
+  "net"
+  "os"
+  "strings"
+  "time"
+  "github.com/vishvananda/netlink"
+  meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+  "k8s.io/client-go/rest"
+  "k8s.io/client-go/tools/cache"
+  danmtypes "github.com/nokia/danm/pkg/crd/apis/danm/v1"
+  danmclientset "github.com/nokia/danm/pkg/crd/client/clientset/versioned"
+  danminformers "github.com/nokia/danm/pkg/crd/client/informers/externalversions"
+  "github.com/nokia/danm/pkg/danmep"
+  "github.com/nokia/danm/pkg/netspec"
+)
+
+// Handler answers ARP requests, and IPv6 Neighbor Solicitations arriving from the fabric on the host interface of IPVLAN networks on behalf of the Pods running on other nodes
+// The mapping is published as proxy neighbor entries, derived from the DanmEps of the networks enabling the proxy_arp option
+type Handler struct {
+  client danmclientset.Interface
+  host string
+}
+
+// NewHandler initializes and returns a new Handler object
+func NewHandler(cfg *rest.Config) (Handler,error) {
+  client, err := danmclientset.NewForConfig(cfg)
+  if err != nil {
+    return Handler{}, err
+  }
+  host, err := os.Hostname()
+  if err != nil {
+    return Handler{}, err
+  }
+  return Handler{client: client, host: host}, nil
+}
+
+// CreateController returns a controller watching DanmEps
+// Every DanmEp is delivered as an Add event at start-up, so the proxy entries of the already existing DanmEps are published too
+func (handler Handler) CreateController() cache.Controller {
+  danmInformerFactory := danminformers.NewSharedInformerFactory(handler.client, time.Minute*10)
+  controller := danmInformerFactory.Danm().V1().DanmEps().Informer()
+  controller.AddEventHandler(cache.ResourceEventHandlerFuncs{
+    AddFunc: func(obj interface{}) {
+      handler.publish(obj.(*danmtypes.DanmEp))
+    },
+    UpdateFunc: func(oldObj, newObj interface{}) {
+      oldEp, newEp := oldObj.(*danmtypes.DanmEp), newObj.(*danmtypes.DanmEp)
+      if oldEp.Spec.Host == newEp.Spec.Host && oldEp.Spec.Iface.Address == newEp.Spec.Iface.Address && oldEp.Spec.Iface.AddressIPv6 == newEp.Spec.Iface.AddressIPv6 {
+        return
+      }
+      handler.unpublish(oldEp)
+      handler.publish(newEp)
+    },
+    DeleteFunc: func(obj interface{}) {
+      if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+        obj = tombstone.Obj
+      }
+      if ep, ok := obj.(*danmtypes.DanmEp); ok {
+        handler.unpublish(ep)
+      }
+    },
+  })
+  return controller
+}
+
+func (handler Handler) publish(ep *danmtypes.DanmEp) {
+  handler.update(ep, AddProxyEntry, "published on")
+}
+
+func (handler Handler) unpublish(ep *danmtypes.DanmEp) {
+  handler.update(ep, DeleteProxyEntry, "withdrawn from")
+}
+
+func (handler Handler) update(ep *danmtypes.DanmEp, updateEntry func(netlink.Link, net.IP) error, action string) {
+  ips := GetProxiedIps(ep, handler.host)
+  if len(ips) == 0 {
+    return
+  }
+  link, err := handler.getProxyLink(ep)
+  if err != nil {
+    log.Println("ERROR: Host interface of network:" + ep.Spec.NetworkID + " cannot be determined because:" + err.Error())
+    return
+  }
+  if link == nil {
+    return
+  }
+  for _, ip := range ips {
+    err = updateEntry(link, ip)
+    if err != nil {
+      log.Println("ERROR: Proxy entry of:" + ip.String() + " cannot be " + action + " interface:" + link.Attrs().Name + " because:" + err.Error())
+      continue
+    }
+    log.Println("INFO: Proxy entry of:" + ip.String() + " hosted on node:" + ep.Spec.Host + " was " + action + " interface:" + link.Attrs().Name)
+  }
+}
+
+// GetProxiedIps returns the addresses of the DanmEp the given host shall answer for, i.e. all of its addresses if it is hosted on another node
+func GetProxiedIps(ep *danmtypes.DanmEp, host string) []net.IP {
+  if ep.Spec.Host == host || ep.Spec.Host == "" {
+    return nil
+  }
+  var ips []net.IP
+  for _, address := range []string{ep.Spec.Iface.Address, ep.Spec.Iface.AddressIPv6} {
+    ip, _, err := net.ParseCIDR(address)
+    if err == nil {
+      ips = append(ips, ip)
+    }
+  }
+  return ips
+}
+
+// getProxyLink returns the host interface of the network, or nil if the network does not enable proxying, or it is not used on this host
+func (handler Handler) getProxyLink(ep *danmtypes.DanmEp) (netlink.Link, error) {
+  dnet, err := handler.client.DanmV1().DanmNets(ep.ObjectMeta.Namespace).Get(ep.Spec.NetworkID, meta_v1.GetOptions{})
+  if err != nil {
+    return nil, err
+  }
+  if !IsProxied(dnet) {
+    return nil, nil
+  }
+  link, err := netlink.LinkByName(danmep.GetHostInterface(dnet))
+  if err != nil {
+    //Network is not used on this host
+    return nil, nil
+  }
+  return link, nil
+}
+
+// IsProxied tells if the addresses of the remote Pods of the network are published on its host interface
+func IsProxied(dnet *danmtypes.DanmNet) bool {
+  return dnet.Spec.Options.ProxyArp && netspec.IsIpvlan(dnet)
+}
+
+// AddProxyEntry publishes a proxy neighbor entry of the IP on the interface, so the host answers ARP requests, or Neighbor Solicitations for it
+// Only requests received by the host interface from the fabric are answered: IPVLAN slaves of the local Pods send theirs directly to the wire
+// Proxy NDP is also enabled on the interface for IPv6 addresses, as the kernel ignores IPv6 proxy entries otherwise
+func AddProxyEntry(link netlink.Link, ip net.IP) error {
+  family := netlink.FAMILY_V4
+  if ip.To4() == nil {
+    family = netlink.FAMILY_V6
+    err := ioutil.WriteFile("/proc/sys/net/ipv6/conf/" + link.Attrs().Name + "/proxy_ndp", []byte("1"), 0644)
+    if err != nil {
+      return err
+    }
+  }
+  return netlink.NeighAdd(&netlink.Neigh{LinkIndex: link.Attrs().Index, Family: family, Flags: netlink.NTF_PROXY, IP: ip})
+}
+
+// DeleteProxyEntry withdraws the proxy neighbor entry of the IP from the interface, if there is one
+func DeleteProxyEntry(link netlink.Link, ip net.IP) error {
+  family := netlink.FAMILY_V4
+  if ip.To4() == nil {
+    family = netlink.FAMILY_V6
+  }
+  err := netlink.NeighDel(&netlink.Neigh{LinkIndex: link.Attrs().Index, Family: family, Flags: netlink.NTF_PROXY, IP: ip})
+  if err != nil && !strings.Contains(err.Error(), "no such file") {
+    return err
+  }
+  return nil
+}
@@ -0,0 +1,65 @@
+package arpproxy_test
+
+import (
+  "testing"
+  "github.com/nokia/danm/pkg/arpproxy"
+  danmtypes "github.com/nokia/danm/pkg/crd/apis/danm/v1"
+)
+
+const (
+  localHost = "local"
+)
+
+var proxiedIpsTcs = []struct {
+  tcName string
+  host string
+  address string
+  address6 string
+  expectedIps []string
+}{
+  {"localEp", localHost, "10.0.0.2/24", "2001:db8::2/64", nil},
+  {"unscheduledEp", "", "10.0.0.2/24", "", nil},
+  {"remoteEp", "remote", "10.0.0.2/24", "", []string{"10.0.0.2"}},
+  {"remoteDualStackEp", "remote", "10.0.0.2/24", "2001:db8::2/64", []string{"10.0.0.2", "2001:db8::2"}},
+  {"remoteEpWithDynamicPlaceholder", "remote", "dynamic", "", nil},
+}
+
+func TestGetProxiedIps(t *testing.T) {
+  for _, tc := range proxiedIpsTcs {
+    t.Run(tc.tcName, func(t *testing.T) {
+      ep := &danmtypes.DanmEp{Spec: danmtypes.DanmEpSpec{Host: tc.host, Iface: danmtypes.DanmEpIface{Address: tc.address, AddressIPv6: tc.address6}}}
+      ips := arpproxy.GetProxiedIps(ep, localHost)
+      if len(ips) != len(tc.expectedIps) {
+        t.Fatalf("Number of proxied addresses:%d does not match with expected:%d", len(ips), len(tc.expectedIps))
+      }
+      for i, ip := range ips {
+        if ip.String() != tc.expectedIps[i] {
+          t.Errorf("Proxied address:%s does not match with expected:%s", ip.String(), tc.expectedIps[i])
+        }
+      }
+    })
+  }
+}
+
+var proxiedNetTcs = []struct {
+  tcName string
+  netType string
+  proxyArp bool
+  isProxied bool
+}{
+  {"ipvlanWithProxy", "ipvlan", true, true},
+  {"defaultTypeWithProxy", "", true, true},
+  {"ipvlanWithoutProxy", "ipvlan", false, false},
+  {"sriovWithProxy", "sriov", true, false},
+}
+
+func TestIsProxied(t *testing.T) {
+  for _, tc := range proxiedNetTcs {
+    t.Run(tc.tcName, func(t *testing.T) {
+      dnet := &danmtypes.DanmNet{Spec: danmtypes.DanmNetSpec{NetworkType: tc.netType, Options: danmtypes.DanmNetOption{ProxyArp: tc.proxyArp}}}
+      if arpproxy.IsProxied(dnet) != tc.isProxied {
+        t.Errorf("Proxying of network type:%s with proxy_arp:%t does not match with expected:%t", tc.netType, tc.proxyArp, tc.isProxied)
+      }
+    })
+  }
+}
@@ -0,0 +1,102 @@
+package bootbarrier
+
+import (
+  "errors"
+  "io/ioutil"
+  "os"
+  "path/filepath"
+  "strconv"
+  "strings"
+  "time"
+)
+
+const (
+  // DefaultPath is the host file netwatcher opens the barrier with, once the DanmEps left behind by the previous boot of the host are cleaned up
+  DefaultPath = "/var/lib/danm/barrier/boot_id"
+  bootIdPath = "/proc/sys/kernel/random/boot_id"
+  procStatPath = "/proc/stat"
+  pollInterval = 100 * time.Millisecond
+)
+
+// GetBootId returns the identifier the kernel generated for the current boot of the host
+func GetBootId() (string, error) {
+  content, err := ioutil.ReadFile(bootIdPath)
+  if err != nil {
+    return "", errors.New("boot ID of the host cannot be read because:" + err.Error())
+  }
+  return strings.TrimSpace(string(content)), nil
+}
+
+// GetBootTime returns the time the host was booted at
+func GetBootTime() (time.Time, error) {
+  content, err := ioutil.ReadFile(procStatPath)
+  if err != nil {
+    return time.Time{}, errors.New("boot time of the host cannot be read because:" + err.Error())
+  }
+  for _, line := range strings.Split(string(content), "\n") {
+    fields := strings.Fields(line)
+    if len(fields) != 2 || fields[0] != "btime" {
+      continue
+    }
+    btime, err := strconv.ParseInt(fields[1], 10, 64)
+    if err != nil {
+      return time.Time{}, errors.New("boot time of the host cannot be parsed because:" + err.Error())
+    }
+    return time.Unix(btime, 0), nil
+  }
+  return time.Time{}, errors.New("boot time of the host is missing from " + procStatPath)
+}
+
+// Open records in the barrier file that the cleanup of the current boot of the host is done
+// The file is written atomically, so the CNI never reads a partial boot ID
+func Open(path string) error {
+  bootId, err := GetBootId()
+  if err != nil {
+    return err
+  }
+  err = os.MkdirAll(filepath.Dir(path), 0755)
+  if err != nil {
+    return errors.New("directory of boot barrier:" + path + " cannot be created because:" + err.Error())
+  }
+  err = ioutil.WriteFile(path + ".tmp", []byte(bootId), 0644)
+  if err != nil {
+    return errors.New("boot barrier:" + path + " cannot be written because:" + err.Error())
+  }
+  return os.Rename(path + ".tmp", path)
+}
+
+// IsOpen tells whether the barrier was opened during the current boot of the host
+// A barrier opened before the last reboot is closed
+func IsOpen(path string) (bool, error) {
+  content, err := ioutil.ReadFile(path)
+  if os.IsNotExist(err) {
+    return false, nil
+  }
+  if err != nil {
+    return false, errors.New("boot barrier:" + path + " cannot be read because:" + err.Error())
+  }
+  bootId, err := GetBootId()
+  if err != nil {
+    return false, err
+  }
+  return strings.TrimSpace(string(content)) == bootId, nil
+}
+
+// Wait blocks until the barrier is opened, or the timeout expires
+// An error is returned on timeout, so the caller can decide to go on regardless
+func Wait(path string, timeout time.Duration) error {
+  deadline := time.Now().Add(timeout)
+  for {
+    isOpen, err := IsOpen(path)
+    if err != nil {
+      return err
+    }
+    if isOpen {
+      return nil
+    }
+    if time.Now().After(deadline) {
+      return errors.New("boot barrier:" + path + " was not opened in " + timeout.String())
+    }
+    time.Sleep(pollInterval)
+  }
+}
@@ -0,0 +1,61 @@
+package bootbarrier_test
+
+import (
+  "io/ioutil"
+  "os"
+  "path/filepath"
+  "testing"
+  "time"
+  "github.com/nokia/danm/pkg/bootbarrier"
+)
+
+func newBarrierPath(t *testing.T) (string, func()) {
+  dir, err := ioutil.TempDir("", "bootbarrier")
+  if err != nil {
+    t.Fatalf("temporary directory cannot be created because:" + err.Error())
+  }
+  return filepath.Join(dir, "barrier", "boot_id"), func() { os.RemoveAll(dir) }
+}
+
+func TestBarrierIsClosedUntilOpened(t *testing.T) {
+  path, cleanup := newBarrierPath(t)
+  defer cleanup()
+  if isOpen, err := bootbarrier.IsOpen(path); isOpen || err != nil {
+    t.Errorf("Missing barrier is not closed, open:%t err:%v", isOpen, err)
+  }
+  err := bootbarrier.Wait(path, 300*time.Millisecond)
+  if err == nil {
+    t.Errorf("Waiting for a closed barrier did not time out")
+  }
+  err = bootbarrier.Open(path)
+  if err != nil {
+    t.Fatalf("Barrier cannot be opened because:" + err.Error())
+  }
+  err = bootbarrier.Wait(path, time.Second)
+  if err != nil {
+    t.Errorf("Waiting for an open barrier failed with error:" + err.Error())
+  }
+}
+
+func TestBarrierOfPreviousBootIsClosed(t *testing.T) {
+  path, cleanup := newBarrierPath(t)
+  defer cleanup()
+  os.MkdirAll(filepath.Dir(path), 0755)
+  err := ioutil.WriteFile(path, []byte("00000000-0000-0000-0000-000000000000\n"), 0644)
+  if err != nil {
+    t.Fatalf("Barrier of the previous boot cannot be written because:" + err.Error())
+  }
+  if isOpen, _ := bootbarrier.IsOpen(path); isOpen {
+    t.Errorf("Barrier opened during the previous boot is open")
+  }
+}
+
+func TestGetBootTime(t *testing.T) {
+  bootTime, err := bootbarrier.GetBootTime()
+  if err != nil {
+    t.Fatalf("Boot time cannot be read because:" + err.Error())
+  }
+  if bootTime.IsZero() || bootTime.After(time.Now()) {
+    t.Errorf("Implausible boot time:%v", bootTime)
+  }
+}
@@ -0,0 +1,480 @@
+package cleaner
+
+import (
+  "context"
+  "errors"
+  "log"
+  "os"
+  "sort"
+  "strconv"
+  "time"
+  "github.com/prometheus/client_golang/prometheus"
+  corev1 "k8s.io/api/core/v1"
+  apierrors "k8s.io/apimachinery/pkg/api/errors"
+  meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+  kubeinformers "k8s.io/client-go/informers"
+  "k8s.io/client-go/kubernetes"
+  "k8s.io/client-go/kubernetes/scheme"
+  v1core "k8s.io/client-go/kubernetes/typed/core/v1"
+  corelisters "k8s.io/client-go/listers/core/v1"
+  "k8s.io/client-go/tools/cache"
+  "k8s.io/client-go/tools/record"
+  "k8s.io/client-go/util/workqueue"
+  danmtypes "github.com/nokia/danm/pkg/crd/apis/danm/v1"
+  danmclientset "github.com/nokia/danm/pkg/crd/client/clientset/versioned"
+  danminformers "github.com/nokia/danm/pkg/crd/client/informers/externalversions"
+  danmlisters "github.com/nokia/danm/pkg/crd/client/listers/danm/v1"
+  "github.com/nokia/danm/pkg/bootbarrier"
+  "github.com/nokia/danm/pkg/cnidel"
+  "github.com/nokia/danm/pkg/danmep"
+  "github.com/nokia/danm/pkg/ipam"
+  "github.com/nokia/danm/pkg/netspec"
+)
+
+const (
+  // DefaultInterval is the period of reconciliation used when the Config does not set one
+  DefaultInterval = time.Minute
+  // DefaultGracePeriod is the minimum age of the DanmEps cleaned up, used when the Config does not set one
+  DefaultGracePeriod = time.Minute * 5
+  // DefaultMaxDeletesPerCycle is the maximum number of DanmEps deleted in one reconciliation, used when the Config does not set one
+  DefaultMaxDeletesPerCycle = 50
+  // DefaultPodEventDelay is the time waited after a Pod event before its DanmEps are reconciled, used when the Config does not set one
+  DefaultPodEventDelay = time.Second * 30
+  // TooManyDeletesReason is the reason of the Event recorded on the Node when a reconciliation is aborted
+  TooManyDeletesReason = "DanmEpCleanupAborted"
+  barrierCheckInterval = time.Second
+)
+
+var (
+  staleGauge = prometheus.NewGauge(prometheus.GaugeOpts {
+    Name: "danm_cleaner_stale_endpoints",
+    Help: "Number of stale DanmEps found on the host in the last reconciliation.",
+  })
+  abortedCounter = prometheus.NewCounter(prometheus.CounterOpts {
+    Name: "danm_cleaner_aborted_cycles_total",
+    Help: "Number of reconciliations aborted without deleting anything, because more DanmEps were found stale than the allowed maximum.",
+  })
+)
+
+// ContainerChecker tells whether the container of the DanmEp is still alive according to the container runtime
+type ContainerChecker func(ep danmtypes.DanmEp) bool
+
+// Config contains the clients, and informer factories shared with the embedding daemon
+// Only the clients are mandatory, informer factories are created for the Cleaner if not given
+type Config struct {
+  DanmClient danmclientset.Interface
+  KubeClient kubernetes.Interface
+  DanmInformerFactory danminformers.SharedInformerFactory
+  // KubeInformerFactory can be restricted to the Pods of the host with a field selector on spec.nodeName
+  KubeInformerFactory kubeinformers.SharedInformerFactory
+  // Host is the node whose DanmEps are reconciled, the hostname is used if not set
+  Host string
+  Interval time.Duration
+  // GracePeriod protects DanmEps still being created, or torn down by the CNI
+  GracePeriod time.Duration
+  // IsContainerAlive queries the container runtime, danmep.DoesTargetContainerExist is used if not set
+  IsContainerAlive ContainerChecker
+  // MaxDeletesPerCycle protects valid DanmEps from being mass deleted because of a bug, or a wrong hostname
+  // A reconciliation finding more stale DanmEps than this deletes none of them
+  MaxDeletesPerCycle int
+  // IgnoreMaxDeletes lifts the MaxDeletesPerCycle limit, e.g. to clean up after a mass node failure
+  IgnoreMaxDeletes bool
+  // WatchPods reconciles the DanmEps of a Pod of the host shortly after it is deleted, or reaches the Succeeded, or Failed phase, besides the periodic reconciliation
+  WatchPods bool
+  // PodEventDelay gives the CNI the chance to tear the interfaces of the Pod down before the cleaner acts
+  PodEventDelay time.Duration
+  // SkipRuntimeCheck decides only based on the Pods in the K8s API, and never queries the container runtime
+  SkipRuntimeCheck bool
+  // PriorityNamespaces are cleaned up first in every reconciliation, in the order of the list
+  // Infrastructure Pods of these namespaces get their addresses back first when a large backlog is processed after a node incident
+  PriorityNamespaces []string
+  // CheckpointAnnotation, and CheckpointLabel mark the Pods, and DanmEps of checkpointed sandboxes, which can be restored later
+  // Their DanmEps are never cleaned up, regardless of the value of the key. The check is disabled if not set
+  CheckpointAnnotation string
+  CheckpointLabel string
+  // BootBarrier is the host file the Cleaner opens the boot barrier of the CNI with, once the DanmEps created before the boot of the host are cleaned up
+  // These DanmEps are cleaned up regardless of their Pod, and the grace period, as their containers cannot survive the reboot. The barrier is disabled if not set
+  BootBarrier string
+  // BootTime is the time the host was booted at, read from the kernel if not set
+  BootTime time.Time
+}
+
+// Cleaner deletes the DanmEps of the host whose Pod does not exist anymore, or terminated, and whose container is not running
+// These are left behind when the teardown of the Pod never reached the CNI, e.g. because the node was rebooted, or kubelet lost the sandbox
+// Any node daemon can embed a Cleaner, sharing its informers, and runtime client with the other features of the daemon
+type Cleaner struct {
+  config Config
+  epLister danmlisters.DanmEpLister
+  podLister corelisters.PodLister
+  synced []cache.InformerSynced
+  recorder record.EventRecorder
+  podQueue workqueue.DelayingInterface
+  priorities map[string]int
+  isBarrierOpen bool
+}
+
+// New initializes a Cleaner, and registers its informers in the factories
+// It shall be called before the factories are started by the embedding daemon
+func New(config Config) (*Cleaner, error) {
+  if config.DanmClient == nil || config.KubeClient == nil {
+    return nil, errors.New("cleaner requires both a DANM, and a K8s client")
+  }
+  if config.Host == "" {
+    host, err := os.Hostname()
+    if err != nil {
+      return nil, err
+    }
+    config.Host = host
+  }
+  if config.Interval == 0 {
+    config.Interval = DefaultInterval
+  }
+  if config.GracePeriod == 0 {
+    config.GracePeriod = DefaultGracePeriod
+  }
+  if config.MaxDeletesPerCycle == 0 {
+    config.MaxDeletesPerCycle = DefaultMaxDeletesPerCycle
+  }
+  if config.PodEventDelay == 0 {
+    config.PodEventDelay = DefaultPodEventDelay
+  }
+  if config.IsContainerAlive == nil {
+    config.IsContainerAlive = danmep.DoesTargetContainerExist
+  }
+  if config.BootBarrier != "" && config.BootTime.IsZero() {
+    bootTime, err := bootbarrier.GetBootTime()
+    if err != nil {
+      return nil, err
+    }
+    config.BootTime = bootTime
+  }
+  if config.DanmInformerFactory == nil {
+    config.DanmInformerFactory = danminformers.NewSharedInformerFactory(config.DanmClient, time.Minute*10)
+  }
+  if config.KubeInformerFactory == nil {
+    config.KubeInformerFactory = kubeinformers.NewSharedInformerFactory(config.KubeClient, time.Minute*10)
+  }
+  epInformer := config.DanmInformerFactory.Danm().V1().DanmEps()
+  epInformer.Informer().AddIndexers(danmlisters.DanmEpIndexers)
+  podInformer := config.KubeInformerFactory.Core().V1().Pods()
+  for _, collector := range []prometheus.Collector{staleGauge, abortedCounter} {
+    err := prometheus.Register(collector)
+    if err != nil {
+      if _, ok := err.(prometheus.AlreadyRegisteredError); !ok {
+        return nil, errors.New("cannot register cleaner metrics because:" + err.Error())
+      }
+    }
+  }
+  eventBroadcaster := record.NewBroadcaster()
+  eventBroadcaster.StartRecordingToSink(&v1core.EventSinkImpl{Interface: config.KubeClient.CoreV1().Events("")})
+  cleaner := &Cleaner {
+    config: config,
+    epLister: epInformer.Lister(),
+    podLister: podInformer.Lister(),
+    synced: []cache.InformerSynced{epInformer.Informer().HasSynced, podInformer.Informer().HasSynced},
+    recorder: eventBroadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: "danm-cleaner", Host: config.Host}),
+    priorities: make(map[string]int),
+  }
+  for index, namespace := range config.PriorityNamespaces {
+    if _, ok := cleaner.priorities[namespace]; !ok {
+      cleaner.priorities[namespace] = index
+    }
+  }
+  if config.WatchPods {
+    cleaner.podQueue = workqueue.NewNamedDelayingQueue("danm-cleaner")
+    podInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs {
+      UpdateFunc: func(oldObj, newObj interface{}) {
+        oldPod, oldOk := oldObj.(*corev1.Pod)
+        newPod, newOk := newObj.(*corev1.Pod)
+        if oldOk && newOk && !isTerminated(oldPod) && isTerminated(newPod) {
+          cleaner.enqueuePod(newPod)
+        }
+      },
+      DeleteFunc: func(obj interface{}) {
+        if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+          obj = tombstone.Obj
+        }
+        if pod, ok := obj.(*corev1.Pod); ok {
+          cleaner.enqueuePod(pod)
+        }
+      },
+    })
+  }
+  return cleaner, nil
+}
+
+// Start starts the informer factories, then reconciles the host periodically in the background until the context is cancelled
+// Starting the shared factories again is harmless, informers already started by the embedding daemon are not duplicated
+func (cleaner *Cleaner) Start(ctx context.Context) error {
+  cleaner.config.DanmInformerFactory.Start(ctx.Done())
+  cleaner.config.KubeInformerFactory.Start(ctx.Done())
+  if !cache.WaitForCacheSync(ctx.Done(), cleaner.synced...) {
+    return errors.New("caches of the cleaner could not be synced")
+  }
+  if cleaner.podQueue != nil {
+    go cleaner.processPodEvents()
+    go func() {
+      <-ctx.Done()
+      cleaner.podQueue.ShutDown()
+    }()
+  }
+  if cleaner.config.BootBarrier != "" {
+    go cleaner.waitForBootCleanup(ctx)
+  }
+  go func() {
+    ticker := time.NewTicker(cleaner.config.Interval)
+    defer ticker.Stop()
+    for {
+      cleaner.Reconcile()
+      select {
+      case <-ctx.Done():
+        return
+      case <-ticker.C:
+      }
+    }
+  }()
+  return nil
+}
+
+// Reconcile cleans up all the stale DanmEps of the host once
+// Nothing is deleted if more DanmEps are stale than the allowed maximum, instead a warning Event is recorded on the Node
+// DanmEps of the previous boot of the host are exempt from the limit, as their containers provably did not survive the reboot
+func (cleaner *Cleaner) Reconcile() {
+  eps, err := cleaner.epLister.ByHost(cleaner.config.Host)
+  if err != nil {
+    log.Println("ERROR: DanmEps of host:" + cleaner.config.Host + " cannot be listed because:" + err.Error())
+    return
+  }
+  var bootEps, staleEps []*danmtypes.DanmEp
+  for _, ep := range eps {
+    if !cleaner.isStale(ep) {
+      continue
+    }
+    if cleaner.isFromPreviousBoot(ep) {
+      bootEps = append(bootEps, ep)
+    } else {
+      staleEps = append(staleEps, ep)
+    }
+  }
+  staleGauge.Set(float64(len(bootEps) + len(staleEps)))
+  if len(staleEps) > cleaner.config.MaxDeletesPerCycle && !cleaner.config.IgnoreMaxDeletes {
+    cleaner.abort(len(staleEps), len(eps))
+    staleEps = nil
+  }
+  staleEps = append(bootEps, staleEps...)
+  cleaner.prioritize(staleEps)
+  for _, ep := range staleEps {
+    err = cleaner.clean(*ep)
+    if err != nil {
+      log.Println("ERROR: Stale DanmEp:" + ep.ObjectMeta.Name + " cannot be cleaned up, will be retried. Error:" + err.Error())
+    }
+  }
+}
+
+// waitForBootCleanup opens the boot barrier as soon as no DanmEp created before the boot of the host is left to be cleaned up
+func (cleaner *Cleaner) waitForBootCleanup(ctx context.Context) {
+  ticker := time.NewTicker(barrierCheckInterval)
+  defer ticker.Stop()
+  for !cleaner.openBootBarrier() {
+    select {
+    case <-ctx.Done():
+      return
+    case <-ticker.C:
+    }
+  }
+}
+
+// openBootBarrier opens the boot barrier, unless stale DanmEps of the previous boot still exist
+// It returns whether the barrier is open
+func (cleaner *Cleaner) openBootBarrier() bool {
+  if cleaner.isBarrierOpen {
+    return true
+  }
+  eps, err := cleaner.epLister.ByHost(cleaner.config.Host)
+  if err != nil {
+    log.Println("ERROR: DanmEps of host:" + cleaner.config.Host + " cannot be listed because:" + err.Error())
+    return false
+  }
+  for _, ep := range eps {
+    if cleaner.isFromPreviousBoot(ep) && cleaner.isStale(ep) {
+      return false
+    }
+  }
+  err = bootbarrier.Open(cleaner.config.BootBarrier)
+  if err != nil {
+    log.Println("ERROR: Boot barrier of host:" + cleaner.config.Host + " cannot be opened because:" + err.Error())
+    return false
+  }
+  log.Println("INFO: DanmEps of the previous boot of host:" + cleaner.config.Host + " are cleaned up, boot barrier is opened")
+  cleaner.isBarrierOpen = true
+  return true
+}
+
+// isFromPreviousBoot tells if the DanmEp was created before the boot of the host
+func (cleaner *Cleaner) isFromPreviousBoot(ep *danmtypes.DanmEp) bool {
+  return cleaner.config.BootBarrier != "" && ep.ObjectMeta.CreationTimestamp.Time.Before(cleaner.config.BootTime)
+}
+
+// prioritize orders the DanmEps of the priority namespaces first, keeping the order of the namespaces in the configured list
+func (cleaner *Cleaner) prioritize(eps []*danmtypes.DanmEp) {
+  sort.SliceStable(eps, func(i, j int) bool {
+    return cleaner.getPriority(eps[i]) < cleaner.getPriority(eps[j])
+  })
+}
+
+func (cleaner *Cleaner) getPriority(ep *danmtypes.DanmEp) int {
+  if priority, ok := cleaner.priorities[ep.ObjectMeta.Namespace]; ok {
+    return priority
+  }
+  return len(cleaner.config.PriorityNamespaces)
+}
+
+func (cleaner *Cleaner) abort(numOfStale, numOfEps int) {
+  abortedCounter.Inc()
+  message := strconv.Itoa(numOfStale) + " out of " + strconv.Itoa(numOfEps) + " DanmEps of the host were found stale, which is more than the allowed maximum of " +
+    strconv.Itoa(cleaner.config.MaxDeletesPerCycle) + " deletions per cycle, so none of them was deleted"
+  log.Println("ERROR: Cleanup of host:" + cleaner.config.Host + " aborted: " + message)
+  node := &corev1.ObjectReference{Kind: "Node", APIVersion: "v1", Name: cleaner.config.Host}
+  cleaner.recorder.Event(node, corev1.EventTypeWarning, TooManyDeletesReason, message)
+}
+
+func (cleaner *Cleaner) enqueuePod(pod *corev1.Pod) {
+  if pod.Spec.NodeName != cleaner.config.Host {
+    return
+  }
+  key, err := cache.MetaNamespaceKeyFunc(pod)
+  if err != nil {
+    return
+  }
+  cleaner.podQueue.AddAfter(key, cleaner.config.PodEventDelay)
+}
+
+func (cleaner *Cleaner) processPodEvents() {
+  for {
+    key, shutdown := cleaner.podQueue.Get()
+    if shutdown {
+      return
+    }
+    namespace, name, err := cache.SplitMetaNamespaceKey(key.(string))
+    if err == nil {
+      cleaner.reconcilePod(namespace, name)
+    }
+    cleaner.podQueue.Done(key)
+  }
+}
+
+// reconcilePod cleans up the stale DanmEps of one Pod of the host
+// DanmEps not cleaned up here, e.g. because they are younger than the grace period, are left to the periodic reconciliation
+func (cleaner *Cleaner) reconcilePod(namespace, name string) {
+  eps, err := cleaner.epLister.ByHost(cleaner.config.Host)
+  if err != nil {
+    log.Println("ERROR: DanmEps of host:" + cleaner.config.Host + " cannot be listed because:" + err.Error())
+    return
+  }
+  for _, ep := range eps {
+    if ep.ObjectMeta.Namespace != namespace || ep.Spec.Pod != name || !cleaner.isStale(ep) || cleaner.getGcPolicy(ep) != netspec.GcPolicyEvent {
+      continue
+    }
+    err = cleaner.clean(*ep)
+    if err != nil {
+      log.Println("ERROR: Stale DanmEp:" + ep.ObjectMeta.Name + " cannot be cleaned up, will be retried. Error:" + err.Error())
+    }
+  }
+}
+
+// isStale tells if the DanmEp is abandoned, and it can be cleaned up according to the garbage collection policy of its network
+// The network is only read for the abandoned DanmEps, so reconciling the running Pods does not load the API
+func (cleaner *Cleaner) isStale(ep *danmtypes.DanmEp) bool {
+  if cleaner.isCheckpointed(ep) || !cleaner.isAbandoned(ep) {
+    return false
+  }
+  return cleaner.getGcPolicy(ep) != netspec.GcPolicyManual
+}
+
+// isAbandoned decides based on the cache first, and only queries the container runtime of the DanmEps of missing, or terminated Pods
+// DanmEps of the previous boot only depend on the container runtime, as kubelet re-creates the sandbox of a Pod surviving the reboot
+func (cleaner *Cleaner) isAbandoned(ep *danmtypes.DanmEp) bool {
+  if cleaner.isFromPreviousBoot(ep) {
+    return cleaner.config.SkipRuntimeCheck || !cleaner.config.IsContainerAlive(*ep)
+  }
+  if time.Since(ep.ObjectMeta.CreationTimestamp.Time) < cleaner.config.GracePeriod {
+    return false
+  }
+  pod, err := cleaner.podLister.Pods(ep.ObjectMeta.Namespace).Get(ep.Spec.Pod)
+  if err == nil && !isTerminated(pod) {
+    return false
+  }
+  if err != nil && !apierrors.IsNotFound(err) {
+    return false
+  }
+  if cleaner.config.SkipRuntimeCheck {
+    return true
+  }
+  return !cleaner.config.IsContainerAlive(*ep)
+}
+
+// getGcPolicy returns the garbage collection policy of the network of the DanmEp
+// DanmEps of deleted networks are reclaimed with the default policy, while the DanmEps of unreadable networks are treated as manually collected
+func (cleaner *Cleaner) getGcPolicy(ep *danmtypes.DanmEp) string {
+  dnet, err := cleaner.config.DanmClient.DanmV1().DanmNets(ep.ObjectMeta.Namespace).Get(ep.Spec.NetworkID, meta_v1.GetOptions{})
+  if apierrors.IsNotFound(err) {
+    return netspec.GcPolicyEvent
+  }
+  if err != nil {
+    log.Println("ERROR: DanmNet:" + ep.Spec.NetworkID + " of stale DanmEp:" + ep.ObjectMeta.Name + " cannot be read, so it is not cleaned up. Error:" + err.Error())
+    return netspec.GcPolicyManual
+  }
+  return netspec.GetGcPolicy(dnet)
+}
+
+// isCheckpointed tells if the DanmEp, or its Pod is marked with the checkpoint annotation, or label
+// The DanmEp is also checked, because the Pod of a checkpointed sandbox might be deleted until it is restored
+func (cleaner *Cleaner) isCheckpointed(ep *danmtypes.DanmEp) bool {
+  if cleaner.hasCheckpointKey(ep.ObjectMeta) {
+    return true
+  }
+  pod, err := cleaner.podLister.Pods(ep.ObjectMeta.Namespace).Get(ep.Spec.Pod)
+  return err == nil && cleaner.hasCheckpointKey(pod.ObjectMeta)
+}
+
+func (cleaner *Cleaner) hasCheckpointKey(meta meta_v1.ObjectMeta) bool {
+  if cleaner.config.CheckpointAnnotation != "" {
+    if _, ok := meta.Annotations[cleaner.config.CheckpointAnnotation]; ok {
+      return true
+    }
+  }
+  if cleaner.config.CheckpointLabel != "" {
+    if _, ok := meta.Labels[cleaner.config.CheckpointLabel]; ok {
+      return true
+    }
+  }
+  return false
+}
+
+// isTerminated tells if all the containers of the Pod terminated for good, so its sandbox is not needed anymore
+func isTerminated(pod *corev1.Pod) bool {
+  return pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed
+}
+
+// clean deletes the DanmEp before freeing its addresses, so the addresses are never freed twice
+func (cleaner *Cleaner) clean(ep danmtypes.DanmEp) error {
+  client := cleaner.config.DanmClient
+  err := client.DanmV1().DanmEps(ep.ObjectMeta.Namespace).Delete(ep.ObjectMeta.Name, &meta_v1.DeleteOptions{Preconditions: &meta_v1.Preconditions{UID: &ep.ObjectMeta.UID}})
+  if apierrors.IsNotFound(err) || apierrors.IsConflict(err) {
+    return nil
+  } else if err != nil {
+    return errors.New("DanmEp cannot be deleted because:" + err.Error())
+  }
+  log.Println("INFO: Stale DanmEp:" + ep.ObjectMeta.Name + " of Pod:" + ep.ObjectMeta.Namespace + "/" + ep.Spec.Pod + " was deleted")
+  netInfo, err := client.DanmV1().DanmNets(ep.ObjectMeta.Namespace).Get(ep.Spec.NetworkID, meta_v1.GetOptions{})
+  if apierrors.IsNotFound(err) {
+    return nil
+  } else if err != nil {
+    return errors.New("addresses of deleted DanmEp cannot be freed, as its DanmNet cannot be read because:" + err.Error())
+  }
+  if !cnidel.IsDanmIpamUsed(netInfo) || netspec.GetGcPolicy(netInfo) == netspec.GcPolicyManual {
+    return nil
+  }
+  ipam.GarbageCollectIps(client, netInfo, ep.Spec.Iface.Address, ep.Spec.Iface.AddressIPv6)
+  return nil
+}
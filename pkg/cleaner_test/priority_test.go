@@ -0,0 +1,67 @@
+package cleaner_test
+
+import (
+  "context"
+  "strconv"
+  "testing"
+  "time"
+  meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+  "k8s.io/apimachinery/pkg/types"
+  "k8s.io/apimachinery/pkg/watch"
+  "k8s.io/client-go/kubernetes/fake"
+  danmtypes "github.com/nokia/danm/pkg/crd/apis/danm/v1"
+  "github.com/nokia/danm/pkg/cleaner"
+  "github.com/nokia/danm/pkg/stubs"
+)
+
+func newStaleEp(namespace string, index int) danmtypes.DanmEp {
+  name := namespace + "-" + strconv.Itoa(index)
+  return danmtypes.DanmEp {
+    ObjectMeta: meta_v1.ObjectMeta{Name: name, Namespace: namespace, UID: types.UID(name)},
+    Spec: danmtypes.DanmEpSpec{NetworkID: "missing", Host: simHost, Pod: name, CID: "cid-" + name},
+  }
+}
+
+func TestPriorityNamespacesAreCleanedFirst(t *testing.T) {
+  var eps []danmtypes.DanmEp
+  for i := 0; i < 10; i++ {
+    eps = append(eps, newStaleEp("tenant", i), newStaleEp("kube-system", i), newStaleEp("monitoring", i))
+  }
+  server := stubs.NewFakeApiServer(0, nil, eps)
+  deletions, _ := server.DanmV1().DanmEps("").Watch(meta_v1.ListOptions{})
+  defer deletions.Stop()
+  epCleaner, err := cleaner.New(cleaner.Config {
+    DanmClient: server,
+    KubeClient: fake.NewSimpleClientset(),
+    Host: simHost,
+    Interval: time.Hour,
+    GracePeriod: time.Nanosecond,
+    IsContainerAlive: stubs.NewFakeRuntime().IsContainerAlive,
+    IgnoreMaxDeletes: true,
+    PriorityNamespaces: []string{"kube-system", "monitoring"},
+  })
+  if err != nil {
+    t.Fatalf("Cleaner cannot be created because:%v", err)
+  }
+  ctx, cancel := context.WithCancel(context.Background())
+  defer cancel()
+  err = epCleaner.Start(ctx)
+  if err != nil {
+    t.Fatalf("Cleaner cannot be started because:%v", err)
+  }
+  expectedOrder := []string{"kube-system", "monitoring", "tenant"}
+  for i := range eps {
+    select {
+    case event := <-deletions.ResultChan():
+      if event.Type != watch.Deleted {
+        t.Fatalf("Unexpected event:%s", event.Type)
+      }
+      namespace := event.Object.(*danmtypes.DanmEp).ObjectMeta.Namespace
+      if namespace != expectedOrder[i/10] {
+        t.Fatalf("DanmEp number:%d deleted by the cleaner belongs to namespace:%s, expected:%s", i, namespace, expectedOrder[i/10])
+      }
+    case <-time.After(time.Second * 5):
+      t.Fatalf("Timed out waiting for the deletion of DanmEp number:%d", i)
+    }
+  }
+}
@@ -0,0 +1,360 @@
+package cleaner_test
+
+import (
+  "context"
+  "io/ioutil"
+  "net"
+  "os"
+  "path/filepath"
+  "strconv"
+  "testing"
+  "time"
+  corev1 "k8s.io/api/core/v1"
+  meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+  "k8s.io/apimachinery/pkg/types"
+  "k8s.io/client-go/kubernetes/fake"
+  danmtypes "github.com/nokia/danm/pkg/crd/apis/danm/v1"
+  "github.com/nokia/danm/pkg/bitarray"
+  "github.com/nokia/danm/pkg/bootbarrier"
+  "github.com/nokia/danm/pkg/cleaner"
+  "github.com/nokia/danm/pkg/danmnet"
+  "github.com/nokia/danm/pkg/ipam"
+  "github.com/nokia/danm/pkg/loadtest"
+  "github.com/nokia/danm/pkg/netspec"
+  "github.com/nokia/danm/pkg/stubs"
+)
+
+const (
+  simHost = "sim-node"
+  simNamespace = "default"
+  simCheckpointLabel = "checkpointed"
+)
+
+// simulation runs the cleaner of a node against a fake API server, and a fake container runtime
+// The test scripts the lifecycle of the Pods, sandboxes, and CNI invocations of the node
+type simulation struct {
+  t *testing.T
+  danm *stubs.FakeApiServer
+  kube *fake.Clientset
+  runtime *stubs.FakeRuntime
+  cleaner *cleaner.Cleaner
+  stop context.CancelFunc
+  eps map[string]danmtypes.DanmEp
+  // barrier, and bootTime configure the boot barrier of the cleaner, it is disabled if barrier is empty
+  barrier string
+  bootTime time.Time
+  maxDeletes int
+}
+
+func newSimulation(t *testing.T) *simulation {
+  dnet, err := loadtest.NewNetwork("10.10.0.0/24")
+  if err != nil {
+    t.Fatalf("Simulated network cannot be created because:%v", err)
+  }
+  sim := &simulation {
+    t: t,
+    danm: stubs.NewFakeApiServer(0, []danmtypes.DanmNet{*dnet}, nil),
+    kube: fake.NewSimpleClientset(),
+    runtime: stubs.NewFakeRuntime(),
+    eps: make(map[string]danmtypes.DanmEp),
+  }
+  return sim
+}
+
+// start runs the cleaner with a long period, so reconciliations are only triggered by Pod events, or explicitly by the test
+func (sim *simulation) start() {
+  epCleaner, err := cleaner.New(cleaner.Config {
+    DanmClient: sim.danm,
+    KubeClient: sim.kube,
+    Host: simHost,
+    Interval: time.Hour,
+    GracePeriod: time.Nanosecond,
+    IsContainerAlive: sim.runtime.IsContainerAlive,
+    WatchPods: true,
+    PodEventDelay: time.Millisecond * 10,
+    BootBarrier: sim.barrier,
+    MaxDeletesPerCycle: sim.maxDeletes,
+    CheckpointLabel: simCheckpointLabel,
+    BootTime: sim.bootTime,
+  })
+  if err != nil {
+    sim.t.Fatalf("Cleaner cannot be created because:%v", err)
+  }
+  ctx, cancel := context.WithCancel(context.Background())
+  sim.cleaner, sim.stop = epCleaner, cancel
+  err = epCleaner.Start(ctx)
+  if err != nil {
+    sim.t.Fatalf("Cleaner cannot be started because:%v", err)
+  }
+}
+
+// runPod schedules the Pod to the node, starts its sandbox, and connects it to the network like the CNI ADD does
+func (sim *simulation) runPod(name string) string {
+  _, err := sim.kube.CoreV1().Pods(simNamespace).Create(&corev1.Pod {
+    ObjectMeta: meta_v1.ObjectMeta{Name: name, Namespace: simNamespace},
+    Spec: corev1.PodSpec{NodeName: simHost},
+    Status: corev1.PodStatus{Phase: corev1.PodRunning},
+  })
+  if err != nil {
+    sim.t.Fatalf("Pod:%s cannot be created because:%v", name, err)
+  }
+  cid := "cid-" + name + "-" + strconv.Itoa(len(sim.eps))
+  sim.runtime.StartSandbox(cid)
+  ip, _, _, err := ipam.Reserve(sim.danm, *sim.getNetwork(), "dynamic", "")
+  if err != nil {
+    sim.t.Fatalf("IP cannot be allocated to Pod:%s because:%v", name, err)
+  }
+  ep := danmtypes.DanmEp {
+    ObjectMeta: meta_v1.ObjectMeta{Name: name + "-eth0", Namespace: simNamespace, UID: types.UID(cid)},
+    Spec: danmtypes.DanmEpSpec {
+      NetworkID: loadtest.NetworkName,
+      NetworkType: "ipvlan",
+      Host: simHost,
+      Pod: name,
+      CID: cid,
+      Iface: danmtypes.DanmEpIface{Name: "eth0", Address: ip},
+    },
+  }
+  _, err = sim.danm.DanmV1().DanmEps(simNamespace).Create(&ep)
+  if err != nil {
+    sim.t.Fatalf("DanmEp of Pod:%s cannot be created because:%v", name, err)
+  }
+  sim.eps[name] = ep
+  return ip
+}
+
+// deletePod removes the Pod from the API, its sandbox keeps running until the CNI DEL is finished
+func (sim *simulation) deletePod(name string) {
+  err := sim.kube.CoreV1().Pods(simNamespace).Delete(name, &meta_v1.DeleteOptions{})
+  if err != nil {
+    sim.t.Fatalf("Pod:%s cannot be deleted because:%v", name, err)
+  }
+}
+
+// cniDel disconnects the Pod like the CNI DEL does, then removes its sandbox
+func (sim *simulation) cniDel(name string) {
+  ep := sim.eps[name]
+  err := ipam.Free(sim.danm, *sim.getNetwork(), ep.Spec.Iface.Address)
+  if err != nil {
+    sim.t.Fatalf("IP of Pod:%s cannot be freed because:%v", name, err)
+  }
+  err = sim.danm.DanmV1().DanmEps(simNamespace).Delete(ep.ObjectMeta.Name, &meta_v1.DeleteOptions{})
+  if err != nil {
+    sim.t.Fatalf("DanmEp of Pod:%s cannot be deleted because:%v", name, err)
+  }
+  sim.runtime.StopSandbox(ep.Spec.CID)
+}
+
+func (sim *simulation) getNetwork() *danmtypes.DanmNet {
+  dnet, err := sim.danm.DanmV1().DanmNets(simNamespace).Get(loadtest.NetworkName, meta_v1.GetOptions{})
+  if err != nil {
+    sim.t.Fatalf("Simulated network cannot be read because:%v", err)
+  }
+  return dnet
+}
+
+func (sim *simulation) isAllocated(ip string) bool {
+  dnet := sim.getNetwork()
+  _, ipnet, _ := net.ParseCIDR(dnet.Spec.Options.Cidr)
+  addr, _, _ := net.ParseCIDR(ip)
+  alloc := bitarray.NewBitArrayFromBase64(dnet.Spec.Options.Alloc)
+  return alloc.Get(danmnet.Ip2int(addr) - danmnet.Ip2int(ipnet.IP))
+}
+
+func (sim *simulation) hasEp(name string) bool {
+  _, err := sim.danm.DanmV1().DanmEps(simNamespace).Get(sim.eps[name].ObjectMeta.Name, meta_v1.GetOptions{})
+  return err == nil
+}
+
+// waitFor polls the condition, as the cleaner acts on the events asynchronously
+func (sim *simulation) waitFor(description string, condition func() bool) {
+  deadline := time.Now().Add(time.Second * 5)
+  for !condition() {
+    if time.Now().After(deadline) {
+      sim.t.Fatalf("Timed out waiting for:%s", description)
+    }
+    time.Sleep(time.Millisecond * 10)
+  }
+}
+
+func TestPodEventDuringCniDel(t *testing.T) {
+  sim := newSimulation(t)
+  ip := sim.runPod("web")
+  sim.start()
+  defer sim.stop()
+  cid := sim.eps["web"].Spec.CID
+  //The Pod event arrives while the CNI DEL is still running in the sandbox
+  sim.deletePod("web")
+  sim.waitFor("inspection of the sandbox", func() bool { return sim.runtime.Inspections(cid) > 0 })
+  if !sim.hasEp("web") || !sim.isAllocated(ip) {
+    t.Fatalf("DanmEp of a Pod with a running sandbox was cleaned up")
+  }
+  //The CNI DEL finishes, and a new Pod reuses the freed address
+  sim.cniDel("web")
+  newIp := sim.runPod("db")
+  if newIp != ip {
+    t.Fatalf("Freed address:%s was not reused, the new Pod got:%s", ip, newIp)
+  }
+  sim.cleaner.Reconcile()
+  if !sim.hasEp("db") || !sim.isAllocated(newIp) {
+    t.Errorf("Address reused by a running Pod was freed by the cleaner")
+  }
+}
+
+func TestMissedDanmEpEvent(t *testing.T) {
+  sim := newSimulation(t)
+  ip := sim.runPod("web")
+  sim.start()
+  defer sim.stop()
+  //The deletion of the DanmEp by the CNI DEL never reaches the cleaner, so it keeps seeing the DanmEp
+  sim.danm.DropWatchEvents(1)
+  sim.deletePod("web")
+  sim.cniDel("web")
+  newIp := sim.runPod("db")
+  if newIp != ip {
+    t.Fatalf("Freed address:%s was not reused, the new Pod got:%s", ip, newIp)
+  }
+  sim.waitFor("inspection of the sandbox", func() bool { return sim.runtime.Inspections(sim.eps["web"].Spec.CID) > 0 })
+  sim.cleaner.Reconcile()
+  if !sim.isAllocated(newIp) {
+    t.Errorf("Address reused by a running Pod was freed again, because of a stale DanmEp in the cache of the cleaner")
+  }
+}
+
+func TestPodDeletedWhileCleanerWasDown(t *testing.T) {
+  sim := newSimulation(t)
+  ip := sim.runPod("web")
+  //The node was rebooted, so neither the Pod event, nor the CNI DEL was ever received
+  sim.deletePod("web")
+  sim.runtime.StopSandbox(sim.eps["web"].Spec.CID)
+  sim.start()
+  defer sim.stop()
+  sim.waitFor("cleanup of the stale DanmEp", func() bool { return !sim.hasEp("web") })
+  if sim.isAllocated(ip) {
+    t.Errorf("Address of the stale DanmEp was not freed")
+  }
+}
+
+func TestRuntimeRestart(t *testing.T) {
+  sim := newSimulation(t)
+  runningIp := sim.runPod("web")
+  lostIp := sim.runPod("db")
+  sim.start()
+  defer sim.stop()
+  sim.runtime.BeginRestart()
+  sim.cleaner.Reconcile()
+  if !sim.hasEp("web") || !sim.hasEp("db") {
+    t.Fatalf("DanmEps of existing Pods were cleaned up while the runtime was restarting")
+  }
+  //The sandbox of the db Pod was lost during the restart, so kubelet deletes the Pod without a CNI DEL
+  sim.runtime.FinishRestart(sim.eps["db"].Spec.CID)
+  sim.deletePod("db")
+  sim.waitFor("cleanup of the DanmEp of the lost sandbox", func() bool { return !sim.hasEp("db") })
+  if sim.isAllocated(lostIp) {
+    t.Errorf("Address of the lost sandbox was not freed")
+  }
+  if !sim.hasEp("web") || !sim.isAllocated(runningIp) {
+    t.Errorf("DanmEp of the running Pod was cleaned up")
+  }
+}
+
+func TestRebootBarrier(t *testing.T) {
+  dir, err := ioutil.TempDir("", "barrier")
+  if err != nil {
+    t.Fatalf("Temporary directory cannot be created because:%v", err)
+  }
+  defer os.RemoveAll(dir)
+  sim := newSimulation(t)
+  //Previous boot DanmEps are not limited by the maximum number of deletions per cycle
+  sim.maxDeletes = 1
+  //DanmEps created by the simulation have no creation timestamp, so they all belong to the previous boot
+  pods := []string{"web", "db", "cache"}
+  var ips []string
+  for _, pod := range pods {
+    ips = append(ips, sim.runPod(pod))
+    //The Pod survives the reboot in the API, but its sandbox does not
+    sim.runtime.StopSandbox(sim.eps[pod].Spec.CID)
+  }
+  sim.barrier, sim.bootTime = filepath.Join(dir, "boot_id"), time.Now()
+  if isOpen, _ := bootbarrier.IsOpen(sim.barrier); isOpen {
+    t.Fatalf("Boot barrier is open before the cleanup")
+  }
+  sim.start()
+  defer sim.stop()
+  sim.waitFor("opening of the boot barrier", func() bool {
+    isOpen, _ := bootbarrier.IsOpen(sim.barrier)
+    return isOpen
+  })
+  for i, pod := range pods {
+    if sim.hasEp(pod) || sim.isAllocated(ips[i]) {
+      t.Errorf("Boot barrier was opened before the DanmEp of Pod:%s of the previous boot was cleaned up", pod)
+    }
+  }
+}
+
+func TestCheckpointedSandbox(t *testing.T) {
+  sim := newSimulation(t)
+  ip := sim.runPod("web")
+  ep, err := sim.danm.DanmV1().DanmEps(simNamespace).Get(sim.eps["web"].ObjectMeta.Name, meta_v1.GetOptions{})
+  if err != nil {
+    t.Fatalf("DanmEp cannot be read because:%v", err)
+  }
+  ep.ObjectMeta.Labels = map[string]string{simCheckpointLabel: "true"}
+  _, err = sim.danm.DanmV1().DanmEps(simNamespace).Update(ep)
+  if err != nil {
+    t.Fatalf("DanmEp cannot be labeled because:%v", err)
+  }
+  //The sandbox is checkpointed, and its Pod is deleted until it is restored
+  sim.runtime.StopSandbox(sim.eps["web"].Spec.CID)
+  sim.deletePod("web")
+  sim.start()
+  defer sim.stop()
+  sim.cleaner.Reconcile()
+  if !sim.hasEp("web") || !sim.isAllocated(ip) {
+    t.Errorf("DanmEp of a checkpointed sandbox was cleaned up")
+  }
+}
+
+func (sim *simulation) setGcPolicy(policy string) {
+  dnet := sim.getNetwork()
+  dnet.Spec.Options.GcPolicy = policy
+  _, err := sim.danm.DanmV1().DanmNets(simNamespace).Update(dnet)
+  if err != nil {
+    sim.t.Fatalf("GC policy of the simulated network cannot be set because:%v", err)
+  }
+}
+
+func TestManualGcPolicy(t *testing.T) {
+  sim := newSimulation(t)
+  sim.setGcPolicy(netspec.GcPolicyManual)
+  ip := sim.runPod("web")
+  sim.deletePod("web")
+  sim.runtime.StopSandbox(sim.eps["web"].Spec.CID)
+  sim.start()
+  defer sim.stop()
+  sim.cleaner.Reconcile()
+  if !sim.hasEp("web") || !sim.isAllocated(ip) {
+    t.Errorf("DanmEp of a manually collected network was cleaned up")
+  }
+}
+
+func TestPeriodicGcPolicy(t *testing.T) {
+  sim := newSimulation(t)
+  sim.setGcPolicy(netspec.GcPolicyPeriodic)
+  ip := sim.runPod("web")
+  sim.start()
+  defer sim.stop()
+  //Lets the initial periodic reconciliation pass, while the Pod is still running
+  time.Sleep(time.Millisecond * 100)
+  cid := sim.eps["web"].Spec.CID
+  sim.runtime.StopSandbox(cid)
+  sim.deletePod("web")
+  sim.waitFor("inspection of the sandbox", func() bool { return sim.runtime.Inspections(cid) > 0 })
+  if !sim.hasEp("web") || !sim.isAllocated(ip) {
+    t.Fatalf("DanmEp of a periodically collected network was cleaned up on a Pod event")
+  }
+  sim.cleaner.Reconcile()
+  if sim.hasEp("web") || sim.isAllocated(ip) {
+    t.Errorf("DanmEp of a periodically collected network was not cleaned up periodically")
+  }
+}
@@ -13,9 +13,12 @@ import (
   "github.com/containernetworking/cni/pkg/types"
   "github.com/containernetworking/cni/pkg/types/current"
   "github.com/nokia/danm/pkg/ipam"
+  "github.com/nokia/danm/pkg/apiretry"
+  "github.com/nokia/danm/pkg/sriov"
   danmtypes "github.com/nokia/danm/pkg/crd/apis/danm/v1"
   danmclientset "github.com/nokia/danm/pkg/crd/client/clientset/versioned"
   meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+  "github.com/nokia/danm/pkg/netspec"
 )
 
 var (
@@ -84,20 +87,22 @@ var (
 // IsDelegationRequired decides if the interface creation operations should be delegated to a 3rd party CNI, or can be handled by DANM
 // Decision is made based on the NetworkType parameter of the DanmNet object
 func IsDelegationRequired(danmClient danmclientset.Interface, nid, namespace string) (bool,*danmtypes.DanmNet,error) {
-  netInfo, err := danmClient.DanmV1().DanmNets(namespace).Get(nid, meta_v1.GetOptions{})
+  var netInfo *danmtypes.DanmNet
+  err := apiretry.Do(apiretry.DefaultBackoff, func() error {
+    var getErr error
+    netInfo, getErr = danmClient.DanmV1().DanmNets(namespace).Get(nid, meta_v1.GetOptions{})
+    return getErr
+  })
   if err != nil {
     return false, nil, err
   }
-  neType := netInfo.Spec.NetworkType
-  if neType == "ipvlan" || neType == "" {
-    return false, netInfo, nil
-  }
-  return true, netInfo, nil
+  return netspec.IsDelegated(netInfo), netInfo, nil
 }
 
 // DelegateInterfaceSetup delegates Ks8 Pod network interface setup task to the input 3rd party CNI plugin
-// Returns the CNI compatible result object, or an error if interface creation was unsuccessful, or if the 3rd party CNI config could not be loaded
-func DelegateInterfaceSetup(danmClient danmclientset.Interface, netInfo *danmtypes.DanmNet, iface danmtypes.Interface) (types.Result,error) {
+// Returns the CNI compatible result object together with the record of the delegation to be stored in the DanmEp,
+// or an error if interface creation was unsuccessful, or if the 3rd party CNI config could not be loaded
+func DelegateInterfaceSetup(danmClient danmclientset.Interface, netInfo *danmtypes.DanmNet, iface danmtypes.Interface) (types.Result,*danmtypes.DanmEpDelegate,error) {
   var (
     ip4 string
     ip6 string
@@ -107,7 +112,7 @@ func DelegateInterfaceSetup(danmClient danmclientset.Interface, netInfo *danmtyp
   if isIpamNeeded(netInfo.Spec.NetworkType) {
     ip4, ip6, _, err = ipam.Reserve(danmClient, *netInfo, iface.Ip, iface.Ip6)
     if err != nil {
-      return nil, errors.New("IP address reservation failed for network:" + netInfo.Spec.NetworkID + " with error:" + err.Error())
+      return nil, nil, errors.New("IP address reservation failed for network:" + netInfo.Spec.NetworkID + " with error:" + err.Error())
     }
     ipamOptions = getCniIpamConfig(netInfo.Spec.Options, ip4, ip6)
   }
@@ -116,22 +121,121 @@ func DelegateInterfaceSetup(danmClient danmclientset.Interface, netInfo *danmtyp
     if isIpamNeeded(netInfo.Spec.NetworkType) {
       ipam.GarbageCollectIps(danmClient, netInfo, ip4, ip6)
     }
-    return nil, err
+    return nil, nil, err
   }
   cniType := netInfo.Spec.NetworkType
-  cniResult, err := invoke.DelegateAdd(cniType, rawConfig)
+  cniResult, err := delegateAdd(netInfo, rawConfig)
   if err != nil {
     if isIpamNeeded(netInfo.Spec.NetworkType) {
       ipam.GarbageCollectIps(danmClient, netInfo, ip4, ip6)
     }
-    return nil, errors.New("Error delegating ADD to CNI plugin:" + cniType + " because:" + err.Error())
+    return nil, nil, errors.New("Error delegating ADD to CNI plugin:" + cniType + " because:" + err.Error())
+  }
+  record := NewDelegateRecord(cniType, rawConfig, cniResult)
+  record.PluginVersions = GetPluginVersions(cniType)
+  return cniResult, record, nil
+}
+
+// GetPluginVersions returns the CNI specification versions the plugin binary supports according to the CNI VERSION command
+// A failing query only leaves the versions unrecorded, as the interface was already created
+func GetPluginVersions(cniType string) []string {
+  pluginPath, err := invoke.FindInPath(cniType, filepath.SplitList(os.Getenv("CNI_PATH")))
+  if err != nil {
+    log.Println("INFO: version of CNI plugin:" + cniType + " cannot be recorded because:" + err.Error())
+    return nil
+  }
+  versionInfo, err := invoke.GetVersionInfo(pluginPath)
+  if err != nil {
+    log.Println("INFO: version of CNI plugin:" + cniType + " cannot be recorded because:" + err.Error())
+    return nil
+  }
+  return versionInfo.SupportedVersions()
+}
+
+// NewDelegateRecord returns the record of a successful delegation with the given configuration, and result
+func NewDelegateRecord(cniType string, rawConfig []byte, cniResult types.Result) *danmtypes.DanmEpDelegate {
+  record := &danmtypes.DanmEpDelegate {
+    Plugin: cniType,
+    Config: string(rawConfig),
+  }
+  var netConf types.NetConf
+  err := json.Unmarshal(rawConfig, &netConf)
+  if err == nil {
+    record.CniVersion = netConf.CNIVersion
+  }
+  if cniResult != nil {
+    rawResult, err := json.Marshal(cniResult)
+    if err != nil {
+      log.Println("INFO: result of CNI plugin:" + cniType + " cannot be recorded because:" + err.Error())
+    } else {
+      record.Result = string(rawResult)
+    }
+  }
+  return record
+}
+
+func delegateAdd(netInfo *danmtypes.DanmNet, rawConfig []byte) (types.Result,error) {
+  cniType := netInfo.Spec.NetworkType
+  if cniType != "sriov" || netInfo.Spec.Options.OffloadBridge == "" {
+    return invoke.DelegateAdd(cniType, rawConfig)
+  }
+  return delegateOffloadedSriov(netInfo, rawConfig)
+}
+
+// delegateOffloadedSriov moves a VF into the Pod via the SRIOV plugin, then attaches the representor of the VF to the offload bridge of the network
+func delegateOffloadedSriov(netInfo *danmtypes.DanmNet, rawConfig []byte) (types.Result,error) {
+  pf, err := sriov.GetPhysicalFunction(netInfo.Spec.Options.Device)
+  if err != nil {
+    return nil, err
+  }
+  if !pf.IsSwitchdev() {
+    return nil, errors.New("hardware offload requires the eswitch of host device:" + pf.Name + " to be in switchdev mode")
+  }
+  lock, err := sriov.LockPhysicalFunction(pf.Name)
+  if err != nil {
+    return nil, err
+  }
+  defer lock.Unlock()
+  freeBefore, err := pf.GetFreeVirtualFunctions()
+  if err != nil {
+    return nil, err
+  }
+  cniResult, err := invoke.DelegateAdd("sriov", rawConfig)
+  if err != nil {
+    return nil, err
+  }
+  err = attachOffloadedVf(pf, freeBefore, netInfo.Spec.Options.OffloadBridge)
+  if err != nil {
+    //The VF is given back, so its addresses can be safely garbage collected by the caller
+    delErr := invoke.DelegateDel("sriov", rawConfig)
+    if delErr != nil {
+      return nil, errors.New(err.Error() + ", and the VF cannot be given back because:" + delErr.Error())
+    }
+    return nil, err
   }
   return cniResult, nil
 }
 
+// attachOffloadedVf attaches the representor of the VF the SRIOV plugin has just taken from the PF to the offload bridge
+func attachOffloadedVf(pf *sriov.PhysicalFunction, freeBefore []sriov.VirtualFunction, bridge string) error {
+  freeAfter, err := pf.GetFreeVirtualFunctions()
+  if err != nil {
+    return err
+  }
+  vf, err := sriov.GetTakenVirtualFunction(freeBefore, freeAfter)
+  if err != nil {
+    return err
+  }
+  representor, err := pf.GetRepresentor(vf.Index)
+  if err != nil {
+    return err
+  }
+  return sriov.AttachRepresentor(representor, bridge)
+}
+
 func isIpamNeeded(cniType string) bool {
   for _, cni := range supportedNativeCnis {
-    if cni.BackendName == cniType {
+    if cni.BackendName == netspec.NormalizeType(cniType) {
       return cni.ipamNeeded
     }
   }
@@ -164,7 +268,7 @@ func getCniIpamConfig(options danmtypes.DanmNetOption, ip4 string, ip6 string) d
 }
 
 func getCniPluginConfig(netInfo *danmtypes.DanmNet, ipamOptions danmtypes.IpamConfig) ([]byte, error) {
-  cniType := netInfo.Spec.NetworkType
+  cniType := netspec.GetNetworkType(netInfo)
   for _, cni := range supportedNativeCnis {
     if cni.BackendName == cniType {
       return cni.readConfig(netInfo, ipamOptions)
@@ -202,6 +306,27 @@ func getSriovCniConfig(netInfo *danmtypes.DanmNet, ipamOptions danmtypes.IpamCon
   return rawConfig, nil
 }
 
+// SelectPhysicalFunction returns the network with the PF its next VF shall be allocated from set as its host device
+// It fails the interface creation early, with a meaningful error, when the SRIOV plugin would not find a VF to move into the Pod
+// Other networks are returned as they are
+func SelectPhysicalFunction(netInfo *danmtypes.DanmNet) (*danmtypes.DanmNet, error) {
+  if netspec.GetNetworkType(netInfo) != netspec.TypeSriov {
+    return netInfo, nil
+  }
+  //The explicitly configured host device comes first, so it is always preferred by the strict policy
+  devices := netspec.GetHostDevices(netInfo)
+  if len(devices) == 0 {
+    return nil, errors.New("no host device is configured for SRIOV network:" + netInfo.Spec.NetworkID)
+  }
+  pf, err := sriov.SelectPhysicalFunction(devices, netInfo.Spec.Options.PfSelection, netInfo.Spec.NetworkID)
+  if err != nil {
+    return nil, err
+  }
+  selected := *netInfo
+  selected.Spec.Options.Device = pf.Name
+  return &selected, nil
+}
+
 func readCniConfigFile(netInfo *danmtypes.DanmNet) ([]byte, error) {
   cniType := netInfo.Spec.NetworkType
   //TODO: the path from where the config is read should not be hard-coded
@@ -229,25 +354,53 @@ func parseRoutes(rawRoutes map[string]string, netCidr string) ([]danmtypes.IpamR
 
 // DelegateInterfaceDelete delegates Ks8 Pod network interface delete task to the input 3rd party CNI plugin
 // Returns an error if interface creation was unsuccessful, or if the 3rd party CNI config could not be loaded
-func DelegateInterfaceDelete(danmClient danmclientset.Interface, netInfo *danmtypes.DanmNet, ip string) error {
-  rawConfig, err := getCniPluginConfig(netInfo, danmtypes.IpamConfig{})
+func DelegateInterfaceDelete(danmClient danmclientset.Interface, netInfo *danmtypes.DanmNet, delegate *danmtypes.DanmEpDelegate, ip string) error {
+  err := DelegateInterfaceTeardown(netInfo, delegate, ip)
+  if err != nil {
+    //Best-effort clean-up because we know how to handle exceptions
+    freeDelegatedIps(danmClient, netInfo, ip)
+    return err
+  }
+  return freeDelegatedIps(danmClient, netInfo, ip)
+}
+
+// DelegateInterfaceTeardown delegates the deletion of the interface to the CNI plugin, without freeing its address in the DanmNet
+// The plugin is invoked with the exact configuration it created the interface with, if the delegation was recorded
+func DelegateInterfaceTeardown(netInfo *danmtypes.DanmNet, delegate *danmtypes.DanmEpDelegate, ip string) error {
+  cniType, rawConfig, err := GetTeardownConfig(netInfo, delegate)
   if err != nil {
     return err
   }
-  cniType := netInfo.Spec.NetworkType
   err = invoke.DelegateDel(cniType, rawConfig)
+  if netspec.GetNetworkType(netInfo) == netspec.TypeFlannel && ip != ""{
+    flannelIpExhaustionWorkaround(ip)
+  }
   if err != nil {
-    //Best-effort clean-up because we know how to handle exceptions
-    freeDelegatedIps(danmClient, netInfo, ip)
     return errors.New("Error delegating DEL to CNI plugin:" + cniType + " because:" + err.Error())
   }
-  return freeDelegatedIps(danmClient, netInfo, ip)
+  return nil
 }
 
-func freeDelegatedIps(danmClient danmclientset.Interface, netInfo *danmtypes.DanmNet, ip string) error {
-  if netInfo.Spec.NetworkType == "flannel" && ip != ""{
-    flannelIpExhaustionWorkaround(ip)
+// GetTeardownConfig returns the CNI plugin, and the configuration the interface shall be deleted with
+// The recorded configuration is replayed, so DEL is not affected by the changes of the DanmNet, or of the CNI config file since the creation of the interface
+// DanmEps created by older releases have no record, the plugin is invoked with its current configuration for them
+func GetTeardownConfig(netInfo *danmtypes.DanmNet, delegate *danmtypes.DanmEpDelegate) (string, []byte, error) {
+  if delegate != nil && delegate.Plugin != "" && delegate.Config != "" {
+    return delegate.Plugin, []byte(delegate.Config), nil
+  }
+  rawConfig, err := getCniPluginConfig(netInfo, danmtypes.IpamConfig{})
+  if err != nil {
+    return "", nil, err
   }
+  return netInfo.Spec.NetworkType, rawConfig, nil
+}
+
+// IsDanmIpamUsed tells if the addresses of the network's interfaces are allocated from the DanmNet
+func IsDanmIpamUsed(netInfo *danmtypes.DanmNet) bool {
+  return netspec.IsIpvlan(netInfo) || isIpamNeeded(netInfo.Spec.NetworkType)
+}
+
+func freeDelegatedIps(danmClient danmclientset.Interface, netInfo *danmtypes.DanmNet, ip string) error {
   if isIpamNeeded(netInfo.Spec.NetworkType) && ip != "" {
     err := ipam.Free(danmClient, *netInfo, ip)
     if err != nil {
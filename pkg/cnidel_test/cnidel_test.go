@@ -1,7 +1,13 @@
 package cnidel_test
 
 import (
+  "io/ioutil"
+  "net"
+  "os"
+  "path/filepath"
+  "strings"
   "testing"
+  "github.com/containernetworking/cni/pkg/types/current"
   "github.com/nokia/danm/pkg/cnidel"
   danmtypes "github.com/nokia/danm/pkg/crd/apis/danm/v1"
   "github.com/nokia/danm/pkg/stubs"
@@ -42,3 +48,55 @@ func TestIsDelegationRequired(t *testing.T) {
     })
   }
 }
+
+func TestNewDelegateRecord(t *testing.T) {
+  rawConfig := []byte(`{"cniVersion":"0.3.1","name":"sriov","type":"sriov"}`)
+  cniResult := &current.Result{CNIVersion: "0.3.1", IPs: []*current.IPConfig{&current.IPConfig{Version: "4", Address: net.IPNet{IP: net.ParseIP("10.0.0.5"), Mask: net.CIDRMask(24, 32)}}}}
+  record := cnidel.NewDelegateRecord("sriov", rawConfig, cniResult)
+  if record.Plugin != "sriov" || record.CniVersion != "0.3.1" || record.Config != string(rawConfig) {
+    t.Errorf("Delegation was not recorded correctly:%v", record)
+  }
+  if !strings.Contains(record.Result, "10.0.0.5/24") {
+    t.Errorf("Recorded CNI result:%s does not contain the allocated address", record.Result)
+  }
+  record = cnidel.NewDelegateRecord("macvlan", []byte("not a JSON"), nil)
+  if record.CniVersion != "" || record.Result != "" {
+    t.Errorf("Invalid config, or missing result was recorded:%v", record)
+  }
+}
+
+func TestGetTeardownConfig(t *testing.T) {
+  netInfo := &danmtypes.DanmNet{Spec: danmtypes.DanmNetSpec{NetworkID: "sriov", NetworkType: "sriov", Options: danmtypes.DanmNetOption{Device: "enp1s0f1", Vlan: 200}}}
+  recorded := &danmtypes.DanmEpDelegate{Plugin: "sriov", Config: `{"type":"sriov","if0":"enp1s0f0","vlan":100}`}
+  cniType, rawConfig, err := cnidel.GetTeardownConfig(netInfo, recorded)
+  if err != nil || cniType != "sriov" || string(rawConfig) != recorded.Config {
+    t.Errorf("Recorded config was not replayed, got plugin:%s config:%s err:%v", cniType, rawConfig, err)
+  }
+  cniType, rawConfig, err = cnidel.GetTeardownConfig(netInfo, nil)
+  if err != nil || cniType != "sriov" || !strings.Contains(string(rawConfig), "enp1s0f1") {
+    t.Errorf("Current config was not used without a record, got plugin:%s config:%s err:%v", cniType, rawConfig, err)
+  }
+}
+
+func TestGetPluginVersions(t *testing.T) {
+  dir, err := ioutil.TempDir("", "cnipath")
+  if err != nil {
+    t.Fatalf("Temporary directory cannot be created because:%v", err)
+  }
+  defer os.RemoveAll(dir)
+  plugin := "#!/bin/sh\necho '{\"cniVersion\":\"0.3.1\",\"supportedVersions\":[\"0.1.0\",\"0.2.0\",\"0.3.0\",\"0.3.1\"]}'\n"
+  err = ioutil.WriteFile(filepath.Join(dir, "fakeplugin"), []byte(plugin), 0755)
+  if err != nil {
+    t.Fatalf("Fake CNI plugin cannot be created because:%v", err)
+  }
+  os.Setenv("CNI_PATH", dir)
+  defer os.Unsetenv("CNI_PATH")
+  versions := cnidel.GetPluginVersions("fakeplugin")
+  if strings.Join(versions, ",") != "0.1.0,0.2.0,0.3.0,0.3.1" {
+    t.Errorf("Reported versions of the plugin were not returned, got:%v", versions)
+  }
+  versions = cnidel.GetPluginVersions("missingplugin")
+  if versions != nil {
+    t.Errorf("Versions were returned for a missing plugin:%v", versions)
+  }
+}
@@ -0,0 +1,114 @@
+package cnilog
+
+import (
+  "bytes"
+  "errors"
+  "io"
+  "log"
+  "os"
+  "strconv"
+  "syscall"
+)
+
+const (
+  // DefaultPath is the log file used when the NetConf does not configure one
+  DefaultPath = "/var/log/plugin.log"
+  // DefaultMaxSizeMB is the size above which the log file is rotated, if the NetConf does not configure it
+  DefaultMaxSizeMB = 10
+  // DefaultMaxBackups is the number of rotated log files kept, if the NetConf does not configure it
+  DefaultMaxBackups = 3
+)
+
+// Log levels, each level includes the messages of the previous ones
+const (
+  LevelError = "error"
+  LevelInfo = "info"
+  LevelDebug = "debug"
+)
+
+// Config is the "log" section of the CNI NetConf
+type Config struct {
+  // File is the path of the log file, "stderr" writes the log to the standard error instead
+  File string `json:"file,omitempty"`
+  // MaxSizeMB is the size in megabytes above which the log file is rotated. Negative values disable rotation
+  MaxSizeMB int `json:"max_size_mb,omitempty"`
+  // MaxBackups is the number of rotated log files kept next to the active one. Negative values keep no rotated files
+  MaxBackups int `json:"max_backups,omitempty"`
+}
+
+// Setup directs the output of the standard logger according to the configuration, and filters the messages above the given level
+// Unknown, or empty levels are treated as LevelInfo
+// The log file is rotated before being opened if it grew above the size limit
+// Concurrent CNI invocations on the same host are serialized during rotation, so no rotated file is lost
+func Setup(config Config, level string) error {
+  if config.File == "" {
+    config.File = DefaultPath
+  }
+  if config.MaxSizeMB == 0 {
+    config.MaxSizeMB = DefaultMaxSizeMB
+  }
+  if config.MaxBackups == 0 {
+    config.MaxBackups = DefaultMaxBackups
+  }
+  if config.File == "stderr" {
+    log.SetOutput(&levelFilter{out: os.Stderr, level: level})
+    return nil
+  }
+  if config.MaxSizeMB > 0 {
+    err := rotate(config.File, int64(config.MaxSizeMB) * 1024 * 1024, config.MaxBackups)
+    if err != nil {
+      return err
+    }
+  }
+  file, err := os.OpenFile(config.File, os.O_RDWR | os.O_CREATE | os.O_APPEND, 0640)
+  if err != nil {
+    return errors.New("log file:" + config.File + " cannot be opened because:" + err.Error())
+  }
+  log.SetOutput(&levelFilter{out: file, level: level})
+  return nil
+}
+
+func rotate(path string, maxSize int64, maxBackups int) error {
+  info, err := os.Stat(path)
+  if err != nil || info.Size() < maxSize {
+    return nil
+  }
+  lock, err := os.OpenFile(path + ".lock", os.O_CREATE | os.O_RDWR, 0600)
+  if err != nil {
+    return errors.New("lock file of log:" + path + " cannot be opened because:" + err.Error())
+  }
+  defer lock.Close()
+  err = syscall.Flock(int(lock.Fd()), syscall.LOCK_EX)
+  if err != nil {
+    return errors.New("log:" + path + " cannot be locked because:" + err.Error())
+  }
+  defer syscall.Flock(int(lock.Fd()), syscall.LOCK_UN)
+  //Another invocation might have rotated the file while waiting for the lock
+  info, err = os.Stat(path)
+  if err != nil || info.Size() < maxSize {
+    return nil
+  }
+  for index := maxBackups - 1; index > 0; index-- {
+    os.Rename(path + "." + strconv.Itoa(index), path + "." + strconv.Itoa(index+1))
+  }
+  if maxBackups < 1 {
+    return os.Remove(path)
+  }
+  return os.Rename(path, path + ".1")
+}
+
+type levelFilter struct {
+  out io.Writer
+  level string
+}
+
+// Write drops the messages above the configured level, based on their "DEBUG:", or "INFO:" prefix
+// Messages without a prefix are always written
+func (filter *levelFilter) Write(message []byte) (int, error) {
+  isDebug := bytes.Contains(message, []byte("DEBUG: "))
+  isInfo := bytes.Contains(message, []byte("INFO: "))
+  if (isDebug && filter.level != LevelDebug) || (isInfo && filter.level == LevelError) {
+    return len(message), nil
+  }
+  return filter.out.Write(message)
+}
@@ -0,0 +1,79 @@
+package cnilog_test
+
+import (
+  "io/ioutil"
+  "log"
+  "os"
+  "path/filepath"
+  "strings"
+  "testing"
+  "github.com/nokia/danm/pkg/cnilog"
+)
+
+func TestSetupRotatesLargeLog(t *testing.T) {
+  dir, err := ioutil.TempDir("", "cnilog")
+  if err != nil {
+    t.Fatalf("temporary directory cannot be created:%v", err)
+  }
+  defer os.RemoveAll(dir)
+  path := filepath.Join(dir, "plugin.log")
+  ioutil.WriteFile(path, make([]byte, 1024*1024), 0640)
+  ioutil.WriteFile(path + ".1", []byte("previous"), 0640)
+  err = cnilog.Setup(cnilog.Config{File: path, MaxSizeMB: 1, MaxBackups: 2}, "")
+  if err != nil {
+    t.Fatalf("Setup failed with error:%v", err)
+  }
+  defer log.SetOutput(os.Stderr)
+  log.Println("INFO: after rotation")
+  if content, _ := ioutil.ReadFile(path + ".2"); string(content) != "previous" {
+    t.Errorf("Previous backup was expected to be shifted, got:%s", string(content))
+  }
+  if info, err := os.Stat(path + ".1"); err != nil || info.Size() != 1024*1024 {
+    t.Errorf("Full log was expected to be rotated to the first backup, err:%v", err)
+  }
+  if content, _ := ioutil.ReadFile(path); !strings.Contains(string(content), "after rotation") {
+    t.Errorf("New messages were expected to be written into a fresh log, got:%s", string(content))
+  }
+}
+
+var levelTcs = []struct {
+  level string
+  expectedMessages []string
+  droppedMessages []string
+}{
+  {"error", []string{"ERROR: e", "plain"}, []string{"INFO: i", "DEBUG: d"}},
+  {"", []string{"ERROR: e", "INFO: i", "plain"}, []string{"DEBUG: d"}},
+  {"debug", []string{"ERROR: e", "INFO: i", "DEBUG: d", "plain"}, nil},
+}
+
+func TestSetupFiltersLevels(t *testing.T) {
+  dir, err := ioutil.TempDir("", "cnilog")
+  if err != nil {
+    t.Fatalf("temporary directory cannot be created:%v", err)
+  }
+  defer os.RemoveAll(dir)
+  defer log.SetOutput(os.Stderr)
+  for _, tc := range levelTcs {
+    t.Run("level:" + tc.level, func(t *testing.T) {
+      path := filepath.Join(dir, tc.level + ".log")
+      err := cnilog.Setup(cnilog.Config{File: path}, tc.level)
+      if err != nil {
+        t.Fatalf("Setup failed with error:%v", err)
+      }
+      for _, message := range []string{"ERROR: e", "INFO: i", "DEBUG: d", "plain"} {
+        log.Println(message)
+      }
+      content, _ := ioutil.ReadFile(path)
+      for _, message := range tc.expectedMessages {
+        if !strings.Contains(string(content), message) {
+          t.Errorf("Message:%s was expected to be logged", message)
+        }
+      }
+      for _, message := range tc.droppedMessages {
+        if strings.Contains(string(content), message) {
+          t.Errorf("Message:%s was expected to be dropped", message)
+        }
+      }
+    })
+  }
+}
@@ -0,0 +1,97 @@
+package compat
+
+import (
+  "errors"
+  "strconv"
+  danmtypes "github.com/nokia/danm/pkg/crd/apis/danm/v1"
+)
+
+const (
+  // MinCniRevisionAnnotation stores the lowest revision of the DANM CNI binary able to correctly connect Pods to the DanmNet
+  // DanmNets without this annotation can be used by any revision
+  MinCniRevisionAnnotation = "danm.k8s.io/min-cni-revision"
+  // BaseRevision is the revision of the DanmNet API understood by all DANM releases
+  BaseRevision = 1
+  // CniRevision is the revision of the DanmNet API understood by this build of DANM
+  // It shall be increased, and a new feature shall be added to the features list, whenever a new DanmNet option is introduced which older CNI binaries would silently ignore
+  CniRevision = 10
+)
+
+// feature is a DanmNet option requiring a minimum CNI revision to be honoured
+type feature struct {
+  name string
+  revision int
+  isUsed func(opts danmtypes.DanmNetOption) bool
+}
+
+var features = []feature {
+  feature{"tx_queues, rx_queues, rps_cpus, xps_cpus", 2, func(opts danmtypes.DanmNetOption) bool {
+    return opts.TxQueues != 0 || opts.RxQueues != 0 || opts.RpsCpus != "" || opts.XpsCpus != ""
+  }},
+  feature{"static_assignments", 3, func(opts danmtypes.DanmNetOption) bool {
+    return len(opts.StaticAssignments) > 0
+  }},
+  feature{"offload_bridge", 4, func(opts danmtypes.DanmNetOption) bool {
+    return opts.OffloadBridge != ""
+  }},
+  feature{"preemption", 5, func(opts danmtypes.DanmNetOption) bool {
+    return opts.Preemption
+  }},
+  feature{"host_devices, pf_selection", 6, func(opts danmtypes.DanmNetOption) bool {
+    return len(opts.HostDevices) > 0
+  }},
+  feature{"pod_offloads, host_offloads", 7, func(opts danmtypes.DanmNetOption) bool {
+    return opts.PodOffloads != nil || opts.HostOffloads != nil
+  }},
+  feature{"separate_allocation", 8, func(opts danmtypes.DanmNetOption) bool {
+    return opts.SeparateAllocation
+  }},
+  feature{"intra_host_switching", 9, func(opts danmtypes.DanmNetOption) bool {
+    return opts.IntraHostSwitching == "external"
+  }},
+  feature{"multipath_routes", 10, func(opts danmtypes.DanmNetOption) bool {
+    return len(opts.MultipathRoutes) > 0
+  }},
+}
+
+// GetRequiredRevision returns the lowest CNI revision honouring all the options used by the DanmNet
+// Unknown fields are silently dropped by older binaries when decoding a DanmNet, so optional features are safe to use only if the node runs at least this revision
+func GetRequiredRevision(dnet *danmtypes.DanmNet) int {
+  required := BaseRevision
+  for _, feat := range features {
+    if feat.revision > required && feat.isUsed(dnet.Spec.Options) {
+      required = feat.revision
+    }
+  }
+  return required
+}
+
+// SetRequiredRevision records the lowest CNI revision honouring the DanmNet in its annotations
+func SetRequiredRevision(dnet *danmtypes.DanmNet) {
+  required := GetRequiredRevision(dnet)
+  if required == BaseRevision {
+    delete(dnet.ObjectMeta.Annotations, MinCniRevisionAnnotation)
+    return
+  }
+  if dnet.ObjectMeta.Annotations == nil {
+    dnet.ObjectMeta.Annotations = make(map[string]string)
+  }
+  dnet.ObjectMeta.Annotations[MinCniRevisionAnnotation] = strconv.Itoa(required)
+}
+
+// CheckCniRevision refuses to use a DanmNet requiring a newer CNI binary than the one running on this node
+func CheckCniRevision(dnet *danmtypes.DanmNet) error {
+  annotation, ok := dnet.ObjectMeta.Annotations[MinCniRevisionAnnotation]
+  if !ok {
+    return nil
+  }
+  required, err := strconv.Atoi(annotation)
+  if err != nil {
+    return errors.New("DanmNet:" + dnet.ObjectMeta.Name + " has an invalid " + MinCniRevisionAnnotation + " annotation:" + annotation)
+  }
+  if required > CniRevision {
+    return errors.New("DanmNet:" + dnet.ObjectMeta.Name + " uses options requiring DANM CNI revision " + annotation +
+                      ", but this node runs revision " + strconv.Itoa(CniRevision) + ". Upgrade the danm binary on this node, or remove the newer options from the network")
+  }
+  return nil
+}
@@ -0,0 +1,69 @@
+package compat_test
+
+import (
+  "strconv"
+  "testing"
+  meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+  danmtypes "github.com/nokia/danm/pkg/crd/apis/danm/v1"
+  "github.com/nokia/danm/pkg/compat"
+)
+
+var revisionTcs = []struct {
+  tcName string
+  opts danmtypes.DanmNetOption
+  expectedRevision int
+}{
+  {"baseOptions", danmtypes.DanmNetOption{Device: "ens3", Cidr: "10.0.0.0/24", Vlan: 10}, compat.BaseRevision},
+  {"queues", danmtypes.DanmNetOption{Device: "ens3", RpsCpus: "f"}, 2},
+  {"staticAssignments", danmtypes.DanmNetOption{TxQueues: 2, StaticAssignments: []danmtypes.StaticAssignment{danmtypes.StaticAssignment{Node: "node1"}}}, 3},
+  {"offload", danmtypes.DanmNetOption{Device: "ens4f0", OffloadBridge: "br-offload"}, 4},
+  {"ethtoolOffloads", danmtypes.DanmNetOption{Device: "ens3", PodOffloads: &danmtypes.Offloads{}}, 7},
+  {"separateAllocation", danmtypes.DanmNetOption{Device: "ens3", Cidr: "10.0.0.0/24", SeparateAllocation: true}, 8},
+  {"externalSwitching", danmtypes.DanmNetOption{Device: "ens3", Vlan: 100, IntraHostSwitching: "external"}, 9},
+  {"localSwitching", danmtypes.DanmNetOption{Device: "ens3", Vlan: 100, IntraHostSwitching: "local"}, compat.BaseRevision},
+  {"multipathRoutes", danmtypes.DanmNetOption{Device: "ens3", MultipathRoutes: []danmtypes.MultipathRoute{{Destination: "0.0.0.0/0"}}}, 10},
+}
+
+func TestSetRequiredRevision(t *testing.T) {
+  for _, tc := range revisionTcs {
+    t.Run(tc.tcName, func(t *testing.T) {
+      dnet := danmtypes.DanmNet{Spec: danmtypes.DanmNetSpec{Options: tc.opts}}
+      compat.SetRequiredRevision(&dnet)
+      annotation, ok := dnet.ObjectMeta.Annotations[compat.MinCniRevisionAnnotation]
+      if tc.expectedRevision == compat.BaseRevision {
+        if ok {
+          t.Errorf("Revision annotation:%s was set, although only base options were used", annotation)
+        }
+        return
+      }
+      if annotation != strconv.Itoa(tc.expectedRevision) {
+        t.Errorf("Revision annotation:%s does not match with expected:%d", annotation, tc.expectedRevision)
+      }
+      if tc.expectedRevision > compat.CniRevision {
+        t.Errorf("Required revision:%d is newer than the revision of the binary:%d", tc.expectedRevision, compat.CniRevision)
+      }
+    })
+  }
+}
+
+func TestCheckCniRevision(t *testing.T) {
+  checkTcs := []struct {
+    tcName string
+    annotations map[string]string
+    isErrorExpected bool
+  }{
+    {"noAnnotation", nil, false},
+    {"sameRevision", map[string]string{compat.MinCniRevisionAnnotation: strconv.Itoa(compat.CniRevision)}, false},
+    {"newerRevision", map[string]string{compat.MinCniRevisionAnnotation: strconv.Itoa(compat.CniRevision + 1)}, true},
+    {"invalidRevision", map[string]string{compat.MinCniRevisionAnnotation: "latest"}, true},
+  }
+  for _, tc := range checkTcs {
+    t.Run(tc.tcName, func(t *testing.T) {
+      dnet := danmtypes.DanmNet{ObjectMeta: meta_v1.ObjectMeta{Name: "net", Annotations: tc.annotations}}
+      err := compat.CheckCniRevision(&dnet)
+      if (err != nil) != tc.isErrorExpected {
+        t.Errorf("Received error:%v does not match with expectation", err)
+      }
+    })
+  }
+}
@@ -32,6 +32,14 @@ func addKnownTypes(scheme *runtime.Scheme) error {
 		&DanmEpList{},
 		&DanmNet{},
 		&DanmNetList{},
+		&DanmNetReport{},
+		&DanmNetReportList{},
+		&DanmIPReservation{},
+		&DanmIPReservationList{},
+		&DanmNetAllocation{},
+		&DanmNetAllocationList{},
+		&DanmNodeCapability{},
+		&DanmNodeCapabilityList{},
 	)
 	meta_v1.AddToGroupVersion(scheme, SchemeGroupVersion)
 	return nil
@@ -55,6 +55,61 @@ type DanmNetOption struct {
   Vlan  int  `json:"vlan,omitempty"`
   // option to determinate if DPDK options should be used
   Dpdk    bool               `json:"dpdk,omitempty"`
+  // number of transmit queues of the Pod side interface
+  TxQueues int `json:"tx_queues,omitempty"`
+  // number of receive queues of the Pod side interface
+  RxQueues int `json:"rx_queues,omitempty"`
+  // hexadecimal CPU bitmap configured as RPS mask for all receive queues of the Pod side interface
+  RpsCpus string `json:"rps_cpus,omitempty"`
+  // hexadecimal CPU bitmap configured as XPS mask for all transmit queues of the Pod side interface
+  XpsCpus string `json:"xps_cpus,omitempty"`
+  // addresses always assigned to the same Pods on the same nodes, instead of dynamically allocating one
+  StaticAssignments []StaticAssignment `json:"static_assignments,omitempty"`
+  // host bridge the representors of the VFs are attached to, instead of using plain VF passthrough
+  OffloadBridge string `json:"offload_bridge,omitempty"`
+  // allows higher priority Pods to take over the addresses of completed, or failed lower priority Pods when the allocation pool is exhausted
+  Preemption bool `json:"preemption,omitempty"`
+  // records every IP reservation from the network as a K8s Event of the DanmNet
+  IpamAudit bool `json:"ipam_audit,omitempty"`
+  // answers ARP requests, and Neighbor Solicitations on the host interface on behalf of the Pods of the IPVLAN network running on other nodes
+  ProxyArp bool `json:"proxy_arp,omitempty"`
+  // the PFs the VFs of an SRIOV network are spread across
+  HostDevices []string `json:"host_devices,omitempty"`
+  // the policy of selecting the PF from host_devices: least-loaded, round-robin, or strict
+  PfSelection string `json:"pf_selection,omitempty"`
+  // offload features switched on, or off on the Pod side interface
+  PodOffloads *Offloads `json:"pod_offloads,omitempty"`
+  // offload features switched on, or off on the host interface of the network
+  HostOffloads *Offloads `json:"host_offloads,omitempty"`
+  // where the traffic between the Pods of the network on the same host is switched: on the host (local), or by the external switch (external)
+  IntraHostSwitching string `json:"intra_host_switching,omitempty"`
+  // keeps the allocation record in a DanmNetAllocation object with the same name instead of the alloc field, can only be set at creation
+  SeparateAllocation bool `json:"separate_allocation,omitempty"`
+  // routes installed with more than one gateway, e.g. ECMP default routes towards redundant routers
+  MultipathRoutes []MultipathRoute `json:"multipath_routes,omitempty"`
+  // when the cleaner of netwatcher reclaims the addresses of stale DanmEps: on Pod events, and periodically (event), only periodically (periodic), or never (manual)
+  GcPolicy string `json:"gc_policy,omitempty"`
+}
+
+// MultipathRoute is an IPv4, or IPv6 route spreading the traffic between more than one nexthop
+type MultipathRoute struct {
+  Destination string    `json:"destination"`
+  Nexthops    []Nexthop `json:"nexthops"`
+}
+
+// Nexthop is one gateway of a MultipathRoute, receiving a share of the flows proportional to its weight
+type Nexthop struct {
+  Gateway string `json:"gateway"`
+  // between 1 and 256, 1 if omitted
+  Weight  int    `json:"weight,omitempty"`
+}
+
+// Offloads are the ethtool offload features of an interface, omitted features are left untouched
+type Offloads struct {
+  Gro *bool `json:"gro,omitempty"`
+  Gso *bool `json:"gso,omitempty"`
+  Tso *bool `json:"tso,omitempty"`
+  Lro *bool `json:"lro,omitempty"`
 }
 
 type IP4Pool struct {
@@ -62,6 +117,15 @@ type IP4Pool struct {
   End   string `json:"end"`
 }
 
+// StaticAssignment pins an IP address to the Pods matching the selector, and scheduled to a specific node
+// Pinned addresses are given instead of a dynamically allocated one, so peers can whitelist the address of the instance per node
+type StaticAssignment struct {
+  Node string `json:"node"`
+  PodSelector map[string]string `json:"pod_selector,omitempty"`
+  Ip string `json:"ip,omitempty"`
+  Ip6 string `json:"ip6,omitempty"`
+}
+
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
 type DanmNetList struct {
   meta_v1.TypeMeta `json:",inline"`
@@ -87,6 +151,37 @@ type DanmEpSpec struct {
   CID         string      `json:"CID,omitempty"`
   Creator     string      `json:"Creator,omitempty"`
   Expires     string      `json:"Expires,omitempty"`
+  // Creating, Ready, or Deleting; DanmEps created by older releases have no phase, and are treated as Ready
+  Phase       string      `json:"Phase,omitempty"`
+  // attributes of the DanmNet needed to tear the interface down, even if the DanmNet is deleted before the Pod
+  Network     *DanmEpNetwork `json:"Network,omitempty"`
+  // the CNI backend which created the interface of a delegated network, so DEL can replay its exact configuration
+  Delegate    *DanmEpDelegate `json:"Delegate,omitempty"`
+}
+
+// DanmEpDelegate records how the CNI backend of a delegated network created the interface
+type DanmEpDelegate struct {
+  // name of the CNI plugin binary
+  Plugin         string   `json:"Plugin"`
+  // CNI specification version of the configuration passed to the plugin
+  CniVersion     string   `json:"CniVersion,omitempty"`
+  // CNI specification versions the plugin reported supporting to the CNI VERSION command, the release of the plugin is not reported by CNI
+  PluginVersions []string `json:"PluginVersions,omitempty"`
+  // the raw CNI configuration the plugin was invoked with
+  Config         string   `json:"Config,omitempty"`
+  // the raw CNI result returned by the plugin
+  Result         string   `json:"Result,omitempty"`
+}
+
+// DanmEpNetwork is the copy of the DanmNet attributes the interface of a DanmEp was created with
+type DanmEpNetwork struct {
+  Device string `json:"Device,omitempty"`
+  Prefix string `json:"Prefix,omitempty"`
+  Cidr   string `json:"Cidr,omitempty"`
+  Net6   string `json:"Net6,omitempty"`
+  Vlan   int    `json:"Vlan,omitempty"`
+  Vxlan  int    `json:"Vxlan,omitempty"`
+  Dpdk   bool   `json:"Dpdk,omitempty"`
 }
 
 type DanmEpIface struct {
@@ -96,6 +191,10 @@ type DanmEpIface struct {
   MacAddress  string            `json:"MacAddress"`
   Proutes     map[string]string `json:"proutes"`
   Proutes6    map[string]string `json:"proutes6"`
+  Mirror      string            `json:"Mirror,omitempty"`
+  Device      string            `json:"Device,omitempty"`
+  Offloads    *Offloads         `json:"Offloads,omitempty"`
+  HostOffloads *Offloads        `json:"HostOffloads,omitempty"`
 }
 
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
@@ -105,6 +204,139 @@ type DanmEpList struct {
   Items            []DanmEp `json:"items"`
 }
 
+// +genclient
+// +genclient:nonNamespaced
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+type DanmNetReport struct {
+  meta_v1.TypeMeta   `json:",inline"`
+  meta_v1.ObjectMeta `json:"metadata"`
+  Spec               DanmNetReportSpec `json:"spec"`
+}
+
+// DanmNetReportSpec contains the result of the last cluster-wide consistency check of all the DanmNets
+type DanmNetReportSpec struct {
+  GeneratedAt      string           `json:"GeneratedAt"`
+  NumberOfNetworks int              `json:"NumberOfNetworks"`
+  Findings         []NetworkFinding `json:"Findings,omitempty"`
+}
+
+// NetworkFinding describes one inconsistency between the configuration of one, or more DanmNets
+// Networks are identified by their namespace, and name in the "<namespace>/<name>" format
+type NetworkFinding struct {
+  Type     string   `json:"Type"`
+  Networks []string `json:"Networks"`
+  Detail   string   `json:"Detail"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+type DanmNetReportList struct {
+  meta_v1.TypeMeta `json:",inline"`
+  meta_v1.ListMeta `json:"metadata"`
+  Items            []DanmNetReport `json:"items"`
+}
+
+// +genclient
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+type DanmNetAllocation struct {
+  meta_v1.TypeMeta   `json:",inline"`
+  meta_v1.ObjectMeta `json:"metadata"`
+  Spec               DanmNetAllocationSpec `json:"spec"`
+}
+
+// DanmNetAllocationSpec is the allocation record of a DanmNet configured with separate_allocation
+// It has the same name, and namespace as its DanmNet
+type DanmNetAllocationSpec struct {
+  NetworkID string `json:"NetworkID"`
+  // bit array of tracking address allocation, in the same format as the alloc field of the DanmNet
+  Alloc     string `json:"Alloc"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+type DanmNetAllocationList struct {
+  meta_v1.TypeMeta `json:",inline"`
+  meta_v1.ListMeta `json:"metadata"`
+  Items            []DanmNetAllocation `json:"items"`
+}
+
+// +genclient
+// +genclient:nonNamespaced
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+type DanmNodeCapability struct {
+  meta_v1.TypeMeta   `json:",inline"`
+  meta_v1.ObjectMeta `json:"metadata"`
+  Spec               DanmNodeCapabilitySpec `json:"spec"`
+}
+
+// DanmNodeCapabilitySpec contains the networking capabilities of a node, as probed by its netwatcher at start-up
+// It has the same name as the node
+type DanmNodeCapabilitySpec struct {
+  ProbedAt      string          `json:"ProbedAt"`
+  KernelVersion string          `json:"KernelVersion"`
+  Features      NodeFeatures    `json:"Features"`
+  // path of the first container runtime socket found on the node, empty if none
+  RuntimeSocket string          `json:"RuntimeSocket,omitempty"`
+  Nics          []NicCapability `json:"Nics,omitempty"`
+}
+
+// NodeFeatures lists which kernel networking features are available on the node, either built-in, or as a loadable module
+type NodeFeatures struct {
+  Ipvlan     bool `json:"Ipvlan"`
+  // IPVLAN VEPA mode, i.e. intra_host_switching: external
+  IpvlanVepa bool `json:"IpvlanVepa"`
+  Vxlan      bool `json:"Vxlan"`
+  Sriov      bool `json:"Sriov"`
+  Netkit     bool `json:"Netkit"`
+}
+
+// NicCapability describes a physical NIC of the node
+type NicCapability struct {
+  Name     string `json:"Name"`
+  Driver   string `json:"Driver,omitempty"`
+  TotalVfs int    `json:"TotalVfs,omitempty"`
+  NumVfs   int    `json:"NumVfs,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+type DanmNodeCapabilityList struct {
+  meta_v1.TypeMeta `json:",inline"`
+  meta_v1.ListMeta `json:"metadata"`
+  Items            []DanmNodeCapability `json:"items"`
+}
+
+// +genclient
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+type DanmIPReservation struct {
+  meta_v1.TypeMeta   `json:",inline"`
+  meta_v1.ObjectMeta `json:"metadata"`
+  Spec               DanmIPReservationSpec `json:"spec"`
+}
+
+// DanmIPReservationSpec describes addresses carved out of the allocation pool of a DanmNet for consumers other than Pods
+// The DanmNet shall be in the same namespace as the reservation
+type DanmIPReservationSpec struct {
+  NetworkID   string `json:"NetworkID"`
+  // requested IPv4 address in CIDR format, or "dynamic"
+  Ip          string `json:"Ip,omitempty"`
+  // requested IPv6 address in CIDR format, or "dynamic"
+  Ip6         string `json:"Ip6,omitempty"`
+  // free text identifying the external system using the addresses
+  Consumer    string `json:"Consumer,omitempty"`
+  // Pending, Reserved, or Failed; set by netwatcher
+  State       string `json:"State,omitempty"`
+  // RFC3339 time of the last claim; a reservation left Pending longer than the claim timeout is claimed again
+  ClaimTime   string `json:"ClaimTime,omitempty"`
+  Address     string `json:"Address,omitempty"`
+  AddressIPv6 string `json:"AddressIPv6,omitempty"`
+  Message     string `json:"Message,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+type DanmIPReservationList struct {
+  meta_v1.TypeMeta `json:",inline"`
+  meta_v1.ListMeta `json:"metadata"`
+  Items            []DanmIPReservation `json:"items"`
+}
+
 // Interface represents a request coming from the Pod to connect it to one DanmNet during CNI_ADD operation
 // It contains the name of the DanmNet the Pod should be connected to, and other optional requests
 // Pods can influence the scheme of IP allocation (dynamic, static, none),
@@ -115,6 +347,8 @@ type Interface struct {
   Ip6 string `json:"ip6"`
   Proutes map[string]string `json:"proutes"`
   Proutes6 map[string]string `json:"proutes6"`
+  // Name of the host interface all the traffic of this interface is mirrored to
+  Mirror string `json:"mirror,omitempty"`
 }
 
 type IpamConfig struct {
@@ -0,0 +1,78 @@
+package v1
+
+import (
+	danmv1 "github.com/nokia/danm/pkg/crd/apis/danm/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/tools/cache"
+)
+
+// Names of the indexes DanmEp informers can be extended with
+const (
+	DanmEpHostIndex = "host"
+	DanmEpCIDIndex  = "cid"
+)
+
+// DanmEpIndexers shall be added to DanmEp informers before they are started, so the expansion methods do not need to scan the whole cache
+var DanmEpIndexers = cache.Indexers{
+	DanmEpHostIndex: DanmEpHostIndexFunc,
+	DanmEpCIDIndex:  DanmEpCIDIndexFunc,
+}
+
+// DanmEpHostIndexFunc indexes DanmEps by the name of the host their Pod is running on
+func DanmEpHostIndexFunc(obj interface{}) ([]string, error) {
+	ep, ok := obj.(*danmv1.DanmEp)
+	if !ok || ep.Spec.Host == "" {
+		return []string{}, nil
+	}
+	return []string{ep.Spec.Host}, nil
+}
+
+// DanmEpCIDIndexFunc indexes DanmEps by the ID of the infra container of their Pod
+func DanmEpCIDIndexFunc(obj interface{}) ([]string, error) {
+	ep, ok := obj.(*danmv1.DanmEp)
+	if !ok || ep.Spec.CID == "" {
+		return []string{}, nil
+	}
+	return []string{ep.Spec.CID}, nil
+}
+
+// DanmEpListerExpansion allows custom methods to be added to
+// DanmEpLister.
+type DanmEpListerExpansion interface {
+	// ByHost lists the DanmEps of all namespaces belonging to Pods running on the given host.
+	ByHost(host string) ([]*danmv1.DanmEp, error)
+	// ByCID lists the DanmEps of all namespaces belonging to the Pod of the given infra container.
+	ByCID(cid string) ([]*danmv1.DanmEp, error)
+}
+
+// DanmEpNamespaceListerExpansion allows custom methods to be added to
+// DanmEpNamespaceLister.
+type DanmEpNamespaceListerExpansion interface{}
+
+func (s *danmEpLister) ByHost(host string) ([]*danmv1.DanmEp, error) {
+	return s.byIndex(DanmEpHostIndex, host, DanmEpHostIndexFunc)
+}
+
+func (s *danmEpLister) ByCID(cid string) ([]*danmv1.DanmEp, error) {
+	return s.byIndex(DanmEpCIDIndex, cid, DanmEpCIDIndexFunc)
+}
+
+// byIndex falls back to filtering the whole cache when the informer was not extended with DanmEpIndexers
+func (s *danmEpLister) byIndex(indexName, value string, indexFunc cache.IndexFunc) (ret []*danmv1.DanmEp, err error) {
+	if _, ok := s.indexer.GetIndexers()[indexName]; !ok {
+		err = cache.ListAll(s.indexer, labels.Everything(), func(m interface{}) {
+			if keys, _ := indexFunc(m); len(keys) > 0 && keys[0] == value {
+				ret = append(ret, m.(*danmv1.DanmEp))
+			}
+		})
+		return ret, err
+	}
+	objs, err := s.indexer.ByIndex(indexName, value)
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range objs {
+		ret = append(ret, m.(*danmv1.DanmEp))
+	}
+	return ret, nil
+}
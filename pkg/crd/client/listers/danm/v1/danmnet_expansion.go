@@ -0,0 +1,70 @@
+package v1
+
+import (
+	danmv1 "github.com/nokia/danm/pkg/crd/apis/danm/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/tools/cache"
+)
+
+// DanmNetDeviceIndex is the name of the index DanmNet informers can be extended with
+const DanmNetDeviceIndex = "device"
+
+// DanmNetIndexers shall be added to DanmNet informers before they are started, so the expansion methods do not need to scan the whole cache
+var DanmNetIndexers = cache.Indexers{
+	DanmNetDeviceIndex: DanmNetDeviceIndexFunc,
+}
+
+// DanmNetDeviceIndexFunc indexes DanmNets by all the host devices they use: the host_device, and the members of host_devices
+func DanmNetDeviceIndexFunc(obj interface{}) ([]string, error) {
+	dnet, ok := obj.(*danmv1.DanmNet)
+	if !ok {
+		return []string{}, nil
+	}
+	devices := []string{}
+	for _, device := range append([]string{dnet.Spec.Options.Device}, dnet.Spec.Options.HostDevices...) {
+		if device != "" && !isIndexed(devices, device) {
+			devices = append(devices, device)
+		}
+	}
+	return devices, nil
+}
+
+func isIndexed(devices []string, device string) bool {
+	for _, indexed := range devices {
+		if indexed == device {
+			return true
+		}
+	}
+	return false
+}
+
+// DanmNetListerExpansion allows custom methods to be added to
+// DanmNetLister.
+type DanmNetListerExpansion interface {
+	// ByDevice lists the DanmNets of all namespaces using the given host device.
+	ByDevice(device string) ([]*danmv1.DanmNet, error)
+}
+
+// DanmNetNamespaceListerExpansion allows custom methods to be added to
+// DanmNetNamespaceLister.
+type DanmNetNamespaceListerExpansion interface{}
+
+// ByDevice falls back to filtering the whole cache when the informer was not extended with DanmNetIndexers
+func (s *danmNetLister) ByDevice(device string) (ret []*danmv1.DanmNet, err error) {
+	if _, ok := s.indexer.GetIndexers()[DanmNetDeviceIndex]; !ok {
+		err = cache.ListAll(s.indexer, labels.Everything(), func(m interface{}) {
+			if devices, _ := DanmNetDeviceIndexFunc(m); isIndexed(devices, device) {
+				ret = append(ret, m.(*danmv1.DanmNet))
+			}
+		})
+		return ret, err
+	}
+	objs, err := s.indexer.ByIndex(DanmNetDeviceIndex, device)
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range objs {
+		ret = append(ret, m.(*danmv1.DanmNet))
+	}
+	return ret, nil
+}
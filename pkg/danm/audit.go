@@ -0,0 +1,25 @@
+package main
+
+import (
+  "log"
+  corev1 "k8s.io/api/core/v1"
+  danmtypes "github.com/nokia/danm/pkg/crd/apis/danm/v1"
+  "github.com/nokia/danm/pkg/ipam"
+)
+
+// setupIpamAudit registers the audit trail of the reservations from DanmNets
+func setupIpamAudit(args *cniArgs) {
+  confArgs, err := loadNetConf(args.stdIn)
+  if err != nil {
+    return
+  }
+  ipam.SetAuditFunc(func(netInfo *danmtypes.DanmNet, decision ipam.Decision) {
+    k8sClient, err := createK8sClient(confArgs.Kubeconfig)
+    if err != nil {
+      log.Println("ERROR: IPAM audit event of network:" + netInfo.Spec.NetworkID + " cannot be recorded because:" + err.Error())
+      return
+    }
+    network := corev1.ObjectReference{Kind: "DanmNet", APIVersion: danmtypes.SchemeGroupVersion.String(), Namespace: netInfo.ObjectMeta.Namespace, Name: netInfo.ObjectMeta.Name, UID: netInfo.ObjectMeta.UID}
+    recordEvent(k8sClient, network, corev1.EventTypeNormal, "DanmIPReserved", "Pod:" + args.podId + " " + decision.String())
+  })
+}
@@ -7,28 +7,40 @@ import (
   "net"
   "os"
   "strings"
+  "time"
   "encoding/json"
   "github.com/satori/go.uuid"
   "github.com/containernetworking/cni/pkg/skel"
   "github.com/containernetworking/cni/pkg/types"
   "github.com/containernetworking/cni/pkg/version"
   "github.com/containernetworking/cni/pkg/types/current"
+  corev1 "k8s.io/api/core/v1"
+  apierrors "k8s.io/apimachinery/pkg/api/errors"
   meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
   "k8s.io/client-go/rest"
   "k8s.io/client-go/tools/clientcmd"
   "k8s.io/client-go/kubernetes"
   danmtypes "github.com/nokia/danm/pkg/crd/apis/danm/v1"
   danmclientset "github.com/nokia/danm/pkg/crd/client/clientset/versioned"
+  "github.com/nokia/danm/pkg/apiretry"
+  "github.com/nokia/danm/pkg/bootbarrier"
+  "github.com/nokia/danm/pkg/compat"
   "github.com/nokia/danm/pkg/danmep"
+  "github.com/nokia/danm/pkg/danmnet"
   "github.com/nokia/danm/pkg/ipam"
+  "github.com/nokia/danm/pkg/nodecap"
   "github.com/nokia/danm/pkg/cnidel"
+  "github.com/nokia/danm/pkg/spool"
+  "github.com/nokia/danm/pkg/cnilog"
   "github.com/nokia/danm/pkg/syncher"
+  "github.com/nokia/danm/pkg/netspec"
 )
 
 var (
   apiHost = os.Getenv("API_SERVERS")
   danmApiPath = "danm.k8s.io"
   danmIfDefinitionSyntax = danmApiPath + "/interfaces"
+  danmDefaultIfDefinitionSyntax = danmApiPath + "/default-interfaces"
   v1Endpoint = "/api/v1/"
   cniVersion = "0.3.1"
   kubeConf string
@@ -37,6 +49,15 @@ var (
 type NetConf struct {
   types.NetConf
   Kubeconfig string `json:"kubeconfig"`
+  // LogLevel is one of "error", "info" (default), or "debug". The "debug" level also logs every IPAM decision
+  LogLevel string `json:"log_level,omitempty"`
+  Log cnilog.Config `json:"log,omitempty"`
+  // AsyncCleanup only tears the interfaces down during DEL, and hands freeing the addresses, and deleting the DanmEps over to netwatcher
+  AsyncCleanup bool `json:"async_cleanup,omitempty"`
+  // PrimaryIpFamily is the address family listed first in the result, i.e. reported as the IP of the Pod: "ipv4" (default), or "ipv6"
+  PrimaryIpFamily string `json:"primary_ip_family,omitempty"`
+  // BootBarrierTimeout is the maximum number of seconds ADD waits for netwatcher to clean up the DanmEps of the previous boot of the host. ADD does not wait if 0
+  BootBarrierTimeout int `json:"boot_barrier_timeout,omitempty"`
 }
 
 // K8sArgs is the valid CNI_ARGS type used to parse K8s CNI event calls (thanks Multus)
@@ -56,24 +77,34 @@ type cniArgs struct {
   labels map[string]string
   stdIn []byte
   interfaces []danmtypes.Interface
+  pod *corev1.Pod
+  // defaultInterfaces are the interfaces defined by the namespace for Pods without their own definition
+  defaultInterfaces string
 }
 
 func createInterfaces(args *skel.CmdArgs) error {
+  setupLogging(args.StdinData)
   cniArgs,err := extractCniArgs(args)
   if err != nil {
     log.Println("ERROR: ADD: CNI args cannot be loaded with error:" + err.Error())
     return fmt.Errorf("CNI args cannot be loaded with error: %v", err)
   }
   log.Println("CNI ADD invoked with: ns:" + cniArgs.nameSpace + " PID:" + cniArgs.podId + " CID: " + cniArgs.containerId)
+  setupIpamAudit(cniArgs)
   if err = fillAnnotationsAndLabels(cniArgs); err != nil {
     log.Println("ERROR: ADD: Annotation could not be parsed with error:" + err.Error())
     return fmt.Errorf("Annotation could not be parsed with error: %v", err)
   }
-  extractConnections(cniArgs)
+  err = extractConnections(cniArgs)
+  if err != nil {
+    log.Println("ERROR: ADD: Network interfaces of the Pod could not be determined with error:" + err.Error())
+    return fmt.Errorf("Network interfaces of the Pod could not be determined with error: %v", err)
+  }
   if len(cniArgs.interfaces) == 0 {
     log.Println("INFO: ADD: No networks in manifest of Pod:" + cniArgs.podId + "Danm invocation is skipped")
     return types.PrintResult(&current.Result{}, cniVersion)
   }
+  waitForBootBarrier(args.StdinData)
   cniResult, err := setupNetworking(cniArgs)
   if err != nil {
     //Best effort cleanup - not interested in possible errors, anyway could not do anything with them
@@ -85,6 +116,19 @@ func createInterfaces(args *skel.CmdArgs) error {
   return types.PrintResult(cniResult, cniVersion)
 }
 
+// waitForBootBarrier delays the ADD until the DanmEps left behind by the previous boot of the host are cleaned up, so the new Pod never collides with their addresses
+// The ADD goes on after the timeout regardless, so a netwatcher not running on the host never blocks the Pods for good
+func waitForBootBarrier(stdIn []byte) {
+  confArgs, err := loadNetConf(stdIn)
+  if err != nil || confArgs.BootBarrierTimeout <= 0 {
+    return
+  }
+  err = bootbarrier.Wait(bootbarrier.DefaultPath, time.Duration(confArgs.BootBarrierTimeout) * time.Second)
+  if err != nil {
+    log.Println("INFO: ADD: going on without waiting for the cleanup of the previous boot of the host because:" + err.Error())
+  }
+}
+
 func createDanmClient(stdIn []byte) (danmclientset.Interface,error) {
   config, err := getClientConfig(stdIn)
   if err != nil {
@@ -110,6 +154,20 @@ func getClientConfig(stdIn []byte) (*rest.Config, error){
   return config, nil
 }
 
+// setupLogging directs the log of the invocation to the destination configured in the NetConf
+// The default log file is used if the NetConf cannot be parsed, its parsing error is logged later by the invoked operation
+func setupLogging(stdIn []byte) {
+  confArgs, err := loadNetConf(stdIn)
+  if err != nil {
+    confArgs = &NetConf{}
+  }
+  err = cnilog.Setup(confArgs.Log, confArgs.LogLevel)
+  if err != nil {
+    log.Println("ERROR: Log destination cannot be set up because:" + err.Error())
+  }
+  ipam.SetDebugLogging(confArgs.LogLevel == cnilog.LevelDebug)
+}
+
 func loadNetConf(bytes []byte) (*NetConf, error) {
   netconf := &NetConf{}
   err := json.Unmarshal(bytes, netconf)
@@ -132,6 +190,8 @@ func extractCniArgs(args *skel.CmdArgs) (*cniArgs,error) {
                      nil,
                      args.StdinData,
                      nil,
+                     nil,
+                     "",
                     }
   return &cmdArgs, nil
 }
@@ -145,15 +205,44 @@ func fillAnnotationsAndLabels(args *cniArgs) error {
   if err != nil {
     return errors.New("cannot create kube client due to error:" + err.Error())
   }
-  pod, err := k8sClient.CoreV1().Pods(string(args.nameSpace)).Get(string(args.podId), meta_v1.GetOptions{})
+  var pod *corev1.Pod
+  err = apiretry.Do(apiretry.DefaultBackoff, func() error {
+    var getErr error
+    pod, getErr = k8sClient.CoreV1().Pods(string(args.nameSpace)).Get(string(args.podId), meta_v1.GetOptions{})
+    return getErr
+  })
   if err != nil {
     return errors.New("failed to get pod info from API server due to:" + err.Error())
   }
   args.annotation = pod.Annotations
   args.labels = pod.Labels
+  args.pod = pod
+  if _, ok := getIfDefinition(pod.Annotations); ok {
+    return nil
+  }
+  var namespace *corev1.Namespace
+  err = apiretry.Do(apiretry.DefaultBackoff, func() error {
+    var getErr error
+    namespace, getErr = k8sClient.CoreV1().Namespaces().Get(args.nameSpace, meta_v1.GetOptions{})
+    return getErr
+  })
+  if err != nil {
+    return errors.New("failed to get namespace info from API server due to:" + err.Error())
+  }
+  args.defaultInterfaces = namespace.Annotations[danmDefaultIfDefinitionSyntax]
   return nil
 }
 
+// getIfDefinition returns the interface definition of the Pod annotations, if there is one
+func getIfDefinition(annotations map[string]string) (string,bool) {
+  for key, val := range annotations {
+    if strings.Contains(key, danmIfDefinitionSyntax) {
+      return val, true
+    }
+  }
+  return "", false
+}
+
 func createK8sClient(kubeconfig string) (kubernetes.Interface, error) {
   config, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
   if err != nil {
@@ -162,15 +251,19 @@ func createK8sClient(kubeconfig string) (kubernetes.Interface, error) {
  return kubernetes.NewForConfig(config)
 }
 
+// extractConnections parses the interfaces of the Pod annotation
+// Pods without their own definition get the default interfaces of their namespace, while an explicit empty list opts out of the defaults
 func extractConnections(args *cniArgs) error {
   var ifaces []danmtypes.Interface
-  for key, val := range args.annotation {
-    if strings.Contains(key, danmIfDefinitionSyntax) {
-      err := json.Unmarshal([]byte(val), &ifaces)
-      if err != nil {
-        return errors.New("Can't create network interfaces for Pod: " + args.podId + " due to badly formatted " + danmIfDefinitionSyntax + " definition in Pod annotation")
-      }
-      break
+  if val, ok := getIfDefinition(args.annotation); ok {
+    err := json.Unmarshal([]byte(val), &ifaces)
+    if err != nil {
+      return errors.New("Can't create network interfaces for Pod: " + args.podId + " due to badly formatted " + danmIfDefinitionSyntax + " definition in Pod annotation")
+    }
+  } else if args.defaultInterfaces != "" {
+    err := json.Unmarshal([]byte(args.defaultInterfaces), &ifaces)
+    if err != nil {
+      return errors.New("Can't create network interfaces for Pod: " + args.podId + " due to badly formatted " + danmDefaultIfDefinitionSyntax + " definition in the annotation of Namespace: " + args.nameSpace + ":" + err.Error())
     }
   }
   args.interfaces = ifaces
@@ -183,7 +276,16 @@ func setupNetworking(args *cniArgs) (*current.Result, error) {
     go createInterface(syncher, val, args)
   }
   err := syncher.GetAggregatedResult()
-  return syncher.MergeCniResults(), err
+  var networks []string
+  for _, iface := range args.interfaces {
+    networks = append(networks, iface.Network)
+  }
+  isIpv6Primary := false
+  confArgs, confErr := loadNetConf(args.stdIn)
+  if confErr == nil {
+    isIpv6Primary = confArgs.PrimaryIpFamily == "ipv6"
+  }
+  return syncher.MergeCniResults(networks, isIpv6Primary), err
 }
 
 func createInterface(syncher *syncher.Syncher, iface danmtypes.Interface, args *cniArgs) {
@@ -197,6 +299,21 @@ func createInterface(syncher *syncher.Syncher, iface danmtypes.Interface, args *
     syncher.PushResult(iface.Network, err, nil)
     return
   }
+  err = compat.CheckCniRevision(netInfo)
+  if err != nil {
+    syncher.PushResult(iface.Network, err, nil)
+    return
+  }
+  host, err := os.Hostname()
+  if err != nil {
+    syncher.PushResult(iface.Network, err, nil)
+    return
+  }
+  err = nodecap.Validate(danmClient, host, netInfo)
+  if err != nil {
+    syncher.PushResult(iface.Network, err, nil)
+    return
+  }
   var cniRes *current.Result
   if isDelegationRequired {
     cniRes, err = createDelegatedInterface(danmClient, iface, netInfo, args)
@@ -215,19 +332,31 @@ func createInterface(syncher *syncher.Syncher, iface danmtypes.Interface, args *
 }
 
 func createDelegatedInterface(danmClient danmclientset.Interface, iface danmtypes.Interface, netInfo *danmtypes.DanmNet, args *cniArgs) (*current.Result,error) {
-  delegateResult,err := cnidel.DelegateInterfaceSetup(danmClient, netInfo, iface)
+  netInfo, err := cnidel.SelectPhysicalFunction(netInfo)
+  if err != nil {
+    return nil, err
+  }
+  delegateResult,delegateRecord,err := cnidel.DelegateInterfaceSetup(danmClient, netInfo, iface)
   if err != nil {
     return nil, err
   }
   delegatedResult := cnidel.ConvertCniResult(delegateResult)
   epIfaceSpec := danmtypes.DanmEpIface{}
+  if len(netInfo.Spec.Options.HostDevices) > 0 {
+    //The VF has to be given back to the same PF it was taken from
+    epIfaceSpec.Device = netInfo.Spec.Options.Device
+  }
   if delegatedResult != nil {
     setEpIfaceAddress(delegatedResult, &epIfaceSpec)
+    setDelegatedOffloads(netInfo, delegatedResult, &epIfaceSpec)
   }
-  ep, err := createDanmEp(epIfaceSpec, netInfo.Spec.NetworkID, netInfo.Spec.NetworkType, args)
+  ep, err := createDanmEp(epIfaceSpec, netInfo, netInfo.Spec.NetworkType, args)
   if err != nil {
     return nil, errors.New("DanmEp object could not be created due to error:" + err.Error())
   }
+  //The delegated interface is already wired when its DanmEp is created
+  ep.Spec.Phase = danmep.PhaseReady
+  ep.Spec.Delegate = delegateRecord
   err = putDanmEp(args, ep)
   if err != nil {
     return nil, errors.New("DanmEp object could not be PUT to K8s due to error:" + err.Error())
@@ -235,19 +364,66 @@ func createDelegatedInterface(danmClient danmclientset.Interface, iface danmtype
   return delegatedResult, nil
 }
 
+// setEpIfaceAddress records the first IPv4, and the first IPv6 address allocated by the delegated CNI backend
+// Interfaces without any address (e.g. L2 SRIOV VFs), and IPv6-only interfaces are also supported
 func setEpIfaceAddress(cniResult *current.Result, epIface *danmtypes.DanmEpIface) error {
-  // TODO: This only works for CNI backends which allocate one IP address per Pod
-  if cniResult.IPs[0].Version == "4" {
-    epIface.Address = cniResult.IPs[0].Address.String()
-  } else {
-    epIface.AddressIPv6 = cniResult.IPs[0].Address.String()
+  for _, ipConf := range cniResult.IPs {
+    if ipConf.Version == "4" && epIface.Address == "" {
+      epIface.Address = ipConf.Address.String()
+    } else if ipConf.Version == "6" && epIface.AddressIPv6 == "" {
+      epIface.AddressIPv6 = ipConf.Address.String()
+    }
   }
   return nil
 }
 
+// setDelegatedOffloads switches the offload features of the Pod side interface, and of the host interface of the network created by the CNI backend
+// The delegated interface is kept even if an offload cannot be set, only the offloads actually applied are recorded in the DanmEp
+func setDelegatedOffloads(netInfo *danmtypes.DanmNet, cniResult *current.Result, epIface *danmtypes.DanmEpIface) {
+  opts := netInfo.Spec.Options
+  if opts.HostOffloads != nil {
+    err := danmep.SetOffloads(danmep.GetHostInterface(netInfo), opts.HostOffloads)
+    if err != nil {
+      log.Println("ERROR: ADD: host offloads of network:" + netInfo.Spec.NetworkID + " cannot be set because:" + err.Error())
+    } else {
+      epIface.HostOffloads = opts.HostOffloads
+    }
+  }
+  if opts.PodOffloads == nil {
+    return
+  }
+  for _, iface := range cniResult.Interfaces {
+    if iface.Sandbox == "" {
+      continue
+    }
+    err := danmep.SetOffloadsInNs(iface.Sandbox, iface.Name, opts.PodOffloads)
+    if err != nil {
+      log.Println("ERROR: ADD: offloads of interface:" + iface.Name + " cannot be set because:" + err.Error())
+      return
+    }
+    epIface.Offloads = opts.PodOffloads
+    return
+  }
+}
+
 func createDanmInterface(danmClient danmclientset.Interface, iface danmtypes.Interface, netInfo *danmtypes.DanmNet, args *cniArgs) (*current.Result,error) {
   netId := netInfo.Spec.NetworkID
-  ip4, ip6, macAddr, err := ipam.Reserve(danmClient, *netInfo, iface.Ip, iface.Ip6)
+  host, err := os.Hostname()
+  if err != nil {
+    return nil, errors.New("OS.Hostname returned error during IP address reservation:" + err.Error())
+  }
+  err = danmnet.ValidateRoutes(iface.Proutes, false)
+  if err == nil {
+    err = danmnet.ValidateRoutes(iface.Proutes6, true)
+  }
+  if err != nil {
+    return nil, errors.New("invalid policy-based route requested for network:" + netId + ":" + err.Error())
+  }
+  req4, req6 := ipam.ApplyStaticAssignment(*netInfo, host, args.labels, iface.Ip, iface.Ip6)
+  ip4, ip6, macAddr, err := ipam.Reserve(danmClient, *netInfo, req4, req6)
+  if ipam.IsPoolExhausted(err) && netInfo.Spec.Options.Preemption {
+    ip4, ip6, macAddr, err = reserveWithPreemption(danmClient, netInfo, req4, req6, args)
+  }
   if err != nil {
     return nil, errors.New("IP address reservation failed for network:" + netId + " with error:" + err.Error())
   }
@@ -258,13 +434,19 @@ func createDanmInterface(danmClient danmclientset.Interface, iface danmtypes.Int
     MacAddress: macAddr,
     Proutes: iface.Proutes,
     Proutes6: iface.Proutes6,
+    Mirror: iface.Mirror,
+    //The offloads are applied during interface creation, which fails if any of them cannot be set
+    Offloads: netInfo.Spec.Options.PodOffloads,
+    HostOffloads: netInfo.Spec.Options.HostOffloads,
   }
-  networkType := "ipvlan"
-  ep, err := createDanmEp(epSpec, netId, networkType, args)
+  networkType := netspec.TypeIpvlan
+  ep, err := createDanmEp(epSpec, netInfo, networkType, args)
   if err != nil {
     ipam.GarbageCollectIps(danmClient, netInfo, ip4, ip6)
     return nil, errors.New("DanmEp object could not be created due to error:" + err.Error())
   }
+  //The phase lets netwatcher repair the DanmEp if the CNI is interrupted before the interface is wired
+  ep.Spec.Phase = danmep.PhaseCreating
   err = putDanmEp(args, ep)
   if err != nil {
     ipam.GarbageCollectIps(danmClient, netInfo, ip4, ip6)
@@ -276,6 +458,10 @@ func createDanmInterface(danmClient danmclientset.Interface, iface danmtypes.Int
     deleteEp(danmClient, ep)
     return nil, errors.New("IPVLAN interface could not be created due to error:" + err.Error())
   } 
+  err = danmep.SetPhase(danmClient, ep, danmep.PhaseReady)
+  if err != nil {
+    log.Println("ERROR: ADD: DanmEp:" + ep.ObjectMeta.Name + " cannot be marked ready, it is left for netwatcher to repair. Error:" + err.Error())
+  }
   danmResult := &current.Result{}
   addIfaceToResult(ep.Spec.EndpointID, epSpec.MacAddress, args.containerId, danmResult)
   if (ip4 != "") {
@@ -287,7 +473,7 @@ func createDanmInterface(danmClient danmclientset.Interface, iface danmtypes.Int
   return danmResult, nil
 }
 
-func createDanmEp(epInput danmtypes.DanmEpIface, netId string, neType string, args *cniArgs) (danmtypes.DanmEp, error) {
+func createDanmEp(epInput danmtypes.DanmEpIface, netInfo *danmtypes.DanmNet, neType string, args *cniArgs) (danmtypes.DanmEp, error) {
   epidInt, err := uuid.NewV4()
   if err != nil {
     return danmtypes.DanmEp{}, errors.New("uuid.NewV4 returned error during EP creation:" + err.Error())
@@ -298,7 +484,7 @@ func createDanmEp(epInput danmtypes.DanmEpIface, netId string, neType string, ar
     return danmtypes.DanmEp{}, errors.New("OS.Hostname returned error during EP creation:" + err.Error())
   }
   epSpec := danmtypes.DanmEpSpec {
-    NetworkID: netId,
+    NetworkID: netInfo.Spec.NetworkID,
     NetworkType: neType,
     EndpointID: epid,
     Iface: epInput,
@@ -306,6 +492,7 @@ func createDanmEp(epInput danmtypes.DanmEpIface, netId string, neType string, ar
     Pod: args.podId,
     CID: args.containerId,
     Creator: "danm",
+    Network: danmep.NewNetworkCache(netInfo),
   }
   meta := meta_v1.ObjectMeta {
     Name: epid,
@@ -330,11 +517,16 @@ func putDanmEp(args *cniArgs, ep danmtypes.DanmEp) error {
   if err != nil {
     return err
   }
-  _, err = danmClient.DanmV1().DanmEps(ep.Namespace).Create(&ep)
-  if err != nil {
-    return err
-  }
-  return nil
+  isRetry := false
+  return apiretry.Do(apiretry.DefaultBackoff, func() error {
+    _, createErr := danmClient.DanmV1().DanmEps(ep.Namespace).Create(&ep)
+    //EndpointIDs are unique, so an already existing object means a previous, seemingly failed attempt actually succeeded
+    if isRetry && apierrors.IsAlreadyExists(createErr) {
+      return nil
+    }
+    isRetry = true
+    return createErr
+  })
 }
 
 func addIfaceToResult(epid string, macAddress string, sandBox string, cniResult *current.Result) {
@@ -358,6 +550,7 @@ func addIpToResult(ip string, version string, cniResult *current.Result) {
 }
 
 func deleteInterfaces(args *skel.CmdArgs) error {
+  setupLogging(args.StdinData)
   cniArgs,err := extractCniArgs(args)
   log.Println("CNI DEL invoked with: ns:" + cniArgs.nameSpace + " PID:" + cniArgs.podId + " CID: " + cniArgs.containerId)
   if err != nil {
@@ -392,24 +585,47 @@ func deleteInterface(args *cniArgs, syncher *syncher.Syncher, ep danmtypes.DanmE
     return
   }
   netInfo, err := danmClient.DanmV1().DanmNets(args.nameSpace).Get(ep.Spec.NetworkID, meta_v1.GetOptions{})
+  if apierrors.IsNotFound(err) {
+    syncher.PushResult(ep.Spec.NetworkID, deleteOrphanedInterface(danmClient, args, ep), nil)
+    return
+  }
   if err != nil {
     syncher.PushResult(ep.Spec.NetworkID, errors.New("failed to get DanmNet:"+ err.Error()), nil)
     return
   }
+  confArgs, err := loadNetConf(args.stdIn)
+  if err == nil && confArgs.AsyncCleanup {
+    err = teardownNic(netInfo, ep)
+    if err == nil {
+      syncher.PushResult(ep.Spec.NetworkID, nil, nil)
+      return
+    }
+    log.Println("INFO: DEL: asynchronous cleanup of DanmEp:" + ep.ObjectMeta.Name + " is not possible, falling back to synchronous cleanup because:" + err.Error())
+  }
   var aggregatedError string
-  err = deleteNic(danmClient, netInfo, ep)
+  err = deleteNicInterface(netInfo, ep)
   //It can happen that a container was already destroyed at this point in this fully asynch world
   //So we are not interested in errors, but we also can't just return yet, we need to try and clean-up remaining resources, if, any
   if err != nil {
     aggregatedError += "failed to delete container NIC:" + err.Error() + "; "
   }
-  err = ipam.Free(danmClient, *netInfo, ep.Spec.Iface.Address)
-  if err != nil {
-    aggregatedError += "failed to delete container NIC:" + err.Error() + "; "
-  }
-  err = deleteEp(danmClient, ep)
-  if err != nil {
-    aggregatedError += "failed to delete DanmEp:" + err.Error() + "; "
+  teardownErr := confirmTeardown(netInfo, ep)
+  if teardownErr != nil {
+    aggregatedError += "removal of container NIC cannot be confirmed:" + teardownErr.Error() + "; "
+    //The DanmEp, and its address are kept, so netwatcher can finish the teardown, and free the address once the interface is really gone
+    err = danmep.SetPhase(danmClient, ep, danmep.PhaseDeleting)
+    if err != nil {
+      aggregatedError += "failed to hand DanmEp over to the repair controller:" + err.Error() + "; "
+    }
+  } else {
+    err = ipam.Free(danmClient, *netInfo, ep.Spec.Iface.Address)
+    if err != nil {
+      aggregatedError += "failed to free the address of container NIC:" + err.Error() + "; "
+    }
+    err = deleteEp(danmClient, ep)
+    if err != nil {
+      aggregatedError += "failed to delete DanmEp:" + err.Error() + "; "
+    }
   }
   if aggregatedError != "" {
     syncher.PushResult(ep.Spec.NetworkID, errors.New(aggregatedError), nil)
@@ -418,14 +634,57 @@ func deleteInterface(args *cniArgs, syncher *syncher.Syncher, ep danmtypes.DanmE
   }
 }
 
-func deleteNic(danmClient danmclientset.Interface, netInfo *danmtypes.DanmNet, ep danmtypes.DanmEp) error {
+// teardownNic deletes the interface of the DanmEp, then spools the DanmEp for netwatcher to free its address, and delete it
+// Nothing is spooled if the interface cannot be deleted, so the synchronous path can still retry everything
+func teardownNic(netInfo *danmtypes.DanmNet, ep danmtypes.DanmEp) error {
+  err := deleteNicInterface(netInfo, ep)
+  if err != nil {
+    return err
+  }
+  err = danmep.VerifyTeardown(ep)
+  if err != nil {
+    return errors.New("removal of the interface cannot be confirmed:" + err.Error())
+  }
+  return spool.Push(spool.DefaultDir, ep)
+}
+
+// confirmTeardown verifies that the interface of the DanmEp is really gone, and retries its deletion once if it is not
+func confirmTeardown(netInfo *danmtypes.DanmNet, ep danmtypes.DanmEp) error {
+  err := danmep.VerifyTeardown(ep)
+  if err == nil {
+    return nil
+  }
+  log.Println("INFO: DEL: interface of DanmEp:" + ep.ObjectMeta.Name + " survived the deletion, retrying because:" + err.Error())
+  err = deleteNicInterface(netInfo, ep)
+  if err != nil {
+    return err
+  }
+  return danmep.VerifyTeardown(ep)
+}
+
+// deleteNicInterface deletes the interface of the DanmEp, without touching its addresses
+func deleteNicInterface(netInfo *danmtypes.DanmNet, ep danmtypes.DanmEp) error {
   var err error
-  if ep.Spec.NetworkType != "ipvlan" {
-    err = cnidel.DelegateInterfaceDelete(danmClient, netInfo, ep.Spec.Iface.Address)
+  netInfo = getCreatorNetwork(netInfo, ep)
+  if !netspec.IsIpvlanEp(&ep) {
+    err = cnidel.DelegateInterfaceTeardown(netInfo, ep.Spec.Delegate, ep.Spec.Iface.Address)
   } else {
-    err = deleteDanmNet(danmClient, ep, netInfo)
+    err = danmep.DeleteIpvlanInterface(netInfo, ep)
+  }
+  if err != nil {
+    return errors.New("interface cannot be deleted:" + err.Error())
   }
-  return err
+  return nil
+}
+
+// getCreatorNetwork returns the network with the host device the interface of the DanmEp was created from
+func getCreatorNetwork(netInfo *danmtypes.DanmNet, ep danmtypes.DanmEp) *danmtypes.DanmNet {
+  if ep.Spec.Iface.Device == "" {
+    return netInfo
+  }
+  creator := *netInfo
+  creator.Spec.Options.Device = ep.Spec.Iface.Device
+  return &creator
 }
 
 func deleteEp(danmClient danmclientset.Interface, ep danmtypes.DanmEp) error {
@@ -437,20 +696,6 @@ func deleteEp(danmClient danmclientset.Interface, ep danmtypes.DanmEp) error {
   return nil
 }
 
-func deleteDanmNet(danmClient danmclientset.Interface, ep danmtypes.DanmEp, netInfo *danmtypes.DanmNet) error {
-  err := ipam.Free(danmClient, *netInfo, ep.Spec.Iface.Address)
-  if err != nil {
-    return errors.New("cannot give back ip4 address for NID:" + ep.Spec.NetworkID + " addr:" +ep.Spec.Iface.Address)
-  }
-  return danmep.DeleteIpvlanInterface(ep)
-}
-
 func main() {
-  var err error
-  f, err := os.OpenFile("/var/log/plugin.log", os.O_RDWR | os.O_CREATE | os.O_APPEND, 0640)
-  if err == nil {
-    log.SetOutput(f)
-    defer f.Close()
-  }
   skel.PluginMain(createInterfaces, deleteInterfaces, version.All)
 }
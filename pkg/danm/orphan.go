@@ -0,0 +1,46 @@
+package main
+
+import (
+  "errors"
+  "log"
+  corev1 "k8s.io/api/core/v1"
+  "github.com/nokia/danm/pkg/danmep"
+  danmtypes "github.com/nokia/danm/pkg/crd/apis/danm/v1"
+  danmclientset "github.com/nokia/danm/pkg/crd/client/clientset/versioned"
+)
+
+// deleteOrphanedInterface cleans up a DanmEp whose DanmNet was deleted while its Pod was still running
+// The interface is torn down based on the network attributes cached in the DanmEp, then the DanmEp is deleted
+// The address is not freed, as the allocation record of the network was deleted together with the DanmNet
+func deleteOrphanedInterface(danmClient danmclientset.Interface, args *cniArgs, ep danmtypes.DanmEp) error {
+  var aggregatedError string
+  err := deleteNicInterface(danmep.RestoreNetwork(ep), ep)
+  if err != nil {
+    aggregatedError += "failed to delete container NIC of deleted network:" + err.Error() + "; "
+  }
+  err = deleteEp(danmClient, ep)
+  if err != nil {
+    aggregatedError += "failed to delete DanmEp:" + err.Error() + "; "
+  }
+  recordOrphanEvent(args, ep)
+  if aggregatedError != "" {
+    return errors.New(aggregatedError)
+  }
+  return nil
+}
+
+func recordOrphanEvent(args *cniArgs, ep danmtypes.DanmEp) {
+  message := "DanmNet:" + ep.Spec.NetworkID + " was deleted while the Pod was connected to it, so its interface was removed without freeing its addresses"
+  log.Println("INFO: DEL: " + message)
+  confArgs, err := loadNetConf(args.stdIn)
+  if err != nil {
+    return
+  }
+  k8sClient, err := createK8sClient(confArgs.Kubeconfig)
+  if err != nil {
+    log.Println("ERROR: DEL: event of DanmEp:" + ep.ObjectMeta.Name + " cannot be recorded because:" + err.Error())
+    return
+  }
+  pod := corev1.ObjectReference{Kind: "Pod", APIVersion: "v1", Namespace: ep.ObjectMeta.Namespace, Name: ep.Spec.Pod}
+  recordEvent(k8sClient, pod, corev1.EventTypeWarning, "DanmNetDeleted", message)
+}
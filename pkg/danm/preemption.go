@@ -0,0 +1,119 @@
+package main
+
+import (
+  "errors"
+  "log"
+  "strconv"
+  "time"
+  corev1 "k8s.io/api/core/v1"
+  apierrors "k8s.io/apimachinery/pkg/api/errors"
+  meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+  "k8s.io/client-go/kubernetes"
+  danmtypes "github.com/nokia/danm/pkg/crd/apis/danm/v1"
+  danmclientset "github.com/nokia/danm/pkg/crd/client/clientset/versioned"
+  "github.com/nokia/danm/pkg/ipam"
+)
+
+// reserveWithPreemption takes over the IPv4 address of a completed, or failed lower priority Pod, then repeats the reservation
+func reserveWithPreemption(danmClient danmclientset.Interface, netInfo *danmtypes.DanmNet, req4, req6 string, args *cniArgs) (string,string,string,error) {
+  confArgs, err := loadNetConf(args.stdIn)
+  if err != nil {
+    return "", "", "", err
+  }
+  k8sClient, err := createK8sClient(confArgs.Kubeconfig)
+  if err != nil {
+    return "", "", "", errors.New("cannot create kube client due to error:" + err.Error())
+  }
+  err = preemptAllocation(danmClient, k8sClient, netInfo, args.pod)
+  if err != nil {
+    return "", "", "", errors.New(ipam.ErrPoolExhausted.Error() + ", and no address could be preempted:" + err.Error())
+  }
+  freshNet, err := danmClient.DanmV1().DanmNets(netInfo.ObjectMeta.Namespace).Get(netInfo.ObjectMeta.Name, meta_v1.GetOptions{})
+  if err != nil {
+    return "", "", "", err
+  }
+  return ipam.Reserve(danmClient, *freshNet, req4, req6)
+}
+
+// preemptAllocation frees the address held by the lowest priority Pod of the network which is not running anymore, and has lower priority than the preemptor
+// The DanmEp of the holder is deleted before its address is freed, so concurrent preemptors can never free the same address twice
+func preemptAllocation(danmClient danmclientset.Interface, k8sClient kubernetes.Interface, netInfo *danmtypes.DanmNet, preemptor *corev1.Pod) error {
+  namespace := netInfo.ObjectMeta.Namespace
+  eps, err := danmClient.DanmV1().DanmEps(namespace).List(meta_v1.ListOptions{})
+  if err != nil {
+    return errors.New("DanmEps cannot be listed because:" + err.Error())
+  }
+  var victim *danmtypes.DanmEp
+  var victimPod *corev1.Pod
+  for i, ep := range eps.Items {
+    if ep.Spec.NetworkID != netInfo.Spec.NetworkID || ep.Spec.Iface.Address == "" {
+      continue
+    }
+    holder, err := k8sClient.CoreV1().Pods(namespace).Get(ep.Spec.Pod, meta_v1.GetOptions{})
+    if err != nil || !isPreemptible(holder, preemptor) {
+      continue
+    }
+    if victim == nil || getPriority(holder) < getPriority(victimPod) {
+      victim, victimPod = &eps.Items[i], holder
+    }
+  }
+  if victim == nil {
+    return errors.New("no completed, or failed Pod with priority lower than " + strconv.Itoa(int(getPriority(preemptor))) + " holds an address")
+  }
+  err = danmClient.DanmV1().DanmEps(namespace).Delete(victim.ObjectMeta.Name, &meta_v1.DeleteOptions{})
+  if err != nil {
+    if apierrors.IsNotFound(err) {
+      return errors.New("address of Pod:" + victimPod.Name + " was preempted concurrently by another Pod")
+    }
+    return errors.New("DanmEp:" + victim.ObjectMeta.Name + " cannot be deleted because:" + err.Error())
+  }
+  err = ipam.Free(danmClient, *netInfo, victim.Spec.Iface.Address)
+  if err != nil {
+    return errors.New("address:" + victim.Spec.Iface.Address + " cannot be freed because:" + err.Error())
+  }
+  log.Println("INFO: Address:" + victim.Spec.Iface.Address + " of network:" + netInfo.Spec.NetworkID + " was preempted from Pod:" + victimPod.Name + " by Pod:" + preemptor.Name)
+  recordEvent(k8sClient, getPodReference(victimPod), corev1.EventTypeWarning, "DanmAddressPreempted",
+              "Address:" + victim.Spec.Iface.Address + " of network:" + netInfo.Spec.NetworkID + " was preempted by higher priority Pod:" + preemptor.Name)
+  recordEvent(k8sClient, getPodReference(preemptor), corev1.EventTypeNormal, "DanmAddressPreemption",
+              "Address:" + victim.Spec.Iface.Address + " of network:" + netInfo.Spec.NetworkID + " was taken over from completed Pod:" + victimPod.Name)
+  return nil
+}
+
+// isPreemptible verifies that the holder does not run anymore, and has lower priority than the preemptor
+func isPreemptible(holder, preemptor *corev1.Pod) bool {
+  if holder.Status.Phase != corev1.PodSucceeded && holder.Status.Phase != corev1.PodFailed {
+    return false
+  }
+  return getPriority(holder) < getPriority(preemptor)
+}
+
+func getPriority(pod *corev1.Pod) int32 {
+  if pod == nil || pod.Spec.Priority == nil {
+    return 0
+  }
+  return *pod.Spec.Priority
+}
+
+// recordEvent creates the Event directly, as the CNI binary exits before an asynchronous event broadcaster could flush
+func recordEvent(k8sClient kubernetes.Interface, object corev1.ObjectReference, eventType, reason, message string) {
+  now := meta_v1.NewTime(time.Now())
+  event := &corev1.Event {
+    ObjectMeta: meta_v1.ObjectMeta{GenerateName: object.Name + ".", Namespace: object.Namespace},
+    InvolvedObject: object,
+    Reason: reason,
+    Message: message,
+    Type: eventType,
+    Source: corev1.EventSource{Component: "danm"},
+    FirstTimestamp: now,
+    LastTimestamp: now,
+    Count: 1,
+  }
+  _, err := k8sClient.CoreV1().Events(object.Namespace).Create(event)
+  if err != nil {
+    log.Println("ERROR: Event:" + reason + " of " + object.Kind + ":" + object.Name + " cannot be recorded because:" + err.Error())
+  }
+}
+
+func getPodReference(pod *corev1.Pod) corev1.ObjectReference {
+  return corev1.ObjectReference{Kind: "Pod", APIVersion: "v1", Namespace: pod.Namespace, Name: pod.Name, UID: pod.UID}
+}
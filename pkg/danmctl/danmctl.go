@@ -0,0 +1,66 @@
+package main
+
+import (
+  "fmt"
+  "os"
+  "sort"
+  "k8s.io/client-go/rest"
+  "k8s.io/client-go/tools/clientcmd"
+  danmclientset "github.com/nokia/danm/pkg/crd/client/clientset/versioned"
+)
+
+// verb is a sub-command of danmctl
+// Every verb parses its own command line arguments, and returns the exit code of the tool
+type verb struct {
+  description string
+  run func(args []string) int
+}
+
+var verbs = map[string]verb {
+  "doctor": verb{"Collects the CNI config, logs, host interfaces, DanmEps, and kernel modules of the node into a diagnostic bundle", runDoctor},
+  "import": verb{"Converts IPVLAN and SRIOV NetworkAttachmentDefinitions using whereabouts IPAM to DanmNets, without restarting the Pods", runImport},
+  "loadtest": verb{"Simulates concurrent IP allocations against an in-memory API server, and reports conflict rate, and latencies", runLoadtest},
+  "report": verb{"Checks all DanmNets for overlapping subnets, duplicate VNIs and VLANs, and gateways inside allocation pools", runReport},
+  "uninstall": verb{"Removes the DANM CNI configuration, host interfaces, and node-local caches from the node, optionally evicting the Pods connected by DANM first", runUninstall},
+}
+
+func getClientConfig(kubeConfig string) (*rest.Config, error) {
+  if kubeConfig != "" {
+    return clientcmd.BuildConfigFromFlags("", kubeConfig)
+  }
+  return rest.InClusterConfig()
+}
+
+func createDanmClient(kubeConfig string) (danmclientset.Interface, error) {
+  config, err := getClientConfig(kubeConfig)
+  if err != nil {
+    return nil, err
+  }
+  return danmclientset.NewForConfig(config)
+}
+
+func usage() {
+  fmt.Fprintln(os.Stderr, "Usage: danmctl <verb> [arguments]")
+  fmt.Fprintln(os.Stderr, "Verbs:")
+  var names []string
+  for name := range verbs {
+    names = append(names, name)
+  }
+  sort.Strings(names)
+  for _, name := range names {
+    fmt.Fprintf(os.Stderr, "  %-10s %s\n", name, verbs[name].description)
+  }
+}
+
+func main() {
+  if len(os.Args) < 2 {
+    usage()
+    os.Exit(2)
+  }
+  command, ok := verbs[os.Args[1]]
+  if !ok {
+    usage()
+    os.Exit(2)
+  }
+  os.Exit(command.run(os.Args[2:]))
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+  "archive/tar"
+  "bufio"
+  "bytes"
+  "compress/gzip"
+  "errors"
+  "flag"
+  "fmt"
+  "io/ioutil"
+  "log"
+  "os"
+  "path/filepath"
+  "sort"
+  "strings"
+  "time"
+  "github.com/vishvananda/netlink"
+  meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+  "k8s.io/client-go/kubernetes"
+  danmclientset "github.com/nokia/danm/pkg/crd/client/clientset/versioned"
+  "github.com/nokia/danm/pkg/danmnet"
+)
+
+var (
+  // kernelModules are the modules DANM, and its natively supported backends rely on
+  kernelModules = []string{"ipvlan", "8021q", "vxlan", "bridge", "openvswitch"}
+)
+
+// bundle collects the files of a diagnostic archive in memory
+// Collection failures are recorded in the archive too, so a partial bundle is still useful for support
+type bundle struct {
+  files map[string][]byte
+  failures []string
+}
+
+func (b *bundle) add(name string, content []byte) {
+  b.files[name] = content
+}
+
+func (b *bundle) fail(collector string, err error) {
+  b.failures = append(b.failures, collector + ": " + err.Error())
+}
+
+// runDoctor collects the node level state of DANM into a gzipped tarball, which can be attached to bug reports
+func runDoctor(args []string) int {
+  flags := flag.NewFlagSet("doctor", flag.ExitOnError)
+  kubeConfig := flags.String("kubeconf", "", "Path to a kube config. Only required if out-of-cluster. Cluster state is not collected if the API server cannot be reached.")
+  cniConfDir := flags.String("cni-conf-dir", "/etc/cni/net.d", "Directory of the CNI configuration files.")
+  logFile := flags.String("log-file", "/var/log/plugin.log", "Log file of the DANM CNI plugin.")
+  logLines := flags.Int("log-lines", 2000, "Number of the most recent log lines to collect.")
+  output := flags.String("output", "", "Path of the created archive. Defaults to danm-doctor-<HOSTNAME>-<TIMESTAMP>.tar.gz in the working directory.")
+  flags.Parse(args)
+  host, err := os.Hostname()
+  if err != nil {
+    log.Println("ERROR: Hostname cannot be determined because:" + err.Error())
+    return 1
+  }
+  if *output == "" {
+    *output = "danm-doctor-" + host + "-" + time.Now().Format("20060102-150405") + ".tar.gz"
+  }
+  b := &bundle{files: make(map[string][]byte)}
+  collectCniConfig(b, *cniConfDir)
+  collectLogs(b, *logFile, *logLines)
+  collectHostInterfaces(b)
+  collectKernelModules(b)
+  collectEndpoints(b, *kubeConfig, host)
+  if len(b.failures) > 0 {
+    b.add("failures.txt", []byte(strings.Join(b.failures, "\n") + "\n"))
+  }
+  err = b.write(*output)
+  if err != nil {
+    log.Println("ERROR: Diagnostic bundle cannot be written because:" + err.Error())
+    return 1
+  }
+  fmt.Println("Diagnostic bundle written to:" + *output)
+  return 0
+}
+
+func collectCniConfig(b *bundle, confDir string) {
+  files, err := ioutil.ReadDir(confDir)
+  if err != nil {
+    b.fail("cni-config", err)
+    return
+  }
+  for _, file := range files {
+    if file.IsDir() {
+      continue
+    }
+    content, err := ioutil.ReadFile(filepath.Join(confDir, file.Name()))
+    if err != nil {
+      b.fail("cni-config", err)
+      continue
+    }
+    b.add(filepath.Join("cni-config", file.Name()), content)
+  }
+}
+
+func collectLogs(b *bundle, logFile string, maxLines int) {
+  file, err := os.Open(logFile)
+  if err != nil {
+    b.fail("logs", err)
+    return
+  }
+  defer file.Close()
+  var lines []string
+  scanner := bufio.NewScanner(file)
+  for scanner.Scan() {
+    lines = append(lines, scanner.Text())
+    if len(lines) > maxLines {
+      lines = lines[1:]
+    }
+  }
+  if err = scanner.Err(); err != nil {
+    b.fail("logs", err)
+  }
+  b.add(filepath.Base(logFile), []byte(strings.Join(lines, "\n") + "\n"))
+}
+
+func collectHostInterfaces(b *bundle) {
+  danmLinks, err := danmnet.GetDanmHostInterfaces()
+  if err != nil {
+    b.fail("host-interfaces", err)
+    return
+  }
+  var netIds []string
+  for netId := range danmLinks {
+    netIds = append(netIds, netId)
+  }
+  sort.Strings(netIds)
+  var report bytes.Buffer
+  for _, netId := range netIds {
+    for _, link := range danmLinks[netId] {
+      attrs := link.Attrs()
+      fmt.Fprintf(&report, "network:%s interface:%s type:%s state:%s mtu:%d master:%d parent:%d\n",
+                  netId, attrs.Name, link.Type(), attrs.OperState, attrs.MTU, attrs.MasterIndex, attrs.ParentIndex)
+    }
+  }
+  links, err := netlink.LinkList()
+  if err != nil {
+    b.fail("host-interfaces", err)
+  }
+  report.WriteString("\nall host interfaces:\n")
+  for _, link := range links {
+    attrs := link.Attrs()
+    fmt.Fprintf(&report, "%d: %s type:%s state:%s mtu:%d alias:%s\n", attrs.Index, attrs.Name, link.Type(), attrs.OperState, attrs.MTU, attrs.Alias)
+  }
+  b.add("host-interfaces.txt", report.Bytes())
+}
+
+func collectKernelModules(b *bundle) {
+  content, err := ioutil.ReadFile("/proc/modules")
+  if err != nil {
+    b.fail("kernel-modules", err)
+    return
+  }
+  loaded := make(map[string]bool)
+  for _, line := range strings.Split(string(content), "\n") {
+    fields := strings.Fields(line)
+    if len(fields) > 0 {
+      loaded[fields[0]] = true
+    }
+  }
+  var report bytes.Buffer
+  for _, module := range kernelModules {
+    status := "not loaded"
+    if loaded[module] {
+      status = "loaded"
+    } else if _, err := os.Stat(filepath.Join("/sys/module", module)); err == nil {
+      //Built-in modules are not listed in /proc/modules
+      status = "built-in"
+    }
+    fmt.Fprintf(&report, "%s: %s\n", module, status)
+  }
+  report.WriteString("\n")
+  report.Write(content)
+  b.add("kernel-modules.txt", report.Bytes())
+}
+
+// collectEndpoints compares the DanmEps of the node with the Pods running on it
+// DanmEps without a Pod are leaked, and Pods without DanmEps were connected to the network by something else than DANM
+func collectEndpoints(b *bundle, kubeConfig, host string) {
+  config, err := getClientConfig(kubeConfig)
+  if err != nil {
+    b.fail("endpoints", err)
+    return
+  }
+  danmClient, err := danmclientset.NewForConfig(config)
+  if err != nil {
+    b.fail("endpoints", err)
+    return
+  }
+  k8sClient, err := kubernetes.NewForConfig(config)
+  if err != nil {
+    b.fail("endpoints", err)
+    return
+  }
+  eps, err := danmClient.DanmV1().DanmEps("").List(meta_v1.ListOptions{})
+  if err != nil {
+    b.fail("endpoints", errors.New("DanmEps cannot be listed because:" + err.Error()))
+    return
+  }
+  pods, err := k8sClient.CoreV1().Pods("").List(meta_v1.ListOptions{FieldSelector: "spec.nodeName=" + host})
+  if err != nil {
+    b.fail("endpoints", errors.New("Pods cannot be listed because:" + err.Error()))
+    return
+  }
+  runningPods := make(map[string]bool)
+  for _, pod := range pods.Items {
+    if !pod.Spec.HostNetwork {
+      runningPods[pod.Namespace + "/" + pod.Name] = false
+    }
+  }
+  var report bytes.Buffer
+  report.WriteString("DanmEps of the node:\n")
+  for _, ep := range eps.Items {
+    if ep.Spec.Host != host {
+      continue
+    }
+    podKey := ep.Namespace + "/" + ep.Spec.Pod
+    status := "ok"
+    if _, ok := runningPods[podKey]; ok {
+      runningPods[podKey] = true
+    } else {
+      status = "LEAKED: Pod does not run on this node"
+    }
+    fmt.Fprintf(&report, "%s pod:%s network:%s type:%s interface:%s ip:%s ip6:%s container:%s %s\n", ep.Name, podKey,
+                ep.Spec.NetworkID, ep.Spec.NetworkType, ep.Spec.Iface.Name, ep.Spec.Iface.Address, ep.Spec.Iface.AddressIPv6, ep.Spec.CID, status)
+  }
+  report.WriteString("\nPods of the node without DanmEps:\n")
+  for podKey, hasEp := range runningPods {
+    if !hasEp {
+      report.WriteString(podKey + "\n")
+    }
+  }
+  b.add("endpoints.txt", report.Bytes())
+}
+
+func (b *bundle) write(path string) error {
+  file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+  if err != nil {
+    return err
+  }
+  defer file.Close()
+  gzipWriter := gzip.NewWriter(file)
+  tarWriter := tar.NewWriter(gzipWriter)
+  var names []string
+  for name := range b.files {
+    names = append(names, name)
+  }
+  sort.Strings(names)
+  now := time.Now()
+  for _, name := range names {
+    header := &tar.Header{Name: filepath.Join("danm-doctor", name), Mode: 0600, Size: int64(len(b.files[name])), ModTime: now}
+    err = tarWriter.WriteHeader(header)
+    if err != nil {
+      return err
+    }
+    _, err = tarWriter.Write(b.files[name])
+    if err != nil {
+      return err
+    }
+  }
+  err = tarWriter.Close()
+  if err != nil {
+    return err
+  }
+  return gzipWriter.Close()
+}
@@ -0,0 +1,438 @@
+package main
+
+import (
+  "encoding/json"
+  "errors"
+  "flag"
+  "fmt"
+  "log"
+  "math/big"
+  "net"
+  "strconv"
+  "strings"
+  "time"
+  "github.com/satori/go.uuid"
+  corev1 "k8s.io/api/core/v1"
+  apierrors "k8s.io/apimachinery/pkg/api/errors"
+  meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+  "k8s.io/apimachinery/pkg/runtime"
+  "k8s.io/apimachinery/pkg/runtime/schema"
+  "k8s.io/client-go/dynamic"
+  "k8s.io/client-go/kubernetes"
+  danmtypes "github.com/nokia/danm/pkg/crd/apis/danm/v1"
+  danmclientset "github.com/nokia/danm/pkg/crd/client/clientset/versioned"
+  "github.com/nokia/danm/pkg/bitarray"
+  "github.com/nokia/danm/pkg/danmnet"
+)
+
+const (
+  networksStatusAnnotation = "k8s.v1.cni.cncf.io/networks-status"
+  importCreator = "danmctl-import"
+)
+
+var (
+  nadResource = schema.GroupVersionResource{Group: "k8s.cni.cncf.io", Version: "v1", Resource: "network-attachment-definitions"}
+  ipPoolResource = schema.GroupVersionResource{Group: "whereabouts.cni.cncf.io", Version: "v1alpha1", Resource: "ippools"}
+  importableTypes = []string{"ipvlan","sriov"}
+)
+
+type networkAttachmentDefinition struct {
+  meta_v1.ObjectMeta `json:"metadata"`
+  Spec struct {
+    Config string `json:"config"`
+  } `json:"spec"`
+}
+
+type nadConfig struct {
+  Type   string `json:"type"`
+  Master string `json:"master"`
+  Ipam   struct {
+    Type       string `json:"type"`
+    Range      string `json:"range"`
+    RangeStart string `json:"range_start"`
+    RangeEnd   string `json:"range_end"`
+    Gateway    string `json:"gateway"`
+    Routes     []struct {
+      Dst string `json:"dst"`
+      Gw  string `json:"gw"`
+    } `json:"routes"`
+  } `json:"ipam"`
+}
+
+type ipPool struct {
+  meta_v1.ObjectMeta `json:"metadata"`
+  Spec struct {
+    Range       string                  `json:"range"`
+    Allocations map[string]ipAllocation `json:"allocations"`
+  } `json:"spec"`
+}
+
+type ipAllocation struct {
+  Id     string `json:"id"`
+  PodRef string `json:"podref"`
+}
+
+type networkStatus struct {
+  Name      string   `json:"name"`
+  Interface string   `json:"interface"`
+  Ips       []string `json:"ips"`
+  Mac       string   `json:"mac"`
+}
+
+// importedAddress is an IP allocated by whereabouts to a running Pod
+type importedAddress struct {
+  ip net.IP
+  containerId string
+  pod *corev1.Pod
+}
+
+type importer struct {
+  danmClient danmclientset.Interface
+  k8sClient kubernetes.Interface
+  dynClient dynamic.Interface
+  prefix string
+  timeout time.Duration
+  dryRun bool
+}
+
+// runImport converts the IPVLAN and SRIOV NetworkAttachmentDefinitions using whereabouts IPAM to equivalent DanmNets
+// Addresses already allocated by whereabouts are reserved in the allocation record of the new DanmNet,
+// and a DanmEp is created for every running Pod, so the Pods don't need to be restarted during the migration
+func runImport(args []string) int {
+  flags := flag.NewFlagSet("import", flag.ExitOnError)
+  kubeConfig := flags.String("kubeconf", "", "Path to a kube config. Only required if out-of-cluster.")
+  namespace := flags.String("namespace", "", "Only import the NetworkAttachmentDefinitions of this namespace. All namespaces are imported if not set.")
+  prefix := flags.String("container-prefix", "net1", "Container interface name of the imported networks, used when the Pod does not report the name of its interface.")
+  timeout := flags.Duration("timeout", 30*time.Second, "Time to wait for netwatcher to validate an imported network.")
+  dryRun := flags.Bool("dry-run", false, "Only print the DanmNets which would be created.")
+  flags.Parse(args)
+  imp, err := newImporter(*kubeConfig)
+  if err != nil {
+    log.Println("ERROR: Cannot create API clients because:" + err.Error())
+    return 1
+  }
+  imp.prefix, imp.timeout, imp.dryRun = *prefix, *timeout, *dryRun
+  nads, err := imp.listNads(*namespace)
+  if err != nil {
+    log.Println("ERROR: " + err.Error())
+    return 1
+  }
+  pools, err := imp.listIpPools()
+  if err != nil {
+    log.Println("ERROR: " + err.Error())
+    return 1
+  }
+  exitCode := 0
+  for _, nad := range nads {
+    err = imp.importNad(nad, pools)
+    if err != nil {
+      log.Println("ERROR: Import of NetworkAttachmentDefinition:" + nad.Namespace + "/" + nad.Name + " failed with error:" + err.Error())
+      exitCode = 1
+    }
+  }
+  return exitCode
+}
+
+func newImporter(kubeConfig string) (*importer, error) {
+  config, err := getClientConfig(kubeConfig)
+  if err != nil {
+    return nil, err
+  }
+  imp := &importer{}
+  imp.danmClient, err = danmclientset.NewForConfig(config)
+  if err != nil {
+    return nil, err
+  }
+  imp.k8sClient, err = kubernetes.NewForConfig(config)
+  if err != nil {
+    return nil, err
+  }
+  imp.dynClient, err = dynamic.NewForConfig(config)
+  if err != nil {
+    return nil, err
+  }
+  return imp, nil
+}
+
+func (imp *importer) listNads(namespace string) ([]networkAttachmentDefinition, error) {
+  list, err := imp.dynClient.Resource(nadResource).Namespace(namespace).List(meta_v1.ListOptions{})
+  if err != nil {
+    return nil, errors.New("NetworkAttachmentDefinitions cannot be listed because:" + err.Error())
+  }
+  var nads []networkAttachmentDefinition
+  for _, item := range list.Items {
+    var nad networkAttachmentDefinition
+    err = runtime.DefaultUnstructuredConverter.FromUnstructured(item.Object, &nad)
+    if err != nil {
+      return nil, errors.New("NetworkAttachmentDefinition:" + item.GetName() + " cannot be parsed because:" + err.Error())
+    }
+    nads = append(nads, nad)
+  }
+  return nads, nil
+}
+
+func (imp *importer) listIpPools() (map[string]ipPool, error) {
+  list, err := imp.dynClient.Resource(ipPoolResource).Namespace("").List(meta_v1.ListOptions{})
+  if err != nil {
+    if apierrors.IsNotFound(err) {
+      return map[string]ipPool{}, nil
+    }
+    return nil, errors.New("whereabouts IPPools cannot be listed because:" + err.Error())
+  }
+  pools := make(map[string]ipPool)
+  for _, item := range list.Items {
+    var pool ipPool
+    err = runtime.DefaultUnstructuredConverter.FromUnstructured(item.Object, &pool)
+    if err != nil {
+      return nil, errors.New("IPPool:" + item.GetName() + " cannot be parsed because:" + err.Error())
+    }
+    pools[pool.Spec.Range] = pool
+  }
+  return pools, nil
+}
+
+func (imp *importer) importNad(nad networkAttachmentDefinition, pools map[string]ipPool) error {
+  var conf nadConfig
+  err := json.Unmarshal([]byte(nad.Spec.Config), &conf)
+  if err != nil {
+    return errors.New("CNI config cannot be parsed because:" + err.Error())
+  }
+  if !isImportable(conf) {
+    log.Println("INFO: NetworkAttachmentDefinition:" + nad.Namespace + "/" + nad.Name + " of type:" + conf.Type + " with IPAM:" + conf.Ipam.Type +
+      " is skipped, only " + strings.Join(importableTypes, ",") + " networks using whereabouts IPAM can be imported")
+    return nil
+  }
+  dnet, err := imp.convertNad(nad, conf)
+  if err != nil {
+    return err
+  }
+  addresses, err := imp.collectAddresses(nad, pools[conf.Ipam.Range])
+  if err != nil {
+    return err
+  }
+  if imp.dryRun {
+    out, _ := json.MarshalIndent(dnet, "", "  ")
+    fmt.Println(string(out))
+    fmt.Printf("# %d allocated addresses of running Pods would be imported\n", len(addresses))
+    return nil
+  }
+  _, err = imp.danmClient.DanmV1().DanmNets(dnet.Namespace).Create(dnet)
+  if apierrors.IsAlreadyExists(err) {
+    log.Println("INFO: DanmNet:" + dnet.Namespace + "/" + dnet.Name + " already exists, NetworkAttachmentDefinition is skipped")
+    return nil
+  } else if err != nil {
+    return errors.New("DanmNet cannot be created because:" + err.Error())
+  }
+  validNet, err := imp.waitForValidation(dnet)
+  if err != nil {
+    return err
+  }
+  err = imp.reserveAddresses(validNet, addresses)
+  if err != nil {
+    return err
+  }
+  for _, address := range addresses {
+    err = imp.createEp(validNet, nad, address)
+    if err != nil {
+      return err
+    }
+  }
+  log.Println("INFO: NetworkAttachmentDefinition:" + nad.Namespace + "/" + nad.Name + " was imported with " + strconv.Itoa(len(addresses)) + " allocated addresses")
+  return nil
+}
+
+func isImportable(conf nadConfig) bool {
+  if conf.Ipam.Type != "whereabouts" {
+    return false
+  }
+  for _, importableType := range importableTypes {
+    if conf.Type == importableType {
+      return true
+    }
+  }
+  return false
+}
+
+func (imp *importer) convertNad(nad networkAttachmentDefinition, conf nadConfig) (*danmtypes.DanmNet, error) {
+  ip, ipnet, err := net.ParseCIDR(conf.Ipam.Range)
+  if err != nil || ip.To4() == nil {
+    return nil, errors.New("only IPv4 whereabouts ranges in CIDR format can be imported, range:" + conf.Ipam.Range + " is not")
+  }
+  routes := make(map[string]string)
+  for _, route := range conf.Ipam.Routes {
+    if route.Gw != "" {
+      routes[route.Dst] = route.Gw
+    }
+  }
+  if conf.Ipam.Gateway != "" {
+    routes["0.0.0.0/0"] = conf.Ipam.Gateway
+  }
+  pool := danmtypes.IP4Pool{Start: conf.Ipam.RangeStart, End: conf.Ipam.RangeEnd}
+  if pool.Start == "" {
+    pool.Start = danmnet.Int2ip(danmnet.Ip2int(ipnet.IP) + 1).String()
+  }
+  if pool.End == "" {
+    ones, bits := ipnet.Mask.Size()
+    pool.End = danmnet.Int2ip(danmnet.Ip2int(ipnet.IP) + uint32(1) << uint(bits-ones) - 2).String()
+  }
+  return &danmtypes.DanmNet {
+    TypeMeta: meta_v1.TypeMeta{APIVersion: danmtypes.SchemeGroupVersion.String(), Kind: "DanmNet"},
+    ObjectMeta: meta_v1.ObjectMeta{Name: nad.Name, Namespace: nad.Namespace},
+    Spec: danmtypes.DanmNetSpec {
+      NetworkID: nad.Name,
+      NetworkType: conf.Type,
+      Options: danmtypes.DanmNetOption {
+        Device: conf.Master,
+        Prefix: imp.prefix,
+        Cidr: ipnet.String(),
+        Pool: pool,
+        Routes: routes,
+      },
+    },
+  }, nil
+}
+
+// collectAddresses returns the whereabouts allocations of the network belonging to still existing Pods
+// Allocations of already deleted Pods are not imported, so they are freed-up during the migration
+func (imp *importer) collectAddresses(nad networkAttachmentDefinition, pool ipPool) ([]importedAddress, error) {
+  if pool.Spec.Range == "" {
+    return nil, nil
+  }
+  base, _, err := net.ParseCIDR(pool.Spec.Range)
+  if err != nil {
+    return nil, errors.New("IPPool range:" + pool.Spec.Range + " is invalid")
+  }
+  var addresses []importedAddress
+  for offsetKey, allocation := range pool.Spec.Allocations {
+    offset, ok := big.NewInt(0).SetString(offsetKey, 10)
+    if !ok {
+      return nil, errors.New("IPPool:" + pool.Name + " contains invalid allocation offset:" + offsetKey)
+    }
+    podRef := strings.SplitN(allocation.PodRef, "/", 2)
+    if len(podRef) != 2 {
+      log.Println("INFO: Allocation:" + offsetKey + " of IPPool:" + pool.Name + " has no Pod reference, it is not imported")
+      continue
+    }
+    pod, err := imp.k8sClient.CoreV1().Pods(podRef[0]).Get(podRef[1], meta_v1.GetOptions{})
+    if apierrors.IsNotFound(err) {
+      continue
+    } else if err != nil {
+      return nil, errors.New("Pod:" + allocation.PodRef + " cannot be read because:" + err.Error())
+    }
+    if pod.Namespace != nad.Namespace {
+      continue
+    }
+    ip := danmnet.Int2ip(danmnet.Ip2int(base) + uint32(offset.Uint64()))
+    addresses = append(addresses, importedAddress{ip: ip, containerId: allocation.Id, pod: pod})
+  }
+  return addresses, nil
+}
+
+func (imp *importer) waitForValidation(dnet *danmtypes.DanmNet) (*danmtypes.DanmNet, error) {
+  deadline := time.Now().Add(imp.timeout)
+  for time.Now().Before(deadline) {
+    currentNet, err := imp.danmClient.DanmV1().DanmNets(dnet.Namespace).Get(dnet.Name, meta_v1.GetOptions{})
+    if err != nil {
+      return nil, errors.New("DanmNet cannot be read because:" + err.Error())
+    }
+    if currentNet.Spec.Validation == "True" {
+      return currentNet, nil
+    } else if currentNet.Spec.Validation == "False" {
+      return nil, errors.New("DanmNet:" + dnet.Namespace + "/" + dnet.Name + " was found invalid by netwatcher, check its logs for details")
+    }
+    time.Sleep(500*time.Millisecond)
+  }
+  return nil, errors.New("DanmNet:" + dnet.Namespace + "/" + dnet.Name + " was not validated by netwatcher in time")
+}
+
+func (imp *importer) reserveAddresses(dnet *danmtypes.DanmNet, addresses []importedAddress) error {
+  if len(addresses) == 0 {
+    return nil
+  }
+  for {
+    _, ipnet, _ := net.ParseCIDR(dnet.Spec.Options.Cidr)
+    ba := bitarray.NewBitArrayFromBase64(dnet.Spec.Options.Alloc)
+    for _, address := range addresses {
+      if !ipnet.Contains(address.ip) {
+        return errors.New("allocated address:" + address.ip.String() + " is outside of CIDR:" + dnet.Spec.Options.Cidr)
+      }
+      ba.Set(danmnet.Ip2int(address.ip) - danmnet.Ip2int(ipnet.IP))
+    }
+    dnet.Spec.Options.Alloc = ba.Encode()
+    wasAlreadyUpdated, err := danmnet.PutDanmNet(imp.danmClient, dnet)
+    if err != nil {
+      return errors.New("allocations cannot be written into DanmNet because:" + err.Error())
+    }
+    if !wasAlreadyUpdated {
+      return nil
+    }
+    dnet, err = imp.danmClient.DanmV1().DanmNets(dnet.Namespace).Get(dnet.Name, meta_v1.GetOptions{})
+    if err != nil {
+      return errors.New("DanmNet cannot be read because:" + err.Error())
+    }
+  }
+}
+
+func (imp *importer) createEp(dnet *danmtypes.DanmNet, nad networkAttachmentDefinition, address importedAddress) error {
+  epid, err := uuid.NewV4()
+  if err != nil {
+    return errors.New("uuid.NewV4 returned error during EP creation:" + err.Error())
+  }
+  ones, _ := getMaskSize(dnet.Spec.Options.Cidr)
+  iface := danmtypes.DanmEpIface {
+    Name: dnet.Spec.Options.Prefix,
+    Address: address.ip.String() + "/" + strconv.Itoa(ones),
+  }
+  status := getNetworkStatus(address.pod, nad)
+  if status != nil {
+    if status.Interface != "" {
+      iface.Name = status.Interface
+    }
+    iface.MacAddress = status.Mac
+  }
+  ep := &danmtypes.DanmEp {
+    TypeMeta: meta_v1.TypeMeta{APIVersion: danmtypes.SchemeGroupVersion.String(), Kind: "DanmEp"},
+    ObjectMeta: meta_v1.ObjectMeta {
+      Name: epid.String(),
+      Namespace: address.pod.Namespace,
+      Labels: address.pod.Labels,
+    },
+    Spec: danmtypes.DanmEpSpec {
+      NetworkID: dnet.Spec.NetworkID,
+      NetworkType: dnet.Spec.NetworkType,
+      EndpointID: epid.String(),
+      Iface: iface,
+      Host: address.pod.Spec.NodeName,
+      Pod: address.pod.Name,
+      CID: address.containerId,
+      Creator: importCreator,
+    },
+  }
+  _, err = imp.danmClient.DanmV1().DanmEps(ep.Namespace).Create(ep)
+  if err != nil {
+    return errors.New("DanmEp of Pod:" + address.pod.Name + " cannot be created because:" + err.Error())
+  }
+  return nil
+}
+
+func getMaskSize(cidr string) (int, int) {
+  _, ipnet, err := net.ParseCIDR(cidr)
+  if err != nil {
+    return 0, 0
+  }
+  return ipnet.Mask.Size()
+}
+
+func getNetworkStatus(pod *corev1.Pod, nad networkAttachmentDefinition) *networkStatus {
+  var statuses []networkStatus
+  err := json.Unmarshal([]byte(pod.Annotations[networksStatusAnnotation]), &statuses)
+  if err != nil {
+    return nil
+  }
+  for i, status := range statuses {
+    if status.Name == nad.Name || status.Name == nad.Namespace + "/" + nad.Name {
+      return &statuses[i]
+    }
+  }
+  return nil
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+  "flag"
+  "fmt"
+  "log"
+  "time"
+  "github.com/nokia/danm/pkg/loadtest"
+)
+
+// runLoadtest simulates concurrent Pod creations, and deletions against an in-memory API server, and prints the observed conflict rate and latencies
+// The exit code is non-zero if the p99 ADD latency exceeds the configured budget, so the verb can gate releases in CI
+func runLoadtest(args []string) int {
+  flags := flag.NewFlagSet("loadtest", flag.ExitOnError)
+  rate := flags.Int("rate", 50, "Number of ADD, and DEL operations started per second.")
+  duration := flags.Duration("duration", 10*time.Second, "Length of the load phase.")
+  cidr := flags.String("cidr", "10.0.0.0/16", "IPv4 subnet of the simulated network.")
+  apiLatency := flags.Duration("api-latency", 2*time.Millisecond, "Latency added to every request served by the fake API server.")
+  maxP99 := flags.Duration("max-p99", 0, "Fail if the p99 latency of ADD operations exceeds this value. Disabled by default.")
+  flags.Parse(args)
+  result, err := loadtest.Run(loadtest.Config{Rate: *rate, Duration: *duration, Cidr: *cidr, ApiLatency: *apiLatency})
+  if err != nil {
+    log.Println("ERROR: Load test cannot be started because:" + err.Error())
+    return 1
+  }
+  fmt.Printf("operations: %d ADD, %d DEL, %d failed\n", result.Adds, result.Dels, result.Failures)
+  fmt.Printf("DanmNet updates: %d successful, %d conflicted (conflict rate: %.2f%%)\n", result.Updates, result.Conflicts, result.ConflictRate()*100)
+  fmt.Printf("ADD latency: p50 %v, p99 %v, max %v\n", result.AddLatency.P50, result.AddLatency.P99, result.AddLatency.Max)
+  fmt.Printf("DEL latency: p50 %v, p99 %v, max %v\n", result.DelLatency.P50, result.DelLatency.P99, result.DelLatency.Max)
+  if result.Failures > 0 {
+    return 1
+  }
+  if *maxP99 > 0 && result.AddLatency.P99 > *maxP99 {
+    log.Println("ERROR: p99 ADD latency:" + result.AddLatency.P99.String() + " exceeds the budget:" + maxP99.String())
+    return 1
+  }
+  return 0
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+  "errors"
+  "flag"
+  "fmt"
+  "log"
+  "net/http"
+  "os"
+  "strings"
+  "time"
+  "github.com/prometheus/client_golang/prometheus"
+  "github.com/prometheus/client_golang/prometheus/promhttp"
+  apierrors "k8s.io/apimachinery/pkg/api/errors"
+  meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+  "k8s.io/client-go/kubernetes"
+  danmtypes "github.com/nokia/danm/pkg/crd/apis/danm/v1"
+  danmclientset "github.com/nokia/danm/pkg/crd/client/clientset/versioned"
+  "github.com/nokia/danm/pkg/allocstatus"
+  "github.com/nokia/danm/pkg/netreport"
+)
+
+const (
+  reportName = "danm-network-report"
+)
+
+var (
+  findingsGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts {
+    Name: "danm_network_report_findings",
+    Help: "Number of configuration inconsistencies found between DanmNets, per finding type.",
+  }, []string{"type"})
+  networksGauge = prometheus.NewGauge(prometheus.GaugeOpts {
+    Name: "danm_network_report_networks",
+    Help: "Number of DanmNets checked during the last run.",
+  })
+  lastRunGauge = prometheus.NewGauge(prometheus.GaugeOpts {
+    Name: "danm_network_report_last_run_timestamp_seconds",
+    Help: "Unix time of the last successful run of the network report.",
+  })
+)
+
+// runReport checks all DanmNets once, or periodically when an interval is given
+// In one-shot mode the findings are printed, and the exit code is non-zero if any inconsistency was found
+// In periodic mode the findings are continuously published as a DanmNetReport object, and as Prometheus metrics
+func runReport(args []string) int {
+  flags := flag.NewFlagSet("report", flag.ExitOnError)
+  kubeConfig := flags.String("kubeconf", "", "Path to a kube config. Only required if out-of-cluster.")
+  publish := flags.Bool("publish", false, "Publish the findings as the cluster scoped DanmNetReport object named " + reportName + ".")
+  interval := flags.Duration("interval", 0, "Re-check the networks periodically with this interval, instead of running only once.")
+  metricsAddr := flags.String("metrics-addr", "", "Address the Prometheus metrics are served on in periodic mode (e.g. :9100).")
+  publishAllocs := flags.Bool("publish-allocations", false, "Publish the allocated addresses of every DanmNet, and their holders in paged ConfigMaps labeled " + allocstatus.NetworkLabel + ".")
+  pageSize := flags.Int("page-size", allocstatus.DefaultPageSize, "Maximum number of addresses published in one allocation status ConfigMap.")
+  flags.Parse(args)
+  client, err := createDanmClient(*kubeConfig)
+  if err != nil {
+    log.Println("ERROR: Cannot create DANM client because:" + err.Error())
+    return 1
+  }
+  var publishAllocations func() error
+  if *publishAllocs {
+    config, err := getClientConfig(*kubeConfig)
+    if err == nil {
+      var kubeClient kubernetes.Interface
+      kubeClient, err = kubernetes.NewForConfig(config)
+      publishAllocations = func() error {
+        return allocstatus.Publish(client, kubeClient, *pageSize)
+      }
+    }
+    if err != nil {
+      log.Println("ERROR: Cannot create K8s client because:" + err.Error())
+      return 1
+    }
+  }
+  if *interval == 0 {
+    report, err := generateReport(client)
+    if err != nil {
+      log.Println("ERROR: " + err.Error())
+      return 1
+    }
+    printReport(report)
+    if *publish {
+      err = publishReport(client, report)
+      if err != nil {
+        log.Println("ERROR: " + err.Error())
+        return 1
+      }
+    }
+    if publishAllocations != nil {
+      err = publishAllocations()
+      if err != nil {
+        log.Println("ERROR: " + err.Error())
+        return 1
+      }
+    }
+    if len(report.Findings) > 0 {
+      return 1
+    }
+    return 0
+  }
+  if *metricsAddr != "" {
+    prometheus.MustRegister(findingsGauge, networksGauge, lastRunGauge)
+    http.Handle("/metrics", promhttp.Handler())
+    go func() {
+      log.Println("ERROR: Metrics server stopped because:" + http.ListenAndServe(*metricsAddr, nil).Error())
+      os.Exit(1)
+    }()
+  }
+  for {
+    report, err := generateReport(client)
+    if err != nil {
+      log.Println("ERROR: " + err.Error())
+    } else {
+      updateMetrics(report)
+      if *publish {
+        err = publishReport(client, report)
+        if err != nil {
+          log.Println("ERROR: " + err.Error())
+        }
+      }
+    }
+    if publishAllocations != nil {
+      err = publishAllocations()
+      if err != nil {
+        log.Println("ERROR: " + err.Error())
+      }
+    }
+    time.Sleep(*interval)
+  }
+}
+
+func generateReport(client danmclientset.Interface) (danmtypes.DanmNetReportSpec, error) {
+  nets, err := client.DanmV1().DanmNets("").List(meta_v1.ListOptions{})
+  if err != nil {
+    return danmtypes.DanmNetReportSpec{}, errors.New("DanmNets cannot be listed because:" + err.Error())
+  }
+  return danmtypes.DanmNetReportSpec {
+    GeneratedAt: time.Now().UTC().Format(time.RFC3339),
+    NumberOfNetworks: len(nets.Items),
+    Findings: netreport.Analyze(nets.Items),
+  }, nil
+}
+
+func printReport(report danmtypes.DanmNetReportSpec) {
+  fmt.Printf("Checked %d networks, found %d inconsistencies\n", report.NumberOfNetworks, len(report.Findings))
+  for _, finding := range report.Findings {
+    fmt.Printf("%s\t%s\t%s\n", finding.Type, strings.Join(finding.Networks, ","), finding.Detail)
+  }
+}
+
+func updateMetrics(report danmtypes.DanmNetReportSpec) {
+  for findingType, count := range netreport.CountFindings(report.Findings) {
+    findingsGauge.WithLabelValues(findingType).Set(float64(count))
+  }
+  networksGauge.Set(float64(report.NumberOfNetworks))
+  lastRunGauge.Set(float64(time.Now().Unix()))
+}
+
+func publishReport(client danmclientset.Interface, report danmtypes.DanmNetReportSpec) error {
+  existingReport, err := client.DanmV1().DanmNetReports().Get(reportName, meta_v1.GetOptions{})
+  if apierrors.IsNotFound(err) {
+    newReport := &danmtypes.DanmNetReport {
+      TypeMeta: meta_v1.TypeMeta{APIVersion: danmtypes.SchemeGroupVersion.String(), Kind: "DanmNetReport"},
+      ObjectMeta: meta_v1.ObjectMeta{Name: reportName},
+      Spec: report,
+    }
+    _, err = client.DanmV1().DanmNetReports().Create(newReport)
+    if err != nil {
+      return errors.New("DanmNetReport cannot be created because:" + err.Error())
+    }
+    return nil
+  } else if err != nil {
+    return errors.New("DanmNetReport cannot be read because:" + err.Error())
+  }
+  existingReport.Spec = report
+  _, err = client.DanmV1().DanmNetReports().Update(existingReport)
+  if err != nil {
+    return errors.New("DanmNetReport cannot be updated because:" + err.Error())
+  }
+  return nil
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+  "encoding/json"
+  "errors"
+  "flag"
+  "fmt"
+  "io/ioutil"
+  "log"
+  "os"
+  "path/filepath"
+  "time"
+  "github.com/vishvananda/netlink"
+  apierrors "k8s.io/apimachinery/pkg/api/errors"
+  meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+  "k8s.io/client-go/kubernetes"
+  danmclientset "github.com/nokia/danm/pkg/crd/client/clientset/versioned"
+  "github.com/nokia/danm/pkg/danmnet"
+  "github.com/nokia/danm/pkg/spool"
+)
+
+var (
+  // danmBinaries are the CNI binaries shipped by DANM
+  danmBinaries = []string{"danm", "fakeipam"}
+)
+
+// uninstaller reverts the node level state of DANM, printing every step
+// In dry-run mode the steps are only printed
+type uninstaller struct {
+  dryRun bool
+  failures int
+}
+
+func (u *uninstaller) do(step string, action func() error) {
+  if u.dryRun {
+    fmt.Println("would " + step)
+    return
+  }
+  err := action()
+  if err != nil {
+    u.failures++
+    log.Println("ERROR: Failed to " + step + " because:" + err.Error())
+    return
+  }
+  fmt.Println(step)
+}
+
+// runUninstall removes the DANM CNI configuration, DANM owned host interfaces, and node-local caches from the node
+// Optionally the Pods of the node connected by DANM are deleted first, so their controllers re-create them with the default CNI
+func runUninstall(args []string) int {
+  flags := flag.NewFlagSet("uninstall", flag.ExitOnError)
+  kubeConfig := flags.String("kubeconf", "", "Path to a kube config. Only required if out-of-cluster, and --evict-pods is set.")
+  cniConfDir := flags.String("cni-conf-dir", "/etc/cni/net.d", "Directory of the CNI configuration files. Files configuring the danm plugin are deleted.")
+  cniBinDir := flags.String("cni-bin-dir", "/opt/cni/bin", "Directory of the CNI binaries. Only used if --remove-binaries is set.")
+  removeBinaries := flags.Bool("remove-binaries", false, "Also delete the danm, and fakeipam binaries from the CNI binary directory.")
+  evictPods := flags.Bool("evict-pods", false, "Delete the Pods of the node connected by DANM before removing its configuration, so their controllers re-create them with the default CNI. Pods without a controller are left running.")
+  evictTimeout := flags.Duration("evict-timeout", time.Minute*2, "Maximum time to wait for the DanmEps of the evicted Pods to be deleted.")
+  dryRun := flags.Bool("dry-run", false, "Only print what would be removed.")
+  flags.Parse(args)
+  host, err := os.Hostname()
+  if err != nil {
+    log.Println("ERROR: Hostname cannot be determined because:" + err.Error())
+    return 1
+  }
+  u := &uninstaller{dryRun: *dryRun}
+  if *evictPods {
+    //The CNI configuration is still in place, so the sandboxes are torn down, and the addresses are freed by DANM itself
+    err = evictDanmPods(u, *kubeConfig, host, *evictTimeout)
+    if err != nil {
+      log.Println("ERROR: Pods cannot be evicted because:" + err.Error())
+      return 1
+    }
+  }
+  removeCniConfig(u, *cniConfDir)
+  if *removeBinaries {
+    for _, binary := range danmBinaries {
+      path := filepath.Join(*cniBinDir, binary)
+      if _, err := os.Stat(path); err == nil {
+        u.do("delete CNI binary:" + path, func() error { return os.Remove(path) })
+      }
+    }
+  }
+  removeHostInterfaces(u)
+  removeSpool(u, spool.DefaultDir)
+  if u.failures > 0 {
+    return 1
+  }
+  return 0
+}
+
+// isDanmConfig tells whether a CNI configuration, or configuration list file configures the danm plugin
+func isDanmConfig(content []byte) bool {
+  var conf struct {
+    Type string `json:"type"`
+    Plugins []struct {
+      Type string `json:"type"`
+    } `json:"plugins"`
+  }
+  if json.Unmarshal(content, &conf) != nil {
+    return false
+  }
+  if conf.Type == "danm" {
+    return true
+  }
+  for _, plugin := range conf.Plugins {
+    if plugin.Type == "danm" {
+      return true
+    }
+  }
+  return false
+}
+
+func removeCniConfig(u *uninstaller, confDir string) {
+  files, err := ioutil.ReadDir(confDir)
+  if err != nil {
+    u.failures++
+    log.Println("ERROR: CNI configuration directory cannot be read because:" + err.Error())
+    return
+  }
+  for _, file := range files {
+    if file.IsDir() {
+      continue
+    }
+    path := filepath.Join(confDir, file.Name())
+    content, err := ioutil.ReadFile(path)
+    if err != nil || !isDanmConfig(content) {
+      continue
+    }
+    u.do("delete CNI configuration:" + path, func() error { return os.Remove(path) })
+  }
+}
+
+// removeHostInterfaces deletes the VLAN, and VxLAN host interfaces carrying DANM's ownership marker
+func removeHostInterfaces(u *uninstaller) {
+  danmLinks, err := danmnet.GetDanmHostInterfaces()
+  if err != nil {
+    u.failures++
+    log.Println("ERROR: " + err.Error())
+    return
+  }
+  for netId, links := range danmLinks {
+    for _, link := range links {
+      link := link
+      u.do("delete host interface:" + link.Attrs().Name + " of network:" + netId, func() error { return netlink.LinkDel(link) })
+    }
+  }
+}
+
+// removeSpool deletes the hand-over directory of async_cleanup
+// Pending hand-overs are kept, as the addresses they hold would never be freed without them
+func removeSpool(u *uninstaller, dir string) {
+  files, err := ioutil.ReadDir(dir)
+  if os.IsNotExist(err) {
+    return
+  }
+  if err != nil {
+    u.failures++
+    log.Println("ERROR: Cleanup directory cannot be read because:" + err.Error())
+    return
+  }
+  if len(files) > 0 {
+    u.failures++
+    log.Println("ERROR: Cleanup directory:" + dir + " holds " + fmt.Sprint(len(files)) + " pending hand-overs, start netwatcher to process them before uninstalling")
+    return
+  }
+  u.do("delete cleanup directory:" + dir, func() error { return os.Remove(dir) })
+}
+
+// evictDanmPods deletes the Pods of the node having DanmEps, and waits until their DanmEps are deleted by the CNI
+func evictDanmPods(u *uninstaller, kubeConfig, host string, timeout time.Duration) error {
+  config, err := getClientConfig(kubeConfig)
+  if err != nil {
+    return err
+  }
+  danmClient, err := danmclientset.NewForConfig(config)
+  if err != nil {
+    return err
+  }
+  k8sClient, err := kubernetes.NewForConfig(config)
+  if err != nil {
+    return err
+  }
+  pods, err := getDanmPods(danmClient, host)
+  if err != nil {
+    return err
+  }
+  for podKey, pod := range pods {
+    existing, err := k8sClient.CoreV1().Pods(pod[0]).Get(pod[1], meta_v1.GetOptions{})
+    if apierrors.IsNotFound(err) {
+      continue
+    } else if err != nil {
+      return errors.New("Pod:" + podKey + " cannot be read because:" + err.Error())
+    }
+    if meta_v1.GetControllerOf(existing) == nil {
+      log.Println("INFO: Pod:" + podKey + " has no controller re-creating it, so it is left running with its DANM interfaces")
+      continue
+    }
+    namespace, name := pod[0], pod[1]
+    u.do("evict Pod:" + podKey, func() error { return k8sClient.CoreV1().Pods(namespace).Delete(name, &meta_v1.DeleteOptions{}) })
+  }
+  if u.dryRun {
+    return nil
+  }
+  deadline := time.Now().Add(timeout)
+  for time.Now().Before(deadline) {
+    remaining, err := getDanmPods(danmClient, host)
+    if err != nil {
+      return err
+    }
+    if len(remaining) == 0 {
+      return nil
+    }
+    time.Sleep(time.Second * 2)
+  }
+  log.Println("INFO: Not all DanmEps of the node were deleted within " + timeout.String() + ", continuing with the uninstallation")
+  return nil
+}
+
+// getDanmPods returns the namespace, and name of the Pods of the node having DanmEps, keyed by "<namespace>/<name>"
+func getDanmPods(danmClient danmclientset.Interface, host string) (map[string][2]string, error) {
+  eps, err := danmClient.DanmV1().DanmEps("").List(meta_v1.ListOptions{})
+  if err != nil {
+    return nil, errors.New("DanmEps cannot be listed because:" + err.Error())
+  }
+  pods := make(map[string][2]string)
+  for _, ep := range eps.Items {
+    if ep.Spec.Host == host {
+      pods[ep.Namespace + "/" + ep.Spec.Pod] = [2]string{ep.Namespace, ep.Spec.Pod}
+    }
+  }
+  return pods, nil
+}
@@ -5,6 +5,7 @@ import (
   meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
   danmtypes "github.com/nokia/danm/pkg/crd/apis/danm/v1"
   danmclientset "github.com/nokia/danm/pkg/crd/client/clientset/versioned"
+  "github.com/nokia/danm/pkg/netspec"
 )
 
 const (
@@ -13,7 +14,12 @@ const (
 )
 
 // DeleteIpvlanInterface deletes a Pod's IPVLAN network interface based on the related DanmEp
-func DeleteIpvlanInterface(ep danmtypes.DanmEp) (error) { 
+// Traffic mirroring rules belonging to the interface are also removed from the host
+func DeleteIpvlanInterface(dnet *danmtypes.DanmNet, ep danmtypes.DanmEp) (error) { 
+  err := deleteTrafficMirror(dnet, ep)
+  if err != nil {
+    log.Println("INFO: traffic mirror of DanmEp:" + ep.ObjectMeta.Name + " could not be removed because:" + err.Error())
+  }
   return deleteEp(ep)
 }
 
@@ -58,7 +64,7 @@ func CidsByHost(client danmclientset.Interface, host string)(map[string]danmtype
 }
 
 func AddIpvlanInterface(dnet *danmtypes.DanmNet, ep danmtypes.DanmEp) error {
-  if ep.Spec.NetworkType != "ipvlan" {
+  if !netspec.IsIpvlanEp(&ep) {
     return nil
   }
   return createIpvlanInterface(dnet, ep)
@@ -15,6 +15,13 @@ import (
   danmtypes "github.com/nokia/danm/pkg/crd/apis/danm/v1"
 )
 
+const (
+  // SwitchingLocal switches the traffic between the Pods of the same host on the host, this is the default
+  SwitchingLocal = "local"
+  // SwitchingExternal sends the traffic between the Pods of the same host through the external switch (VEPA)
+  SwitchingExternal = "external"
+)
+
 var containerPid int
 
 func createIpvlanInterface(dnet *danmtypes.DanmNet, ep danmtypes.DanmEp) error {
@@ -29,8 +36,21 @@ func createIpvlanInterface(dnet *danmtypes.DanmNet, ep danmtypes.DanmEp) error {
   if !doesTargetContainerExist(ep) {
     return errors.New("Cannot get container pid!")
   }
-  device := determineIfName(dnet)
-  return createContainerIface(ep, dnet, device)
+  device := GetHostInterface(dnet)
+  err = createContainerIface(ep, dnet, device)
+  if err != nil {
+    return err
+  }
+  return setupTrafficMirror(dnet, ep)
+}
+
+// getIpvlanFlag returns the VEPA flag if the traffic between the Pods of the same host shall be visible to the external switch
+// VEPA mode requires Linux kernel 4.15, or newer, and a switch hairpinning the frames back to the port they were received on
+func getIpvlanFlag(dnet *danmtypes.DanmNet) netlink.IPVlanFlag {
+  if dnet.Spec.Options.IntraHostSwitching == SwitchingExternal {
+    return netlink.IPVLAN_FLAG_VEPA
+  }
+  return netlink.IPVLAN_FLAG_BRIDGE
 }
 
 // TODO: Refactor this, as cyclomatic complexity is 40
@@ -56,24 +76,35 @@ func createContainerIface(ep danmtypes.DanmEp, dnet *danmtypes.DanmNet, device s
   if err != nil {
     return errors.New("cannot find host device because:" + err.Error())
   }
-  outer := ep.Spec.EndpointID
+  err = SetOffloads(device, dnet.Spec.Options.HostOffloads)
+  if err != nil {
+    return err
+  }
   ipvlan := &netlink.IPVlan {
     LinkAttrs: netlink.LinkAttrs {
-      Name:        outer[0:15],
       ParentIndex: iface.Attrs().Index,
       MTU:         iface.Attrs().MTU,
+      NumTxQueues: dnet.Spec.Options.TxQueues,
+      NumRxQueues: dnet.Spec.Options.RxQueues,
     },
     Mode: netlink.IPVLAN_MODE_L2,
+    Flag: getIpvlanFlag(dnet),
   }
-  err = netlink.LinkAdd(ipvlan)
+  tmpName, err := addIpvlanWithRetry(ipvlan, ep.Spec.EndpointID)
   if err != nil {
     return errors.New("cannot create IPVLAN interface because:" + err.Error())
   }
-  peer, err := netlink.LinkByName(outer[0:15])
+  // Queue steering is configured while the interface is still visible in the sysfs of the host
+  err = setQueueSteering(tmpName, dnet)
+  if err != nil {
+    netlink.LinkDel(ipvlan)
+    return errors.New("cannot set queue steering of IPVLAN interface because:" + err.Error())
+  }
+  peer, err := netlink.LinkByName(tmpName)
   if err != nil {
     return errors.New("cannot find created IPVLAN interface because:" + err.Error())
   }
-  err = netlink.LinkSetNsPid(peer, containerPid)
+  err = moveLinkWithRetry(peer, containerPid)
   if err != nil {
     netlink.LinkDel(peer)
     return errors.New("cannot move IPVLAN interface to netns because:" + err.Error())
@@ -83,7 +114,7 @@ func createContainerIface(ep danmtypes.DanmEp, dnet *danmtypes.DanmNet, device s
   if err != nil {
     return errors.New("failed to enter network namespace of CID:"+strconv.Itoa(containerPid)+" with error:"+err.Error())
   }
-  iface, err = netlink.LinkByName(outer[0:15])
+  iface, err = netlink.LinkByName(tmpName)
   if err != nil {
     return errors.New("cannot find IPVLAN interface in network namespace:" + err.Error())
   }
@@ -113,7 +144,7 @@ func createContainerIface(ep danmtypes.DanmEp, dnet *danmtypes.DanmNet, device s
     }
   }
   dstPrefix := dnet.Spec.Options.Prefix
-  err = netlink.LinkSetName(iface, dstPrefix)
+  err = renameLinkWithRetry(iface, dstPrefix)
   if err != nil {
     return errors.New("cannot rename IPVLAN interface because:" + err.Error())
   }
@@ -121,6 +152,10 @@ func createContainerIface(ep danmtypes.DanmEp, dnet *danmtypes.DanmNet, device s
   if err != nil {
     return errors.New("cannot set renamed IPVLAN interface to up because:" + err.Error())
   }
+  err = SetOffloads(dstPrefix, dnet.Spec.Options.PodOffloads)
+  if err != nil {
+    return err
+  }
   sendGratArps(ip, ip6, dstPrefix)
   // TODO: Refactor, duplicate of 156-176
   routes := dnet.Spec.Options.Routes
@@ -167,8 +202,16 @@ func createContainerIface(ep danmtypes.DanmEp, dnet *danmtypes.DanmNet, device s
       return errors.New("Adding IP route with destination:" + ipnet.String() + " and gateway:" + ip.String() + "failed with error:" + err.Error())
     }
   }
+  err = addMultipathRoutes(iface, dnet.Spec.Options.MultipathRoutes)
+  if err != nil {
+    return err
+  }
   // TODO: Refactor, duplicate of 212-244
   proutes := ep.Spec.Iface.Proutes
+  if ep.Spec.Iface.Address == "" {
+    //Policy-based IPv4 routes are meaningless without an IPv4 source address, e.g. on IPv6-only networks
+    proutes = nil
+  }
   if proutes != nil {
     srcIp, srcNet, _ := net.ParseCIDR(ep.Spec.Iface.Address)
     srcCidr := &net.IPNet{IP: srcIp, Mask: srcNet.Mask}
@@ -203,6 +246,9 @@ func createContainerIface(ep danmtypes.DanmEp, dnet *danmtypes.DanmNet, device s
     }
   }
   proutes6 := ep.Spec.Iface.Proutes6
+  if ep.Spec.Iface.AddressIPv6 == "" {
+    proutes6 = nil
+  }
   if proutes6 != nil {
     srcIp6, srcNet6, _ := net.ParseCIDR(ep.Spec.Iface.AddressIPv6)
     srcPref6 := &net.IPNet{IP: srcIp6, Mask: srcNet6.Mask}
@@ -304,6 +350,39 @@ func deleteDockerIface(ep danmtypes.DanmEp) error {
   return nil
 }
 
+// addMultipathRoutes installs every multipath route as one route with a nexthop per gateway, so the kernel spreads the flows between them (ECMP)
+// The weight of a nexthop is configured through its hops attribute, which the kernel increments by one
+func addMultipathRoutes(iface netlink.Link, routes []danmtypes.MultipathRoute) error {
+  for _, mpRoute := range routes {
+    _, ipnet, err := net.ParseCIDR(mpRoute.Destination)
+    if err != nil {
+      //Bad destination in IP route, ignoring the route
+      continue
+    }
+    route := netlink.Route{
+      Scope: netlink.SCOPE_UNIVERSE,
+      Dst:   ipnet,
+    }
+    for _, nexthop := range mpRoute.Nexthops {
+      gw := net.ParseIP(nexthop.Gateway)
+      if gw == nil {
+        //Bad gateway in IP route, ignoring the nexthop
+        continue
+      }
+      hops := 0
+      if nexthop.Weight > 1 {
+        hops = nexthop.Weight - 1
+      }
+      route.MultiPath = append(route.MultiPath, &netlink.NexthopInfo{LinkIndex: iface.Attrs().Index, Gw: gw, Hops: hops})
+    }
+    err = netlink.RouteAdd(&route)
+    if err != nil {
+      return errors.New("Adding multipath IP route with destination:" + ipnet.String() + " failed with error:" + err.Error())
+    }
+  }
+  return nil
+}
+
 func doesTargetContainerExist(ep danmtypes.DanmEp) bool{
   getDockerPid(ep)
   if containerPid == 0 {
@@ -328,21 +407,6 @@ func getDockerPid(ep danmtypes.DanmEp) {
   containerPid = c.State.Pid
 }
 
-func determineIfName(dnet *danmtypes.DanmNet) string {
-  var device string
-  isVlanDefined := (dnet.Spec.Options.Vlan!=0)
-  isVxlanDefined := (dnet.Spec.Options.Vxlan!=0)
-  if isVxlanDefined {
-    device = "vx_" + dnet.Spec.NetworkID
-  } else if isVlanDefined {
-    vlanId := strconv.Itoa(dnet.Spec.Options.Vlan)
-    device = dnet.Spec.NetworkID + "." + vlanId
-  } else {
-    device = dnet.Spec.Options.Device
-  }
-  return device
-}
-
 func deleteEp(ep danmtypes.DanmEp) error {
   if !doesTargetContainerExist(ep) {
     return errors.New("Cannot get container pid")
@@ -0,0 +1,34 @@
+package danmep
+
+import (
+  "github.com/vishvananda/netlink"
+  danmtypes "github.com/nokia/danm/pkg/crd/apis/danm/v1"
+  "github.com/nokia/danm/pkg/netspec"
+)
+
+// GetHostInterface returns the name of the host interface the IPVLAN slaves of the network are connected to on this host
+// VLAN, and VxLAN host interfaces adopted by netwatcher keep their original name, so they are looked up by their ownership marker
+// when no interface exists with the name DANM would give them
+func GetHostInterface(dnet *danmtypes.DanmNet) string {
+  name := netspec.GetHostInterface(dnet)
+  linkType := "vlan"
+  if dnet.Spec.Options.Vxlan != 0 {
+    linkType = "vxlan"
+  } else if dnet.Spec.Options.Vlan == 0 {
+    return name
+  }
+  if _, err := netlink.LinkByName(name); err == nil {
+    return name
+  }
+  links, err := netlink.LinkList()
+  if err != nil {
+    return name
+  }
+  alias := netspec.GetHostInterfaceAlias(dnet.Spec.NetworkID)
+  for _, link := range links {
+    if link.Type() == linkType && link.Attrs().Alias == alias {
+      return link.Attrs().Name
+    }
+  }
+  return name
+}
@@ -0,0 +1,113 @@
+package danmep
+
+import (
+  "errors"
+  "log"
+  "strconv"
+  "syscall"
+  "time"
+  "github.com/vishvananda/netlink"
+)
+
+const (
+  // maxLinkRetries is the number of times a netlink operation failing with a transient error is attempted
+  maxLinkRetries = 5
+  linkRetryBackoff = 50 * time.Millisecond
+)
+
+// isTransientLinkError tells whether a netlink operation failed because the kernel, or a concurrent CNI invocation was busy with the same object
+func isTransientLinkError(err error) bool {
+  errno, ok := err.(syscall.Errno)
+  if !ok {
+    return false
+  }
+  return errno == syscall.EBUSY || errno == syscall.EAGAIN
+}
+
+// isLinkNameTaken tells whether a link could not be created because its name is already used, e.g. by a leftover of an interrupted attempt
+// It is only worth retrying with another name, retrying a rename to the same name would fail the same way
+func isLinkNameTaken(err error) bool {
+  errno, ok := err.(syscall.Errno)
+  return ok && errno == syscall.EEXIST
+}
+
+// getTempLinkNames returns the host side names an IPVLAN interface of the endpoint can be created with, in the order they are tried
+// The names are derived from the EndpointID, so leftovers of interrupted attempts can be found later
+func getTempLinkNames(endpointID string) []string {
+  if len(endpointID) < 15 {
+    return nil
+  }
+  names := []string{endpointID[0:15]}
+  for i := 1; i < maxLinkRetries; i++ {
+    names = append(names, endpointID[0:13] + "-" + strconv.Itoa(i))
+  }
+  return names
+}
+
+func waitLinkRetry(attempt int, operation string, err error) {
+  log.Println("INFO: " + operation + " failed with transient error:" + err.Error() + ", retrying (attempt " + strconv.Itoa(attempt+1) + " of " + strconv.Itoa(maxLinkRetries) + ")")
+  time.Sleep(time.Duration(attempt+1) * linkRetryBackoff)
+}
+
+// addIpvlanWithRetry creates the IPVLAN interface, and tries the next temporary name if the previous one is already taken
+// It returns the name the interface was created with
+func addIpvlanWithRetry(ipvlan *netlink.IPVlan, endpointID string) (string,error) {
+  names := getTempLinkNames(endpointID)
+  if len(names) == 0 {
+    return "", errors.New("EndpointID:" + endpointID + " is too short to derive an interface name from")
+  }
+  var err error
+  for attempt, name := range names {
+    ipvlan.LinkAttrs.Name = name
+    err = netlink.LinkAdd(ipvlan)
+    if err == nil {
+      return name, nil
+    }
+    if !isTransientLinkError(err) && !isLinkNameTaken(err) {
+      return "", err
+    }
+    waitLinkRetry(attempt, "creating interface:" + name, err)
+  }
+  return "", err
+}
+
+// moveLinkWithRetry moves the link into the network namespace of the process
+func moveLinkWithRetry(link netlink.Link, pid int) error {
+  var err error
+  for attempt := 0; attempt < maxLinkRetries; attempt++ {
+    err = netlink.LinkSetNsPid(link, pid)
+    if err == nil || !isTransientLinkError(err) {
+      return err
+    }
+    waitLinkRetry(attempt, "moving interface:" + link.Attrs().Name, err)
+  }
+  return err
+}
+
+// renameLinkWithRetry renames the link, then verifies the new name really refers to it
+// A link is set down before the next attempt, because the kernel refuses to rename running interfaces with EBUSY
+func renameLinkWithRetry(link netlink.Link, name string) error {
+  var err error
+  for attempt := 0; attempt < maxLinkRetries; attempt++ {
+    err = netlink.LinkSetName(link, name)
+    if err == nil {
+      break
+    }
+    if !isTransientLinkError(err) {
+      return err
+    }
+    waitLinkRetry(attempt, "renaming interface:" + link.Attrs().Name + " to:" + name, err)
+    netlink.LinkSetDown(link)
+  }
+  if err != nil {
+    return err
+  }
+  renamed, err := netlink.LinkByName(name)
+  if err != nil {
+    return errors.New("cannot find interface after renaming it because:" + err.Error())
+  }
+  if renamed.Attrs().Index != link.Attrs().Index {
+    return errors.New("interface:" + name + " is not the renamed interface, but another one with index:" + strconv.Itoa(renamed.Attrs().Index))
+  }
+  return nil
+}
@@ -0,0 +1,159 @@
+package danmep
+
+import (
+  "encoding/binary"
+  "errors"
+  "net"
+  "syscall"
+  "github.com/vishvananda/netlink"
+  danmtypes "github.com/nokia/danm/pkg/crd/apis/danm/v1"
+)
+
+const (
+  mirrorFilterPriority = 100
+  ip4SrcOffset = 12
+  ip4DstOffset = 16
+)
+
+// Traffic of a Pod's IPVLAN interface is mirrored on the host device the IPVLAN slave is connected to.
+// Every packet entering the host device towards the Pod's IP, and every packet leaving the host device from the Pod's IP is copied to the monitoring interface with tc mirred
+// The mirroring rules are matched on the IPv4 address of the Pod, so they are automatically scoped to exactly one DanmEp
+func setupTrafficMirror(dnet *danmtypes.DanmNet, ep danmtypes.DanmEp) error {
+  if ep.Spec.Iface.Mirror == "" {
+    return nil
+  }
+  podIp, err := getMirroredIp(ep)
+  if err != nil {
+    return err
+  }
+  hostDevice, err := netlink.LinkByName(GetHostInterface(dnet))
+  if err != nil {
+    return errors.New("cannot find host device of mirrored interface because:" + err.Error())
+  }
+  monitorDevice, err := netlink.LinkByName(ep.Spec.Iface.Mirror)
+  if err != nil {
+    return errors.New("cannot find traffic mirroring target device:" + ep.Spec.Iface.Mirror + " because:" + err.Error())
+  }
+  err = addClsactQdisc(hostDevice)
+  if err != nil {
+    return errors.New("cannot add clsact qdisc to host device:" + hostDevice.Attrs().Name + " because:" + err.Error())
+  }
+  err = netlink.FilterAdd(createMirrorFilter(hostDevice, monitorDevice, netlink.HANDLE_MIN_INGRESS, ip4DstOffset, podIp))
+  if err != nil {
+    return errors.New("cannot add ingress traffic mirroring filter because:" + err.Error())
+  }
+  err = netlink.FilterAdd(createMirrorFilter(hostDevice, monitorDevice, netlink.HANDLE_MIN_EGRESS, ip4SrcOffset, podIp))
+  if err != nil {
+    deleteMirrorFilters(hostDevice, netlink.HANDLE_MIN_INGRESS, podIp, monitorDevice.Attrs().Index)
+    return errors.New("cannot add egress traffic mirroring filter because:" + err.Error())
+  }
+  return nil
+}
+
+func getMirroredIp(ep danmtypes.DanmEp) (uint32, error) {
+  ip, _, err := net.ParseCIDR(ep.Spec.Iface.Address)
+  if err != nil || ip.To4() == nil {
+    return 0, errors.New("traffic mirroring is only supported for interfaces having an IPv4 address")
+  }
+  return binary.BigEndian.Uint32(ip.To4()), nil
+}
+
+func addClsactQdisc(link netlink.Link) error {
+  qdiscs, err := netlink.QdiscList(link)
+  if err != nil {
+    return err
+  }
+  for _, qdisc := range qdiscs {
+    if qdisc.Type() == "clsact" {
+      return nil
+    }
+  }
+  clsact := &netlink.GenericQdisc {
+    QdiscAttrs: netlink.QdiscAttrs {
+      LinkIndex: link.Attrs().Index,
+      Handle:    netlink.MakeHandle(0xffff, 0),
+      Parent:    netlink.HANDLE_CLSACT,
+    },
+    QdiscType: "clsact",
+  }
+  return netlink.QdiscAdd(clsact)
+}
+
+func createMirrorFilter(hostDevice, monitorDevice netlink.Link, parent uint32, offset int32, ip uint32) *netlink.U32 {
+  mirror := netlink.NewMirredAction(monitorDevice.Attrs().Index)
+  mirror.MirredAction = netlink.TCA_EGRESS_MIRROR
+  mirror.Action = netlink.TC_ACT_PIPE
+  return &netlink.U32 {
+    FilterAttrs: netlink.FilterAttrs {
+      LinkIndex: hostDevice.Attrs().Index,
+      Parent:    parent,
+      Priority:  mirrorFilterPriority,
+      Protocol:  syscall.ETH_P_IP,
+    },
+    Sel: &netlink.TcU32Sel {
+      Flags: netlink.TC_U32_TERMINAL,
+      Keys: []netlink.TcU32Key {
+        netlink.TcU32Key {
+          Mask: 0xffffffff,
+          Val:  ip,
+          Off:  offset,
+        },
+      },
+    },
+    Actions: []netlink.Action{mirror},
+  }
+}
+
+func deleteTrafficMirror(dnet *danmtypes.DanmNet, ep danmtypes.DanmEp) error {
+  if ep.Spec.Iface.Mirror == "" || dnet == nil {
+    return nil
+  }
+  podIp, err := getMirroredIp(ep)
+  if err != nil {
+    return err
+  }
+  hostDevice, err := netlink.LinkByName(GetHostInterface(dnet))
+  if err != nil {
+    //Host device is already gone, together with all of its filters
+    return nil
+  }
+  monitorIndex := 0
+  monitorDevice, err := netlink.LinkByName(ep.Spec.Iface.Mirror)
+  if err == nil {
+    monitorIndex = monitorDevice.Attrs().Index
+  }
+  ingressErr := deleteMirrorFilters(hostDevice, netlink.HANDLE_MIN_INGRESS, podIp, monitorIndex)
+  egressErr := deleteMirrorFilters(hostDevice, netlink.HANDLE_MIN_EGRESS, podIp, monitorIndex)
+  if ingressErr != nil {
+    return ingressErr
+  }
+  return egressErr
+}
+
+// Only the filters matching the IP of the Pod are deleted, mirroring rules belonging to other Pods are left intact
+// If the monitoring device does not exist anymore, all the mirroring filters of the Pod are deleted regardless of their target
+func deleteMirrorFilters(hostDevice netlink.Link, parent uint32, ip uint32, monitorIndex int) error {
+  filters, err := netlink.FilterList(hostDevice, parent)
+  if err != nil {
+    return errors.New("cannot list tc filters of host device:" + hostDevice.Attrs().Name + " because:" + err.Error())
+  }
+  for _, filter := range filters {
+    u32, ok := filter.(*netlink.U32)
+    if !ok || u32.Priority != mirrorFilterPriority || u32.Sel == nil {
+      continue
+    }
+    if monitorIndex != 0 && u32.RedirIndex != monitorIndex {
+      continue
+    }
+    for _, key := range u32.Sel.Keys {
+      if key.Val == ip && key.Mask == 0xffffffff {
+        err = netlink.FilterDel(u32)
+        if err != nil {
+          return errors.New("cannot delete traffic mirroring filter because:" + err.Error())
+        }
+        break
+      }
+    }
+  }
+  return nil
+}
@@ -0,0 +1,48 @@
+package danmep
+
+import (
+  meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+  danmtypes "github.com/nokia/danm/pkg/crd/apis/danm/v1"
+)
+
+// NewNetworkCache copies the attributes of the DanmNet needed to tear the interface of a DanmEp down
+func NewNetworkCache(dnet *danmtypes.DanmNet) *danmtypes.DanmEpNetwork {
+  opts := dnet.Spec.Options
+  return &danmtypes.DanmEpNetwork {
+    Device: opts.Device,
+    Prefix: opts.Prefix,
+    Cidr: opts.Cidr,
+    Net6: opts.Net6,
+    Vlan: opts.Vlan,
+    Vxlan: opts.Vxlan,
+    Dpdk: opts.Dpdk,
+  }
+}
+
+// RestoreNetwork rebuilds the DanmNet of the DanmEp from its cached attributes, e.g. because the DanmNet was already deleted
+// DanmEps created by older releases have no cache, so only the identity, and the type of their network can be restored
+// The restored network never has an allocation record, so addresses cannot be freed from it
+func RestoreNetwork(ep danmtypes.DanmEp) *danmtypes.DanmNet {
+  dnet := &danmtypes.DanmNet {
+    ObjectMeta: meta_v1.ObjectMeta{Name: ep.Spec.NetworkID, Namespace: ep.ObjectMeta.Namespace},
+    Spec: danmtypes.DanmNetSpec {
+      NetworkID: ep.Spec.NetworkID,
+      NetworkType: ep.Spec.NetworkType,
+      Options: danmtypes.DanmNetOption{Prefix: ep.Spec.Iface.Name},
+    },
+  }
+  cache := ep.Spec.Network
+  if cache == nil {
+    return dnet
+  }
+  dnet.Spec.Options = danmtypes.DanmNetOption {
+    Device: cache.Device,
+    Prefix: cache.Prefix,
+    Cidr: cache.Cidr,
+    Net6: cache.Net6,
+    Vlan: cache.Vlan,
+    Vxlan: cache.Vxlan,
+    Dpdk: cache.Dpdk,
+  }
+  return dnet
+}
@@ -0,0 +1,119 @@
+package danmep
+
+import (
+  "errors"
+  "runtime"
+  "syscall"
+  "unsafe"
+  "github.com/vishvananda/netns"
+  danmtypes "github.com/nokia/danm/pkg/crd/apis/danm/v1"
+)
+
+// Legacy ethtool commands, supported by all kernels DANM runs on
+const (
+  siocEthtool = 0x8946
+  ethtoolSetTso = 0x1f
+  ethtoolSetGso = 0x24
+  ethtoolGetFlags = 0x25
+  ethtoolSetFlags = 0x26
+  ethtoolSetGro = 0x2c
+  ethFlagLro = 1 << 15
+)
+
+type ethtoolValue struct {
+  cmd uint32
+  data uint32
+}
+
+type ifreq struct {
+  name [syscall.IFNAMSIZ]byte
+  data uintptr
+  pad [16]byte
+}
+
+// SetOffloads switches the offload features configured in offloads on, or off on the interface of the current network namespace
+// Features omitted from the configuration are left untouched
+func SetOffloads(ifaceName string, offloads *danmtypes.Offloads) error {
+  if offloads == nil {
+    return nil
+  }
+  sock, err := syscall.Socket(syscall.AF_INET, syscall.SOCK_DGRAM, 0)
+  if err != nil {
+    return errors.New("cannot open ethtool socket because:" + err.Error())
+  }
+  defer syscall.Close(sock)
+  for _, feature := range []struct{name string; cmd uint32; enabled *bool}{{"gro", ethtoolSetGro, offloads.Gro}, {"gso", ethtoolSetGso, offloads.Gso}, {"tso", ethtoolSetTso, offloads.Tso}} {
+    if feature.enabled == nil {
+      continue
+    }
+    value := ethtoolValue{cmd: feature.cmd, data: boolToData(*feature.enabled)}
+    err = ethtool(sock, ifaceName, &value)
+    if err != nil {
+      return errors.New("cannot set " + feature.name + " offload of interface:" + ifaceName + " because:" + err.Error())
+    }
+  }
+  if offloads.Lro == nil {
+    return nil
+  }
+  flags := ethtoolValue{cmd: ethtoolGetFlags}
+  err = ethtool(sock, ifaceName, &flags)
+  if err == nil {
+    if *offloads.Lro {
+      flags.data |= ethFlagLro
+    } else {
+      flags.data &^= ethFlagLro
+    }
+    flags.cmd = ethtoolSetFlags
+    err = ethtool(sock, ifaceName, &flags)
+  }
+  if err != nil {
+    return errors.New("cannot set lro offload of interface:" + ifaceName + " because:" + err.Error())
+  }
+  return nil
+}
+
+// SetOffloadsInNs switches the offload features of an interface living in the network namespace of the given path
+func SetOffloadsInNs(nsPath, ifaceName string, offloads *danmtypes.Offloads) error {
+  if offloads == nil {
+    return nil
+  }
+  runtime.LockOSThread()
+  defer runtime.UnlockOSThread()
+  origns, err := netns.Get()
+  if err != nil {
+    return errors.New("getting current namespace failed")
+  }
+  defer origns.Close()
+  targetns, err := netns.GetFromPath(nsPath)
+  if err != nil {
+    return errors.New("cannot open network namespace:" + nsPath + " because:" + err.Error())
+  }
+  defer targetns.Close()
+  err = netns.Set(targetns)
+  if err != nil {
+    return errors.New("cannot enter network namespace:" + nsPath + " because:" + err.Error())
+  }
+  defer netns.Set(origns)
+  return SetOffloads(ifaceName, offloads)
+}
+
+func boolToData(enabled bool) uint32 {
+  if enabled {
+    return 1
+  }
+  return 0
+}
+
+func ethtool(sock int, ifaceName string, value *ethtoolValue) error {
+  if len(ifaceName) >= syscall.IFNAMSIZ {
+    return errors.New("interface name is too long")
+  }
+  req := ifreq{data: uintptr(unsafe.Pointer(value))}
+  copy(req.name[:], ifaceName)
+  _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(sock), siocEthtool, uintptr(unsafe.Pointer(&req)))
+  runtime.KeepAlive(value)
+  if errno != 0 {
+    return errno
+  }
+  return nil
+}
@@ -0,0 +1,90 @@
+package danmep
+
+import (
+  "encoding/json"
+  "errors"
+  "runtime"
+  "strconv"
+  "github.com/vishvananda/netlink"
+  "github.com/vishvananda/netns"
+  apierrors "k8s.io/apimachinery/pkg/api/errors"
+  "k8s.io/apimachinery/pkg/types"
+  danmtypes "github.com/nokia/danm/pkg/crd/apis/danm/v1"
+  danmclientset "github.com/nokia/danm/pkg/crd/client/clientset/versioned"
+  "github.com/nokia/danm/pkg/apiretry"
+)
+
+const (
+  // PhaseCreating means that the DanmEp is stored, but its interface might not be wired into the Pod yet
+  PhaseCreating = "Creating"
+  // PhaseReady means that the interface of the DanmEp is fully wired
+  PhaseReady = "Ready"
+  // PhaseDeleting means that the CNI could not confirm the removal of the interface, and left the DanmEp for the repair controller
+  PhaseDeleting = "Deleting"
+)
+
+// SetPhase records the phase of the DanmEp in the API
+// The phase is owned by DANM, so it is set with a merge patch touching only this field, instead of a read-modify-write update
+// racing with the label, and annotation changes of other components
+// The patch is refused if the DanmEp was re-created meanwhile
+func SetPhase(client danmclientset.Interface, ep danmtypes.DanmEp, phase string) error {
+  patch := map[string]interface{} {
+    "spec": map[string]interface{}{"Phase": phase},
+  }
+  if ep.ObjectMeta.UID != "" {
+    patch["metadata"] = map[string]interface{}{"uid": ep.ObjectMeta.UID}
+  }
+  data, err := json.Marshal(patch)
+  if err != nil {
+    return err
+  }
+  return apiretry.Do(apiretry.DefaultBackoff, func() error {
+    _, err := client.DanmV1().DanmEps(ep.ObjectMeta.Namespace).Patch(ep.ObjectMeta.Name, types.MergePatchType, data)
+    if apierrors.IsConflict(err) {
+      return errors.New("DanmEp:" + ep.ObjectMeta.Name + " was re-created meanwhile")
+    }
+    return err
+  })
+}
+
+// IsInterfaceCreated returns whether the interface of the DanmEp exists with its final name in the network namespace of its alive container
+func IsInterfaceCreated(ep danmtypes.DanmEp) (bool,error) {
+  if !doesTargetContainerExist(ep) {
+    return false, nil
+  }
+  runtime.LockOSThread()
+  defer runtime.UnlockOSThread()
+  origns, err := netns.Get()
+  if err != nil {
+    return false, errors.New("getting the current netNS failed")
+  }
+  defer origns.Close()
+  hns, err := netns.GetFromPid(containerPid)
+  if err != nil {
+    return false, errors.New("cannot open network namespace:" + strconv.Itoa(containerPid))
+  }
+  defer hns.Close()
+  err = netns.Set(hns)
+  if err != nil {
+    return false, errors.New("failed to enter network namespace" + strconv.Itoa(containerPid))
+  }
+  defer netns.Set(origns)
+  _, err = netlink.LinkByName(ep.Spec.Iface.Name)
+  return err == nil, nil
+}
+
+// DeleteHostLeftover deletes the IPVLAN interface of the DanmEp from the host network namespace
+// The interface is left there if the CNI was interrupted between creating it, and moving it into the Pod
+func DeleteHostLeftover(ep danmtypes.DanmEp) error {
+  for _, name := range getTempLinkNames(ep.Spec.EndpointID) {
+    link, err := netlink.LinkByName(name)
+    if err != nil {
+      continue
+    }
+    err = netlink.LinkDel(link)
+    if err != nil {
+      return err
+    }
+  }
+  return nil
+}
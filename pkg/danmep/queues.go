@@ -0,0 +1,38 @@
+package danmep
+
+import (
+  "errors"
+  "io/ioutil"
+  "path/filepath"
+  danmtypes "github.com/nokia/danm/pkg/crd/apis/danm/v1"
+)
+
+var (
+  sysClassNet = "/sys/class/net"
+)
+
+// setQueueSteering writes the RPS and XPS CPU masks configured in the DanmNet to all the receive, and transmit queues of the interface
+func setQueueSteering(ifaceName string, dnet *danmtypes.DanmNet) error {
+  err := writeQueueAttribute(ifaceName, "rx-*", "rps_cpus", dnet.Spec.Options.RpsCpus)
+  if err != nil {
+    return err
+  }
+  return writeQueueAttribute(ifaceName, "tx-*", "xps_cpus", dnet.Spec.Options.XpsCpus)
+}
+
+func writeQueueAttribute(ifaceName, queuePattern, attribute, mask string) error {
+  if mask == "" {
+    return nil
+  }
+  queues, err := filepath.Glob(filepath.Join(sysClassNet, ifaceName, "queues", queuePattern))
+  if err != nil {
+    return errors.New("cannot list queues of interface:" + ifaceName + " because:" + err.Error())
+  }
+  for _, queue := range queues {
+    err = ioutil.WriteFile(filepath.Join(queue, attribute), []byte(mask), 0644)
+    if err != nil {
+      return errors.New("cannot set " + attribute + " of queue:" + filepath.Base(queue) + " because:" + err.Error())
+    }
+  }
+  return nil
+}
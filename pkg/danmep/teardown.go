@@ -0,0 +1,52 @@
+package danmep
+
+import (
+  "errors"
+  "time"
+  "github.com/vishvananda/netlink"
+  danmtypes "github.com/nokia/danm/pkg/crd/apis/danm/v1"
+  "github.com/nokia/danm/pkg/netspec"
+)
+
+const (
+  teardownChecks = 5
+  teardownCheckInterval = 100*time.Millisecond
+)
+
+// VerifyTeardown confirms through netlink that the interface of the DanmEp has really disappeared
+// The interface must be gone from the network namespace of the container if it is still alive, so an IPVLAN slave is deleted, and a VF is given back to the host pool of its PF
+// IPVLAN interfaces must not be left in the host network namespace either
+// The kernel can finish the removal asynchronously, so the check is repeated a few times before giving up
+func VerifyTeardown(ep danmtypes.DanmEp) error {
+  var err error
+  for check := 0; check < teardownChecks; check++ {
+    if check > 0 {
+      time.Sleep(teardownCheckInterval)
+    }
+    err = checkTeardown(ep)
+    if err == nil {
+      return nil
+    }
+  }
+  return err
+}
+
+func checkTeardown(ep danmtypes.DanmEp) error {
+  isPresent, err := IsInterfaceCreated(ep)
+  if err != nil {
+    return err
+  }
+  if isPresent {
+    return errors.New("interface:" + ep.Spec.Iface.Name + " still exists in the network namespace of container:" + ep.Spec.CID)
+  }
+  if !netspec.IsIpvlanEp(&ep) {
+    return nil
+  }
+  for _, name := range getTempLinkNames(ep.Spec.EndpointID) {
+    _, err = netlink.LinkByName(name)
+    if err == nil {
+      return errors.New("IPVLAN interface:" + name + " still exists in the host network namespace")
+    }
+  }
+  return nil
+}
@@ -0,0 +1,54 @@
+package danmep_test
+
+import (
+  "testing"
+  meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+  "k8s.io/apimachinery/pkg/types"
+  danmtypes "github.com/nokia/danm/pkg/crd/apis/danm/v1"
+  "github.com/nokia/danm/pkg/danmep"
+  "github.com/nokia/danm/pkg/stubs"
+)
+
+var testEp = danmtypes.DanmEp {
+  ObjectMeta: meta_v1.ObjectMeta{Name: "pod-eth0", Namespace: "default", UID: "ep-uid", Labels: map[string]string{"app": "old"}},
+  Spec: danmtypes.DanmEpSpec{Pod: "pod", Phase: danmep.PhaseCreating},
+}
+
+func TestSetPhaseKeepsConcurrentLabelChange(t *testing.T) {
+  server := stubs.NewFakeApiServer(0, nil, []danmtypes.DanmEp{testEp})
+  //Labels are changed by another component after the CNI read the DanmEp
+  labelPatch := []byte(`{"metadata":{"labels":{"app":"new"}}}`)
+  _, err := server.DanmV1().DanmEps(testEp.Namespace).Patch(testEp.Name, types.MergePatchType, labelPatch)
+  if err != nil {
+    t.Fatalf("Label patch failed with error:%v", err)
+  }
+  err = danmep.SetPhase(server, testEp, danmep.PhaseReady)
+  if err != nil {
+    t.Fatalf("SetPhase failed with error:%v", err)
+  }
+  ep, _ := server.DanmV1().DanmEps(testEp.Namespace).Get(testEp.Name, meta_v1.GetOptions{})
+  if ep.Spec.Phase != danmep.PhaseReady {
+    t.Errorf("Phase of the DanmEp is:%s, expected:%s", ep.Spec.Phase, danmep.PhaseReady)
+  }
+  if ep.ObjectMeta.Labels["app"] != "new" {
+    t.Errorf("Concurrently changed label of the DanmEp was overwritten, got:%s", ep.ObjectMeta.Labels["app"])
+  }
+  _, _, conflicts := server.Stats()
+  if conflicts != 0 {
+    t.Errorf("Setting the phase caused %d conflicts", conflicts)
+  }
+}
+
+func TestSetPhaseRefusesRecreatedEp(t *testing.T) {
+  recreatedEp := testEp
+  recreatedEp.ObjectMeta.UID = "new-uid"
+  server := stubs.NewFakeApiServer(0, nil, []danmtypes.DanmEp{recreatedEp})
+  err := danmep.SetPhase(server, testEp, danmep.PhaseReady)
+  if err == nil {
+    t.Fatalf("Phase of a re-created DanmEp was set")
+  }
+  ep, _ := server.DanmV1().DanmEps(testEp.Namespace).Get(testEp.Name, meta_v1.GetOptions{})
+  if ep.Spec.Phase != danmep.PhaseCreating {
+    t.Errorf("Phase of the re-created DanmEp was changed to:%s", ep.Spec.Phase)
+  }
+}
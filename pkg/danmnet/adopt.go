@@ -0,0 +1,99 @@
+package danmnet
+
+import (
+  "errors"
+  "log"
+  "strconv"
+  "strings"
+  "github.com/vishvananda/netlink"
+)
+
+// adoptHostInterface takes over an already existing VLAN, or VxLAN host interface of the network, e.g. created manually, or by a previous installation
+// The interface is only adopted if its type, ID, and parent device match the network, then it is marked as owned, so it is deleted together with the DanmNet
+// Interfaces already owned by another DanmNet are never taken over
+func adoptHostInterface(link netlink.Link, linkType string, ifId int, netId, hostDevice string) error {
+  name := link.Attrs().Name
+  if IsDanmOwned(link) {
+    if link.Attrs().Alias != getHostInterfaceAlias(netId) {
+      return errors.New("host interface:" + name + " is already owned by DanmNet:" + strings.TrimPrefix(link.Attrs().Alias, HostInterfaceAliasPrefix))
+    }
+    return nil
+  }
+  parent, err := netlink.LinkByName(hostDevice)
+  if err != nil {
+    return errors.New("host device:" + hostDevice + " is not present in the system")
+  }
+  err = verifyHostInterface(link, linkType, ifId, parent.Attrs().Index)
+  if err != nil {
+    return errors.New("existing host interface:" + name + " cannot be adopted, because " + err.Error())
+  }
+  err = netlink.LinkSetAlias(link, getHostInterfaceAlias(netId))
+  if err != nil {
+    return errors.New("ownership of existing host interface:" + name + " cannot be marked because:" + err.Error())
+  }
+  err = netlink.LinkSetUp(link)
+  if err != nil {
+    return err
+  }
+  log.Println("INFO: Existing host interface:" + name + " was adopted by DanmNet:" + netId)
+  return nil
+}
+
+// findHostInterface looks for an existing VLAN, or VxLAN host interface with the ID, and parent device of the network, whatever its name is
+// Adopted interfaces keep their original name, so they can be found later only by their ownership marker
+func findHostInterface(linkType string, ifId, parentIndex int) (netlink.Link, error) {
+  links, err := netlink.LinkList()
+  if err != nil {
+    return nil, errors.New("cannot list host interfaces because:" + err.Error())
+  }
+  for _, link := range links {
+    if verifyHostInterface(link, linkType, ifId, parentIndex) == nil {
+      return link, nil
+    }
+  }
+  return nil, nil
+}
+
+// findOwnedHostInterface returns the host interface of the given type owned by the network, or nil if there is none
+func findOwnedHostInterface(linkType, netId string) netlink.Link {
+  links, err := netlink.LinkList()
+  if err != nil {
+    return nil
+  }
+  for _, link := range links {
+    if link.Type() == linkType && link.Attrs().Alias == getHostInterfaceAlias(netId) {
+      return link
+    }
+  }
+  return nil
+}
+
+// isLegacyHostInterface tells if an interface without ownership marker was created for the network by a DANM release predating the marker
+// Such interfaces were always named by DANM, so besides the name, their type, ID, and parent device must also match the network
+func isLegacyHostInterface(link netlink.Link, linkType string, ifId int, hostDevice string) bool {
+  parent, err := netlink.LinkByName(hostDevice)
+  if err != nil {
+    return false
+  }
+  return verifyHostInterface(link, linkType, ifId, parent.Attrs().Index) == nil
+}
+
+func verifyHostInterface(link netlink.Link, linkType string, ifId, parentIndex int) error {
+  if link.Type() != linkType {
+    return errors.New("it is a " + link.Type() + " interface instead of " + linkType)
+  }
+  var actualId, actualParent int
+  switch typedLink := link.(type) {
+  case *netlink.Vlan:
+    actualId, actualParent = typedLink.VlanId, typedLink.Attrs().ParentIndex
+  case *netlink.Vxlan:
+    actualId, actualParent = typedLink.VxlanId, typedLink.VtepDevIndex
+  }
+  if actualId != ifId {
+    return errors.New("its ID is " + strconv.Itoa(actualId) + " instead of " + strconv.Itoa(ifId))
+  }
+  if actualParent != parentIndex {
+    return errors.New("it is not connected to the host device of the network")
+  }
+  return nil
+}
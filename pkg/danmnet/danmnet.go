@@ -1,13 +1,19 @@
 package danmnet
 
 import (
+  "errors"
   "log"
   "strings"
   "time"
   "reflect"
+  "github.com/vishvananda/netlink"
+  apierrors "k8s.io/apimachinery/pkg/api/errors"
+  meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
   "k8s.io/client-go/rest"
   "k8s.io/client-go/tools/cache"
   danmtypes "github.com/nokia/danm/pkg/crd/apis/danm/v1"
+  "github.com/nokia/danm/pkg/allocmigration"
+  "github.com/nokia/danm/pkg/compat"
   danmclientset "github.com/nokia/danm/pkg/crd/client/clientset/versioned"
   danminformers "github.com/nokia/danm/pkg/crd/client/informers/externalversions"
 )
@@ -16,19 +22,53 @@ import (
 // Upon the reception of a notification it validates the body, and handles the related VxLAN/VLAN/RT creation/deletions on the host
 type Handler struct {
   client danmclientset.Interface
+  queue *DeviceWorkQueue
+  tenantConfig *TenantConfig
+  reservedAddresses *ReservedAddresses
+  shadow *ShadowConfig
+  status *StatusWriter
+}
+
+// HandlerOptions contains the tunable parameters of a Handler
+type HandlerOptions struct {
+  // NumOfWorkers is the number of DanmNets processed in parallel
+  NumOfWorkers int
+  // TenantConfig restricts the host resources the DanmNets of a namespace can use. No restriction is applied if nil
+  TenantConfig *TenantConfig
+  // ReservedAddresses are never allocated to Pods from the DanmNets validated by the Handler. Nothing is reserved if nil
+  ReservedAddresses *ReservedAddresses
+  // Shadow lists the validation rules which only report the DanmNets they would find invalid. All rules are enforced if nil
+  Shadow *ShadowConfig
+  // StatusBatchInterval is the period of writing the validity of DanmNets to the API in batches. Validity is written immediately if 0
+  StatusBatchInterval time.Duration
+  // StatusBatchSize is the maximum number of DanmNets written in one StatusBatchInterval
+  StatusBatchSize int
 }
 
 // NewHandler initializes and returns a new Handler object
 // Upon the reception of a notification it performs DanmNet validation, and host network management operations
 // Handler contains additional members: one performing HTTPS operations, the other to interact with DamnEp objects
-func NewHandler(cfg *rest.Config) (Handler,error) {
-  danmnethandler := Handler{}
+// Notifications are processed by parallel workers, but operations touching the same host device are always serialized
+// Validity updates are written in batches, if StatusBatchInterval is set
+func NewHandler(cfg *rest.Config, opts HandlerOptions) (Handler,error) {
   client, err := danmclientset.NewForConfig(cfg)
   if err != nil {
-    return danmnethandler, err
+    return Handler{}, err
   }
+  return NewHandlerForClientset(client, opts), nil
+}
+
+// NewHandlerForClientset initializes a Handler using an already existing DANM clientset, e.g. a fake one in unit tests
+func NewHandlerForClientset(client danmclientset.Interface, opts HandlerOptions) Handler {
+  danmnethandler := Handler{}
   danmnethandler.client = client
-  return danmnethandler, nil
+  danmnethandler.queue = NewDeviceWorkQueue(opts.NumOfWorkers)
+  danmnethandler.tenantConfig = opts.TenantConfig
+  danmnethandler.reservedAddresses = opts.ReservedAddresses
+  danmnethandler.shadow = opts.Shadow
+  danmnethandler.status = NewStatusWriter(client, opts.StatusBatchInterval, opts.StatusBatchSize)
+  go danmnethandler.status.Run(make(chan struct{}))
+  return danmnethandler
 }
 
 func (dnetHandler Handler) CreateController() cache.Controller {
@@ -36,10 +76,28 @@ func (dnetHandler Handler) CreateController() cache.Controller {
   controller := danmInformerFactory.Danm().V1().DanmNets().Informer()
   controller.AddEventHandler(cache.ResourceEventHandlerFuncs{
       AddFunc: func(obj interface{}) {
-        addDanmNet(dnetHandler.client, *(reflect.ValueOf(obj).Interface().(*danmtypes.DanmNet)))
+        dn := *(reflect.ValueOf(obj).Interface().(*danmtypes.DanmNet))
+        dnetHandler.queue.Push(getSerializationKey(dn.Spec.Options.Device, dn.Spec.NetworkID), getNetworkKey(dn), "add", func() {
+          addDanmNet(dnetHandler, dn)
+        })
       },
       DeleteFunc: func(obj interface{}) {
-        deleteDanmNet(*(reflect.ValueOf(obj).Interface().(*danmtypes.DanmNet))) 
+        dn, ok := obj.(*danmtypes.DanmNet)
+        if !ok {
+          tombstone, isTombstone := obj.(cache.DeletedFinalStateUnknown)
+          if !isTombstone {
+            return
+          }
+          dn, ok = tombstone.Obj.(*danmtypes.DanmNet)
+          if !ok {
+            return
+          }
+        }
+        deletedNet := *dn
+        dnetHandler.status.Discard(&deletedNet)
+        dnetHandler.queue.Push(getSerializationKey(deletedNet.Spec.Options.Device, deletedNet.Spec.NetworkID), getNetworkKey(deletedNet), "delete", func() {
+          deleteDanmNet(deletedNet)
+        })
       },
       UpdateFunc: func(oldObj, newObj interface{}) {
      },
@@ -47,6 +105,85 @@ func (dnetHandler Handler) CreateController() cache.Controller {
   return controller
 }
 
+// CollectOrphanedHostInterfaces deletes all DANM owned host interfaces whose DanmNet does not exist anymore
+// This can happen when a DanmNet is deleted while netwatcher is not running on the host
+// Host interfaces not carrying DANM's ownership marker are never deleted
+func (dnetHandler Handler) CollectOrphanedHostInterfaces() {
+  danmLinks, err := GetDanmHostInterfaces()
+  if err != nil {
+    log.Println("ERROR: Host interface garbage collection failed with error:" + err.Error())
+    return
+  }
+  nets, err := dnetHandler.client.DanmV1().DanmNets("").List(meta_v1.ListOptions{})
+  if err != nil {
+    log.Println("ERROR: Host interface garbage collection failed, DanmNets cannot be listed because:" + err.Error())
+    return
+  }
+  existingNets := make(map[string]bool)
+  for _, dnet := range nets.Items {
+    existingNets[dnet.Spec.NetworkID] = true
+  }
+  for netId, links := range danmLinks {
+    if existingNets[netId] {
+      continue
+    }
+    for _, link := range links {
+      err = netlink.LinkDel(link)
+      if err != nil {
+        log.Println("ERROR: Deletion of orphaned host interface:" + link.Attrs().Name + " failed with error:" + err.Error())
+        continue
+      }
+      log.Println("INFO: Orphaned host interface:" + link.Attrs().Name + " of deleted DanmNet:" + netId + " was deleted")
+    }
+  }
+}
+
+// MigrateAllocations converts the allocation record of all the DanmNets in the cluster to the target format, or rolls back the last migration
+// DanmNets are converted in place with optimistic locking, so netwatchers running on different hosts can safely execute it at the same time
+// Migration of a network is aborted if its allocations cannot be verified after conversion, leaving the original record intact
+func (dnetHandler Handler) MigrateAllocations(target string, rollback bool) {
+  nets, err := dnetHandler.client.DanmV1().DanmNets("").List(meta_v1.ListOptions{})
+  if err != nil {
+    log.Println("ERROR: Allocation migration failed, DanmNets cannot be listed because:" + err.Error())
+    return
+  }
+  for _, dnet := range nets.Items {
+    err = migrateAllocation(dnetHandler.client, dnet, target, rollback)
+    if err != nil {
+      log.Println("ERROR: Allocation migration of DanmNet:" + dnet.Spec.NetworkID + " failed with error:" + err.Error())
+    }
+  }
+}
+
+func migrateAllocation(client danmclientset.Interface, dnet danmtypes.DanmNet, target string, rollback bool) error {
+  for {
+    var wasModified bool
+    var err error
+    if rollback {
+      wasModified, err = allocmigration.Rollback(&dnet)
+    } else {
+      wasModified, err = allocmigration.Migrate(&dnet, target)
+    }
+    if err != nil || !wasModified {
+      return err
+    }
+    wasAlreadyUpdated, err := PutDanmNet(client, &dnet)
+    if err != nil {
+      return err
+    }
+    if !wasAlreadyUpdated {
+      log.Println("INFO: Allocation record of DanmNet:" + dnet.Spec.NetworkID + " was migrated to format:" + allocmigration.GetFormat(&dnet))
+      return nil
+    }
+    //Allocations were concurrently modified, the migration is re-done on the latest version of the network
+    newNet, err := client.DanmV1().DanmNets(dnet.ObjectMeta.Namespace).Get(dnet.ObjectMeta.Name, meta_v1.GetOptions{})
+    if err != nil {
+      return err
+    }
+    dnet = *newNet
+  }
+}
+
 func PutDanmNet(client danmclientset.Interface, dnet *danmtypes.DanmNet) (bool,error) {
   var wasResourceAlreadyUpdated bool = false
   _, err := client.DanmV1().DanmNets(dnet.Namespace).Update(dnet)
@@ -63,9 +200,18 @@ func PutDanmNet(client danmclientset.Interface, dnet *danmtypes.DanmNet) (bool,e
 // validate DanmNet body
 // update validity in apiserver, don't care for 409 (PATCH or PUT)
 // create host specific network stuff: rt_tables, vlan, and vxlan interfaces
-func addDanmNet(client danmclientset.Interface, dn danmtypes.DanmNet) {
+func addDanmNet(dnetHandler Handler, dn danmtypes.DanmNet) {
+  client := dnetHandler.client
   if dn.Spec.Validation != "" && dn.Spec.Validation == "True" {
-    err := setupHost(&dn)
+    //The tenant configuration might have changed since the network was validated, so it is still enforced before touching the host
+    err := dnetHandler.tenantConfig.Authorize(&dn)
+    if err != nil && !dnetHandler.shadow.Tolerate(TenantRuleName, &dn, err) {
+      invalidate(&dn)
+      dnetHandler.status.Write(&dn)
+      log.Println("ERROR: Already validated DanmNet:" + dn.ObjectMeta.Name + " was invalidated, because its authorization failed with error:" + err.Error())
+      return
+    }
+    err = setupHost(&dn)
     if err != nil {
       log.Println("ERROR: Failed to setup host interfaces for already validated Danmnet:" + dn.Spec.NetworkID +
       " because:" + err.Error())
@@ -73,12 +219,31 @@ func addDanmNet(client danmclientset.Interface, dn danmtypes.DanmNet) {
     return
   }
   invalidate(&dn)
-  defer updateValidity(client, &dn)
-  err := validateNetwork(&dn)
+  defer dnetHandler.status.Write(&dn)
+  err := validateNetwork(&dn, dnetHandler.shadow)
+  if err != nil {
+    log.Println("ERROR: Validation of DanmNet:" + dn.ObjectMeta.Name + " failed with error:" + err.Error())
+    return
+  }
+  err = dnetHandler.tenantConfig.Authorize(&dn)
+  if err != nil && !dnetHandler.shadow.Tolerate(TenantRuleName, &dn, err) {
+    invalidate(&dn)
+    log.Println("ERROR: Validation of DanmNet:" + dn.ObjectMeta.Name + " failed with error:" + err.Error())
+    return
+  }
+  err = dnetHandler.reservedAddresses.Reserve(&dn)
   if err != nil {
+    invalidate(&dn)
     log.Println("ERROR: Validation of DanmNet:" + dn.ObjectMeta.Name + " failed with error:" + err.Error())
     return
   }
+  err = separateAllocation(client, &dn)
+  if err != nil {
+    invalidate(&dn)
+    log.Println("ERROR: Validation of DanmNet:" + dn.ObjectMeta.Name + " failed with error:" + err.Error())
+    return
+  }
+  compat.SetRequiredRevision(&dn)
   err = setupHost(&dn)
   if err != nil {
     log.Println("ERROR: Creating host interfaces for DanmNet:" + dn.ObjectMeta.Name + " failed with error:" + err.Error())
@@ -86,6 +251,29 @@ func addDanmNet(client danmclientset.Interface, dn danmtypes.DanmNet) {
   return
 }
 
+// separateAllocation moves the allocation record of DanmNets configured with separate_allocation into a DanmNetAllocation with the same name
+// An already existing record is kept, so revalidating a network does not release the addresses it has already allocated
+func separateAllocation(client danmclientset.Interface, dn *danmtypes.DanmNet) error {
+  if !dn.Spec.Options.SeparateAllocation || dn.Spec.Options.Alloc == "" {
+    return nil
+  }
+  record := &danmtypes.DanmNetAllocation {
+    TypeMeta: meta_v1.TypeMeta{APIVersion: danmtypes.SchemeGroupVersion.String(), Kind: "DanmNetAllocation"},
+    ObjectMeta: meta_v1.ObjectMeta {
+      Name: dn.ObjectMeta.Name,
+      Namespace: dn.ObjectMeta.Namespace,
+      OwnerReferences: []meta_v1.OwnerReference{{APIVersion: danmtypes.SchemeGroupVersion.String(), Kind: "DanmNet", Name: dn.ObjectMeta.Name, UID: dn.ObjectMeta.UID}},
+    },
+    Spec: danmtypes.DanmNetAllocationSpec{NetworkID: dn.Spec.NetworkID, Alloc: dn.Spec.Options.Alloc},
+  }
+  _, err := client.DanmV1().DanmNetAllocations(dn.ObjectMeta.Namespace).Create(record)
+  if err != nil && !apierrors.IsAlreadyExists(err) {
+    return errors.New("allocation record cannot be created because:" + err.Error())
+  }
+  dn.Spec.Options.Alloc = ""
+  return nil
+}
+
 func updateValidity(client danmclientset.Interface, dn *danmtypes.DanmNet) {
   updateConflicted, err := PutDanmNet(client, dn)
   if err != nil {
@@ -3,9 +3,11 @@ package danmnet
 import (
   "encoding/binary"
   "errors"
+  "log"
   "math"
   "math/big"
   "net"
+  "regexp"
   "strings"
   "strconv"
   "syscall"
@@ -13,6 +15,9 @@ import (
   "github.com/vishvananda/netlink"
   danmtypes "github.com/nokia/danm/pkg/crd/apis/danm/v1"
   "github.com/nokia/danm/pkg/bitarray"
+  "github.com/nokia/danm/pkg/danmep"
+  "github.com/nokia/danm/pkg/sriov"
+  "github.com/nokia/danm/pkg/netspec"
 )
 
 const (
@@ -21,10 +26,15 @@ const (
   maxSupportedNetmask = 32
   maxVlanId = 4094
   maxVxlanId = 16777214
+  maxNumOfQueues = 4096
+  maxIfNameLength = 15
+  // HostInterfaceAliasPrefix marks the alias (IFLA_IFALIAS) of all the host interfaces created by DANM
+  HostInterfaceAliasPrefix = netspec.HostInterfaceAliasPrefix
 )
 
 var (
   nativelySupportedCnis = []string{"ipvlan","sriov"}
+  cpuMaskFormat = regexp.MustCompile("^[0-9a-fA-F]{1,8}(,[0-9a-fA-F]{1,8})*$")
 )
 
 // LinkInfo is an absract struct to represent a host NIC of a special type: either VLAN, or VxLAN
@@ -64,33 +74,58 @@ func Int2ip6(nn *big.Int) net.IP {
   return ip
 }
 
-func validateNetwork(dnet *danmtypes.DanmNet) error {
-  cniType := dnet.Spec.NetworkType
-  if cniType == "" {
-    cniType = "ipvlan"
-  }
-  dnet.Spec.NetworkType = strings.ToLower(cniType)
+func validateNetwork(dnet *danmtypes.DanmNet, shadow *ShadowConfig) error {
+  dnet.Spec.NetworkType = netspec.GetNetworkType(dnet)
   for _,supportedCni := range nativelySupportedCnis {
     if supportedCni == dnet.Spec.NetworkType {
-      return validateDanmNet(dnet)
+      return validateDanmNet(dnet, shadow)
     }
   }
   validate(dnet)
   return nil
 }
 
-func validateDanmNet(dnet *danmtypes.DanmNet) error {
-  err := validateIpv4Fields(dnet)
-  if err != nil {
-    return err
-  }
-  err = validateIpv6Fields(dnet)
-  if err != nil {
-    return err
-  }
-  err = validateVids(dnet)
-  if err != nil {
-    return err
+// validationRule is a semantic check of DanmNets. Named rules can be run in shadow mode, unnamed ones also fill in defaults, so they are always enforced
+type validationRule struct {
+  name string
+  check func(dnet *danmtypes.DanmNet) error
+}
+
+var validationRules = []validationRule {
+  {RouteFamiliesRule, func(dnet *danmtypes.DanmNet) error {
+    err := ValidateRoutes(dnet.Spec.Options.Routes, false)
+    if err != nil {
+      return err
+    }
+    return ValidateRoutes(dnet.Spec.Options.Routes6, true)
+  }},
+  {MultipathRoutesRule, func(dnet *danmtypes.DanmNet) error {
+    err := ValidateMultipathRoutes(dnet.Spec.Options)
+    if err != nil {
+      return err
+    }
+    if len(dnet.Spec.Options.MultipathRoutes) > 0 && !netspec.IsIpvlan(dnet) {
+      return errors.New("Multipath routes can only be configured for IPVLAN networks")
+    }
+    return nil
+  }},
+  {"", validateIpv4Fields},
+  {"", validateIpv6Fields},
+  {StaticAssignmentsRule, validateStaticAssignments},
+  {VidsRule, validateVids},
+  {QueuesRule, validateQueueOptions},
+  {OffloadsRule, validateOffloadOptions},
+  {PfSelectionRule, validatePfSelection},
+  {IntraHostSwitchingRule, validateIntraHostSwitching},
+  {"", validateGcPolicy},
+}
+
+func validateDanmNet(dnet *danmtypes.DanmNet, shadow *ShadowConfig) error {
+  for _, rule := range validationRules {
+    err := rule.check(dnet)
+    if err != nil && !shadow.Tolerate(rule.name, dnet, err) {
+      return err
+    }
   }
   validate(dnet)
   return nil
@@ -107,7 +142,7 @@ func validateIpv4Fields(dnet *danmtypes.DanmNet) error {
     return nil
   }
   _, ipnet, err := net.ParseCIDR(cidr)
-  if err != nil {
+  if err != nil || ipnet.IP.To4() == nil {
     return errors.New("Invalid CIDR parameter: " + cidr)
   }
   bitArray, err := createBitArray(ipnet)
@@ -118,6 +153,10 @@ func validateIpv4Fields(dnet *danmtypes.DanmNet) error {
   if err != nil {
     return err
   }
+  err = reserveGatewayIps(getMultipathGateways(dnet.Spec.Options.MultipathRoutes, false), bitArray, ipnet)
+  if err != nil {
+    return err
+  }
   err = validateAllocationPool(dnet, ipnet)
   if err != nil {
     return err
@@ -172,7 +211,7 @@ func validateIpv6Fields(dnet *danmtypes.DanmNet) error {
   }
   net6 := dnet.Spec.Options.Net6
   _, ipnet6, err := net.ParseCIDR(net6)
-  if err != nil {
+  if err != nil || ipnet6.IP.To4() != nil {
     return errors.New("Invalid IPv6 CIDR: " + net6)
   }
   routes6 := dnet.Spec.Options.Routes6
@@ -181,6 +220,142 @@ func validateIpv6Fields(dnet *danmtypes.DanmNet) error {
       return errors.New("IPv6 GW address:" + gw6 + " is not part of IPv6 CIDR")
     }
   }
+  for _, gw6 := range getMultipathGateways(dnet.Spec.Options.MultipathRoutes, true) {
+    if !ipnet6.Contains(net.ParseIP(gw6)) {
+      return errors.New("IPv6 GW address:" + gw6 + " is not part of IPv6 CIDR")
+    }
+  }
+  return nil
+}
+
+// ValidateRoutes checks that the destinations, and gateways of the routes belong to the same address family as the route list
+// IPv4 routes, and IPv6 routes are always given in separate lists, so mixed-family routes are refused before they could fail at netlink time
+func ValidateRoutes(routes map[string]string, isIpv6 bool) error {
+  family := "IPv4"
+  if isIpv6 {
+    family = "IPv6"
+  }
+  for dst, gw := range routes {
+    _, dstNet, err := net.ParseCIDR(dst)
+    if err != nil || (dstNet.IP.To4() == nil) != isIpv6 {
+      return errors.New("Route destination:" + dst + " is not a valid " + family + " CIDR")
+    }
+    gwIp := net.ParseIP(gw)
+    if gwIp == nil || (gwIp.To4() == nil) != isIpv6 {
+      return errors.New("Gateway:" + gw + " of route:" + dst + " is not a valid " + family + " address")
+    }
+  }
+  return nil
+}
+
+// ValidateMultipathRoutes checks that every multipath route has at least two nexthops of the same address family as its destination
+// A destination can only be routed once, either in routes, routes6, or multipath_routes
+func ValidateMultipathRoutes(opts danmtypes.DanmNetOption) error {
+  destinations := make(map[string]bool)
+  for dst := range opts.Routes {
+    destinations[dst] = true
+  }
+  for dst := range opts.Routes6 {
+    destinations[dst] = true
+  }
+  for _, route := range opts.MultipathRoutes {
+    _, dstNet, err := net.ParseCIDR(route.Destination)
+    if err != nil {
+      return errors.New("Multipath route destination:" + route.Destination + " is not a valid CIDR")
+    }
+    if destinations[route.Destination] {
+      return errors.New("Destination:" + route.Destination + " is routed more than once")
+    }
+    destinations[route.Destination] = true
+    if len(route.Nexthops) < 2 {
+      return errors.New("Multipath route:" + route.Destination + " shall have at least two nexthops")
+    }
+    isIpv6 := dstNet.IP.To4() == nil
+    gateways := make(map[string]bool)
+    for _, nexthop := range route.Nexthops {
+      gwIp := net.ParseIP(nexthop.Gateway)
+      if gwIp == nil || (gwIp.To4() == nil) != isIpv6 {
+        return errors.New("Gateway:" + nexthop.Gateway + " of multipath route:" + route.Destination + " is not an address of the same family as the destination")
+      }
+      if gateways[gwIp.String()] {
+        return errors.New("Gateway:" + nexthop.Gateway + " is listed more than once in multipath route:" + route.Destination)
+      }
+      gateways[gwIp.String()] = true
+      if nexthop.Weight < 0 || nexthop.Weight > 256 {
+        return errors.New("Weight of gateway:" + nexthop.Gateway + " in multipath route:" + route.Destination + " shall be between 1 and 256")
+      }
+    }
+  }
+  return nil
+}
+
+// getMultipathGateways returns the IPv4, or IPv6 gateways of the multipath routes keyed by their destination, and position
+func getMultipathGateways(routes []danmtypes.MultipathRoute, isIpv6 bool) map[string]string {
+  gateways := make(map[string]string)
+  for _, route := range routes {
+    for i, nexthop := range route.Nexthops {
+      gwIp := net.ParseIP(nexthop.Gateway)
+      if gwIp != nil && (gwIp.To4() == nil) == isIpv6 {
+        gateways[route.Destination + "/" + strconv.Itoa(i)] = nexthop.Gateway
+      }
+    }
+  }
+  return gateways
+}
+
+// Statically assigned IPv4 addresses shall be outside of the allocation pool, so they can never be dynamically allocated to other Pods
+func validateStaticAssignments(dnet *danmtypes.DanmNet) error {
+  opts := dnet.Spec.Options
+  assignedIps := make(map[string]bool)
+  for _, assignment := range opts.StaticAssignments {
+    if assignment.Node == "" {
+      return errors.New("Node must be defined for all static assignments")
+    }
+    if assignment.Ip == "" && assignment.Ip6 == "" {
+      return errors.New("Static assignment for node:" + assignment.Node + " does not define any IP address")
+    }
+    if assignment.Ip != "" {
+      err := validateStaticIp(assignment.Ip, opts)
+      if err != nil {
+        return err
+      }
+    }
+    if assignment.Ip6 != "" {
+      ip6, _, err := net.ParseCIDR(assignment.Ip6)
+      if err != nil || ip6.To4() != nil {
+        return errors.New("Invalid statically assigned IPv6 address:" + assignment.Ip6)
+      }
+      _, ipnet6, err := net.ParseCIDR(opts.Net6)
+      if err != nil || !ipnet6.Contains(ip6) {
+        return errors.New("Statically assigned IPv6 address:" + assignment.Ip6 + " is not part of IPv6 CIDR")
+      }
+    }
+    for _, ip := range []string{assignment.Ip, assignment.Ip6} {
+      if ip == "" {
+        continue
+      }
+      if assignedIps[ip] {
+        return errors.New("IP address:" + ip + " is statically assigned more than once")
+      }
+      assignedIps[ip] = true
+    }
+  }
+  return nil
+}
+
+func validateStaticIp(staticIp string, opts danmtypes.DanmNetOption) error {
+  ip, ipnet, err := net.ParseCIDR(staticIp)
+  if err != nil || ip.To4() == nil {
+    return errors.New("Invalid statically assigned IPv4 address:" + staticIp)
+  }
+  _, netCidr, err := net.ParseCIDR(opts.Cidr)
+  if err != nil || !netCidr.Contains(ip) || netCidr.Mask.String() != ipnet.Mask.String() {
+    return errors.New("Statically assigned IPv4 address:" + staticIp + " is not part of CIDR")
+  }
+  ipNum := Ip2int(ip)
+  if ipNum >= Ip2int(net.ParseIP(opts.Pool.Start)) && ipNum <= Ip2int(net.ParseIP(opts.Pool.End)) {
+    return errors.New("Statically assigned IPv4 address:" + staticIp + " is inside the allocation pool")
+  }
   return nil
 }
 
@@ -193,16 +368,106 @@ func validateVids(dnet *danmtypes.DanmNet) error {
   return nil
 }
 
+func validateQueueOptions(dnet *danmtypes.DanmNet) error {
+  opts := dnet.Spec.Options
+  if opts.TxQueues < 0 || opts.TxQueues > maxNumOfQueues || opts.RxQueues < 0 || opts.RxQueues > maxNumOfQueues {
+    return errors.New("Number of transmit and receive queues cannot be negative, or more than " + strconv.Itoa(maxNumOfQueues))
+  }
+  if opts.RpsCpus != "" && !cpuMaskFormat.MatchString(opts.RpsCpus) {
+    return errors.New("RPS CPU mask:" + opts.RpsCpus + " is not a valid hexadecimal CPU bitmap")
+  }
+  if opts.XpsCpus != "" && !cpuMaskFormat.MatchString(opts.XpsCpus) {
+    return errors.New("XPS CPU mask:" + opts.XpsCpus + " is not a valid hexadecimal CPU bitmap")
+  }
+  return nil
+}
+
+func validatePfSelection(dnet *danmtypes.DanmNet) error {
+  opts := dnet.Spec.Options
+  if len(opts.HostDevices) == 0 {
+    if opts.PfSelection != "" {
+      return errors.New("PF selection policy can only be configured together with host_devices")
+    }
+    return nil
+  }
+  if netspec.GetNetworkType(dnet) != netspec.TypeSriov {
+    return errors.New("Multiple host devices can only be configured for SRIOV networks")
+  }
+  if opts.PfSelection != "" && opts.PfSelection != sriov.SelectionLeastLoaded && opts.PfSelection != sriov.SelectionRoundRobin && opts.PfSelection != sriov.SelectionStrict {
+    return errors.New("PF selection policy:" + opts.PfSelection + " is not one of " + sriov.SelectionLeastLoaded + ", " + sriov.SelectionRoundRobin + ", or " + sriov.SelectionStrict)
+  }
+  if opts.Device != "" && !isDeviceListed(opts.HostDevices, opts.Device) {
+    return errors.New("host_device:" + opts.Device + " shall also be listed in host_devices")
+  }
+  return nil
+}
+
+func validateIntraHostSwitching(dnet *danmtypes.DanmNet) error {
+  switching := dnet.Spec.Options.IntraHostSwitching
+  if switching == "" || switching == danmep.SwitchingLocal {
+    return nil
+  }
+  if switching != danmep.SwitchingExternal {
+    return errors.New("intra_host_switching:" + switching + " is not one of " + danmep.SwitchingLocal + ", or " + danmep.SwitchingExternal)
+  }
+  if !netspec.IsIpvlan(dnet) {
+    return errors.New("External intra-host switching can only be configured for IPVLAN networks")
+  }
+  // The bridge, or VEPA flag belongs to the IPVLAN port, i.e. it is shared by all the networks connected to the same parent
+  if dnet.Spec.Options.Vlan == 0 && dnet.Spec.Options.Vxlan == 0 {
+    return errors.New("External intra-host switching can only be configured for VLAN, or VxLAN networks, as the IPVLAN interfaces of other networks share their host device")
+  }
+  return nil
+}
+
+func validateGcPolicy(dnet *danmtypes.DanmNet) error {
+  if dnet.Spec.Options.GcPolicy == "" {
+    return nil
+  }
+  policy := netspec.GetGcPolicy(dnet)
+  if policy != netspec.GcPolicyEvent && policy != netspec.GcPolicyPeriodic && policy != netspec.GcPolicyManual {
+    return errors.New("gc_policy:" + dnet.Spec.Options.GcPolicy + " is not one of " + netspec.GcPolicyEvent + ", " + netspec.GcPolicyPeriodic + ", or " + netspec.GcPolicyManual)
+  }
+  dnet.Spec.Options.GcPolicy = policy
+  return nil
+}
+
+func isDeviceListed(devices []string, device string) bool {
+  for _, dev := range devices {
+    if dev == device {
+      return true
+    }
+  }
+  return false
+}
+
+func validateOffloadOptions(dnet *danmtypes.DanmNet) error {
+  opts := dnet.Spec.Options
+  if opts.OffloadBridge == "" {
+    return nil
+  }
+  if netspec.GetNetworkType(dnet) != netspec.TypeSriov {
+    return errors.New("Offload bridge can only be configured for SRIOV networks")
+  }
+  if opts.Dpdk {
+    return errors.New("Offload bridge cannot be used together with DPDK, as VFs bound to userspace drivers cannot be tracked")
+  }
+  if len(opts.OffloadBridge) > maxIfNameLength {
+    return errors.New("Offload bridge name:" + opts.OffloadBridge + " is longer than " + strconv.Itoa(maxIfNameLength) + " characters")
+  }
+  return nil
+}
+
 func deleteNetworks(dnet *danmtypes.DanmNet) error {
   var combinedErrorMessage string
   vxlanId := dnet.Spec.Options.Vxlan
   netId := dnet.Spec.NetworkID
-  tempErr := deleteHostInterface(vxlanId, "vx_" + netId)
+  tempErr := deleteHostInterface(vxlanId, "vxlan", netspec.GetVxlanInterfaceName(netId), netId, dnet.Spec.Options.Device)
   if tempErr != nil {
     combinedErrorMessage = tempErr.Error() + "\n"
   }
   vlanId := dnet.Spec.Options.Vlan
-  tempErr = deleteHostInterface(vlanId, determineVlanHdev(vlanId, netId, dnet.Spec.Options.Device))
+  tempErr = deleteHostInterface(vlanId, "vlan", determineVlanHdev(vlanId, netId, dnet.Spec.Options.Device), netId, dnet.Spec.Options.Device)
   if tempErr != nil {
     combinedErrorMessage += tempErr.Error()
   }
@@ -212,12 +477,22 @@ func deleteNetworks(dnet *danmtypes.DanmNet) error {
   return nil
 }
 
-func deleteHostInterface(ifId int, ifName string) error {
+func deleteHostInterface(ifId int, ifType, ifName, netId, hostDevice string) error {
   if ifId == 0 {
     return nil
   }
   iface, err := netlink.LinkByName(ifName)
   if err != nil {
+    iface = findOwnedHostInterface(ifType, netId)
+    if iface == nil {
+      return nil
+    }
+    ifName = iface.Attrs().Name
+  }
+  if iface.Attrs().Alias == "" && isLegacyHostInterface(iface, ifType, ifId, hostDevice) {
+    log.Println("INFO: host interface:" + ifName + " has no ownership marker, but it matches DanmNet:" + netId + ", so it is deleted as created by an older DANM release")
+  } else if iface.Attrs().Alias != getHostInterfaceAlias(netId) {
+    log.Println("INFO: host interface:" + ifName + " is not owned by DanmNet:" + netId + ", so it is not deleted")
     return nil
   }
   err = netlink.LinkDel(iface)
@@ -238,7 +513,7 @@ func validate(dnet *danmtypes.DanmNet) {
 func setupHost(dnet *danmtypes.DanmNet) error {
   netId := dnet.Spec.NetworkID
   hdev := dnet.Spec.Options.Device
-  if dnet.Spec.NetworkType != "ipvlan" {
+  if !netspec.IsIpvlan(dnet) {
     return nil
   }
   vxlanId := dnet.Spec.Options.Vxlan
@@ -256,7 +531,7 @@ func setupHost(dnet *danmtypes.DanmNet) error {
 
 func setupVlan(vlanId int, netId, hdev string) error {
   vlanName := determineVlanHdev(vlanId, netId, hdev)
-  shouldInterfaceBeCreated, hostLink, err := shouldInterfaceBeCreated(vlanId, vlanName, hdev)
+  shouldInterfaceBeCreated, hostLink, err := shouldInterfaceBeCreated(vlanId, "vlan", vlanName, netId, hdev)
   if err != nil {
     return errors.New("cannot set-up host VLAN interface:" + err.Error())
   } else if !shouldInterfaceBeCreated {
@@ -269,36 +544,51 @@ func setupVlan(vlanId int, netId, hdev string) error {
     },
     VlanId:  hostLink.interfaceId,
   }
-  err = addLink(vlan)
+  err = addLink(vlan, netId)
   if err != nil {
     return errors.New("cannot add VLAN interface to host due to:"+err.Error())
   }
   return nil
 }
 
-func shouldInterfaceBeCreated(ifId int, ifName string, hostDevice string) (bool, LinkInfo, error) {
+// shouldInterfaceBeCreated tells if the host interface of the network is missing
+// An already existing interface is adopted instead of creating a duplicate, if it matches the network
+func shouldInterfaceBeCreated(ifId int, ifType, ifName, netId, hostDevice string) (bool, LinkInfo, error) {
   hostLink := LinkInfo{}
   if ifId == 0 {
     return false, hostLink, nil
   }
-  _, err := netlink.LinkByName(ifName)
+  existing, err := netlink.LinkByName(ifName)
   if err == nil {
-    return false, hostLink, nil
+    return false, hostLink, adoptHostInterface(existing, ifType, ifId, netId, hostDevice)
   }
   dev, err := netlink.LinkByName(hostDevice)
   if err != nil {
     return false, hostLink, errors.New("host device:" + hostDevice + " is not present in the system")
   }
+  existing, err = findHostInterface(ifType, ifId, dev.Attrs().Index)
+  if err != nil {
+    return false, hostLink, err
+  }
+  if existing != nil {
+    return false, hostLink, adoptHostInterface(existing, ifType, ifId, netId, hostDevice)
+  }
   hostLink.interfaceId = ifId
   hostLink.link = dev
   return true, hostLink, nil
 }
 
-func addLink(link netlink.Link) error {
+// addLink creates the host interface, and marks it as owned by DANM with setting its alias
+func addLink(link netlink.Link, netId string) error {
   err := netlink.LinkAdd(link)
   if err != nil {
     return err
   }
+  err = netlink.LinkSetAlias(link, getHostInterfaceAlias(netId))
+  if err != nil {
+    netlink.LinkDel(link)
+    return err
+  }
   err = netlink.LinkSetUp(link)
   if err != nil {
     return err
@@ -313,12 +603,12 @@ func determineVlanHdev(vlanId int, netId, hdev string) string {
   if vlanId == 0 {
     return hdev
   }
-  return netId + "." + strconv.Itoa(vlanId)
+  return netspec.GetVlanInterfaceName(netId, vlanId)
 }
 
 func setupVxlan(vxlanId int, netId, hdev string) error {
-  vxlanName := "vx_"+netId
-  shouldInterfaceBeCreated, hostLink, err := shouldInterfaceBeCreated(vxlanId, vxlanName, hdev)
+  vxlanName := netspec.GetVxlanInterfaceName(netId)
+  shouldInterfaceBeCreated, hostLink, err := shouldInterfaceBeCreated(vxlanId, "vxlan", vxlanName, netId, hdev)
   if err != nil {
     return errors.New("cannot set-up host VxLAN interface:" + err.Error())
   } else if !shouldInterfaceBeCreated {
@@ -352,13 +642,39 @@ func setupVxlan(vxlanId int, netId, hdev string) error {
     L2miss:       true,
     L3miss:       true,
   }
-  err = addLink(vxlan)
+  err = addLink(vxlan, netId)
   if err != nil {
     return errors.New("cannot add VxLAN interface to the host due to:"+err.Error())
   }
   return nil
 }
 
+func getHostInterfaceAlias(netId string) string {
+  return netspec.GetHostInterfaceAlias(netId)
+}
+
+// IsDanmOwned returns true if the host interface was created by DANM, i.e. its alias carries DANM's ownership marker
+func IsDanmOwned(link netlink.Link) bool {
+  return strings.HasPrefix(link.Attrs().Alias, HostInterfaceAliasPrefix)
+}
+
+// GetDanmHostInterfaces returns all the host interfaces created by DANM, indexed with the NetworkID they belong to
+// Only interfaces carrying DANM's ownership marker are returned, so interfaces created by other agents are never touched
+func GetDanmHostInterfaces() (map[string][]netlink.Link, error) {
+  links, err := netlink.LinkList()
+  if err != nil {
+    return nil, errors.New("cannot list host interfaces because:" + err.Error())
+  }
+  danmLinks := make(map[string][]netlink.Link)
+  for _, link := range links {
+    if IsDanmOwned(link) {
+      netId := strings.TrimPrefix(link.Attrs().Alias, HostInterfaceAliasPrefix)
+      danmLinks[netId] = append(danmLinks[netId], link)
+    }
+  }
+  return danmLinks, nil
+}
+
 func getMulticastIp(ipFamily int, vxlanId string ) (net.IP, error) {
   vxlanIdInt, err := strconv.Atoi(vxlanId)
   if err != nil {
@@ -0,0 +1,72 @@
+package danmnet
+
+import (
+  "encoding/json"
+  "errors"
+  "io/ioutil"
+  "net"
+  danmtypes "github.com/nokia/danm/pkg/crd/apis/danm/v1"
+  "github.com/nokia/danm/pkg/bitarray"
+)
+
+// ReservedAddresses lists the IPv4 addresses never allocated to Pods from any DanmNet of the cluster, e.g. DNS VIPs, NTP servers, and gateways
+// Offsets are positions reserved in every CIDR: positive ones are counted from the network address, negative ones backwards from the broadcast address
+// E.g. "offsets": [1, -1] reserves the .1, and .254 addresses of every /24 network
+type ReservedAddresses struct {
+  Addresses []string `json:"addresses,omitempty"`
+  Offsets   []int    `json:"offsets,omitempty"`
+}
+
+// LoadReservedAddresses reads the cluster-wide reserved addresses from a JSON formatted configuration file
+func LoadReservedAddresses(path string) (*ReservedAddresses, error) {
+  content, err := ioutil.ReadFile(path)
+  if err != nil {
+    return nil, errors.New("cannot read reserved address configuration file:" + path + " because:" + err.Error())
+  }
+  reserved := &ReservedAddresses{}
+  err = json.Unmarshal(content, reserved)
+  if err != nil {
+    return nil, errors.New("cannot parse reserved address configuration file:" + path + " because:" + err.Error())
+  }
+  for _, address := range reserved.Addresses {
+    ip := net.ParseIP(address)
+    if ip == nil || ip.To4() == nil {
+      return nil, errors.New("reserved address:" + address + " in configuration file:" + path + " is not a valid IPv4 address")
+    }
+  }
+  return reserved, nil
+}
+
+// Reserve marks the reserved addresses falling into the CIDR of a freshly validated DanmNet as allocated
+// Addresses outside of the CIDR, and offsets pointing beyond it are ignored
+func (reserved *ReservedAddresses) Reserve(dnet *danmtypes.DanmNet) error {
+  if reserved == nil || dnet.Spec.Options.Cidr == "" || dnet.Spec.Options.Alloc == "" {
+    return nil
+  }
+  _, ipnet, err := net.ParseCIDR(dnet.Spec.Options.Cidr)
+  if err != nil {
+    return errors.New("Invalid CIDR parameter: " + dnet.Spec.Options.Cidr)
+  }
+  bitArray := bitarray.NewBitArrayFromBase64(dnet.Spec.Options.Alloc)
+  ones, bits := ipnet.Mask.Size()
+  size := 1 << uint(bits - ones)
+  for _, address := range reserved.Addresses {
+    ip := net.ParseIP(address)
+    if ip != nil && ipnet.Contains(ip) {
+      bitArray.Set(Ip2int(ip) - Ip2int(ipnet.IP))
+    }
+  }
+  for _, offset := range reserved.Offsets {
+    position := offset
+    if offset < 0 {
+      position = size - 1 + offset
+    }
+    //The network, and broadcast addresses are never allocated anyway
+    if position <= 0 || position >= size - 1 {
+      continue
+    }
+    bitArray.Set(uint32(position))
+  }
+  dnet.Spec.Options.Alloc = bitArray.Encode()
+  return nil
+}
@@ -0,0 +1,82 @@
+package danmnet
+
+import (
+  "errors"
+  "log"
+  "strings"
+  "time"
+  "github.com/prometheus/client_golang/prometheus"
+  danmtypes "github.com/nokia/danm/pkg/crd/apis/danm/v1"
+)
+
+const (
+  // RouteFamiliesRule checks the address family of the destinations, and gateways of routes, and routes6
+  RouteFamiliesRule = "route-families"
+  // MultipathRoutesRule checks the nexthops of multipath_routes
+  MultipathRoutesRule = "multipath-routes"
+  // StaticAssignmentsRule checks the addresses of static_assignments
+  StaticAssignmentsRule = "static-assignments"
+  // VidsRule refuses networks defining both VLAN, and VxLAN
+  VidsRule = "vids"
+  // QueuesRule checks the number of queues, and the RPS/XPS CPU masks
+  QueuesRule = "queues"
+  // OffloadsRule checks offload_bridge
+  OffloadsRule = "offloads"
+  // PfSelectionRule checks host_devices, and pf_selection
+  PfSelectionRule = "pf-selection"
+  // IntraHostSwitchingRule checks intra_host_switching
+  IntraHostSwitchingRule = "intra-host-switching"
+  // TenantRuleName checks the DanmNet against the rule of its namespace in the tenant configuration
+  TenantRuleName = "tenant"
+)
+
+// ShadowableRules lists the validation rules which can be run in shadow mode
+var ShadowableRules = []string{RouteFamiliesRule, MultipathRoutesRule, StaticAssignmentsRule, VidsRule, QueuesRule, OffloadsRule, PfSelectionRule, IntraHostSwitchingRule, TenantRuleName}
+
+var shadowRejections = prometheus.NewCounterVec(prometheus.CounterOpts {
+  Name: "danm_validation_shadow_rejections_total",
+  Help: "Number of DanmNets which would have been found invalid by a validation rule running in shadow mode, per rule.",
+}, []string{"rule"})
+
+// ShadowConfig lists the validation rules which only log, and count the DanmNets they would reject, instead of invalidating them
+// This way new, or tightened rules can be rolled out to live clusters, and enforced only once no valid network would be refused
+type ShadowConfig struct {
+  rules map[string]bool
+  until time.Time
+}
+
+// NewShadowConfig runs the listed rules in shadow mode until the given point in time, or indefinitely if it is zero
+func NewShadowConfig(rules []string, until time.Time) (*ShadowConfig, error) {
+  shadow := &ShadowConfig{rules: make(map[string]bool), until: until}
+  for _, rule := range rules {
+    if !contains(ShadowableRules, rule) {
+      return nil, errors.New("validation rule:" + rule + " cannot be run in shadow mode, it is not one of " + strings.Join(ShadowableRules, ", "))
+    }
+    shadow.rules[rule] = true
+  }
+  err := prometheus.Register(shadowRejections)
+  if err != nil {
+    if _, ok := err.(prometheus.AlreadyRegisteredError); !ok {
+      return nil, errors.New("cannot register shadow validation metrics because:" + err.Error())
+    }
+  }
+  return shadow, nil
+}
+
+// IsShadowed tells whether violations of the rule are currently only reported
+func (shadow *ShadowConfig) IsShadowed(rule string) bool {
+  if shadow == nil || !shadow.rules[rule] {
+    return false
+  }
+  return shadow.until.IsZero() || time.Now().Before(shadow.until)
+}
+
+// Tolerate reports the would-be rejection of the DanmNet, and returns true if the rule runs in shadow mode
+func (shadow *ShadowConfig) Tolerate(rule string, dnet *danmtypes.DanmNet, err error) bool {
+  if !shadow.IsShadowed(rule) {
+    return false
+  }
+  shadowRejections.WithLabelValues(rule).Inc()
+  log.Println("INFO: DanmNet:" + dnet.ObjectMeta.Namespace + "/" + dnet.ObjectMeta.Name + " would be invalid according to validation rule:" + rule + " running in shadow mode, because:" + err.Error())
+  return true
+}
@@ -0,0 +1,110 @@
+package danmnet
+
+import (
+  "sync"
+  "time"
+  danmtypes "github.com/nokia/danm/pkg/crd/apis/danm/v1"
+  danmclientset "github.com/nokia/danm/pkg/crd/client/clientset/versioned"
+)
+
+// StatusWriter batches the validity updates of DanmNets, bounding the API write volume of netwatcher when a large number of DanmNets is created at once
+// Only the latest update of a DanmNet is kept until it is written, and at most BatchSize DanmNets are written in every period
+type StatusWriter struct {
+  client danmclientset.Interface
+  interval time.Duration
+  batchSize int
+  mux sync.Mutex
+  pending map[string]*danmtypes.DanmNet
+  order []string
+}
+
+// NewStatusWriter returns a StatusWriter flushing at most batchSize DanmNets in every interval
+// DanmNets are written immediately if the interval is 0
+func NewStatusWriter(client danmclientset.Interface, interval time.Duration, batchSize int) *StatusWriter {
+  if batchSize < 1 {
+    batchSize = 1
+  }
+  return &StatusWriter {
+    client: client,
+    interval: interval,
+    batchSize: batchSize,
+    pending: make(map[string]*danmtypes.DanmNet),
+  }
+}
+
+// Write schedules the update of the DanmNet, replacing its earlier update not yet written
+func (writer *StatusWriter) Write(dn *danmtypes.DanmNet) {
+  if writer.interval == 0 {
+    updateValidity(writer.client, dn)
+    return
+  }
+  key := dn.ObjectMeta.Namespace + "/" + dn.ObjectMeta.Name
+  writer.mux.Lock()
+  defer writer.mux.Unlock()
+  if _, isPending := writer.pending[key]; !isPending {
+    writer.order = append(writer.order, key)
+  }
+  writer.pending[key] = dn.DeepCopy()
+}
+
+// Discard drops the pending update of the DanmNet, e.g. because it was deleted meanwhile
+func (writer *StatusWriter) Discard(dn *danmtypes.DanmNet) {
+  key := dn.ObjectMeta.Namespace + "/" + dn.ObjectMeta.Name
+  writer.mux.Lock()
+  defer writer.mux.Unlock()
+  if _, isPending := writer.pending[key]; !isPending {
+    return
+  }
+  delete(writer.pending, key)
+  for i, pendingKey := range writer.order {
+    if pendingKey == key {
+      writer.order = append(writer.order[:i], writer.order[i+1:]...)
+      break
+    }
+  }
+}
+
+// Pending returns the number of DanmNets waiting to be written
+func (writer *StatusWriter) Pending() int {
+  writer.mux.Lock()
+  defer writer.mux.Unlock()
+  return len(writer.order)
+}
+
+// Flush writes at most one batch of the pending DanmNets, in the order they were first scheduled
+// It returns the number of DanmNets written
+func (writer *StatusWriter) Flush() int {
+  writer.mux.Lock()
+  batchLen := len(writer.order)
+  if batchLen > writer.batchSize {
+    batchLen = writer.batchSize
+  }
+  batch := make([]*danmtypes.DanmNet, 0, batchLen)
+  for _, key := range writer.order[:batchLen] {
+    batch = append(batch, writer.pending[key])
+    delete(writer.pending, key)
+  }
+  writer.order = writer.order[batchLen:]
+  writer.mux.Unlock()
+  for _, dn := range batch {
+    updateValidity(writer.client, dn)
+  }
+  return len(batch)
+}
+
+// Run flushes the pending DanmNets periodically until the stop channel is closed
+func (writer *StatusWriter) Run(stop <-chan struct{}) {
+  if writer.interval == 0 {
+    return
+  }
+  ticker := time.NewTicker(writer.interval)
+  defer ticker.Stop()
+  for {
+    select {
+    case <-stop:
+      return
+    case <-ticker.C:
+      writer.Flush()
+    }
+  }
+}
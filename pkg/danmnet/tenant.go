@@ -0,0 +1,111 @@
+package danmnet
+
+import (
+  "encoding/json"
+  "errors"
+  "io/ioutil"
+  "strconv"
+  danmtypes "github.com/nokia/danm/pkg/crd/apis/danm/v1"
+  "github.com/nokia/danm/pkg/netspec"
+)
+
+const (
+  // DefaultTenantRule is the namespace wildcard matching all the namespaces without a dedicated rule
+  DefaultTenantRule = "*"
+)
+
+// TenantConfig restricts which host devices, network types, VLAN, and VxLAN identifiers the DanmNets of a namespace can use
+// Namespaces not matched by any of the rules are not restricted
+type TenantConfig struct {
+  Rules []TenantRule `json:"rules"`
+}
+
+// TenantRule lists the resources the DanmNets of the listed namespaces are allowed to use
+// An omitted attribute does not restrict the namespace, while an empty list forbids the usage of the resource altogether
+// E.g. a rule with "host_devices": ["tenant-bond"], "vlans": [], and "vxlans": [{"start": 1000, "end": 1999}] only allows VxLAN networks over "tenant-bond"
+type TenantRule struct {
+  Namespaces   []string  `json:"namespaces"`
+  HostDevices  []string  `json:"host_devices,omitempty"`
+  NetworkTypes []string  `json:"network_types,omitempty"`
+  Vlans        []IdRange `json:"vlans,omitempty"`
+  Vxlans       []IdRange `json:"vxlans,omitempty"`
+}
+
+// IdRange is an inclusive range of VLAN, or VxLAN identifiers
+type IdRange struct {
+  Start int `json:"start"`
+  End   int `json:"end"`
+}
+
+// LoadTenantConfig reads the tenant restrictions from a JSON formatted configuration file
+func LoadTenantConfig(path string) (*TenantConfig, error) {
+  content, err := ioutil.ReadFile(path)
+  if err != nil {
+    return nil, errors.New("cannot read tenant configuration file:" + path + " because:" + err.Error())
+  }
+  tenantConfig := &TenantConfig{}
+  err = json.Unmarshal(content, tenantConfig)
+  if err != nil {
+    return nil, errors.New("cannot parse tenant configuration file:" + path + " because:" + err.Error())
+  }
+  return tenantConfig, nil
+}
+
+// Authorize returns an error if the DanmNet uses a resource its namespace is not allowed to use
+func (tenantConfig *TenantConfig) Authorize(dnet *danmtypes.DanmNet) error {
+  if tenantConfig == nil {
+    return nil
+  }
+  rule := tenantConfig.getRule(dnet.ObjectMeta.Namespace)
+  if rule == nil {
+    return nil
+  }
+  opts := dnet.Spec.Options
+  for _, device := range netspec.GetHostDevices(dnet) {
+    if rule.HostDevices != nil && !contains(rule.HostDevices, device) {
+      return errors.New("namespace:" + dnet.ObjectMeta.Namespace + " is not allowed to use host device:" + device)
+    }
+  }
+  networkType := netspec.GetNetworkType(dnet)
+  if rule.NetworkTypes != nil && !contains(rule.NetworkTypes, networkType) {
+    return errors.New("namespace:" + dnet.ObjectMeta.Namespace + " is not allowed to use network type:" + networkType)
+  }
+  if opts.Vlan != 0 && rule.Vlans != nil && !isInRanges(rule.Vlans, opts.Vlan) {
+    return errors.New("namespace:" + dnet.ObjectMeta.Namespace + " is not allowed to use VLAN:" + strconv.Itoa(opts.Vlan))
+  }
+  if opts.Vxlan != 0 && rule.Vxlans != nil && !isInRanges(rule.Vxlans, opts.Vxlan) {
+    return errors.New("namespace:" + dnet.ObjectMeta.Namespace + " is not allowed to use VxLAN:" + strconv.Itoa(opts.Vxlan))
+  }
+  return nil
+}
+
+func (tenantConfig *TenantConfig) getRule(namespace string) *TenantRule {
+  var defaultRule *TenantRule
+  for i, rule := range tenantConfig.Rules {
+    if contains(rule.Namespaces, namespace) {
+      return &tenantConfig.Rules[i]
+    }
+    if contains(rule.Namespaces, DefaultTenantRule) {
+      defaultRule = &tenantConfig.Rules[i]
+    }
+  }
+  return defaultRule
+}
+
+func contains(list []string, item string) bool {
+  for _, listItem := range list {
+    if listItem == item {
+      return true
+    }
+  }
+  return false
+}
+
+func isInRanges(ranges []IdRange, id int) bool {
+  for _, idRange := range ranges {
+    if id >= idRange.Start && id <= idRange.End {
+      return true
+    }
+  }
+  return false
+}
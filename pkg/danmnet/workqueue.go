@@ -0,0 +1,99 @@
+package danmnet
+
+import (
+  "sync"
+  danmtypes "github.com/nokia/danm/pkg/crd/apis/danm/v1"
+)
+
+// DeviceWorkQueue executes DanmNet related host operations concurrently in a bounded number of worker threads
+// Operations touching the same parent host device are always executed serially, in the order they were received
+// This way creating hundreds of VLAN, or VxLAN interfaces is parallelized, while netlink operations manipulating the same parent device never race
+// A new operation replaces the not yet started operation of the same kind on the same DanmNet, so a storm of events results in one netlink operation per network
+type DeviceWorkQueue struct {
+  mux sync.Mutex
+  pending map[string][]queuedOperation
+  workers chan struct{}
+}
+
+type queuedOperation struct {
+  network string
+  kind string
+  run func()
+}
+
+// NewDeviceWorkQueue returns a queue executing the operations in at most numOfWorkers parallel threads
+func NewDeviceWorkQueue(numOfWorkers int) *DeviceWorkQueue {
+  if numOfWorkers < 1 {
+    numOfWorkers = 1
+  }
+  return &DeviceWorkQueue {
+    pending: make(map[string][]queuedOperation),
+    workers: make(chan struct{}, numOfWorkers),
+  }
+}
+
+// Push schedules an operation of the given kind on a DanmNet for a parent device
+// The operation is merged into the last pending operation of the network if that is of the same kind, as executing it would be superfluous
+// The call blocks when all the workers are busy, throttling the producer of the events
+func (queue *DeviceWorkQueue) Push(device, network, kind string, operation func()) {
+  queue.mux.Lock()
+  ops, isDeviceBeingProcessed := queue.pending[device]
+  if coalesce(ops, network, kind, operation) {
+    queue.mux.Unlock()
+    return
+  }
+  queue.pending[device] = append(ops, queuedOperation{network: network, kind: kind, run: operation})
+  queue.mux.Unlock()
+  if isDeviceBeingProcessed {
+    return
+  }
+  queue.workers <- struct{}{}
+  go queue.drain(device)
+}
+
+func (queue *DeviceWorkQueue) drain(device string) {
+  defer func() { <-queue.workers }()
+  for {
+    queue.mux.Lock()
+    ops := queue.pending[device]
+    if len(ops) == 0 {
+      delete(queue.pending, device)
+      queue.mux.Unlock()
+      return
+    }
+    operation := ops[0]
+    queue.pending[device] = ops[1:]
+    queue.mux.Unlock()
+    operation.run()
+  }
+}
+
+// coalesce replaces the last pending operation of the network with the new one, if they are of the same kind
+// Operations of different kinds are never merged, so e.g. re-creating a network never skips the deletion of its old host interfaces
+func coalesce(ops []queuedOperation, network, kind string, operation func()) bool {
+  for i := len(ops)-1; i >= 0; i-- {
+    if ops[i].network != network {
+      continue
+    }
+    if ops[i].kind != kind {
+      return false
+    }
+    ops[i].run = operation
+    return true
+  }
+  return false
+}
+
+// getSerializationKey returns the identifier of the host resource the operations of a DanmNet shall be serialized on
+// Networks without a host device don't touch shared host resources, so they are only serialized with themselves
+func getSerializationKey(device, netId string) string {
+  if device == "" {
+    return "network:" + netId
+  }
+  return device
+}
+
+// getNetworkKey returns the identifier of the DanmNet the operations are coalesced on
+func getNetworkKey(dn danmtypes.DanmNet) string {
+  return dn.ObjectMeta.Namespace + "/" + dn.ObjectMeta.Name
+}
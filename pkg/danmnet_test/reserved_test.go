@@ -0,0 +1,78 @@
+package danmnet_test
+
+import (
+  "io/ioutil"
+  "os"
+  "testing"
+  danmtypes "github.com/nokia/danm/pkg/crd/apis/danm/v1"
+  "github.com/nokia/danm/pkg/bitarray"
+  "github.com/nokia/danm/pkg/danmnet"
+)
+
+var reserveTcs = []struct {
+  tcName string
+  cidr string
+  reserved *danmnet.ReservedAddresses
+  expectedReserved []uint32
+}{
+  {"noConfig", "10.0.0.0/24", nil, nil},
+  {"gatewayOffsets", "10.0.0.0/24", &danmnet.ReservedAddresses{Offsets: []int{1, -1}}, []uint32{1, 254}},
+  {"dnsVip", "10.96.0.0/16", &danmnet.ReservedAddresses{Addresses: []string{"10.96.0.10", "192.168.1.1"}}, []uint32{10}},
+  {"offsetsBeyondCidr", "10.0.0.0/30", &danmnet.ReservedAddresses{Offsets: []int{1, 5, -5}}, []uint32{1}},
+}
+
+func TestReserve(t *testing.T) {
+  for _, tc := range reserveTcs {
+    t.Run(tc.tcName, func(t *testing.T) {
+      dnet := danmtypes.DanmNet{Spec: danmtypes.DanmNetSpec{Options: danmtypes.DanmNetOption{Cidr: tc.cidr}}}
+      alloc, _ := bitarray.NewBitArray(256)
+      dnet.Spec.Options.Alloc = alloc.Encode()
+      err := tc.reserved.Reserve(&dnet)
+      if err != nil {
+        t.Fatalf("Reserve failed with error:%s", err.Error())
+      }
+      result := bitarray.NewBitArrayFromBase64(dnet.Spec.Options.Alloc)
+      numOfReserved := 0
+      for pos := uint32(1); pos < 256; pos++ {
+        if result.Get(pos) {
+          numOfReserved++
+        }
+      }
+      if numOfReserved != len(tc.expectedReserved) {
+        t.Errorf("Number of reserved addresses:%d does not match with expected:%d", numOfReserved, len(tc.expectedReserved))
+      }
+      for _, pos := range tc.expectedReserved {
+        if !result.Get(pos) {
+          t.Errorf("Address at position:%d is not reserved", pos)
+        }
+      }
+    })
+  }
+}
+
+func TestLoadReservedAddresses(t *testing.T) {
+  loadTcs := []struct {
+    tcName string
+    content string
+    isErrorExpected bool
+  }{
+    {"validConfig", `{"addresses": ["10.96.0.10"], "offsets": [1, -1]}`, false},
+    {"ipv6Address", `{"addresses": ["2001:db8::1"]}`, true},
+    {"invalidJson", `{"addresses": `, true},
+  }
+  for _, tc := range loadTcs {
+    t.Run(tc.tcName, func(t *testing.T) {
+      file, err := ioutil.TempFile("", "reserved")
+      if err != nil {
+        t.Fatalf("Temporary file could not be created because:%s", err.Error())
+      }
+      defer os.Remove(file.Name())
+      file.WriteString(tc.content)
+      file.Close()
+      _, err = danmnet.LoadReservedAddresses(file.Name())
+      if (err != nil) != tc.isErrorExpected {
+        t.Errorf("Received error:%v does not match with expectation", err)
+      }
+    })
+  }
+}
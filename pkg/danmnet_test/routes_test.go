@@ -0,0 +1,63 @@
+package danmnet_test
+
+import (
+  "testing"
+  danmtypes "github.com/nokia/danm/pkg/crd/apis/danm/v1"
+  "github.com/nokia/danm/pkg/danmnet"
+)
+
+var routeTcs = []struct {
+  tcName string
+  routes map[string]string
+  isIpv6 bool
+  isErrorExpected bool
+}{
+  {"noRoutes", nil, false, false},
+  {"ipv4Routes", map[string]string{"10.20.0.0/16": "10.0.0.1", "0.0.0.0/0": "10.0.0.254"}, false, false},
+  {"ipv6Routes", map[string]string{"2001:db8:1::/48": "2001:db8::1"}, true, false},
+  {"ipv6DestinationInIpv4List", map[string]string{"2001:db8:1::/48": "10.0.0.1"}, false, true},
+  {"ipv6GatewayInIpv4List", map[string]string{"10.20.0.0/16": "2001:db8::1"}, false, true},
+  {"ipv4DestinationInIpv6List", map[string]string{"10.20.0.0/16": "2001:db8::1"}, true, true},
+  {"ipv4GatewayInIpv6List", map[string]string{"2001:db8:1::/48": "10.0.0.1"}, true, true},
+  {"invalidDestination", map[string]string{"10.20.0.0": "10.0.0.1"}, false, true},
+  {"invalidGateway", map[string]string{"10.20.0.0/16": "gateway"}, false, true},
+}
+
+func TestValidateRoutes(t *testing.T) {
+  for _, tc := range routeTcs {
+    t.Run(tc.tcName, func(t *testing.T) {
+      err := danmnet.ValidateRoutes(tc.routes, tc.isIpv6)
+      if (err != nil) != tc.isErrorExpected {
+        t.Errorf("Received error:%v does not match with expectation", err)
+      }
+    })
+  }
+}
+
+var dualGateways = []danmtypes.Nexthop{{Gateway: "10.0.0.1"}, {Gateway: "10.0.0.2", Weight: 2}}
+
+var multipathTcs = []struct {
+  tcName string
+  opts danmtypes.DanmNetOption
+  isErrorExpected bool
+}{
+  {"ecmpDefaultRoute", danmtypes.DanmNetOption{MultipathRoutes: []danmtypes.MultipathRoute{{Destination: "0.0.0.0/0", Nexthops: dualGateways}}}, false},
+  {"ipv6EcmpDefaultRoute", danmtypes.DanmNetOption{MultipathRoutes: []danmtypes.MultipathRoute{{Destination: "::/0", Nexthops: []danmtypes.Nexthop{{Gateway: "2001:db8::1"}, {Gateway: "2001:db8::2"}}}}}, false},
+  {"singleNexthop", danmtypes.DanmNetOption{MultipathRoutes: []danmtypes.MultipathRoute{{Destination: "0.0.0.0/0", Nexthops: dualGateways[0:1]}}}, true},
+  {"mixedFamilies", danmtypes.DanmNetOption{MultipathRoutes: []danmtypes.MultipathRoute{{Destination: "::/0", Nexthops: dualGateways}}}, true},
+  {"duplicateGateway", danmtypes.DanmNetOption{MultipathRoutes: []danmtypes.MultipathRoute{{Destination: "0.0.0.0/0", Nexthops: []danmtypes.Nexthop{{Gateway: "10.0.0.1"}, {Gateway: "10.0.0.1"}}}}}, true},
+  {"tooHighWeight", danmtypes.DanmNetOption{MultipathRoutes: []danmtypes.MultipathRoute{{Destination: "0.0.0.0/0", Nexthops: []danmtypes.Nexthop{{Gateway: "10.0.0.1"}, {Gateway: "10.0.0.2", Weight: 257}}}}}, true},
+  {"destinationAlsoInRoutes", danmtypes.DanmNetOption{Routes: map[string]string{"0.0.0.0/0": "10.0.0.254"}, MultipathRoutes: []danmtypes.MultipathRoute{{Destination: "0.0.0.0/0", Nexthops: dualGateways}}}, true},
+  {"invalidDestination", danmtypes.DanmNetOption{MultipathRoutes: []danmtypes.MultipathRoute{{Destination: "default", Nexthops: dualGateways}}}, true},
+}
+
+func TestValidateMultipathRoutes(t *testing.T) {
+  for _, tc := range multipathTcs {
+    t.Run(tc.tcName, func(t *testing.T) {
+      err := danmnet.ValidateMultipathRoutes(tc.opts)
+      if (err != nil) != tc.isErrorExpected {
+        t.Errorf("Received error:%v does not match with expectation", err)
+      }
+    })
+  }
+}
@@ -0,0 +1,47 @@
+package danmnet_test
+
+import (
+  "errors"
+  "testing"
+  "time"
+  danmtypes "github.com/nokia/danm/pkg/crd/apis/danm/v1"
+  "github.com/nokia/danm/pkg/danmnet"
+)
+
+func TestNewShadowConfig(t *testing.T) {
+  _, err := danmnet.NewShadowConfig([]string{danmnet.RouteFamiliesRule, "no-such-rule"}, time.Time{})
+  if err == nil {
+    t.Errorf("Unknown validation rule was accepted for shadow mode")
+  }
+}
+
+func TestTolerate(t *testing.T) {
+  shadowTcs := []struct {
+    tcName string
+    until time.Time
+    rule string
+    isTolerated bool
+  }{
+    {"shadowedIndefinitely", time.Time{}, danmnet.TenantRuleName, true},
+    {"shadowPeriodNotOver", time.Now().Add(time.Hour), danmnet.TenantRuleName, true},
+    {"shadowPeriodOver", time.Now().Add(-time.Hour), danmnet.TenantRuleName, false},
+    {"notShadowedRule", time.Time{}, danmnet.VidsRule, false},
+    {"structuralRule", time.Time{}, "", false},
+  }
+  dnet := &danmtypes.DanmNet{}
+  for _, tc := range shadowTcs {
+    t.Run(tc.tcName, func(t *testing.T) {
+      shadow, err := danmnet.NewShadowConfig([]string{danmnet.TenantRuleName, danmnet.QueuesRule}, tc.until)
+      if err != nil {
+        t.Fatalf("Shadow configuration could not be created because:%s", err.Error())
+      }
+      if shadow.Tolerate(tc.rule, dnet, errors.New("violation")) != tc.isTolerated {
+        t.Errorf("Violation of rule:%s was not handled as expected", tc.rule)
+      }
+    })
+  }
+  var noShadow *danmnet.ShadowConfig
+  if noShadow.Tolerate(danmnet.TenantRuleName, dnet, errors.New("violation")) {
+    t.Errorf("Violation was tolerated without shadow configuration")
+  }
+}
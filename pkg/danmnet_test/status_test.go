@@ -0,0 +1,84 @@
+package danmnet_test
+
+import (
+  "strconv"
+  "testing"
+  "time"
+  meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+  danmtypes "github.com/nokia/danm/pkg/crd/apis/danm/v1"
+  "github.com/nokia/danm/pkg/danmnet"
+  "github.com/nokia/danm/pkg/stubs"
+)
+
+func newStatusNets(num int) []danmtypes.DanmNet {
+  var nets []danmtypes.DanmNet
+  for i := 0; i < num; i++ {
+    name := "net" + strconv.Itoa(i)
+    nets = append(nets, danmtypes.DanmNet{ObjectMeta: meta_v1.ObjectMeta{Name: name, Namespace: "default"}, Spec: danmtypes.DanmNetSpec{NetworkID: name}})
+  }
+  return nets
+}
+
+func getStored(t *testing.T, server *stubs.FakeApiServer, name string) *danmtypes.DanmNet {
+  dnet, err := server.DanmV1().DanmNets("default").Get(name, meta_v1.GetOptions{})
+  if err != nil {
+    t.Fatalf("DanmNet:" + name + " cannot be read because:" + err.Error())
+  }
+  return dnet
+}
+
+func TestStatusWriterCoalesces(t *testing.T) {
+  server := stubs.NewFakeApiServer(0, newStatusNets(2), nil)
+  writer := danmnet.NewStatusWriter(server, time.Hour, 10)
+  first := getStored(t, server, "net0")
+  for _, validity := range []string{"False", "True"} {
+    dnet := first.DeepCopy()
+    dnet.Spec.Validation = validity
+    writer.Write(dnet)
+  }
+  second := getStored(t, server, "net1")
+  second.Spec.Validation = "True"
+  writer.Write(second)
+  if writer.Pending() != 2 {
+    t.Fatalf("Expected 2 pending DanmNets, got:%d", writer.Pending())
+  }
+  _, updatesBefore, _ := server.Stats()
+  if written := writer.Flush(); written != 2 {
+    t.Errorf("Expected 2 written DanmNets, got:%d", written)
+  }
+  _, updatesAfter, _ := server.Stats()
+  if updatesAfter - updatesBefore != 2 {
+    t.Errorf("Expected 2 API writes, got:%d", updatesAfter - updatesBefore)
+  }
+  for _, name := range []string{"net0", "net1"} {
+    if getStored(t, server, name).Spec.Validation != "True" {
+      t.Errorf("The latest validity of DanmNet:%s was not written", name)
+    }
+  }
+}
+
+func TestStatusWriterBoundsBatch(t *testing.T) {
+  nets := newStatusNets(5)
+  server := stubs.NewFakeApiServer(0, nets, nil)
+  writer := danmnet.NewStatusWriter(server, time.Hour, 2)
+  for _, dnet := range nets {
+    writer.Write(getStored(t, server, dnet.ObjectMeta.Name))
+  }
+  writer.Discard(&nets[4])
+  for _, expected := range []int{2, 2, 0} {
+    if written := writer.Flush(); written != expected {
+      t.Errorf("Expected %d written DanmNets, got:%d", expected, written)
+    }
+  }
+}
+
+func TestStatusWriterWithoutBatching(t *testing.T) {
+  server := stubs.NewFakeApiServer(0, newStatusNets(1), nil)
+  writer := danmnet.NewStatusWriter(server, 0, 0)
+  dnet := getStored(t, server, "net0")
+  dnet.Spec.Validation = "True"
+  writer.Write(dnet)
+  if writer.Pending() != 0 || getStored(t, server, "net0").Spec.Validation != "True" {
+    t.Errorf("Validity was not written immediately")
+  }
+}
@@ -0,0 +1,90 @@
+package danmnet_test
+
+import (
+  "testing"
+  "time"
+  meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+  danmtypes "github.com/nokia/danm/pkg/crd/apis/danm/v1"
+  "github.com/nokia/danm/pkg/danmnet"
+  "github.com/nokia/danm/pkg/stubs"
+)
+
+var tenantConfig = &danmnet.TenantConfig {
+  Rules: []danmnet.TenantRule {
+    danmnet.TenantRule {
+      Namespaces: []string{"tenant-a", "tenant-b"},
+      HostDevices: []string{"tenant-bond"},
+      NetworkTypes: []string{"ipvlan"},
+      Vlans: []danmnet.IdRange{},
+      Vxlans: []danmnet.IdRange{danmnet.IdRange{Start: 1000, End: 1999}},
+    },
+    danmnet.TenantRule {
+      Namespaces: []string{danmnet.DefaultTenantRule},
+      Vlans: []danmnet.IdRange{danmnet.IdRange{Start: 100, End: 199}},
+    },
+    danmnet.TenantRule {
+      Namespaces: []string{"kube-system"},
+    },
+  },
+}
+
+func newNet(namespace, networkType string, opts danmtypes.DanmNetOption) *danmtypes.DanmNet {
+  return &danmtypes.DanmNet{ObjectMeta: meta_v1.ObjectMeta{Name: "net", Namespace: namespace}, Spec: danmtypes.DanmNetSpec{NetworkType: networkType, Options: opts}}
+}
+
+var authorizeTcs = []struct {
+  tcName string
+  dnet *danmtypes.DanmNet
+  isErrorExpected bool
+}{
+  {"allowedVxlan", newNet("tenant-a", "", danmtypes.DanmNetOption{Device: "tenant-bond", Vxlan: 1500}), false},
+  {"vxlanOutOfRange", newNet("tenant-b", "ipvlan", danmtypes.DanmNetOption{Device: "tenant-bond", Vxlan: 2000}), true},
+  {"forbiddenVlan", newNet("tenant-a", "ipvlan", danmtypes.DanmNetOption{Device: "tenant-bond", Vlan: 150}), true},
+  {"forbiddenDevice", newNet("tenant-a", "ipvlan", danmtypes.DanmNetOption{Device: "ens3", Vxlan: 1500}), true},
+  {"forbiddenType", newNet("tenant-a", "sriov", danmtypes.DanmNetOption{Device: "tenant-bond"}), true},
+  {"defaultRuleAllowed", newNet("other", "sriov", danmtypes.DanmNetOption{Device: "ens3", Vlan: 150}), false},
+  {"defaultRuleViolated", newNet("other", "", danmtypes.DanmNetOption{Device: "ens3", Vlan: 250}), true},
+  {"dedicatedRulePrevailsOverDefault", newNet("kube-system", "", danmtypes.DanmNetOption{Device: "ens3", Vlan: 250}), false},
+}
+
+func TestAuthorize(t *testing.T) {
+  for _, tc := range authorizeTcs {
+    t.Run(tc.tcName, func(t *testing.T) {
+      err := tenantConfig.Authorize(tc.dnet)
+      if (err != nil && !tc.isErrorExpected) || (err == nil && tc.isErrorExpected) {
+        t.Errorf("Received error:%v does not match with expectation", err)
+      }
+    })
+  }
+}
+
+func TestAuthorizeWithoutConfig(t *testing.T) {
+  var noConfig *danmnet.TenantConfig
+  err := noConfig.Authorize(newNet("tenant-a", "", danmtypes.DanmNetOption{Device: "ens3", Vlan: 4000}))
+  if err != nil {
+    t.Errorf("Network was rejected without tenant configuration with error:%v", err)
+  }
+}
+
+func TestAuthorizePreValidatedNet(t *testing.T) {
+  dnet := newNet("tenant-a", "ipvlan", danmtypes.DanmNetOption{Device: "tenant-bond", Vlan: 150})
+  dnet.Spec.NetworkID = "prevalidated"
+  dnet.Spec.Validation = "True"
+  server := stubs.NewFakeApiServer(0, []danmtypes.DanmNet{*dnet}, nil)
+  handler := danmnet.NewHandlerForClientset(server, danmnet.HandlerOptions{NumOfWorkers: 1, TenantConfig: tenantConfig})
+  stop := make(chan struct{})
+  defer close(stop)
+  go handler.CreateController().Run(stop)
+  deadline := time.Now().Add(5 * time.Second)
+  for time.Now().Before(deadline) {
+    stored, err := server.DanmV1().DanmNets("tenant-a").Get("net", meta_v1.GetOptions{})
+    if err != nil {
+      t.Fatalf("DanmNet cannot be read because:%v", err)
+    }
+    if stored.Spec.Validation == "False" {
+      return
+    }
+    time.Sleep(10 * time.Millisecond)
+  }
+  t.Errorf("Pre-validated DanmNet violating the tenant configuration was not invalidated")
+}
@@ -0,0 +1,228 @@
+package danmnet_test
+
+import (
+  "strconv"
+  "sync"
+  "testing"
+  "time"
+  "github.com/nokia/danm/pkg/danmnet"
+)
+
+const queueTimeout = 5 * time.Second
+
+// recorder logs the operations executed by a DeviceWorkQueue, and the parallelism they were executed with
+type recorder struct {
+  mux sync.Mutex
+  executed []string
+  running map[string]int
+  maxPerDevice int
+  maxTotal int
+  total int
+}
+
+func newRecorder() *recorder {
+  return &recorder{running: make(map[string]int)}
+}
+
+// operation returns an operation recording its execution, which returns only after the release channel is closed
+func (rec *recorder) operation(device, name string, release <-chan struct{}) func() {
+  return func() {
+    rec.mux.Lock()
+    rec.executed = append(rec.executed, name)
+    rec.running[device]++
+    rec.total++
+    if rec.running[device] > rec.maxPerDevice {
+      rec.maxPerDevice = rec.running[device]
+    }
+    if rec.total > rec.maxTotal {
+      rec.maxTotal = rec.total
+    }
+    rec.mux.Unlock()
+    if release != nil {
+      <-release
+    }
+    rec.mux.Lock()
+    rec.running[device]--
+    rec.total--
+    rec.mux.Unlock()
+  }
+}
+
+func (rec *recorder) getExecuted() []string {
+  rec.mux.Lock()
+  defer rec.mux.Unlock()
+  return append([]string{}, rec.executed...)
+}
+
+func (rec *recorder) getParallelism() (int, int) {
+  rec.mux.Lock()
+  defer rec.mux.Unlock()
+  return rec.maxPerDevice, rec.maxTotal
+}
+
+func (rec *recorder) waitForExecuted(t *testing.T, num int) []string {
+  deadline := time.Now().Add(queueTimeout)
+  for time.Now().Before(deadline) {
+    executed := rec.getExecuted()
+    if len(executed) >= num {
+      return executed
+    }
+    time.Sleep(time.Millisecond)
+  }
+  t.Fatalf("Only operations:%v were executed out of the expected %d", rec.getExecuted(), num)
+  return nil
+}
+
+func isExecuted(executed []string, name string) bool {
+  for _, op := range executed {
+    if op == name {
+      return true
+    }
+  }
+  return false
+}
+
+func TestQueueSerializesDevice(t *testing.T) {
+  queue := danmnet.NewDeviceWorkQueue(10)
+  rec := newRecorder()
+  release := make(chan struct{})
+  for i := 0; i < 5; i++ {
+    name := "net" + strconv.Itoa(i)
+    queue.Push("ens3", name, "add", rec.operation("ens3", name, release))
+  }
+  //Operations started in parallel would all be running when the first one is released
+  rec.waitForExecuted(t, 1)
+  time.Sleep(50 * time.Millisecond)
+  close(release)
+  rec.waitForExecuted(t, 5)
+  if maxPerDevice, _ := rec.getParallelism(); maxPerDevice != 1 {
+    t.Errorf("Operations of the same host device were executed in parallel, maximum parallelism was:%d", maxPerDevice)
+  }
+}
+
+func TestQueueParallelizesDevices(t *testing.T) {
+  queue := danmnet.NewDeviceWorkQueue(2)
+  rec := newRecorder()
+  release := make(chan struct{})
+  defer close(release)
+  queue.Push("ens3", "net1", "add", rec.operation("ens3", "net1", release))
+  queue.Push("ens4", "net2", "add", rec.operation("ens4", "net2", release))
+  //Both operations are blocked until the end of the test, so the second one can only start if they run in parallel
+  executed := rec.waitForExecuted(t, 2)
+  if !isExecuted(executed, "net1") || !isExecuted(executed, "net2") {
+    t.Errorf("Operations of different host devices were not executed in parallel, executed operations:%v", executed)
+  }
+}
+
+func TestQueueBoundsWorkers(t *testing.T) {
+  queue := danmnet.NewDeviceWorkQueue(2)
+  rec := newRecorder()
+  release := make(chan struct{})
+  queue.Push("ens3", "net1", "add", rec.operation("ens3", "net1", release))
+  queue.Push("ens4", "net2", "add", rec.operation("ens4", "net2", release))
+  rec.waitForExecuted(t, 2)
+  isPushed := make(chan struct{})
+  go func() {
+    queue.Push("ens5", "net3", "add", rec.operation("ens5", "net3", nil))
+    close(isPushed)
+  }()
+  time.Sleep(50 * time.Millisecond)
+  if isExecuted(rec.getExecuted(), "net3") {
+    t.Errorf("Operation was started while all the workers were busy")
+  }
+  select {
+    case <-isPushed:
+      t.Errorf("Push did not block while all the workers were busy")
+    default:
+  }
+  close(release)
+  rec.waitForExecuted(t, 3)
+  if _, maxTotal := rec.getParallelism(); maxTotal != 2 {
+    t.Errorf("Expected 2 operations running in parallel at most, got:%d", maxTotal)
+  }
+}
+
+func TestQueueKeepsOrder(t *testing.T) {
+  queue := danmnet.NewDeviceWorkQueue(10)
+  rec := newRecorder()
+  release := make(chan struct{})
+  queue.Push("ens3", "blocker", "add", rec.operation("ens3", "blocker", release))
+  rec.waitForExecuted(t, 1)
+  var expected []string
+  for i := 0; i < 10; i++ {
+    name := "net" + strconv.Itoa(i)
+    kind := "add"
+    if i % 2 == 1 {
+      kind = "delete"
+    }
+    queue.Push("ens3", name, kind, rec.operation("ens3", name, nil))
+    expected = append(expected, name)
+  }
+  close(release)
+  executed := rec.waitForExecuted(t, 11)
+  for i, name := range expected {
+    if executed[i+1] != name {
+      t.Fatalf("Operations were not executed in the order they were pushed, executed order:%v", executed)
+    }
+  }
+}
+
+type queuedOp struct {
+  network string
+  kind string
+  name string
+}
+
+// pushBlocked pushes the operations while an earlier operation keeps their device busy, so none of them is started before all are pushed
+func pushBlocked(t *testing.T, ops []queuedOp) []string {
+  queue := danmnet.NewDeviceWorkQueue(10)
+  rec := newRecorder()
+  release := make(chan struct{})
+  queue.Push("ens3", "blocker", "add", rec.operation("ens3", "blocker", release))
+  rec.waitForExecuted(t, 1)
+  for _, op := range ops {
+    queue.Push("ens3", op.network, op.kind, rec.operation("ens3", op.name, nil))
+  }
+  queue.Push("ens3", "last", "add", rec.operation("ens3", "last", nil))
+  close(release)
+  deadline := time.Now().Add(queueTimeout)
+  for time.Now().Before(deadline) {
+    if executed := rec.getExecuted(); isExecuted(executed, "last") {
+      return executed[1:len(executed)-1]
+    }
+    time.Sleep(time.Millisecond)
+  }
+  t.Fatalf("Operations were not executed, executed operations:%v", rec.getExecuted())
+  return nil
+}
+
+var coalesceTcs = []struct {
+  tcName string
+  ops []queuedOp
+  expected []string
+}{
+  {"addsAreMerged", []queuedOp{{"net1", "add", "add1"}, {"net1", "add", "add2"}, {"net1", "add", "add3"}}, []string{"add3"}},
+  {"deletesAreMerged", []queuedOp{{"net1", "delete", "delete1"}, {"net1", "delete", "delete2"}}, []string{"delete2"}},
+  {"addDeleteAddIsNotMerged", []queuedOp{{"net1", "add", "add1"}, {"net1", "delete", "delete1"}, {"net1", "add", "add2"}}, []string{"add1", "delete1", "add2"}},
+  {"deleteAddDeleteIsNotMerged", []queuedOp{{"net1", "delete", "delete1"}, {"net1", "add", "add1"}, {"net1", "delete", "delete2"}}, []string{"delete1", "add1", "delete2"}},
+  {"onlyLastOperationIsMerged", []queuedOp{{"net1", "add", "add1"}, {"net1", "delete", "delete1"}, {"net1", "delete", "delete2"}, {"net1", "add", "add2"}}, []string{"add1", "delete2", "add2"}},
+  {"otherNetworksAreKept", []queuedOp{{"net1", "add", "net1add1"}, {"net2", "add", "net2add"}, {"net1", "add", "net1add2"}, {"net3", "delete", "net3delete"}}, []string{"net1add2", "net2add", "net3delete"}},
+  {"otherNetworksDoNotBlockMerge", []queuedOp{{"net1", "add", "net1add1"}, {"net2", "delete", "net2delete"}, {"net2", "add", "net2add"}, {"net1", "add", "net1add2"}}, []string{"net1add2", "net2delete", "net2add"}},
+}
+
+func TestQueueCoalesces(t *testing.T) {
+  for _, tc := range coalesceTcs {
+    t.Run(tc.tcName, func(t *testing.T) {
+      executed := pushBlocked(t, tc.ops)
+      if len(executed) != len(tc.expected) {
+        t.Fatalf("Expected operations:%v, executed operations:%v", tc.expected, executed)
+      }
+      for i, name := range tc.expected {
+        if executed[i] != name {
+          t.Errorf("Expected operations:%v, executed operations:%v", tc.expected, executed)
+          break
+        }
+      }
+    })
+  }
+}
@@ -0,0 +1,12 @@
+package main
+
+import (
+  "os"
+  "github.com/nokia/danm/pkg/watcher"
+)
+
+// danmwatcher runs all DANM Kubernetes controllers from a single binary
+// The controller is selected by the name of the binary (e.g. a netwatcher symlink), or by the first argument
+func main() {
+  watcher.Main(os.Args)
+}
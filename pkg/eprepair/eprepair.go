@@ -0,0 +1,144 @@
+package eprepair
+
+import (
+  "errors"
+  "log"
+  "os"
+  "time"
+  apierrors "k8s.io/apimachinery/pkg/api/errors"
+  meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+  "k8s.io/client-go/tools/cache"
+  danmtypes "github.com/nokia/danm/pkg/crd/apis/danm/v1"
+  danmclientset "github.com/nokia/danm/pkg/crd/client/clientset/versioned"
+  danminformers "github.com/nokia/danm/pkg/crd/client/informers/externalversions"
+  danmlisters "github.com/nokia/danm/pkg/crd/client/listers/danm/v1"
+  "github.com/nokia/danm/pkg/danmep"
+  "github.com/nokia/danm/pkg/ipam"
+  "github.com/nokia/danm/pkg/netspec"
+)
+
+// Repairer completes, or rolls back the DanmEps of the local host stuck in the Creating phase, e.g. because the CNI crashed while wiring their interface
+// It also finishes the teardown of the DanmEps the CNI left in the Deleting phase
+type Repairer struct {
+  client danmclientset.Interface
+  host string
+  timeout time.Duration
+}
+
+// NewRepairer initializes and returns a new Repairer object
+// DanmEps are only repaired once they have been in the Creating phase for longer than the timeout, so running CNI invocations are never disturbed
+func NewRepairer(client danmclientset.Interface, timeout time.Duration) (*Repairer, error) {
+  host, err := os.Hostname()
+  if err != nil {
+    return nil, err
+  }
+  return &Repairer{client: client, host: host, timeout: timeout}, nil
+}
+
+// Run checks the DanmEps of the local host periodically until the stop channel is closed
+func (repairer *Repairer) Run(stop <-chan struct{}) {
+  factory := danminformers.NewSharedInformerFactory(repairer.client, time.Minute*10)
+  informer := factory.Danm().V1().DanmEps()
+  informer.Informer().AddIndexers(danmlisters.DanmEpIndexers)
+  lister := informer.Lister()
+  factory.Start(stop)
+  if !cache.WaitForCacheSync(stop, informer.Informer().HasSynced) {
+    return
+  }
+  ticker := time.NewTicker(repairer.timeout / 2)
+  defer ticker.Stop()
+  for {
+    repairer.RepairAll(lister)
+    select {
+    case <-stop:
+      return
+    case <-ticker.C:
+    }
+  }
+}
+
+// RepairAll repairs all the DanmEps of the local host stuck in the Creating, or Deleting phase
+func (repairer *Repairer) RepairAll(lister danmlisters.DanmEpLister) {
+  eps, err := lister.ByHost(repairer.host)
+  if err != nil {
+    log.Println("ERROR: DanmEps of host:" + repairer.host + " cannot be listed because:" + err.Error())
+    return
+  }
+  for _, ep := range eps {
+    switch {
+    case ep.Spec.Phase == danmep.PhaseDeleting:
+      err = repairer.finishTeardown(*ep)
+    case ep.Spec.Phase == danmep.PhaseCreating && time.Since(ep.ObjectMeta.CreationTimestamp.Time) >= repairer.timeout:
+      err = repairer.repair(*ep)
+    default:
+      continue
+    }
+    if err != nil {
+      log.Println("ERROR: Repair of DanmEp:" + ep.ObjectMeta.Name + " failed, will be retried. Error:" + err.Error())
+    }
+  }
+}
+
+// finishTeardown removes the interface of a DanmEp the CNI could not confirm to be deleted, and deletes the DanmEp once the removal is verified
+// The CNI keeps the addresses of such DanmEps reserved, so they are only freed here, after the removal is verified, and the DanmEp is deleted
+// Only IPVLAN interfaces can be deleted without the CNI configuration of the Pod, delegated interfaces are waited for until their container is gone
+func (repairer *Repairer) finishTeardown(ep danmtypes.DanmEp) error {
+  err := danmep.VerifyTeardown(ep)
+  if err != nil && netspec.IsIpvlanEp(&ep) {
+    log.Println("INFO: Interface of DanmEp:" + ep.ObjectMeta.Name + " survived the CNI DEL, deleting it again")
+    err = danmep.DeleteIpvlanInterface(danmep.RestoreNetwork(ep), ep)
+    if err == nil {
+      err = danmep.DeleteHostLeftover(ep)
+    }
+    if err == nil {
+      err = danmep.VerifyTeardown(ep)
+    }
+  }
+  if err != nil {
+    return errors.New("interface cannot be torn down because:" + err.Error())
+  }
+  err = repairer.client.DanmV1().DanmEps(ep.ObjectMeta.Namespace).Delete(ep.ObjectMeta.Name, &meta_v1.DeleteOptions{Preconditions: &meta_v1.Preconditions{UID: &ep.ObjectMeta.UID}})
+  if apierrors.IsNotFound(err) || apierrors.IsConflict(err) {
+    //The DanmEp was deleted, or re-created meanwhile, so its addresses are not ours to free anymore
+    return nil
+  } else if err != nil {
+    return errors.New("DanmEp cannot be deleted because:" + err.Error())
+  }
+  return repairer.freeAddresses(ep)
+}
+
+// repair marks the DanmEp ready if its interface was wired after all, otherwise removes what was created, and deletes it
+// The DanmEp is deleted before its addresses are freed, so the addresses are never freed twice
+func (repairer *Repairer) repair(ep danmtypes.DanmEp) error {
+  isCreated, err := danmep.IsInterfaceCreated(ep)
+  if err != nil {
+    return err
+  }
+  if isCreated {
+    log.Println("INFO: Interface of DanmEp:" + ep.ObjectMeta.Name + " exists, the DanmEp is completed")
+    return danmep.SetPhase(repairer.client, ep, danmep.PhaseReady)
+  }
+  log.Println("INFO: Interface of DanmEp:" + ep.ObjectMeta.Name + " was never wired, the DanmEp is rolled back")
+  err = danmep.DeleteHostLeftover(ep)
+  if err != nil {
+    return errors.New("IPVLAN interface left in the host network namespace cannot be deleted because:" + err.Error())
+  }
+  err = repairer.client.DanmV1().DanmEps(ep.ObjectMeta.Namespace).Delete(ep.ObjectMeta.Name, &meta_v1.DeleteOptions{Preconditions: &meta_v1.Preconditions{UID: &ep.ObjectMeta.UID}})
+  if apierrors.IsNotFound(err) || apierrors.IsConflict(err) {
+    //The DanmEp was deleted, or re-created meanwhile together with its addresses
+    return nil
+  } else if err != nil {
+    return errors.New("DanmEp cannot be deleted because:" + err.Error())
+  }
+  return repairer.freeAddresses(ep)
+}
+
+// freeAddresses gives the addresses of an already deleted DanmEp back to its DanmNet
+func (repairer *Repairer) freeAddresses(ep danmtypes.DanmEp) error {
+  netInfo, err := repairer.client.DanmV1().DanmNets(ep.ObjectMeta.Namespace).Get(ep.Spec.NetworkID, meta_v1.GetOptions{})
+  if err != nil {
+    return errors.New("addresses of deleted DanmEp cannot be freed, as its DanmNet cannot be read because:" + err.Error())
+  }
+  ipam.GarbageCollectIps(repairer.client, netInfo, ep.Spec.Iface.Address, ep.Spec.Iface.AddressIPv6)
+  return nil
+}
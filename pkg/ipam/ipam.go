@@ -12,7 +12,11 @@ import (
   "math/rand"
   danmtypes "github.com/nokia/danm/pkg/crd/apis/danm/v1"
   danmclientset "github.com/nokia/danm/pkg/crd/client/clientset/versioned"
+  apierrors "k8s.io/apimachinery/pkg/api/errors"
   meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+  "k8s.io/apimachinery/pkg/labels"
+  "github.com/nokia/danm/pkg/allocmigration"
+  "github.com/nokia/danm/pkg/apiretry"
   "github.com/nokia/danm/pkg/danmnet"
   "github.com/nokia/danm/pkg/bitarray"
 )
@@ -21,6 +25,56 @@ const (
   backOffTimer = 50
 )
 
+// ErrPoolExhausted is returned when a dynamic IPv4 address is requested from a network without free addresses
+var ErrPoolExhausted = errors.New("allocation pool is exhausted")
+
+// IsPoolExhausted tells if an IP reservation failed because the allocation pool of the network is exhausted
+func IsPoolExhausted(err error) bool {
+  return err != nil && strings.Contains(err.Error(), ErrPoolExhausted.Error())
+}
+
+var (
+  debugLogging bool
+  auditFunc AuditFunc
+)
+
+// Decision describes how an IP reservation request was served
+type Decision struct {
+  Network string
+  Namespace string
+  Request4 string
+  Request6 string
+  Strategy4 string
+  Strategy6 string
+  Pool4 string
+  Pool6 string
+  Ip4 string
+  Ip6 string
+  // Retries is the number of times the allocation was repeated because the DanmNet was concurrently modified
+  Retries int
+}
+
+// String formats the decision as space separated key=value pairs
+func (decision Decision) String() string {
+  return "network=" + decision.Namespace + "/" + decision.Network +
+         " request4=" + decision.Request4 + " strategy4=" + decision.Strategy4 + " pool4=" + decision.Pool4 + " ip4=" + decision.Ip4 +
+         " request6=" + decision.Request6 + " strategy6=" + decision.Strategy6 + " pool6=" + decision.Pool6 + " ip6=" + decision.Ip6 +
+         " retries=" + strconv.Itoa(decision.Retries)
+}
+
+// AuditFunc is invoked after every successful reservation from a DanmNet with the "ipam_audit" option enabled
+type AuditFunc func(netInfo *danmtypes.DanmNet, decision Decision)
+
+// SetDebugLogging enables logging every reservation, and release decision with the "DEBUG:" prefix
+func SetDebugLogging(enabled bool) {
+  debugLogging = enabled
+}
+
+// SetAuditFunc registers the function recording the audit trail of reservations, e.g. as K8s Events
+func SetAuditFunc(audit AuditFunc) {
+  auditFunc = audit
+}
+
 // Reserve inspects the DanmNet object received as an input, and allocates an IPv4 or IPv6 address from the appropriate allocation pool
 // In case static IP allocation is requested, it will try reserver the requested error. If it is not possible, it returns an error
 // The reserved IP address is represented by setting a bit in the network's BitArray type allocation matrix
@@ -29,71 +83,241 @@ func Reserve(danmClient danmclientset.Interface, netInfo danmtypes.DanmNet, req4
   if strings.ToLower(netInfo.Spec.Validation) != "true" {
     return "", "", "", errors.New("Invalid network: " + netInfo.Spec.NetworkID)
   }
-  tempNetSpec := netInfo
+  alloc, err := loadAllocation(danmClient, netInfo)
+  if err != nil {
+    return "", "", "", err
+  }
+  decision := newDecision(&alloc.net, req4, req6)
   for {
-    ip4, ip6, macAddr, err := allocateIP(&tempNetSpec, req4, req6)
+    if !allocmigration.IsFormatSupported(&alloc.net) {
+      return "", "", "", errors.New("allocation format:" + allocmigration.GetFormat(&alloc.net) + " of network:" + netInfo.Spec.NetworkID + " is not supported by this version of DANM")
+    }
+    ip4, ip6, macAddr, err := allocateIP(&alloc.net, req4, req6)
     if err != nil {
+      logDecision(decision, err)
       return "", "", "", errors.New("failed to allocate IP address for network:" + netInfo.Spec.NetworkID + " with error:" + err.Error())
     }
-    retryNeeded, err, newNetSpec := updateDanmNetAllocation(danmClient, tempNetSpec)
+    retryNeeded, err := updateDanmNetAllocation(danmClient, alloc)
     if err != nil {
+      logDecision(decision, err)
       return "", "", "", err
     }
     if retryNeeded {
-      tempNetSpec = newNetSpec
+      decision.Retries++
       continue
     }
+    decision.Ip4, decision.Ip6 = ip4, ip6
+    logDecision(decision, nil)
+    if auditFunc != nil && netInfo.Spec.Options.IpamAudit {
+      auditFunc(&netInfo, decision)
+    }
     return ip4, ip6, macAddr, nil
   }
 }
 
+func newDecision(netInfo *danmtypes.DanmNet, req4, req6 string) Decision {
+  opts := netInfo.Spec.Options
+  decision := Decision {
+    Network: netInfo.Spec.NetworkID,
+    Namespace: netInfo.ObjectMeta.Namespace,
+    Request4: req4,
+    Request6: req6,
+    Strategy4: getStrategy(req4, opts.Alloc != "", "first-free"),
+    Strategy6: getStrategy(req6, opts.Net6 != "", "eui64"),
+    Pool6: opts.Net6,
+  }
+  if opts.Alloc != "" {
+    decision.Pool4 = opts.Pool.Start + "-" + opts.Pool.End
+  }
+  return decision
+}
+
+// getStrategy names the way a request is served: not at all, from the managed range, or passed through as requested for unmanaged networks
+func getStrategy(req string, isManaged bool, dynamicStrategy string) string {
+  switch {
+  case req == "" || req == "none":
+    return "none"
+  case !isManaged:
+    return "unmanaged"
+  case req == "dynamic":
+    return dynamicStrategy
+  default:
+    return "static"
+  }
+}
+
+func logDecision(decision Decision, err error) {
+  if !debugLogging {
+    return
+  }
+  if err != nil {
+    log.Println("DEBUG: ipam reservation failed " + decision.String() + " error=\"" + err.Error() + "\"")
+    return
+  }
+  log.Println("DEBUG: ipam reservation succeeded " + decision.String())
+}
+
 // Free inspects the DanmNet object received as an input, and releases an IPv4 or IPv6 address from the appropriate allocation pool
 // The IP address liberation is represented by unsetting a bit in the network's BitArray type allocation matrix
 // The refreshed DanmNet object is modified in the K8s API server at the end
 func Free(danmClient danmclientset.Interface, netInfo danmtypes.DanmNet, ip string) error {
-  if netInfo.Spec.Options.Alloc == "" || ip == "" {
+  if ip == "" {
+    return nil
+  }
+  alloc, err := loadAllocation(danmClient, netInfo)
+  if err != nil {
+    return err
+  }
+  if alloc.net.Spec.Options.Alloc == "" {
     // Nothing to return here: either network, or the interface is an L2
     return nil
   }
-  tempNetSpec := netInfo
+  retries := 0
   for {
-    resetIP(&tempNetSpec, ip)
-    retryNeeded, err, newNetSpec := updateDanmNetAllocation(danmClient, tempNetSpec)
+    if !allocmigration.IsFormatSupported(&alloc.net) {
+      return errors.New("allocation format:" + allocmigration.GetFormat(&alloc.net) + " of network:" + netInfo.Spec.NetworkID + " is not supported by this version of DANM")
+    }
+    resetIP(&alloc.net, ip)
+    retryNeeded, err := updateDanmNetAllocation(danmClient, alloc)
     if err != nil {
       return err
     }
     if retryNeeded {
-      tempNetSpec = newNetSpec
+      retries++
       continue
     }
+    if debugLogging {
+      log.Println("DEBUG: ipam release succeeded network=" + netInfo.ObjectMeta.Namespace + "/" + netInfo.Spec.NetworkID + " ip4=" + ip + " retries=" + strconv.Itoa(retries))
+    }
     return nil
   }
 }
 
-func updateDanmNetAllocation (danmClient danmclientset.Interface, netInfo danmtypes.DanmNet) (bool,error,danmtypes.DanmNet) {
-  resourceConflicted, err := danmnet.PutDanmNet(danmClient, &netInfo)
+// ApplyStaticAssignment replaces dynamic IP allocation requests with the address statically assigned to the Pod in the DanmNet
+// An assignment matches when it belongs to the node, and its Pod selector matches the labels of the Pod
+// Other type of requests are left unchanged, as an explicitly requested address always takes precedence
+func ApplyStaticAssignment(netInfo danmtypes.DanmNet, node string, podLabels map[string]string, req4, req6 string) (string, string) {
+  for _, assignment := range netInfo.Spec.Options.StaticAssignments {
+    if assignment.Node != node || !labels.SelectorFromSet(labels.Set(assignment.PodSelector)).Matches(labels.Set(podLabels)) {
+      continue
+    }
+    if req4 == "dynamic" && assignment.Ip != "" {
+      req4 = assignment.Ip
+    }
+    if req6 == "dynamic" && assignment.Ip6 != "" {
+      req6 = assignment.Ip6
+    }
+    break
+  }
+  return req4, req6
+}
+
+// allocation is the working copy of the allocation record of a network
+// The record is always manipulated in the alloc field of the DanmNet copy, but for networks configured with separate_allocation it is stored in their DanmNetAllocation
+type allocation struct {
+  net danmtypes.DanmNet
+  record *danmtypes.DanmNetAllocation
+}
+
+func loadAllocation(danmClient danmclientset.Interface, netInfo danmtypes.DanmNet) (*allocation, error) {
+  alloc := &allocation{net: netInfo}
+  if !netInfo.Spec.Options.SeparateAllocation || netInfo.Spec.Options.Cidr == "" {
+    return alloc, nil
+  }
+  err := apiretry.Do(apiretry.DefaultBackoff, func() error {
+    var getErr error
+    alloc.record, getErr = danmClient.DanmV1().DanmNetAllocations(netInfo.ObjectMeta.Namespace).Get(netInfo.ObjectMeta.Name, meta_v1.GetOptions{})
+    return getErr
+  })
+  if apierrors.IsNotFound(err) {
+    // separate_allocation was set after the creation of the network, so its record was never moved out of the DanmNet
+    alloc.record = nil
+    return alloc, nil
+  }
+  if err != nil {
+    return nil, errors.New("allocation record of network:" + netInfo.Spec.NetworkID + " cannot be read because:" + err.Error())
+  }
+  alloc.net.Spec.Options.Alloc = alloc.record.Spec.Alloc
+  return alloc, nil
+}
+
+func updateDanmNetAllocation (danmClient danmclientset.Interface, alloc *allocation) (bool,error) {
+  if alloc.record != nil {
+    return updateSeparateAllocation(danmClient, alloc)
+  }
+  var resourceConflicted bool
+  err := apiretry.Do(apiretry.DefaultBackoff, func() error {
+    var putErr error
+    resourceConflicted, putErr = danmnet.PutDanmNet(danmClient, &alloc.net)
+    return putErr
+  })
   if err != nil {
-    return false, errors.New("DanmNet update failed with error:" + err.Error()), danmtypes.DanmNet{}
+    return false, errors.New("DanmNet update failed with error:" + err.Error())
   }
   if resourceConflicted {
     //Randomizing backoff time to decrease the possibility of conflicts
     randomBackoff := rand.Intn(backOffTimer) 
     time.Sleep(time.Duration(randomBackoff) * time.Millisecond)
-    newNetSpec, err := danmClient.Danm().DanmNets(netInfo.ObjectMeta.Namespace).Get(netInfo.Spec.NetworkID, meta_v1.GetOptions{})
+    var newNetSpec *danmtypes.DanmNet
+    err = apiretry.Do(apiretry.DefaultBackoff, func() error {
+      var getErr error
+      newNetSpec, getErr = danmClient.Danm().DanmNets(alloc.net.ObjectMeta.Namespace).Get(alloc.net.Spec.NetworkID, meta_v1.GetOptions{})
+      return getErr
+    })
     if err != nil {
-        return false, errors.New("After IP address reservation conflict, network cannot be read again!"), danmtypes.DanmNet{}
+        return false, errors.New("After IP address reservation conflict, network cannot be read again!")
     }
-    return true, nil, *newNetSpec
+    alloc.net = *newNetSpec
+    return true, nil
   }
-  return false, nil, danmtypes.DanmNet{}
+  return false, nil
 }
 
+// updateSeparateAllocation writes the allocation record of the working copy into the DanmNetAllocation of the network, leaving the DanmNet untouched
+func updateSeparateAllocation(danmClient danmclientset.Interface, alloc *allocation) (bool,error) {
+  allocClient := danmClient.DanmV1().DanmNetAllocations(alloc.record.ObjectMeta.Namespace)
+  alloc.record.Spec.Alloc = alloc.net.Spec.Options.Alloc
+  var resourceConflicted bool
+  err := apiretry.Do(apiretry.DefaultBackoff, func() error {
+    updatedRecord, putErr := allocClient.Update(alloc.record)
+    if putErr != nil && strings.Contains(putErr.Error(), danmtypes.OptimisticLockErrorMsg) {
+      resourceConflicted = true
+      return nil
+    }
+    if putErr == nil {
+      alloc.record = updatedRecord
+    }
+    return putErr
+  })
+  if err != nil {
+    return false, errors.New("DanmNetAllocation update failed with error:" + err.Error())
+  }
+  if !resourceConflicted {
+    return false, nil
+  }
+  randomBackoff := rand.Intn(backOffTimer)
+  time.Sleep(time.Duration(randomBackoff) * time.Millisecond)
+  err = apiretry.Do(apiretry.DefaultBackoff, func() error {
+    var getErr error
+    alloc.record, getErr = allocClient.Get(alloc.record.ObjectMeta.Name, meta_v1.GetOptions{})
+    return getErr
+  })
+  if err != nil {
+    return false, errors.New("After IP address reservation conflict, allocation record cannot be read again!")
+  }
+  alloc.net.Spec.Options.Alloc = alloc.record.Spec.Alloc
+  return true, nil
+}
 
 func resetIP(netInfo *danmtypes.DanmNet, rip string) {
   ba := bitarray.NewBitArrayFromBase64(netInfo.Spec.Options.Alloc)
   _, ipnet, _ := net.ParseCIDR(netInfo.Spec.Options.Cidr)
   ipnetNum := danmnet.Ip2int(ipnet.IP)
   ip, _, _ := net.ParseCIDR(rip)
+  if ip == nil || ip.To4() == nil || !ipnet.Contains(ip) {
+    //IPv6, and static addresses outside the subnet are not recorded in the allocation bitmap
+    return
+  }
   reserved := danmnet.Ip2int(ip)
   ba.Reset(reserved - ipnetNum)
   netInfo.Spec.Options.Alloc = ba.Encode()
@@ -140,13 +364,14 @@ func allocIPv4(reqType string, netInfo *danmtypes.DanmNet, ip4 *string, macAddr
         *ip4 = (danmnet.Int2ip(ipnetNum + i)).String() + "/" + strconv.Itoa(ones)
         ba.Set(uint32(i))
         netInfo.Spec.Options.Alloc = ba.Encode()
-        break
+        return nil
       }
     }
+    return ErrPoolExhausted
   } else {
     ip, ipnet, _ := net.ParseCIDR(reqType)
-    if ip == nil {
-      return errors.New("IPv4 allocation failure, invalid fix ip")
+    if ip == nil || ip.To4() == nil {
+      return errors.New("IPv4 allocation failure, invalid fix ip:" + reqType)
     }
     if netInfo.Spec.Options.Alloc == "" {
       //fix ip address allocation without cidr/pool
@@ -168,7 +393,6 @@ func allocIPv4(reqType string, netInfo *danmtypes.DanmNet, ip4 *string, macAddr
     }
     return errors.New("fix ip is not part of network CIDR/allocation pool")
   }
-  return nil
 }
 
 func allocIPv6(reqType string, netInfo *danmtypes.DanmNet, ip6 *string, macAddr string) (error) {
@@ -191,6 +415,10 @@ func allocIPv6(reqType string, netInfo *danmtypes.DanmNet, ip6 *string, macAddr
     maskLen, _ := ip6net.Mask.Size()
     *ip6 = (danmnet.Int2ip6(ss)).String() + "/" + strconv.Itoa(maskLen)
   } else {
+    requested6, _, _ := net.ParseCIDR(reqType)
+    if requested6 == nil || requested6.To4() != nil {
+      return errors.New("IPv6 allocation failure, invalid fix ip6:" + reqType)
+    }
     net6 := netInfo.Spec.Options.Net6
     if net6 == "" {
       //ipv6 fix address for L2 pipe
@@ -198,8 +426,7 @@ func allocIPv6(reqType string, netInfo *danmtypes.DanmNet, ip6 *string, macAddr
       return nil
     }
     _, ip6net, _ := net.ParseCIDR(net6)
-    ip6addr, _, _ := net.ParseCIDR(reqType)
-    if ip6net.Contains(ip6addr) {
+    if ip6net.Contains(requested6) {
       *ip6 = reqType
       return nil
     }
@@ -0,0 +1,60 @@
+package ipam_test
+
+import (
+  "testing"
+  meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+  "github.com/nokia/danm/pkg/ipam"
+  "github.com/nokia/danm/pkg/loadtest"
+  "github.com/nokia/danm/pkg/stubs"
+  danmtypes "github.com/nokia/danm/pkg/crd/apis/danm/v1"
+)
+
+func newBenchServer(b *testing.B, cidr string) *stubs.FakeApiServer {
+  dnet, err := loadtest.NewNetwork(cidr)
+  if err != nil {
+    b.Fatalf("Benchmark network cannot be created:%v", err)
+  }
+  return stubs.NewFakeApiServer(0, []danmtypes.DanmNet{*dnet}, nil)
+}
+
+func reserveAndFree(b *testing.B, server *stubs.FakeApiServer) {
+  dnet, _ := server.DanmV1().DanmNets("default").Get(loadtest.NetworkName, meta_v1.GetOptions{})
+  ip4, _, _, err := ipam.Reserve(server, *dnet, "dynamic", "")
+  if err != nil || ip4 == "" {
+    b.Errorf("IP reservation failed:%v", err)
+    return
+  }
+  dnet, _ = server.DanmV1().DanmNets("default").Get(loadtest.NetworkName, meta_v1.GetOptions{})
+  err = ipam.Free(server, *dnet, ip4)
+  if err != nil {
+    b.Errorf("IP release failed:%v", err)
+  }
+}
+
+func BenchmarkReserveFreeSmallNet(b *testing.B) {
+  server := newBenchServer(b, "10.0.0.0/24")
+  b.ResetTimer()
+  for i := 0; i < b.N; i++ {
+    reserveAndFree(b, server)
+  }
+}
+
+func BenchmarkReserveFreeLargeNet(b *testing.B) {
+  server := newBenchServer(b, "10.0.0.0/16")
+  b.ResetTimer()
+  for i := 0; i < b.N; i++ {
+    reserveAndFree(b, server)
+  }
+}
+
+func BenchmarkReserveFreeParallel(b *testing.B) {
+  server := newBenchServer(b, "10.0.0.0/16")
+  b.ResetTimer()
+  b.RunParallel(func(pb *testing.PB) {
+    for pb.Next() {
+      reserveAndFree(b, server)
+    }
+  })
+  _, updates, conflicts := server.Stats()
+  b.Logf("%d successful, and %d conflicted DanmNet updates", updates, conflicts)
+}
@@ -3,7 +3,10 @@ package ipam_test
 import (
   "testing"
   "os"
+  apierrors "k8s.io/apimachinery/pkg/api/errors"
+  meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
   "github.com/nokia/danm/pkg/ipam"
+  "github.com/nokia/danm/pkg/loadtest"
   danmtypes "github.com/nokia/danm/pkg/crd/apis/danm/v1"
   "github.com/nokia/danm/pkg/stubs"
 )
@@ -29,6 +32,9 @@ var reserveTcs = []struct {
   {"falseValLower", testNets[1], "", "", "", "", true, false},
   {"falseValUpper", testNets[2], "", "", "", "", true, false},
   {"noIpsRequested", testNets[3], "", "", "", "", false, true},
+  {"l2StaticIps", testNets[3], "10.0.0.1/24", "2001:db8::1/64", "10.0.0.1/24", "2001:db8::1/64", false, true},
+  {"ipv6AsStaticIpv4", testNets[3], "2001:db8::1/64", "", "", "", true, false},
+  {"ipv4AsStaticIpv6", testNets[3], "", "10.0.0.1/24", "", "", true, false},
 }
 
 func TestReserve(t *testing.T) {
@@ -55,8 +61,193 @@ func TestReserve(t *testing.T) {
   }
 }
 
+var staticNet = danmtypes.DanmNet {Spec: danmtypes.DanmNetSpec{NetworkID: "staticNet", Options: danmtypes.DanmNetOption{StaticAssignments: []danmtypes.StaticAssignment{
+  danmtypes.StaticAssignment{Node: "node1", PodSelector: map[string]string{"app": "sbc"}, Ip: "10.0.0.10/24", Ip6: "2001:db8::10/64"},
+  danmtypes.StaticAssignment{Node: "node2", Ip: "10.0.0.20/24"},
+}}}}
+
+var staticAssignmentTcs = []struct {
+  tcName string
+  node string
+  podLabels map[string]string
+  requestedIp4 string
+  requestedIp6 string
+  expectedIp4 string
+  expectedIp6 string
+}{
+  {"matchingPod", "node1", map[string]string{"app": "sbc", "tier": "edge"}, "dynamic", "dynamic", "10.0.0.10/24", "2001:db8::10/64"},
+  {"nonMatchingLabels", "node1", map[string]string{"app": "lb"}, "dynamic", "dynamic", "dynamic", "dynamic"},
+  {"nonMatchingNode", "node3", map[string]string{"app": "sbc"}, "dynamic", "", "dynamic", ""},
+  {"emptySelector", "node2", nil, "dynamic", "dynamic", "10.0.0.20/24", "dynamic"},
+  {"explicitRequestsPrevail", "node1", map[string]string{"app": "sbc"}, "10.0.0.5/24", "none", "10.0.0.5/24", "none"},
+}
+
+func TestApplyStaticAssignment(t *testing.T) {
+  for _, tc := range staticAssignmentTcs {
+    t.Run(tc.tcName, func(t *testing.T) {
+      ip4, ip6 := ipam.ApplyStaticAssignment(staticNet, tc.node, tc.podLabels, tc.requestedIp4, tc.requestedIp6)
+      if ip4 != tc.expectedIp4 {
+        t.Errorf("Resolved IP4 request:%s does not match with expected:%s", ip4, tc.expectedIp4)
+      }
+      if ip6 != tc.expectedIp6 {
+        t.Errorf("Resolved IP6 request:%s does not match with expected:%s", ip6, tc.expectedIp6)
+      }
+    })
+  }
+}
+
 func TestMain(m *testing.M) {
   code := m.Run() 
   os.Exit(code)
 }
 
+
+func newConflictTestServer(t *testing.T) (*stubs.FakeApiServer, *danmtypes.DanmNet) {
+  dnet, err := loadtest.NewNetwork("10.0.0.0/24")
+  if err != nil {
+    t.Fatalf("Test network cannot be created:%v", err)
+  }
+  server := stubs.NewFakeApiServer(0, []danmtypes.DanmNet{*dnet}, nil)
+  stored, _ := server.DanmV1().DanmNets(dnet.Namespace).Get(dnet.Name, meta_v1.GetOptions{})
+  return server, stored
+}
+
+func TestReserveRetriesOnConflict(t *testing.T) {
+  server, dnet := newConflictTestServer(t)
+  server.InjectConflicts(3)
+  ip4, _, _, err := ipam.Reserve(server, *dnet, "dynamic", "")
+  if err != nil || ip4 != "10.0.0.1/24" {
+    t.Fatalf("Reservation after conflicts returned IP:%s, error:%v", ip4, err)
+  }
+  _, updates, conflicts := server.Stats()
+  if updates != 1 || conflicts != 3 {
+    t.Errorf("Reservation was expected to be retried after every conflict, updates:%d, conflicts:%d", updates, conflicts)
+  }
+}
+
+func TestReserveAudit(t *testing.T) {
+  server, dnet := newConflictTestServer(t)
+  var decisions []ipam.Decision
+  ipam.SetAuditFunc(func(netInfo *danmtypes.DanmNet, decision ipam.Decision) {
+    decisions = append(decisions, decision)
+  })
+  defer ipam.SetAuditFunc(nil)
+  ipam.Reserve(server, *dnet, "dynamic", "")
+  if len(decisions) != 0 {
+    t.Errorf("Reservation from network without ipam_audit was audited")
+  }
+  dnet.Spec.Options.IpamAudit = true
+  server.InjectConflicts(2)
+  ip4, _, _, err := ipam.Reserve(server, *dnet, "dynamic", "")
+  if err != nil || len(decisions) != 1 {
+    t.Fatalf("Reservation from network with ipam_audit was expected to be audited once, audits:%d, error:%v", len(decisions), err)
+  }
+  if decisions[0].Ip4 != ip4 || decisions[0].Strategy4 != "first-free" || decisions[0].Strategy6 != "none" || decisions[0].Retries < 2 {
+    t.Errorf("Audited decision does not match the reservation:%s", decisions[0].String())
+  }
+}
+
+func TestReserveWithStaleNetwork(t *testing.T) {
+  server, staleNet := newConflictTestServer(t)
+  ip4, _, _, _ := ipam.Reserve(server, *staleNet, "dynamic", "")
+  //The second reservation still starts from the stale copy, so it must re-read the network after the conflict instead of allocating the same address twice
+  secondIp4, _, _, err := ipam.Reserve(server, *staleNet, "dynamic", "")
+  if err != nil || secondIp4 == ip4 {
+    t.Errorf("Reservation from stale network returned IP:%s, error:%v, while first reservation got IP:%s", secondIp4, err, ip4)
+  }
+}
+
+func TestReserveRetriesServerErrors(t *testing.T) {
+  server, dnet := newConflictTestServer(t)
+  server.InjectErrors(2, apierrors.NewServiceUnavailable("apiserver is restarting"))
+  ip4, _, _, err := ipam.Reserve(server, *dnet, "dynamic", "")
+  if err != nil || ip4 == "" {
+    t.Errorf("Reservation was expected to survive transient API server errors, IP:%s, error:%v", ip4, err)
+  }
+  server.InjectErrors(100, apierrors.NewBadRequest("invalid object"))
+  _, _, _, err = ipam.Reserve(server, *dnet, "dynamic", "")
+  if err == nil {
+    t.Errorf("Reservation was expected to fail on a non-retriable API server error")
+  }
+}
+
+func TestFreeRetriesOnConflict(t *testing.T) {
+  server, dnet := newConflictTestServer(t)
+  ip4, _, _, _ := ipam.Reserve(server, *dnet, "dynamic", "")
+  dnet, _ = server.DanmV1().DanmNets(dnet.Namespace).Get(dnet.Name, meta_v1.GetOptions{})
+  server.InjectConflicts(2)
+  err := ipam.Free(server, *dnet, ip4)
+  if err != nil {
+    t.Fatalf("Free after conflicts failed with error:%v", err)
+  }
+  dnet, _ = server.DanmV1().DanmNets(dnet.Namespace).Get(dnet.Name, meta_v1.GetOptions{})
+  reused, _, _, _ := ipam.Reserve(server, *dnet, "dynamic", "")
+  if reused != ip4 {
+    t.Errorf("Freed address:%s was expected to be allocated again, got:%s", ip4, reused)
+  }
+}
+
+func TestReserveFromExhaustedPool(t *testing.T) {
+  dnet, _ := loadtest.NewNetwork("10.0.0.0/30")
+  server := stubs.NewFakeApiServer(0, []danmtypes.DanmNet{*dnet}, nil)
+  var err error
+  for i := 0; i < 4 && err == nil; i++ {
+    dnet, _ = server.DanmV1().DanmNets(dnet.Namespace).Get(dnet.Name, meta_v1.GetOptions{})
+    _, _, _, err = ipam.Reserve(server, *dnet, "dynamic", "")
+  }
+  if !ipam.IsPoolExhausted(err) {
+    t.Errorf("Reservation from an exhausted pool was expected to fail with:%v, got:%v", ipam.ErrPoolExhausted, err)
+  }
+}
+
+func TestFreeIgnoresAddressesOutsideCidr(t *testing.T) {
+  server, dnet := newConflictTestServer(t)
+  ip4, _, _, _ := ipam.Reserve(server, *dnet, "dynamic", "")
+  dnet, _ = server.DanmV1().DanmNets(dnet.Namespace).Get(dnet.Name, meta_v1.GetOptions{})
+  //The lower 32 bits of both addresses match the reserved IPv4 address
+  for _, ip := range []string{"2001:db8::a00:1/64", "10.1.0.1/24"} {
+    err := ipam.Free(server, *dnet, ip)
+    if err != nil {
+      t.Fatalf("Free of address:%s failed with error:%v", ip, err)
+    }
+    dnet, _ = server.DanmV1().DanmNets(dnet.Namespace).Get(dnet.Name, meta_v1.GetOptions{})
+  }
+  next, _, _, _ := ipam.Reserve(server, *dnet, "dynamic", "")
+  if next == ip4 {
+    t.Errorf("Address:%s was freed by releasing an address outside the subnet of the network", ip4)
+  }
+}
+
+func TestReserveFromSeparateAllocation(t *testing.T) {
+  dnet, _ := loadtest.NewNetwork("10.0.0.0/24")
+  record := &danmtypes.DanmNetAllocation {
+    ObjectMeta: meta_v1.ObjectMeta{Name: dnet.Name, Namespace: dnet.Namespace},
+    Spec: danmtypes.DanmNetAllocationSpec{NetworkID: dnet.Spec.NetworkID, Alloc: dnet.Spec.Options.Alloc},
+  }
+  dnet.Spec.Options.SeparateAllocation = true
+  dnet.Spec.Options.Alloc = ""
+  server := stubs.NewFakeApiServer(0, []danmtypes.DanmNet{*dnet}, nil)
+  server.DanmV1().DanmNetAllocations(dnet.Namespace).Create(record)
+  dnet, _ = server.DanmV1().DanmNets(dnet.Namespace).Get(dnet.Name, meta_v1.GetOptions{})
+  server.InjectConflicts(1)
+  ip4, _, _, err := ipam.Reserve(server, *dnet, "dynamic", "")
+  if err != nil || ip4 != "10.0.0.1/24" {
+    t.Fatalf("Reservation from separate allocation record returned IP:%s, error:%v", ip4, err)
+  }
+  secondIp4, _, _, _ := ipam.Reserve(server, *dnet, "dynamic", "")
+  if secondIp4 == ip4 {
+    t.Errorf("Address:%s was allocated twice from the separate allocation record", ip4)
+  }
+  storedNet, _ := server.DanmV1().DanmNets(dnet.Namespace).Get(dnet.Name, meta_v1.GetOptions{})
+  if storedNet.ResourceVersion != dnet.ResourceVersion || storedNet.Spec.Options.Alloc != "" {
+    t.Errorf("DanmNet was modified by reservations from a network with separate allocation record")
+  }
+  err = ipam.Free(server, *dnet, ip4)
+  if err != nil {
+    t.Fatalf("Free from separate allocation record failed with error:%v", err)
+  }
+  reused, _, _, _ := ipam.Reserve(server, *dnet, "dynamic", "")
+  if reused != ip4 {
+    t.Errorf("Freed address:%s was expected to be allocated again, got:%s", ip4, reused)
+  }
+}
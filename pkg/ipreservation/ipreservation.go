@@ -0,0 +1,246 @@
+package ipreservation
+
+import (
+  "errors"
+  "log"
+  "strings"
+  "time"
+  "github.com/prometheus/client_golang/prometheus"
+  meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+  "k8s.io/client-go/rest"
+  "k8s.io/client-go/tools/cache"
+  "k8s.io/client-go/util/retry"
+  danmtypes "github.com/nokia/danm/pkg/crd/apis/danm/v1"
+  danmclientset "github.com/nokia/danm/pkg/crd/client/clientset/versioned"
+  danminformers "github.com/nokia/danm/pkg/crd/client/informers/externalversions"
+  "github.com/nokia/danm/pkg/apiretry"
+  "github.com/nokia/danm/pkg/ipam"
+)
+
+const (
+  // Finalizer keeps a DanmIPReservation in the API until its addresses are returned to the allocation pool
+  Finalizer = "danm.k8s.io/ip-reservation"
+  // StatePending means that a netwatcher instance has claimed the reservation, and is allocating its addresses
+  StatePending = "Pending"
+  // StateReserved means that the addresses are allocated, and protected from Pod allocations
+  StateReserved = "Reserved"
+  // StateFailed means that the addresses could not be allocated, the reason is stored in the Message field
+  StateFailed = "Failed"
+  // ClaimTimeout is the time after which a reservation still Pending is claimed again, as its claimer is assumed to have crashed
+  ClaimTimeout = time.Minute * 2
+)
+
+var reservationsDesc = prometheus.NewDesc("danm_ip_reservations",
+  "Number of DanmIPReservations per network, and state.",
+  []string{"namespace", "network", "state"}, nil)
+
+// Handler allocates, and releases the addresses of DanmIPReservations
+// All netwatcher instances run a Handler, the instance which first claims a reservation with an optimistically locked update handles it
+type Handler struct {
+  client danmclientset.Interface
+}
+
+// NewHandler initializes and returns a new Handler object
+func NewHandler(cfg *rest.Config) (Handler,error) {
+  client, err := danmclientset.NewForConfig(cfg)
+  if err != nil {
+    return Handler{}, err
+  }
+  return Handler{client: client}, nil
+}
+
+// CreateController returns a controller watching DanmIPReservations
+// The number of reservations known by the controller is exported as Prometheus metrics
+func (handler Handler) CreateController() cache.Controller {
+  danmInformerFactory := danminformers.NewSharedInformerFactory(handler.client, time.Minute*10)
+  controller := danmInformerFactory.Danm().V1().DanmIPReservations().Informer()
+  controller.AddEventHandler(cache.ResourceEventHandlerFuncs{
+    AddFunc: func(obj interface{}) {
+      handler.sync(obj.(*danmtypes.DanmIPReservation))
+    },
+    UpdateFunc: func(oldObj, newObj interface{}) {
+      handler.sync(newObj.(*danmtypes.DanmIPReservation))
+    },
+  })
+  prometheus.MustRegister(reservationCollector{store: controller.GetStore()})
+  return controller
+}
+
+func (handler Handler) sync(res *danmtypes.DanmIPReservation) {
+  if res.ObjectMeta.DeletionTimestamp != nil {
+    handler.release(res)
+    return
+  }
+  if res.Spec.State == "" || isStaleClaim(res) {
+    handler.reserve(res)
+  }
+}
+
+// isStaleClaim tells if the reservation is Pending for longer than ClaimTimeout, e.g. because its claimer crashed, or could not record the outcome
+func isStaleClaim(res *danmtypes.DanmIPReservation) bool {
+  if res.Spec.State != StatePending {
+    return false
+  }
+  claimTime, err := time.Parse(time.RFC3339, res.Spec.ClaimTime)
+  return err != nil || time.Since(claimTime) > ClaimTimeout
+}
+
+// reserve claims the reservation, allocates its addresses, then records the outcome in the reservation
+// The Finalizer added during the claim guarantees that the addresses are released even if the reservation is deleted meanwhile
+// The allocated addresses are freed if the outcome cannot be recorded, so the claim left Pending can be safely retried after ClaimTimeout
+func (handler Handler) reserve(res *danmtypes.DanmIPReservation) {
+  reservations := handler.client.DanmV1().DanmIPReservations(res.ObjectMeta.Namespace)
+  claim := res.DeepCopy()
+  claim.Spec.State = StatePending
+  claim.Spec.ClaimTime = time.Now().UTC().Format(time.RFC3339)
+  if !hasFinalizer(claim) {
+    claim.ObjectMeta.Finalizers = append(claim.ObjectMeta.Finalizers, Finalizer)
+  }
+  _, err := reservations.Update(claim)
+  if err != nil {
+    //Another netwatcher claimed it first, or the reservation was modified meanwhile and will be notified again
+    return
+  }
+  ip4, ip6, allocErr := handler.allocate(res)
+  var isReleased bool
+  err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
+    latest, err := reservations.Get(res.ObjectMeta.Name, meta_v1.GetOptions{})
+    if err != nil {
+      return err
+    }
+    isReleased = latest.ObjectMeta.DeletionTimestamp != nil
+    if isReleased || allocErr != nil {
+      removeFinalizer(latest)
+    }
+    if !isReleased {
+      setResult(latest, ip4, ip6, allocErr)
+    }
+    _, err = reservations.Update(latest)
+    return err
+  })
+  if err != nil {
+    log.Println("ERROR: Outcome of DanmIPReservation:" + res.ObjectMeta.Namespace + "/" + res.ObjectMeta.Name + " cannot be recorded, the allocated address is freed because:" + err.Error())
+    if allocErr == nil {
+      handler.freeAddress(res.ObjectMeta.Namespace, res.Spec.NetworkID, ip4)
+    }
+    return
+  }
+  if isReleased {
+    handler.freeAddress(res.ObjectMeta.Namespace, res.Spec.NetworkID, ip4)
+  }
+}
+
+func (handler Handler) allocate(res *danmtypes.DanmIPReservation) (string,string,error) {
+  if res.Spec.Ip == "" && res.Spec.Ip6 == "" {
+    return "", "", errors.New("either Ip, or Ip6 shall be requested")
+  }
+  dnet, err := handler.getNetwork(res.ObjectMeta.Namespace, res.Spec.NetworkID)
+  if err != nil {
+    return "", "", err
+  }
+  ip4, ip6, _, err := ipam.Reserve(handler.client, *dnet, res.Spec.Ip, res.Spec.Ip6)
+  return ip4, ip6, err
+}
+
+func setResult(res *danmtypes.DanmIPReservation, ip4, ip6 string, allocErr error) {
+  if allocErr != nil {
+    res.Spec.State = StateFailed
+    res.Spec.Message = allocErr.Error()
+    return
+  }
+  res.Spec.State = StateReserved
+  res.Spec.Address = ip4
+  res.Spec.AddressIPv6 = ip6
+  res.Spec.Message = ""
+}
+
+// release returns the addresses of a deleted reservation to the allocation pool
+// Only the instance successfully removing the Finalizer frees the addresses, so they are never freed twice
+// Pending, and Failed reservations have no recorded address, so only their Finalizer is removed
+// A claimer still allocating the addresses of a Pending reservation frees them itself, when it cannot record the outcome
+func (handler Handler) release(res *danmtypes.DanmIPReservation) {
+  if !hasFinalizer(res) {
+    return
+  }
+  released := res.DeepCopy()
+  removeFinalizer(released)
+  _, err := handler.client.DanmV1().DanmIPReservations(res.ObjectMeta.Namespace).Update(released)
+  if err != nil {
+    return
+  }
+  handler.freeAddress(res.ObjectMeta.Namespace, res.Spec.NetworkID, res.Spec.Address)
+}
+
+// freeAddress returns an IPv4 address to the allocation pool
+// Dynamic IPv6 addresses are generated from the MAC address, thus they are not tracked in the allocation record
+func (handler Handler) freeAddress(namespace, netId, ip4 string) {
+  if ip4 == "" {
+    return
+  }
+  dnet, err := handler.getNetwork(namespace, netId)
+  if err == nil {
+    err = ipam.Free(handler.client, *dnet, ip4)
+  }
+  if err != nil {
+    log.Println("ERROR: Reserved address:" + ip4 + " of network:" + namespace + "/" + netId + " cannot be freed because:" + err.Error())
+  }
+}
+
+func (handler Handler) getNetwork(namespace, netId string) (*danmtypes.DanmNet,error) {
+  var dnet *danmtypes.DanmNet
+  err := apiretry.Do(apiretry.DefaultBackoff, func() error {
+    var getErr error
+    dnet, getErr = handler.client.DanmV1().DanmNets(namespace).Get(netId, meta_v1.GetOptions{})
+    return getErr
+  })
+  if err != nil {
+    return nil, errors.New("network:" + netId + " cannot be read because:" + err.Error())
+  }
+  if strings.ToLower(dnet.Spec.Validation) != "true" {
+    return nil, errors.New("network:" + netId + " is not valid")
+  }
+  return dnet, nil
+}
+
+func hasFinalizer(res *danmtypes.DanmIPReservation) bool {
+  for _, finalizer := range res.ObjectMeta.Finalizers {
+    if finalizer == Finalizer {
+      return true
+    }
+  }
+  return false
+}
+
+func removeFinalizer(res *danmtypes.DanmIPReservation) {
+  var finalizers []string
+  for _, finalizer := range res.ObjectMeta.Finalizers {
+    if finalizer != Finalizer {
+      finalizers = append(finalizers, finalizer)
+    }
+  }
+  res.ObjectMeta.Finalizers = finalizers
+}
+
+// reservationCollector counts the DanmIPReservations of the informer cache when metrics are scraped
+type reservationCollector struct {
+  store cache.Store
+}
+
+func (collector reservationCollector) Describe(ch chan<- *prometheus.Desc) {
+  ch <- reservationsDesc
+}
+
+func (collector reservationCollector) Collect(ch chan<- prometheus.Metric) {
+  counts := make(map[[3]string]int)
+  for _, obj := range collector.store.List() {
+    res := obj.(*danmtypes.DanmIPReservation)
+    state := res.Spec.State
+    if state == "" {
+      state = StatePending
+    }
+    counts[[3]string{res.ObjectMeta.Namespace, res.Spec.NetworkID, state}]++
+  }
+  for labels, count := range counts {
+    ch <- prometheus.MustNewConstMetric(reservationsDesc, prometheus.GaugeValue, float64(count), labels[0], labels[1], labels[2])
+  }
+}
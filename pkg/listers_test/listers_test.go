@@ -0,0 +1,78 @@
+package listers_test
+
+import (
+  "testing"
+  meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+  "k8s.io/client-go/tools/cache"
+  danmtypes "github.com/nokia/danm/pkg/crd/apis/danm/v1"
+  danmlisters "github.com/nokia/danm/pkg/crd/client/listers/danm/v1"
+)
+
+var eps = []danmtypes.DanmEp {
+  {ObjectMeta: meta_v1.ObjectMeta{Name: "ep1", Namespace: "default"}, Spec: danmtypes.DanmEpSpec{Host: "node1", CID: "cid1"}},
+  {ObjectMeta: meta_v1.ObjectMeta{Name: "ep2", Namespace: "default"}, Spec: danmtypes.DanmEpSpec{Host: "node1", CID: "cid1"}},
+  {ObjectMeta: meta_v1.ObjectMeta{Name: "ep3", Namespace: "kube-system"}, Spec: danmtypes.DanmEpSpec{Host: "node2", CID: "cid2"}},
+}
+
+var nets = []danmtypes.DanmNet {
+  {ObjectMeta: meta_v1.ObjectMeta{Name: "net1", Namespace: "default"}, Spec: danmtypes.DanmNetSpec{Options: danmtypes.DanmNetOption{Device: "ens3"}}},
+  {ObjectMeta: meta_v1.ObjectMeta{Name: "net2", Namespace: "default"}, Spec: danmtypes.DanmNetSpec{Options: danmtypes.DanmNetOption{Device: "ens3", HostDevices: []string{"ens3","ens4"}}}},
+  {ObjectMeta: meta_v1.ObjectMeta{Name: "net3", Namespace: "other"}, Spec: danmtypes.DanmNetSpec{Options: danmtypes.DanmNetOption{Device: "ens5"}}},
+}
+
+var listerTcs = []struct {
+  tcName string
+  isIndexed bool
+}{
+  {"indexed", true},
+  {"notIndexed", false},
+}
+
+func newIndexer(isIndexed bool, indexers cache.Indexers) cache.Indexer {
+  if !isIndexed {
+    indexers = cache.Indexers{}
+  }
+  return cache.NewIndexer(cache.MetaNamespaceKeyFunc, indexers)
+}
+
+func TestDanmEpLister(t *testing.T) {
+  for _, tc := range listerTcs {
+    t.Run(tc.tcName, func(t *testing.T) {
+      indexer := newIndexer(tc.isIndexed, danmlisters.DanmEpIndexers)
+      for i := range eps {
+        indexer.Add(&eps[i])
+      }
+      lister := danmlisters.NewDanmEpLister(indexer)
+      byHost, err := lister.ByHost("node1")
+      if err != nil || len(byHost) != 2 {
+        t.Errorf("ByHost returned %d DanmEps instead of 2, error:%v", len(byHost), err)
+      }
+      byCid, err := lister.ByCID("cid2")
+      if err != nil || len(byCid) != 1 || byCid[0].ObjectMeta.Name != "ep3" {
+        t.Errorf("ByCID did not return exactly ep3, error:%v", err)
+      }
+      unknown, err := lister.ByHost("node3")
+      if err != nil || len(unknown) != 0 {
+        t.Errorf("ByHost returned DanmEps of an unknown host, error:%v", err)
+      }
+    })
+  }
+}
+
+func TestDanmNetLister(t *testing.T) {
+  for _, tc := range listerTcs {
+    t.Run(tc.tcName, func(t *testing.T) {
+      indexer := newIndexer(tc.isIndexed, danmlisters.DanmNetIndexers)
+      for i := range nets {
+        indexer.Add(&nets[i])
+      }
+      lister := danmlisters.NewDanmNetLister(indexer)
+      for device, expected := range map[string]int{"ens3": 2, "ens4": 1, "ens5": 1, "ens6": 0} {
+        byDevice, err := lister.ByDevice(device)
+        if err != nil || len(byDevice) != expected {
+          t.Errorf("ByDevice(%s) returned %d DanmNets instead of %d, error:%v", device, len(byDevice), expected, err)
+        }
+      }
+    })
+  }
+}
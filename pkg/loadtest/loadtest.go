@@ -0,0 +1,177 @@
+package loadtest
+
+import (
+  "errors"
+  "net"
+  "sort"
+  "strconv"
+  "sync"
+  "time"
+  meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+  danmtypes "github.com/nokia/danm/pkg/crd/apis/danm/v1"
+  "github.com/nokia/danm/pkg/bitarray"
+  "github.com/nokia/danm/pkg/danmnet"
+  "github.com/nokia/danm/pkg/ipam"
+  "github.com/nokia/danm/pkg/stubs"
+)
+
+const (
+  // NetworkName is the name of the DanmNet all simulated Pods connect to
+  NetworkName = "loadtest"
+  networkNamespace = "default"
+)
+
+// Config describes the simulated load
+type Config struct {
+  // Rate is the number of ADD, and the same number of DEL operations started every second
+  Rate int
+  // Duration is the length of the load phase
+  Duration time.Duration
+  // Cidr is the IPv4 subnet of the simulated network
+  Cidr string
+  // ApiLatency is added to every request served by the fake API server
+  ApiLatency time.Duration
+}
+
+// Result summarizes the outcome of a load test run
+type Result struct {
+  Adds int
+  Dels int
+  Failures int
+  Updates uint64
+  Conflicts uint64
+  AddLatency Latency
+  DelLatency Latency
+}
+
+// Latency holds the percentiles of operation latencies
+type Latency struct {
+  P50 time.Duration
+  P99 time.Duration
+  Max time.Duration
+}
+
+// ConflictRate returns the ratio of DanmNet updates rejected because of an optimistic lock conflict
+func (result Result) ConflictRate() float64 {
+  if result.Updates + result.Conflicts == 0 {
+    return 0
+  }
+  return float64(result.Conflicts) / float64(result.Updates + result.Conflicts)
+}
+
+type recorder struct {
+  mux sync.Mutex
+  adds []time.Duration
+  dels []time.Duration
+  failures int
+}
+
+func (rec *recorder) record(durations *[]time.Duration, duration time.Duration, err error) {
+  rec.mux.Lock()
+  defer rec.mux.Unlock()
+  *durations = append(*durations, duration)
+  if err != nil {
+    rec.failures++
+  }
+}
+
+// NewNetwork returns a validated DanmNet with the given subnet, like it would be stored by netwatcher
+func NewNetwork(cidr string) (*danmtypes.DanmNet, error) {
+  _, ipnet, err := net.ParseCIDR(cidr)
+  if err != nil {
+    return nil, errors.New("invalid CIDR:" + cidr)
+  }
+  ones, bits := ipnet.Mask.Size()
+  size := 1 << uint(bits - ones)
+  bitArray, err := bitarray.NewBitArray(size)
+  if err != nil {
+    return nil, errors.New("BitArray allocation failed because:" + err.Error())
+  }
+  bitArray.Set(uint32(size - 1))
+  first := danmnet.Ip2int(ipnet.IP)
+  return &danmtypes.DanmNet {
+    ObjectMeta: meta_v1.ObjectMeta{Name: NetworkName, Namespace: networkNamespace},
+    Spec: danmtypes.DanmNetSpec {
+      NetworkID: NetworkName,
+      Validation: "True",
+      Options: danmtypes.DanmNetOption {
+        Cidr: cidr,
+        Pool: danmtypes.IP4Pool{Start: danmnet.Int2ip(first + 1).String(), End: danmnet.Int2ip(first + uint32(size) - 2).String()},
+        Alloc: bitArray.Encode(),
+      },
+    },
+  }, nil
+}
+
+// Run executes the load test described by the config
+// Every started ADD operation reserves a dynamic IP, which is then released by a DEL operation
+func Run(config Config) (Result, error) {
+  if config.Rate <= 0 {
+    return Result{}, errors.New("rate shall be a positive number, got:" + strconv.Itoa(config.Rate))
+  }
+  dnet, err := NewNetwork(config.Cidr)
+  if err != nil {
+    return Result{}, err
+  }
+  server := stubs.NewFakeApiServer(config.ApiLatency, []danmtypes.DanmNet{*dnet}, nil)
+  rec := &recorder{}
+  var wg sync.WaitGroup
+  ticker := time.NewTicker(time.Second / time.Duration(config.Rate))
+  defer ticker.Stop()
+  deadline := time.Now().Add(config.Duration)
+  for time.Now().Before(deadline) {
+    <-ticker.C
+    wg.Add(1)
+    go func() {
+      defer wg.Done()
+      simulatePod(server, rec)
+    }()
+  }
+  wg.Wait()
+  _, updates, conflicts := server.Stats()
+  return Result {
+    Adds: len(rec.adds),
+    Dels: len(rec.dels),
+    Failures: rec.failures,
+    Updates: updates,
+    Conflicts: conflicts,
+    AddLatency: percentiles(rec.adds),
+    DelLatency: percentiles(rec.dels),
+  }, nil
+}
+
+func simulatePod(server *stubs.FakeApiServer, rec *recorder) {
+  begin := time.Now()
+  dnet, err := server.DanmV1().DanmNets(networkNamespace).Get(NetworkName, meta_v1.GetOptions{})
+  if err != nil {
+    rec.record(&rec.adds, time.Since(begin), err)
+    return
+  }
+  ip4, _, _, err := ipam.Reserve(server, *dnet, "dynamic", "")
+  rec.record(&rec.adds, time.Since(begin), err)
+  if err != nil {
+    return
+  }
+  begin = time.Now()
+  dnet, err = server.DanmV1().DanmNets(networkNamespace).Get(NetworkName, meta_v1.GetOptions{})
+  if err == nil {
+    err = ipam.Free(server, *dnet, ip4)
+  }
+  rec.record(&rec.dels, time.Since(begin), err)
+}
+
+func percentiles(durations []time.Duration) Latency {
+  if len(durations) == 0 {
+    return Latency{}
+  }
+  sorted := make([]time.Duration, len(durations))
+  copy(sorted, durations)
+  sort.Slice(sorted, func(i, j int) bool {
+    return sorted[i] < sorted[j]
+  })
+  return Latency {
+    P50: sorted[len(sorted)*50/100],
+    P99: sorted[len(sorted)*99/100],
+    Max: sorted[len(sorted)-1],
+  }
+}
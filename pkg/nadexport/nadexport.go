@@ -0,0 +1,197 @@
+package nadexport
+
+import (
+  "encoding/json"
+  "errors"
+  "log"
+  "reflect"
+  "sort"
+  "time"
+  apierrors "k8s.io/apimachinery/pkg/api/errors"
+  meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+  "k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+  "k8s.io/apimachinery/pkg/runtime/schema"
+  "k8s.io/client-go/dynamic"
+  "k8s.io/client-go/tools/cache"
+  danmtypes "github.com/nokia/danm/pkg/crd/apis/danm/v1"
+  danmclientset "github.com/nokia/danm/pkg/crd/client/clientset/versioned"
+  danminformers "github.com/nokia/danm/pkg/crd/client/informers/externalversions"
+  "github.com/nokia/danm/pkg/netspec"
+)
+
+const (
+  // ExportedFromLabel marks the NetworkAttachmentDefinitions rendered by DANM, its value is the name of the source DanmNet
+  ExportedFromLabel = "danm.k8s.io/exported-from"
+  // ReadOnlyAnnotation warns users that the NetworkAttachmentDefinition is generated, and manual changes are overwritten
+  ReadOnlyAnnotation = "danm.k8s.io/read-only"
+  exportedCniVersion = "0.3.1"
+)
+
+// NadResource is the API resource of Multus' NetworkAttachmentDefinition objects
+var NadResource = schema.GroupVersionResource{Group: "k8s.cni.cncf.io", Version: "v1", Resource: "network-attachment-definitions"}
+
+type exportedConfig struct {
+  CniVersion  string       `json:"cniVersion"`
+  Name        string       `json:"name"`
+  Type        string       `json:"type"`
+  NetworkType string       `json:"networkType"`
+  Master      string       `json:"master,omitempty"`
+  Vlan        int          `json:"vlan,omitempty"`
+  Vxlan       int          `json:"vxlan,omitempty"`
+  Ipam        *exportedIpam `json:"ipam,omitempty"`
+}
+
+type exportedIpam struct {
+  Type       string          `json:"type"`
+  Subnet     string          `json:"subnet,omitempty"`
+  RangeStart string          `json:"rangeStart,omitempty"`
+  RangeEnd   string          `json:"rangeEnd,omitempty"`
+  Subnet6    string          `json:"subnet6,omitempty"`
+  Routes     []exportedRoute `json:"routes,omitempty"`
+}
+
+type exportedRoute struct {
+  Dst string `json:"dst"`
+  Gw  string `json:"gw"`
+}
+
+// Render returns the NetworkAttachmentDefinition describing the DanmNet to tools expecting the Multus API
+// The rendered CNI config has the "danm" type, as interfaces of the network are still provisioned, and addresses are still allocated by DANM
+// The NetworkAttachmentDefinition is owned by the DanmNet, so it is garbage collected together with it
+func Render(dnet *danmtypes.DanmNet) (*unstructured.Unstructured, error) {
+  config, err := json.Marshal(renderConfig(dnet))
+  if err != nil {
+    return nil, errors.New("CNI config of DanmNet:" + dnet.Name + " cannot be rendered because:" + err.Error())
+  }
+  isController := true
+  nad := &unstructured.Unstructured{}
+  nad.SetAPIVersion(NadResource.GroupVersion().String())
+  nad.SetKind("NetworkAttachmentDefinition")
+  nad.SetName(dnet.Name)
+  nad.SetNamespace(dnet.Namespace)
+  nad.SetLabels(map[string]string{ExportedFromLabel: dnet.Name})
+  nad.SetAnnotations(map[string]string{ReadOnlyAnnotation: "true"})
+  nad.SetOwnerReferences([]meta_v1.OwnerReference {
+    meta_v1.OwnerReference {
+      APIVersion: danmtypes.SchemeGroupVersion.String(),
+      Kind: "DanmNet",
+      Name: dnet.Name,
+      UID: dnet.UID,
+      Controller: &isController,
+    },
+  })
+  unstructured.SetNestedField(nad.Object, string(config), "spec", "config")
+  return nad, nil
+}
+
+func renderConfig(dnet *danmtypes.DanmNet) exportedConfig {
+  opts := dnet.Spec.Options
+  networkType := netspec.GetNetworkType(dnet)
+  config := exportedConfig {
+    CniVersion: exportedCniVersion,
+    Name: dnet.Spec.NetworkID,
+    Type: "danm",
+    NetworkType: networkType,
+    Master: netspec.GetHostInterface(dnet),
+    Vlan: opts.Vlan,
+    Vxlan: opts.Vxlan,
+  }
+  if opts.Cidr == "" && opts.Net6 == "" {
+    return config
+  }
+  config.Ipam = &exportedIpam {
+    Type: "danm",
+    Subnet: opts.Cidr,
+    RangeStart: opts.Pool.Start,
+    RangeEnd: opts.Pool.End,
+    Subnet6: opts.Net6,
+  }
+  for _, routes := range []map[string]string{opts.Routes, opts.Routes6} {
+    for dst, gw := range routes {
+      config.Ipam.Routes = append(config.Ipam.Routes, exportedRoute{Dst: dst, Gw: gw})
+    }
+  }
+  //Map iteration order is random, routes are sorted to avoid needless updates
+  sort.Slice(config.Ipam.Routes, func(i, j int) bool {
+    return config.Ipam.Routes[i].Dst < config.Ipam.Routes[j].Dst
+  })
+  return config
+}
+
+// Exporter keeps a read-only NetworkAttachmentDefinition up-to-date for every valid DanmNet
+// NetworkAttachmentDefinitions not created by the Exporter are never modified
+type Exporter struct {
+  danmClient danmclientset.Interface
+  dynClient dynamic.Interface
+}
+
+// NewExporter initializes and returns a new Exporter object
+func NewExporter(danmClient danmclientset.Interface, dynClient dynamic.Interface) *Exporter {
+  return &Exporter {
+    danmClient: danmClient,
+    dynClient: dynClient,
+  }
+}
+
+// Run watches DanmNets, and exports them until the stop channel is closed
+// Periodic resyncs revert the manual modifications of the exported objects
+func (exporter *Exporter) Run(stop <-chan struct{}) {
+  factory := danminformers.NewSharedInformerFactory(exporter.danmClient, time.Minute*10)
+  informer := factory.Danm().V1().DanmNets().Informer()
+  informer.AddEventHandler(cache.ResourceEventHandlerFuncs {
+    AddFunc: func(obj interface{}) {
+      exporter.export(obj.(*danmtypes.DanmNet))
+    },
+    UpdateFunc: func(oldObj, newObj interface{}) {
+      exporter.export(newObj.(*danmtypes.DanmNet))
+    },
+  })
+  informer.Run(stop)
+}
+
+func (exporter *Exporter) export(dnet *danmtypes.DanmNet) {
+  if dnet.Spec.Validation != "True" {
+    return
+  }
+  err := exporter.Sync(dnet)
+  if err != nil {
+    log.Println("ERROR: Export of DanmNet:" + dnet.Namespace + "/" + dnet.Name + " failed with error:" + err.Error())
+  }
+}
+
+// Sync creates, or updates the NetworkAttachmentDefinition of the DanmNet
+func (exporter *Exporter) Sync(dnet *danmtypes.DanmNet) error {
+  desired, err := Render(dnet)
+  if err != nil {
+    return err
+  }
+  nads := exporter.dynClient.Resource(NadResource).Namespace(dnet.Namespace)
+  existing, err := nads.Get(dnet.Name, meta_v1.GetOptions{})
+  if apierrors.IsNotFound(err) {
+    _, err = nads.Create(desired)
+    if err != nil {
+      return errors.New("NetworkAttachmentDefinition cannot be created because:" + err.Error())
+    }
+    return nil
+  } else if err != nil {
+    return errors.New("NetworkAttachmentDefinition cannot be read because:" + err.Error())
+  }
+  if existing.GetLabels()[ExportedFromLabel] != dnet.Name {
+    return errors.New("NetworkAttachmentDefinition with the same name already exists, and it was not created by DANM")
+  }
+  if isUpToDate(existing, desired) {
+    return nil
+  }
+  desired.SetResourceVersion(existing.GetResourceVersion())
+  _, err = nads.Update(desired)
+  if err != nil {
+    return errors.New("NetworkAttachmentDefinition cannot be updated because:" + err.Error())
+  }
+  return nil
+}
+
+func isUpToDate(existing, desired *unstructured.Unstructured) bool {
+  return reflect.DeepEqual(existing.Object["spec"], desired.Object["spec"]) &&
+         reflect.DeepEqual(existing.GetLabels(), desired.GetLabels()) &&
+         reflect.DeepEqual(existing.GetAnnotations(), desired.GetAnnotations())
+}
@@ -0,0 +1,66 @@
+package nadexport_test
+
+import (
+  "encoding/json"
+  "testing"
+  meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+  "k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+  danmtypes "github.com/nokia/danm/pkg/crd/apis/danm/v1"
+  "github.com/nokia/danm/pkg/nadexport"
+)
+
+var renderTcs = []struct {
+  tcName string
+  dnet danmtypes.DanmNet
+  expectedType string
+  expectedMaster string
+  isIpamExpected bool
+}{
+  {"l2Ipvlan", danmtypes.DanmNet{ObjectMeta: meta_v1.ObjectMeta{Name: "l2", Namespace: "default", UID: "uid1"},
+    Spec: danmtypes.DanmNetSpec{NetworkID: "l2", Options: danmtypes.DanmNetOption{Device: "ens3"}}}, "ipvlan", "ens3", false},
+  {"vlanWithCidr", danmtypes.DanmNet{ObjectMeta: meta_v1.ObjectMeta{Name: "vlan", Namespace: "default", UID: "uid2"},
+    Spec: danmtypes.DanmNetSpec{NetworkID: "vlan", Options: danmtypes.DanmNetOption{Device: "ens3", Vlan: 100, Cidr: "10.0.0.0/24",
+    Routes: map[string]string{"10.2.0.0/24": "10.0.0.1", "10.1.0.0/24": "10.0.0.1"}}}}, "ipvlan", "vlan.100", true},
+  {"sriov", danmtypes.DanmNet{ObjectMeta: meta_v1.ObjectMeta{Name: "sriov", Namespace: "default", UID: "uid3"},
+    Spec: danmtypes.DanmNetSpec{NetworkID: "sriov", NetworkType: "sriov", Options: danmtypes.DanmNetOption{Device: "ens4f0"}}}, "sriov", "ens4f0", false},
+}
+
+func TestRender(t *testing.T) {
+  for _, tc := range renderTcs {
+    t.Run(tc.tcName, func(t *testing.T) {
+      nad, err := nadexport.Render(&tc.dnet)
+      if err != nil {
+        t.Fatalf("Rendering failed with error:%v", err)
+      }
+      if nad.GetName() != tc.dnet.Name || nad.GetNamespace() != tc.dnet.Namespace || nad.GetLabels()[nadexport.ExportedFromLabel] != tc.dnet.Name {
+        t.Errorf("Metadata of the rendered NetworkAttachmentDefinition does not match with the DanmNet")
+      }
+      owners := nad.GetOwnerReferences()
+      if len(owners) != 1 || owners[0].UID != tc.dnet.UID || owners[0].Kind != "DanmNet" {
+        t.Errorf("NetworkAttachmentDefinition is not owned by the DanmNet, owners:%v", owners)
+      }
+      rawConfig, _, _ := unstructured.NestedString(nad.Object, "spec", "config")
+      var config map[string]interface{}
+      err = json.Unmarshal([]byte(rawConfig), &config)
+      if err != nil {
+        t.Fatalf("Rendered CNI config:%s is not valid JSON", rawConfig)
+      }
+      if config["type"] != "danm" || config["networkType"] != tc.expectedType || config["master"] != tc.expectedMaster {
+        t.Errorf("Rendered CNI config:%s does not match with expectation", rawConfig)
+      }
+      if _, isIpamPresent := config["ipam"]; isIpamPresent != tc.isIpamExpected {
+        t.Errorf("Presence of IPAM section in rendered CNI config:%s does not match with expectation", rawConfig)
+      }
+    })
+  }
+}
+
+func TestRenderIsStable(t *testing.T) {
+  first, _ := nadexport.Render(&renderTcs[1].dnet)
+  for i := 0; i < 10; i++ {
+    next, _ := nadexport.Render(&renderTcs[1].dnet)
+    if first.Object["spec"].(map[string]interface{})["config"] != next.Object["spec"].(map[string]interface{})["config"] {
+      t.Fatalf("Rendering of the same DanmNet is not deterministic")
+    }
+  }
+}
@@ -0,0 +1,10 @@
+package main
+
+import (
+  "os"
+  "github.com/nokia/danm/pkg/watcher"
+)
+
+func main() {
+  watcher.Run("nadexporter", os.Args[1:])
+}
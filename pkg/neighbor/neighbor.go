@@ -0,0 +1,138 @@
+package neighbor
+
+import (
+  "log"
+  "net"
+  "os"
+  "strings"
+  "time"
+  "github.com/vishvananda/netlink"
+  meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+  "k8s.io/client-go/rest"
+  "k8s.io/client-go/tools/cache"
+  danmtypes "github.com/nokia/danm/pkg/crd/apis/danm/v1"
+  danmclientset "github.com/nokia/danm/pkg/crd/client/clientset/versioned"
+  danminformers "github.com/nokia/danm/pkg/crd/client/informers/externalversions"
+  "github.com/nokia/danm/pkg/danmnet"
+  "github.com/nokia/danm/pkg/danmep"
+)
+
+// Handler flushes stale neighbor entries of the local host when an address moves to a Pod on another node
+// Without it traffic sent to a sticky IP is blackholed until the entry pointing to the MAC of the old Pod expires
+type Handler struct {
+  client danmclientset.Interface
+  host string
+  startTime time.Time
+}
+
+// NewHandler initializes and returns a new Handler object
+func NewHandler(cfg *rest.Config) (Handler,error) {
+  client, err := danmclientset.NewForConfig(cfg)
+  if err != nil {
+    return Handler{}, err
+  }
+  host, err := os.Hostname()
+  if err != nil {
+    return Handler{}, err
+  }
+  return Handler{client: client, host: host, startTime: time.Now()}, nil
+}
+
+// CreateController returns a controller watching DanmEps
+// DanmEps created before the Handler are ignored, as the neighbor entries of those addresses are already up-to-date
+func (handler Handler) CreateController() cache.Controller {
+  danmInformerFactory := danminformers.NewSharedInformerFactory(handler.client, time.Minute*10)
+  controller := danmInformerFactory.Danm().V1().DanmEps().Informer()
+  controller.AddEventHandler(cache.ResourceEventHandlerFuncs{
+    AddFunc: func(obj interface{}) {
+      ep := obj.(*danmtypes.DanmEp)
+      if ep.ObjectMeta.CreationTimestamp.Time.Before(handler.startTime) {
+        return
+      }
+      handler.repair(ep)
+    },
+    UpdateFunc: func(oldObj, newObj interface{}) {
+      oldEp, newEp := oldObj.(*danmtypes.DanmEp), newObj.(*danmtypes.DanmEp)
+      if oldEp.Spec.Host != newEp.Spec.Host {
+        handler.repair(newEp)
+      }
+    },
+  })
+  return controller
+}
+
+// repair deletes the neighbor entries of the addresses of a remote DanmEp from the host interfaces of its network
+func (handler Handler) repair(ep *danmtypes.DanmEp) {
+  if ep.Spec.Host == handler.host {
+    return
+  }
+  var ips []net.IP
+  for _, address := range []string{ep.Spec.Iface.Address, ep.Spec.Iface.AddressIPv6} {
+    ip, _, err := net.ParseCIDR(address)
+    if err == nil {
+      ips = append(ips, ip)
+    }
+  }
+  if len(ips) == 0 {
+    return
+  }
+  links, err := handler.getNetworkLinks(ep)
+  if err != nil {
+    log.Println("ERROR: Host interfaces of network:" + ep.Spec.NetworkID + " cannot be determined because:" + err.Error())
+    return
+  }
+  for _, link := range links {
+    for _, ip := range ips {
+      err = FlushNeighbor(link, ip)
+      if err != nil {
+        log.Println("ERROR: Neighbor entry of:" + ip.String() + " cannot be flushed from interface:" + link.Attrs().Name + " because:" + err.Error())
+      }
+    }
+  }
+}
+
+// getNetworkLinks returns the host interface of the network, and all the DANM owned host interfaces created for it
+func (handler Handler) getNetworkLinks(ep *danmtypes.DanmEp) ([]netlink.Link, error) {
+  dnet, err := handler.client.DanmV1().DanmNets(ep.ObjectMeta.Namespace).Get(ep.Spec.NetworkID, meta_v1.GetOptions{})
+  if err != nil {
+    return nil, err
+  }
+  var links []netlink.Link
+  hostIface, err := netlink.LinkByName(danmep.GetHostInterface(dnet))
+  if err == nil {
+    links = append(links, hostIface)
+  }
+  danmLinks, err := danmnet.GetDanmHostInterfaces()
+  if err != nil {
+    return links, nil
+  }
+  for _, link := range danmLinks[dnet.Spec.NetworkID] {
+    if hostIface == nil || link.Attrs().Index != hostIface.Attrs().Index {
+      links = append(links, link)
+    }
+  }
+  return links, nil
+}
+
+// FlushNeighbor deletes the neighbor entry of the IP from the interface, if there is one
+func FlushNeighbor(link netlink.Link, ip net.IP) error {
+  family := netlink.FAMILY_V4
+  if ip.To4() == nil {
+    family = netlink.FAMILY_V6
+  }
+  neighbors, err := netlink.NeighList(link.Attrs().Index, family)
+  if err != nil {
+    return err
+  }
+  for _, neighbor := range neighbors {
+    if !neighbor.IP.Equal(ip) {
+      continue
+    }
+    err = netlink.NeighDel(&neighbor)
+    if err != nil && !strings.Contains(err.Error(), "no such file") {
+      return err
+    }
+    log.Println("INFO: Stale neighbor entry of:" + ip.String() + " was flushed from interface:" + link.Attrs().Name)
+  }
+  return nil
+}
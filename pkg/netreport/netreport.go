@@ -0,0 +1,151 @@
+package netreport
+
+import (
+  "net"
+  "sort"
+  "strconv"
+  "strings"
+  danmtypes "github.com/nokia/danm/pkg/crd/apis/danm/v1"
+  "github.com/nokia/danm/pkg/danmnet"
+)
+
+const (
+  // OverlappingCidr is reported when networks sharing the same L2 host link have overlapping IPv4, or IPv6 subnets
+  OverlappingCidr = "OverlappingCidr"
+  // DuplicateVni is reported when more than one network uses the same VxLAN identifier
+  DuplicateVni = "DuplicateVni"
+  // DuplicateVlan is reported when more than one network uses the same VLAN identifier on the same host device
+  DuplicateVlan = "DuplicateVlan"
+  // GatewayInAllocationPool is reported when the gateway of a route is inside the allocation pool of the network
+  GatewayInAllocationPool = "GatewayInAllocationPool"
+)
+
+// FindingTypes lists all the types of inconsistencies the report can contain
+var FindingTypes = []string{OverlappingCidr, DuplicateVni, DuplicateVlan, GatewayInAllocationPool}
+
+// Analyze checks the configuration of all the DanmNets of the cluster against each other, and returns all the found inconsistencies
+// Subnets are only compared between networks sharing the same L2 host link, i.e. the same host device, VLAN, and VxLAN identifier
+func Analyze(nets []danmtypes.DanmNet) []danmtypes.NetworkFinding {
+  findings := []danmtypes.NetworkFinding{}
+  findings = append(findings, findOverlappingCidrs(nets)...)
+  findings = append(findings, findDuplicateIds(nets, DuplicateVni, func(dnet danmtypes.DanmNet) string {
+    if dnet.Spec.Options.Vxlan == 0 {
+      return ""
+    }
+    return strconv.Itoa(dnet.Spec.Options.Vxlan)
+  })...)
+  findings = append(findings, findDuplicateIds(nets, DuplicateVlan, func(dnet danmtypes.DanmNet) string {
+    if dnet.Spec.Options.Vlan == 0 {
+      return ""
+    }
+    return strconv.Itoa(dnet.Spec.Options.Vlan) + " on host device " + dnet.Spec.Options.Device
+  })...)
+  findings = append(findings, findGatewaysInPools(nets)...)
+  return findings
+}
+
+func getNetName(dnet danmtypes.DanmNet) string {
+  return dnet.ObjectMeta.Namespace + "/" + dnet.ObjectMeta.Name
+}
+
+func getHostLink(dnet danmtypes.DanmNet) string {
+  return dnet.Spec.Options.Device + "/vlan:" + strconv.Itoa(dnet.Spec.Options.Vlan) + "/vxlan:" + strconv.Itoa(dnet.Spec.Options.Vxlan)
+}
+
+func findOverlappingCidrs(nets []danmtypes.DanmNet) []danmtypes.NetworkFinding {
+  var findings []danmtypes.NetworkFinding
+  for i := 0; i < len(nets); i++ {
+    for j := i+1; j < len(nets); j++ {
+      if nets[i].Spec.Options.Device == "" || getHostLink(nets[i]) != getHostLink(nets[j]) {
+        continue
+      }
+      for _, cidrs := range [][2]string{{nets[i].Spec.Options.Cidr, nets[j].Spec.Options.Cidr}, {nets[i].Spec.Options.Net6, nets[j].Spec.Options.Net6}} {
+        if areSubnetsOverlapping(cidrs[0], cidrs[1]) {
+          findings = append(findings, danmtypes.NetworkFinding {
+            Type: OverlappingCidr,
+            Networks: []string{getNetName(nets[i]), getNetName(nets[j])},
+            Detail: "subnet " + cidrs[0] + " overlaps with " + cidrs[1] + " on host link " + getHostLink(nets[i]),
+          })
+        }
+      }
+    }
+  }
+  return findings
+}
+
+func areSubnetsOverlapping(cidr1, cidr2 string) bool {
+  _, net1, err1 := net.ParseCIDR(cidr1)
+  _, net2, err2 := net.ParseCIDR(cidr2)
+  if err1 != nil || err2 != nil {
+    return false
+  }
+  return net1.Contains(net2.IP) || net2.Contains(net1.IP)
+}
+
+func findDuplicateIds(nets []danmtypes.DanmNet, findingType string, getId func(danmtypes.DanmNet) string) []danmtypes.NetworkFinding {
+  users := make(map[string][]string)
+  for _, dnet := range nets {
+    id := getId(dnet)
+    if id != "" {
+      users[id] = append(users[id], getNetName(dnet))
+    }
+  }
+  var ids []string
+  for id, netNames := range users {
+    if len(netNames) > 1 {
+      ids = append(ids, id)
+    }
+  }
+  sort.Strings(ids)
+  var findings []danmtypes.NetworkFinding
+  for _, id := range ids {
+    findings = append(findings, danmtypes.NetworkFinding {
+      Type: findingType,
+      Networks: users[id],
+      Detail: "identifier " + id + " is used by " + strings.Join(users[id], ", "),
+    })
+  }
+  return findings
+}
+
+func findGatewaysInPools(nets []danmtypes.DanmNet) []danmtypes.NetworkFinding {
+  var findings []danmtypes.NetworkFinding
+  for _, dnet := range nets {
+    start := net.ParseIP(dnet.Spec.Options.Pool.Start)
+    end := net.ParseIP(dnet.Spec.Options.Pool.End)
+    if start == nil || end == nil {
+      continue
+    }
+    var gateways []string
+    for _, gw := range dnet.Spec.Options.Routes {
+      gwIp := net.ParseIP(gw)
+      if gwIp == nil || gwIp.To4() == nil {
+        continue
+      }
+      if danmnet.Ip2int(gwIp) >= danmnet.Ip2int(start) && danmnet.Ip2int(gwIp) <= danmnet.Ip2int(end) {
+        gateways = append(gateways, gw)
+      }
+    }
+    sort.Strings(gateways)
+    for _, gw := range gateways {
+      findings = append(findings, danmtypes.NetworkFinding {
+        Type: GatewayInAllocationPool,
+        Networks: []string{getNetName(dnet)},
+        Detail: "gateway " + gw + " is inside allocation pool " + dnet.Spec.Options.Pool.Start + "-" + dnet.Spec.Options.Pool.End,
+      })
+    }
+  }
+  return findings
+}
+
+// CountFindings returns the number of findings per finding type
+func CountFindings(findings []danmtypes.NetworkFinding) map[string]int {
+  counts := make(map[string]int)
+  for _, findingType := range FindingTypes {
+    counts[findingType] = 0
+  }
+  for _, finding := range findings {
+    counts[finding.Type]++
+  }
+  return counts
+}
@@ -0,0 +1,63 @@
+package netreport_test
+
+import (
+  "testing"
+  meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+  danmtypes "github.com/nokia/danm/pkg/crd/apis/danm/v1"
+  "github.com/nokia/danm/pkg/netreport"
+)
+
+func newNet(name string, opts danmtypes.DanmNetOption) danmtypes.DanmNet {
+  return danmtypes.DanmNet{ObjectMeta: meta_v1.ObjectMeta{Name: name, Namespace: "default"}, Spec: danmtypes.DanmNetSpec{NetworkID: name, Options: opts}}
+}
+
+var analyzeTcs = []struct {
+  tcName string
+  nets []danmtypes.DanmNet
+  expectedFindings map[string]int
+}{
+  {"noNets", nil, map[string]int{}},
+  {"overlappingOnSameDevice", []danmtypes.DanmNet{
+    newNet("a", danmtypes.DanmNetOption{Device: "ens3", Cidr: "10.0.0.0/24"}),
+    newNet("b", danmtypes.DanmNetOption{Device: "ens3", Cidr: "10.0.0.128/25"}),
+  }, map[string]int{netreport.OverlappingCidr: 1}},
+  {"overlappingIpv6OnSameDevice", []danmtypes.DanmNet{
+    newNet("a", danmtypes.DanmNetOption{Device: "ens3", Net6: "2001:db8::/64"}),
+    newNet("b", danmtypes.DanmNetOption{Device: "ens3", Net6: "2001:db8::/48"}),
+  }, map[string]int{netreport.OverlappingCidr: 1}},
+  {"overlappingOnDifferentVlans", []danmtypes.DanmNet{
+    newNet("a", danmtypes.DanmNetOption{Device: "ens3", Vlan: 100, Cidr: "10.0.0.0/24"}),
+    newNet("b", danmtypes.DanmNetOption{Device: "ens3", Vlan: 200, Cidr: "10.0.0.0/24"}),
+  }, map[string]int{}},
+  {"overlappingOnDifferentDevices", []danmtypes.DanmNet{
+    newNet("a", danmtypes.DanmNetOption{Device: "ens3", Cidr: "10.0.0.0/24"}),
+    newNet("b", danmtypes.DanmNetOption{Device: "ens4", Cidr: "10.0.0.0/24"}),
+  }, map[string]int{}},
+  {"duplicateVni", []danmtypes.DanmNet{
+    newNet("a", danmtypes.DanmNetOption{Device: "ens3", Vxlan: 50}),
+    newNet("b", danmtypes.DanmNetOption{Device: "ens4", Vxlan: 50}),
+    newNet("c", danmtypes.DanmNetOption{Device: "ens4", Vxlan: 51}),
+  }, map[string]int{netreport.DuplicateVni: 1}},
+  {"duplicateVlanOnSameDevice", []danmtypes.DanmNet{
+    newNet("a", danmtypes.DanmNetOption{Device: "ens3", Vlan: 100}),
+    newNet("b", danmtypes.DanmNetOption{Device: "ens3", Vlan: 100}),
+    newNet("c", danmtypes.DanmNetOption{Device: "ens4", Vlan: 100}),
+  }, map[string]int{netreport.DuplicateVlan: 1}},
+  {"gatewayInPool", []danmtypes.DanmNet{
+    newNet("a", danmtypes.DanmNetOption{Device: "ens3", Cidr: "10.0.0.0/24", Pool: danmtypes.IP4Pool{Start: "10.0.0.1", End: "10.0.0.100"},
+      Routes: map[string]string{"10.1.0.0/24": "10.0.0.50", "10.2.0.0/24": "10.0.0.254"}}),
+  }, map[string]int{netreport.GatewayInAllocationPool: 1}},
+}
+
+func TestAnalyze(t *testing.T) {
+  for _, tc := range analyzeTcs {
+    t.Run(tc.tcName, func(t *testing.T) {
+      counts := netreport.CountFindings(netreport.Analyze(tc.nets))
+      for _, findingType := range netreport.FindingTypes {
+        if counts[findingType] != tc.expectedFindings[findingType] {
+          t.Errorf("Number of %s findings:%d does not match with expected:%d", findingType, counts[findingType], tc.expectedFindings[findingType])
+        }
+      }
+    })
+  }
+}
@@ -0,0 +1,107 @@
+package netspec
+
+import (
+  "strconv"
+  "strings"
+  danmtypes "github.com/nokia/danm/pkg/crd/apis/danm/v1"
+)
+
+const (
+  // TypeIpvlan is the type of the networks whose interfaces are created by DANM itself
+  TypeIpvlan = "ipvlan"
+  // TypeSriov is the type of the networks whose interfaces are VFs handed over by the SR-IOV CNI plugin
+  TypeSriov = "sriov"
+  // TypeFlannel is the type of the networks delegated to the Flannel CNI plugin
+  TypeFlannel = "flannel"
+  // GcPolicyEvent lets the cleaner reclaim the stale DanmEps of the network on Pod events, and periodically
+  GcPolicyEvent = "event"
+  // GcPolicyPeriodic lets the cleaner reclaim the stale DanmEps of the network only periodically
+  GcPolicyPeriodic = "periodic"
+  // GcPolicyManual never lets the cleaner touch the DanmEps of the network, e.g. because its addresses are managed externally
+  GcPolicyManual = "manual"
+  // HostInterfaceAliasPrefix marks the alias (IFLA_IFALIAS) of all the host interfaces created, or adopted by DANM
+  // The alias of a DANM owned host interface is always the prefix followed by the NetworkID of the DanmNet it belongs to
+  HostInterfaceAliasPrefix = "danm:"
+  vxlanInterfacePrefix = "vx_"
+)
+
+// NormalizeType returns the network type in its canonical form: lower case, with the empty type meaning IPVLAN
+// Both the NetworkType of DanmNets, and DanmEps shall be compared only in this form
+func NormalizeType(networkType string) string {
+  if networkType == "" {
+    return TypeIpvlan
+  }
+  return strings.ToLower(networkType)
+}
+
+// GetNetworkType returns the canonical type of the network
+func GetNetworkType(dnet *danmtypes.DanmNet) string {
+  return NormalizeType(dnet.Spec.NetworkType)
+}
+
+// GetGcPolicy returns the garbage collection policy of the network, the event based policy is the default
+func GetGcPolicy(dnet *danmtypes.DanmNet) string {
+  if dnet.Spec.Options.GcPolicy == "" {
+    return GcPolicyEvent
+  }
+  return strings.ToLower(dnet.Spec.Options.GcPolicy)
+}
+
+// IsIpvlan tells if the interfaces of the network are created by DANM itself
+func IsIpvlan(dnet *danmtypes.DanmNet) bool {
+  return GetNetworkType(dnet) == TypeIpvlan
+}
+
+// IsDelegated tells if the interfaces of the network are created by a 3rd party CNI plugin
+func IsDelegated(dnet *danmtypes.DanmNet) bool {
+  return !IsIpvlan(dnet)
+}
+
+// IsIpvlanEp tells if the interface of the DanmEp was created by DANM itself
+func IsIpvlanEp(ep *danmtypes.DanmEp) bool {
+  return NormalizeType(ep.Spec.NetworkType) == TypeIpvlan
+}
+
+// GetVxlanInterfaceName returns the name of the VxLAN host interface netwatcher creates for the network
+func GetVxlanInterfaceName(netId string) string {
+  return vxlanInterfacePrefix + netId
+}
+
+// GetVlanInterfaceName returns the name of the VLAN host interface netwatcher creates for the network
+func GetVlanInterfaceName(netId string, vlanId int) string {
+  return netId + "." + strconv.Itoa(vlanId)
+}
+
+// GetHostInterfaceAlias returns the ownership marker netwatcher puts into the alias of the VLAN, and VxLAN host interfaces of the network
+func GetHostInterfaceAlias(netId string) string {
+  return HostInterfaceAliasPrefix + netId
+}
+
+// GetHostInterface returns the name of the host interface the IPVLAN slaves of the network are connected to
+// It is either the VxLAN, or the VLAN host interface created for the network by netwatcher; or the host device itself
+func GetHostInterface(dnet *danmtypes.DanmNet) string {
+  opts := dnet.Spec.Options
+  if opts.Vxlan != 0 {
+    return GetVxlanInterfaceName(dnet.Spec.NetworkID)
+  }
+  if opts.Vlan != 0 {
+    return GetVlanInterfaceName(dnet.Spec.NetworkID, opts.Vlan)
+  }
+  return opts.Device
+}
+
+// GetHostDevices returns all the host devices the interfaces of the network can be created from
+// The explicitly configured host device comes first, followed by the other members of host_devices
+func GetHostDevices(dnet *danmtypes.DanmNet) []string {
+  opts := dnet.Spec.Options
+  var devices []string
+  if opts.Device != "" {
+    devices = append(devices, opts.Device)
+  }
+  for _, device := range opts.HostDevices {
+    if device != opts.Device {
+      devices = append(devices, device)
+    }
+  }
+  return devices
+}
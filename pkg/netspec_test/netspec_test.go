@@ -0,0 +1,94 @@
+package netspec_test
+
+import (
+  "reflect"
+  "testing"
+  danmtypes "github.com/nokia/danm/pkg/crd/apis/danm/v1"
+  "github.com/nokia/danm/pkg/netspec"
+)
+
+func newNet(networkType string, opts danmtypes.DanmNetOption) *danmtypes.DanmNet {
+  return &danmtypes.DanmNet{Spec: danmtypes.DanmNetSpec{NetworkID: "internal", NetworkType: networkType, Options: opts}}
+}
+
+func TestNetworkType(t *testing.T) {
+  typeTcs := []struct {
+    tcName string
+    networkType string
+    expectedType string
+    isIpvlan bool
+  }{
+    {"emptyIsIpvlan", "", netspec.TypeIpvlan, true},
+    {"ipvlan", "ipvlan", netspec.TypeIpvlan, true},
+    {"upperCaseIpvlan", "IPVLAN", netspec.TypeIpvlan, true},
+    {"sriov", "sriov", netspec.TypeSriov, false},
+    {"mixedCaseSriov", "SrIoV", netspec.TypeSriov, false},
+    {"flannel", "flannel", netspec.TypeFlannel, false},
+    {"unknownPlugin", "macvlan", "macvlan", false},
+  }
+  for _, tc := range typeTcs {
+    t.Run(tc.tcName, func(t *testing.T) {
+      dnet := newNet(tc.networkType, danmtypes.DanmNetOption{})
+      if netType := netspec.GetNetworkType(dnet); netType != tc.expectedType {
+        t.Errorf("Network type:%s was interpreted as:%s, expected:%s", tc.networkType, netType, tc.expectedType)
+      }
+      if netspec.IsIpvlan(dnet) != tc.isIpvlan || netspec.IsDelegated(dnet) == tc.isIpvlan {
+        t.Errorf("Network type:%s was not interpreted as IPVLAN:%t", tc.networkType, tc.isIpvlan)
+      }
+      ep := &danmtypes.DanmEp{Spec: danmtypes.DanmEpSpec{NetworkType: tc.networkType}}
+      if netspec.IsIpvlanEp(ep) != tc.isIpvlan {
+        t.Errorf("DanmEp of network type:%s was not interpreted as IPVLAN:%t", tc.networkType, tc.isIpvlan)
+      }
+    })
+  }
+}
+
+func TestGetHostInterface(t *testing.T) {
+  ifaceTcs := []struct {
+    tcName string
+    opts danmtypes.DanmNetOption
+    expectedIface string
+  }{
+    {"hostDevice", danmtypes.DanmNetOption{Device: "ens4"}, "ens4"},
+    {"vlan", danmtypes.DanmNetOption{Device: "ens4", Vlan: 500}, "internal.500"},
+    {"vxlan", danmtypes.DanmNetOption{Device: "ens4", Vxlan: 600}, "vx_internal"},
+    {"vxlanPreferredOverVlan", danmtypes.DanmNetOption{Device: "ens4", Vlan: 500, Vxlan: 600}, "vx_internal"},
+    {"noDevice", danmtypes.DanmNetOption{}, ""},
+  }
+  for _, tc := range ifaceTcs {
+    t.Run(tc.tcName, func(t *testing.T) {
+      iface := netspec.GetHostInterface(newNet("ipvlan", tc.opts))
+      if iface != tc.expectedIface {
+        t.Errorf("Host interface is:%s, expected:%s", iface, tc.expectedIface)
+      }
+    })
+  }
+  if name := netspec.GetVlanInterfaceName("internal", 500); name != "internal.500" {
+    t.Errorf("VLAN host interface name is:%s, expected:internal.500", name)
+  }
+  if name := netspec.GetVxlanInterfaceName("internal"); name != "vx_internal" {
+    t.Errorf("VxLAN host interface name is:%s, expected:vx_internal", name)
+  }
+}
+
+func TestGetHostDevices(t *testing.T) {
+  deviceTcs := []struct {
+    tcName string
+    opts danmtypes.DanmNetOption
+    expectedDevices []string
+  }{
+    {"noDevice", danmtypes.DanmNetOption{}, nil},
+    {"onlyDevice", danmtypes.DanmNetOption{Device: "ens4"}, []string{"ens4"}},
+    {"onlyHostDevices", danmtypes.DanmNetOption{HostDevices: []string{"ens4", "ens5"}}, []string{"ens4", "ens5"}},
+    {"deviceComesFirst", danmtypes.DanmNetOption{Device: "ens5", HostDevices: []string{"ens4", "ens5", "ens6"}}, []string{"ens5", "ens4", "ens6"}},
+    {"deviceNotListed", danmtypes.DanmNetOption{Device: "ens7", HostDevices: []string{"ens4"}}, []string{"ens7", "ens4"}},
+  }
+  for _, tc := range deviceTcs {
+    t.Run(tc.tcName, func(t *testing.T) {
+      devices := netspec.GetHostDevices(newNet("sriov", tc.opts))
+      if !reflect.DeepEqual(devices, tc.expectedDevices) {
+        t.Errorf("Host devices are:%v, expected:%v", devices, tc.expectedDevices)
+      }
+    })
+  }
+}
@@ -0,0 +1,90 @@
+package nodecap
+
+import (
+  "errors"
+  apierrors "k8s.io/apimachinery/pkg/api/errors"
+  meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+  danmtypes "github.com/nokia/danm/pkg/crd/apis/danm/v1"
+  danmclientset "github.com/nokia/danm/pkg/crd/client/clientset/versioned"
+  "github.com/nokia/danm/pkg/apiretry"
+  "github.com/nokia/danm/pkg/netspec"
+)
+
+// Publish records the probed capabilities of the node in the DanmNodeCapability named after the node
+func Publish(client danmclientset.Interface, node string, spec danmtypes.DanmNodeCapabilitySpec) error {
+  return apiretry.Do(apiretry.DefaultBackoff, func() error {
+    existing, err := client.DanmV1().DanmNodeCapabilities().Get(node, meta_v1.GetOptions{})
+    if apierrors.IsNotFound(err) {
+      nodeCap := &danmtypes.DanmNodeCapability {
+        TypeMeta: meta_v1.TypeMeta{APIVersion: danmtypes.SchemeGroupVersion.String(), Kind: "DanmNodeCapability"},
+        ObjectMeta: meta_v1.ObjectMeta{Name: node},
+        Spec: spec,
+      }
+      _, err = client.DanmV1().DanmNodeCapabilities().Create(nodeCap)
+      return err
+    } else if err != nil {
+      return err
+    }
+    existing.Spec = spec
+    _, err = client.DanmV1().DanmNodeCapabilities().Update(existing)
+    return err
+  })
+}
+
+// Validate checks whether the node can provision interfaces for the DanmNet, based on its DanmNodeCapability
+// Nodes not probed yet are not validated
+func Validate(client danmclientset.Interface, node string, dnet *danmtypes.DanmNet) error {
+  var nodeCap *danmtypes.DanmNodeCapability
+  err := apiretry.Do(apiretry.DefaultBackoff, func() error {
+    var getErr error
+    nodeCap, getErr = client.DanmV1().DanmNodeCapabilities().Get(node, meta_v1.GetOptions{})
+    return getErr
+  })
+  if apierrors.IsNotFound(err) {
+    return nil
+  } else if err != nil {
+    return errors.New("cannot read the capabilities of node:" + node + " because:" + err.Error())
+  }
+  err = Check(nodeCap.Spec, dnet)
+  if err != nil {
+    return errors.New("network:" + dnet.ObjectMeta.Name + " cannot be used on node:" + node + ", because " + err.Error())
+  }
+  return nil
+}
+
+// Check returns an error describing the first option of the DanmNet not supported by the probed capabilities
+func Check(nodeCap danmtypes.DanmNodeCapabilitySpec, dnet *danmtypes.DanmNet) error {
+  opts := dnet.Spec.Options
+  switch netspec.GetNetworkType(dnet) {
+  case netspec.TypeIpvlan:
+    if !nodeCap.Features.Ipvlan {
+      return errors.New("the ipvlan kernel module is not available in kernel:" + nodeCap.KernelVersion)
+    }
+    if opts.IntraHostSwitching == "external" && !nodeCap.Features.IpvlanVepa {
+      return errors.New("intra_host_switching: external requires Linux kernel 4.15, or newer, but the node runs:" + nodeCap.KernelVersion)
+    }
+  case netspec.TypeSriov:
+    for _, device := range netspec.GetHostDevices(dnet) {
+      nic := getNic(nodeCap, device)
+      if nic == nil {
+        return errors.New("host device:" + device + " is not a physical NIC of the node")
+      }
+      if nic.TotalVfs == 0 {
+        return errors.New("host device:" + device + " does not support SR-IOV")
+      }
+    }
+  }
+  if opts.Vxlan != 0 && !nodeCap.Features.Vxlan {
+    return errors.New("the vxlan kernel module is not available in kernel:" + nodeCap.KernelVersion)
+  }
+  return nil
+}
+
+func getNic(nodeCap danmtypes.DanmNodeCapabilitySpec, name string) *danmtypes.NicCapability {
+  for i := range nodeCap.Nics {
+    if nodeCap.Nics[i].Name == name {
+      return &nodeCap.Nics[i]
+    }
+  }
+  return nil
+}
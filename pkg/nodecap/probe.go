@@ -0,0 +1,152 @@
+package nodecap
+
+import (
+  "bufio"
+  "io/ioutil"
+  "os"
+  "path/filepath"
+  "strconv"
+  "strings"
+  "time"
+  danmtypes "github.com/nokia/danm/pkg/crd/apis/danm/v1"
+)
+
+// Paths tells where the probe looks for the kernel, and the files of the host
+// Every path can be redirected to a fake directory tree, so the probe is testable without the real features
+type Paths struct {
+  SysRoot        string
+  ProcRoot       string
+  // root of the host filesystem; netwatcher runs with hostPID, so it sees it under /proc/1/root without extra mounts
+  HostRoot       string
+  // container runtime sockets relative to HostRoot, in the order of preference
+  RuntimeSockets []string
+}
+
+// DefaultPaths are used by netwatcher
+var DefaultPaths = Paths {
+  SysRoot: "/sys",
+  ProcRoot: "/proc",
+  HostRoot: "/proc/1/root",
+  RuntimeSockets: []string{"/var/run/docker.sock", "/run/containerd/containerd.sock", "/var/run/crio/crio.sock"},
+}
+
+var moduleSuffixes = []string{".xz", ".gz", ".zst"}
+
+// Probe detects the networking capabilities of the node only from local files, without reaching out to any network service
+func Probe(paths Paths) danmtypes.DanmNodeCapabilitySpec {
+  release := readValue(filepath.Join(paths.ProcRoot, "sys", "kernel", "osrelease"))
+  modules := getAvailableModules(paths, release)
+  spec := danmtypes.DanmNodeCapabilitySpec {
+    ProbedAt: time.Now().UTC().Format(time.RFC3339),
+    KernelVersion: release,
+    RuntimeSocket: findRuntimeSocket(paths),
+    Nics: getNics(paths),
+  }
+  spec.Features.Ipvlan = modules["ipvlan"]
+  spec.Features.IpvlanVepa = spec.Features.Ipvlan && IsKernelAtLeast(release, 4, 15)
+  spec.Features.Vxlan = modules["vxlan"]
+  spec.Features.Netkit = modules["netkit"]
+  for _, nic := range spec.Nics {
+    if nic.TotalVfs > 0 {
+      spec.Features.Sriov = true
+    }
+  }
+  return spec
+}
+
+// IsKernelAtLeast tells whether the kernel release, e.g. "4.15.0-91-generic" is not older than major.minor
+func IsKernelAtLeast(release string, major, minor int) bool {
+  parts := strings.SplitN(release, ".", 3)
+  if len(parts) < 2 {
+    return false
+  }
+  relMajor, err := strconv.Atoi(parts[0])
+  if err != nil {
+    return false
+  }
+  relMinor, err := strconv.Atoi(strings.TrimRightFunc(parts[1], func(r rune) bool { return r < '0' || r > '9' }))
+  if err != nil {
+    return false
+  }
+  return relMajor > major || (relMajor == major && relMinor >= minor)
+}
+
+// getAvailableModules returns the kernel modules which are loaded, built into the kernel, or can be loaded from the module directory of the running kernel
+func getAvailableModules(paths Paths, release string) map[string]bool {
+  modules := make(map[string]bool)
+  loaded, err := ioutil.ReadDir(filepath.Join(paths.SysRoot, "module"))
+  if err == nil {
+    for _, module := range loaded {
+      modules[module.Name()] = true
+    }
+  }
+  if release == "" {
+    return modules
+  }
+  moduleDir := filepath.Join(paths.HostRoot, "lib", "modules", release)
+  for _, index := range []string{"modules.builtin", "modules.dep"} {
+    file, err := os.Open(filepath.Join(moduleDir, index))
+    if err != nil {
+      continue
+    }
+    scanner := bufio.NewScanner(file)
+    for scanner.Scan() {
+      modules[getModuleName(strings.SplitN(scanner.Text(), ":", 2)[0])] = true
+    }
+    file.Close()
+  }
+  return modules
+}
+
+// getModuleName turns the path of a module, e.g. "kernel/drivers/net/ipvlan/ipvlan.ko.xz" into the name of the module
+func getModuleName(path string) string {
+  name := filepath.Base(strings.TrimSpace(path))
+  for _, suffix := range moduleSuffixes {
+    name = strings.TrimSuffix(name, suffix)
+  }
+  name = strings.TrimSuffix(name, ".ko")
+  return strings.Replace(name, "-", "_", -1)
+}
+
+func findRuntimeSocket(paths Paths) string {
+  for _, socket := range paths.RuntimeSockets {
+    info, err := os.Stat(filepath.Join(paths.HostRoot, socket))
+    if err == nil && info.Mode() & os.ModeSocket != 0 {
+      return socket
+    }
+  }
+  return ""
+}
+
+// getNics returns the network interfaces of the host backed by a device, i.e. leaving out the virtual ones
+func getNics(paths Paths) []danmtypes.NicCapability {
+  netDir := filepath.Join(paths.SysRoot, "class", "net")
+  links, err := ioutil.ReadDir(netDir)
+  if err != nil {
+    return nil
+  }
+  var nics []danmtypes.NicCapability
+  for _, link := range links {
+    deviceDir := filepath.Join(netDir, link.Name(), "device")
+    if _, err := os.Stat(deviceDir); err != nil {
+      continue
+    }
+    nic := danmtypes.NicCapability{Name: link.Name()}
+    driver, err := os.Readlink(filepath.Join(deviceDir, "driver"))
+    if err == nil {
+      nic.Driver = filepath.Base(driver)
+    }
+    nic.TotalVfs, _ = strconv.Atoi(readValue(filepath.Join(deviceDir, "sriov_totalvfs")))
+    nic.NumVfs, _ = strconv.Atoi(readValue(filepath.Join(deviceDir, "sriov_numvfs")))
+    nics = append(nics, nic)
+  }
+  return nics
+}
+
+func readValue(path string) string {
+  content, err := ioutil.ReadFile(path)
+  if err != nil {
+    return ""
+  }
+  return strings.TrimSpace(string(content))
+}
@@ -0,0 +1,107 @@
+package nodecap_test
+
+import (
+  "io/ioutil"
+  "os"
+  "path/filepath"
+  "testing"
+  danmtypes "github.com/nokia/danm/pkg/crd/apis/danm/v1"
+  "github.com/nokia/danm/pkg/nodecap"
+)
+
+var ipvlanVxlan = danmtypes.NodeFeatures{Ipvlan: true, IpvlanVepa: true, Vxlan: true}
+var sriovNics = []danmtypes.NicCapability{{Name: "ens1f0", TotalVfs: 8}, {Name: "ens3"}}
+
+var checkTcs = []struct {
+  tcName string
+  features danmtypes.NodeFeatures
+  netType string
+  opts danmtypes.DanmNetOption
+  isErrorExpected bool
+}{
+  {"ipvlanSupported", ipvlanVxlan, "", danmtypes.DanmNetOption{Device: "ens3", Vxlan: 50}, false},
+  {"ipvlanMissing", danmtypes.NodeFeatures{Vxlan: true}, "ipvlan", danmtypes.DanmNetOption{Device: "ens3"}, true},
+  {"vxlanMissing", danmtypes.NodeFeatures{Ipvlan: true}, "", danmtypes.DanmNetOption{Device: "ens3", Vxlan: 50}, true},
+  {"vepaOnOldKernel", danmtypes.NodeFeatures{Ipvlan: true}, "", danmtypes.DanmNetOption{Device: "ens3", IntraHostSwitching: "external"}, true},
+  {"vepaSupported", ipvlanVxlan, "", danmtypes.DanmNetOption{Device: "ens3", IntraHostSwitching: "external"}, false},
+  {"sriovSupported", danmtypes.NodeFeatures{Sriov: true}, "sriov", danmtypes.DanmNetOption{Device: "ens1f0"}, false},
+  {"sriovWithoutVfs", danmtypes.NodeFeatures{Sriov: true}, "sriov", danmtypes.DanmNetOption{HostDevices: []string{"ens1f0", "ens3"}}, true},
+  {"sriovUnknownDevice", danmtypes.NodeFeatures{Sriov: true}, "sriov", danmtypes.DanmNetOption{Device: "ens9"}, true},
+  {"staticBackendNotChecked", danmtypes.NodeFeatures{}, "flannel", danmtypes.DanmNetOption{}, false},
+}
+
+func TestCheck(t *testing.T) {
+  for _, tc := range checkTcs {
+    t.Run(tc.tcName, func(t *testing.T) {
+      nodeCap := danmtypes.DanmNodeCapabilitySpec{KernelVersion: "4.14.0", Features: tc.features, Nics: sriovNics}
+      dnet := &danmtypes.DanmNet{Spec: danmtypes.DanmNetSpec{NetworkType: tc.netType, Options: tc.opts}}
+      err := nodecap.Check(nodeCap, dnet)
+      if (err != nil) != tc.isErrorExpected {
+        t.Errorf("Received error:%v does not match with expectation", err)
+      }
+    })
+  }
+}
+
+var kernelTcs = []struct {
+  release string
+  isNewEnough bool
+}{
+  {"4.15.0-91-generic", true},
+  {"5.4.0", true},
+  {"4.14.262", false},
+  {"3.10.0-1160.el7.x86_64", false},
+  {"", false},
+}
+
+func TestIsKernelAtLeast(t *testing.T) {
+  for _, tc := range kernelTcs {
+    if nodecap.IsKernelAtLeast(tc.release, 4, 15) != tc.isNewEnough {
+      t.Errorf("Kernel release:%s was not evaluated as expected", tc.release)
+    }
+  }
+}
+
+func writeFile(t *testing.T, path, content string) {
+  err := os.MkdirAll(filepath.Dir(path), 0755)
+  if err == nil {
+    err = ioutil.WriteFile(path, []byte(content), 0644)
+  }
+  if err != nil {
+    t.Fatalf("Test file:%s could not be created because:%s", path, err.Error())
+  }
+}
+
+func TestProbe(t *testing.T) {
+  root, err := ioutil.TempDir("", "nodecap")
+  if err != nil {
+    t.Fatalf("Temporary directory could not be created because:%s", err.Error())
+  }
+  defer os.RemoveAll(root)
+  paths := nodecap.Paths {
+    SysRoot: filepath.Join(root, "sys"),
+    ProcRoot: filepath.Join(root, "proc"),
+    HostRoot: filepath.Join(root, "host"),
+    RuntimeSockets: []string{"/var/run/docker.sock"},
+  }
+  writeFile(t, filepath.Join(paths.ProcRoot, "sys", "kernel", "osrelease"), "4.18.0-80.el8.x86_64\n")
+  os.MkdirAll(filepath.Join(paths.SysRoot, "module", "vxlan"), 0755)
+  writeFile(t, filepath.Join(paths.HostRoot, "lib", "modules", "4.18.0-80.el8.x86_64", "modules.dep"), "kernel/drivers/net/ipvlan/ipvlan.ko.xz: kernel/net/core/foo.ko.xz\n")
+  writeFile(t, filepath.Join(paths.SysRoot, "class", "net", "ens1f0", "device", "sriov_totalvfs"), "16\n")
+  writeFile(t, filepath.Join(paths.SysRoot, "class", "net", "ens1f0", "device", "sriov_numvfs"), "4\n")
+  os.MkdirAll(filepath.Join(paths.SysRoot, "class", "net", "lo"), 0755)
+  nodeCap := nodecap.Probe(paths)
+  expectedFeatures := danmtypes.NodeFeatures{Ipvlan: true, IpvlanVepa: true, Vxlan: true, Sriov: true}
+  if nodeCap.Features != expectedFeatures {
+    t.Errorf("Probed features:%+v do not match with expected:%+v", nodeCap.Features, expectedFeatures)
+  }
+  if nodeCap.KernelVersion != "4.18.0-80.el8.x86_64" {
+    t.Errorf("Probed kernel version:%s is not the expected one", nodeCap.KernelVersion)
+  }
+  if len(nodeCap.Nics) != 1 || nodeCap.Nics[0].Name != "ens1f0" || nodeCap.Nics[0].TotalVfs != 16 || nodeCap.Nics[0].NumVfs != 4 {
+    t.Errorf("Probed NICs:%+v do not match with expectation", nodeCap.Nics)
+  }
+  if nodeCap.RuntimeSocket != "" {
+    t.Errorf("Runtime socket:%s was found, although it does not exist", nodeCap.RuntimeSocket)
+  }
+}
@@ -0,0 +1,174 @@
+package reachability
+
+import (
+  "errors"
+  "log"
+  "math/rand"
+  "os"
+  "os/exec"
+  "net"
+  "strconv"
+  "syscall"
+  "time"
+  "github.com/prometheus/client_golang/prometheus"
+  meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+  danmtypes "github.com/nokia/danm/pkg/crd/apis/danm/v1"
+  danmclientset "github.com/nokia/danm/pkg/crd/client/clientset/versioned"
+  "github.com/nokia/danm/pkg/danmep"
+  "github.com/nokia/danm/pkg/netspec"
+)
+
+var (
+  sampledGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts {
+    Name: "danm_endpoint_probe_sampled",
+    Help: "Number of remote DanmEp addresses probed in the last probing cycle, per network.",
+  }, []string{"network"})
+  reachableGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts {
+    Name: "danm_endpoint_probe_reachable",
+    Help: "Number of probed remote DanmEp addresses which answered in the last probing cycle, per network.",
+  }, []string{"network"})
+  failuresCounter = prometheus.NewCounterVec(prometheus.CounterOpts {
+    Name: "danm_endpoint_probe_failures_total",
+    Help: "Number of probes of remote DanmEp addresses left unanswered, per network.",
+  }, []string{"network"})
+)
+
+// Prober periodically probes a random sample of the DanmEp addresses of every IPVLAN network from the host side interface of the network
+// Only endpoints hosted on other nodes are probed, so the probes always cross the underlay network
+// The probe is an ARP request sent with an unspecified source address, thus the host interface does not need to have an IP in the network
+type Prober struct {
+  client danmclientset.Interface
+  sampleSize int
+  interval time.Duration
+  timeout time.Duration
+  host string
+}
+
+// NewProber initializes and returns a new Prober object, and registers its metrics to the default Prometheus registry
+func NewProber(client danmclientset.Interface, sampleSize int, interval time.Duration) (*Prober, error) {
+  host, err := os.Hostname()
+  if err != nil {
+    return nil, errors.New("OS.Hostname returned error:" + err.Error())
+  }
+  err = registerMetrics()
+  if err != nil {
+    return nil, err
+  }
+  return &Prober {
+    client: client,
+    sampleSize: sampleSize,
+    interval: interval,
+    timeout: time.Second,
+    host: host,
+  }, nil
+}
+
+func registerMetrics() error {
+  for _, collector := range []prometheus.Collector{sampledGauge, reachableGauge, failuresCounter} {
+    err := prometheus.Register(collector)
+    if err != nil {
+      if _, ok := err.(prometheus.AlreadyRegisteredError); !ok {
+        return errors.New("cannot register reachability metrics because:" + err.Error())
+      }
+    }
+  }
+  return nil
+}
+
+// Run probes the endpoints periodically until the stop channel is closed
+func (prober *Prober) Run(stop <-chan struct{}) {
+  ticker := time.NewTicker(prober.interval)
+  defer ticker.Stop()
+  for {
+    prober.probeAll()
+    select {
+      case <-stop:
+        return
+      case <-ticker.C:
+    }
+  }
+}
+
+func (prober *Prober) probeAll() {
+  nets, err := prober.client.DanmV1().DanmNets("").List(meta_v1.ListOptions{})
+  if err != nil {
+    log.Println("ERROR: Reachability probing failed, DanmNets cannot be listed because:" + err.Error())
+    return
+  }
+  eps, err := prober.client.DanmV1().DanmEps("").List(meta_v1.ListOptions{})
+  if err != nil {
+    log.Println("ERROR: Reachability probing failed, DanmEps cannot be listed because:" + err.Error())
+    return
+  }
+  for _, dnet := range nets.Items {
+    if !netspec.IsIpvlan(&dnet) || dnet.Spec.Validation != "True" {
+      continue
+    }
+    prober.probeNetwork(&dnet, eps.Items)
+  }
+}
+
+func (prober *Prober) probeNetwork(dnet *danmtypes.DanmNet, eps []danmtypes.DanmEp) {
+  netName := dnet.ObjectMeta.Namespace + "/" + dnet.ObjectMeta.Name
+  ifaceName := danmep.GetHostInterface(dnet)
+  if _, err := net.InterfaceByName(ifaceName); err != nil {
+    //Network is not used on this host
+    return
+  }
+  targets := prober.selectTargets(dnet, eps)
+  reachable := 0
+  for _, target := range targets {
+    isReachable, err := arpProbe(ifaceName, target, prober.timeout)
+    if err != nil {
+      log.Println("ERROR: Probing address:" + target + " of network:" + netName + " failed with error:" + err.Error())
+      continue
+    }
+    if isReachable {
+      reachable++
+    } else {
+      failuresCounter.WithLabelValues(netName).Inc()
+      log.Println("INFO: Address:" + target + " of network:" + netName + " did not answer on host interface:" + ifaceName)
+    }
+  }
+  sampledGauge.WithLabelValues(netName).Set(float64(len(targets)))
+  reachableGauge.WithLabelValues(netName).Set(float64(reachable))
+}
+
+func (prober *Prober) selectTargets(dnet *danmtypes.DanmNet, eps []danmtypes.DanmEp) []string {
+  var candidates []string
+  for _, ep := range eps {
+    if ep.Spec.NetworkID != dnet.Spec.NetworkID || ep.ObjectMeta.Namespace != dnet.ObjectMeta.Namespace || ep.Spec.Host == prober.host {
+      continue
+    }
+    ip, _, err := net.ParseCIDR(ep.Spec.Iface.Address)
+    if err != nil || ip.To4() == nil {
+      continue
+    }
+    candidates = append(candidates, ip.String())
+  }
+  var targets []string
+  for _, i := range rand.Perm(len(candidates)) {
+    if len(targets) == prober.sampleSize {
+      break
+    }
+    targets = append(targets, candidates[i])
+  }
+  return targets
+}
+
+// arpProbe sends one ARP request in Duplicate Address Detection mode, i.e. with unspecified source address
+// arping exits with 1 in DAD mode if the address answered, 0 if it did not
+func arpProbe(ifaceName, ip string, timeout time.Duration) (bool, error) {
+  deadline := strconv.Itoa(int(timeout.Seconds()))
+  cmd := exec.Command("arping","-D","-c1","-w" + deadline,"-I" + ifaceName,ip) // #nosec
+  err := cmd.Run()
+  if err == nil {
+    return false, nil
+  }
+  if exitErr, ok := err.(*exec.ExitError); ok {
+    if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.ExitStatus() == 1 {
+      return true, nil
+    }
+  }
+  return false, errors.New("arping failed:" + err.Error())
+}
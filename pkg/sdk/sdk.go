@@ -0,0 +1,240 @@
+// Package sdk is the supported way for 3rd party controllers (e.g. VIP managers) to build on DANM
+// Its interfaces, and types only change in a backward compatible way, while the internal packages behind them can change in any release
+package sdk
+
+import (
+  "errors"
+  "net"
+  "strings"
+  meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+  "k8s.io/client-go/rest"
+  danmtypes "github.com/nokia/danm/pkg/crd/apis/danm/v1"
+  danmclientset "github.com/nokia/danm/pkg/crd/client/clientset/versioned"
+  "github.com/nokia/danm/pkg/ipam"
+  "github.com/nokia/danm/pkg/netspec"
+)
+
+const (
+  // RequestDynamic allocates the next free address of the network
+  RequestDynamic = "dynamic"
+  // RequestNone allocates no address of the family
+  RequestNone = "none"
+)
+
+// Network is the read-only view of a DanmNet
+type Network struct {
+  Name string
+  Namespace string
+  NetworkID string
+  // Type is the canonical network type, e.g. ipvlan, or sriov
+  Type string
+  Cidr string
+  Net6 string
+  // HostInterface is the host interface the IPVLAN interfaces of the network are connected to
+  HostInterface string
+  // Valid networks passed the validation of netwatcher, only these can be used
+  Valid bool
+}
+
+// Endpoint is the read-only view of a DanmEp, i.e. one network interface of a Pod
+type Endpoint struct {
+  Name string
+  Namespace string
+  Pod string
+  Host string
+  // Network is the name of the DanmNet the interface is connected to
+  Network string
+  Interface string
+  Ip4 string
+  Ip6 string
+  MacAddress string
+  // Plugin is the CNI plugin which created the interface of a delegated network. Empty for the interfaces created by DANM itself
+  Plugin string
+}
+
+// AllocationRequest describes the addresses requested from a network
+// Both fields accept RequestDynamic, RequestNone, or a static address in CIDR notation, like the "ip", and "ip6" attributes of the Pod annotation
+type AllocationRequest struct {
+  Ip4 string
+  Ip6 string
+}
+
+// Allocation contains the addresses reserved in a network
+type Allocation struct {
+  Ip4 string
+  Ip6 string
+  MacAddress string
+}
+
+// NetworkResolver resolves the networks of a namespace
+type NetworkResolver interface {
+  GetNetwork(namespace, name string) (Network, error)
+  ListNetworks(namespace string) ([]Network, error)
+}
+
+// Allocator reserves, and releases addresses of a network, e.g. for VIPs not bound to any Pod
+// Addresses are reserved exactly like the ones of the Pods, so they are never given to any Pod until they are released
+type Allocator interface {
+  Allocate(namespace, network string, request AllocationRequest) (Allocation, error)
+  Release(namespace, network string, allocation Allocation) error
+}
+
+// EndpointFinder looks the network interfaces of Pods up
+type EndpointFinder interface {
+  GetEndpointsOfPod(namespace, pod string) ([]Endpoint, error)
+  // FindEndpointByIp returns the interface of the network having the IPv4, or IPv6 address, or nil if the address is not used by any Pod
+  FindEndpointByIp(namespace, network, ip string) (*Endpoint, error)
+}
+
+// Client contains all the capabilities of the SDK
+type Client interface {
+  NetworkResolver
+  Allocator
+  EndpointFinder
+}
+
+type client struct {
+  danmClient danmclientset.Interface
+}
+
+// New returns a Client talking to the K8s API server described by the config
+func New(config *rest.Config) (Client, error) {
+  danmClient, err := danmclientset.NewForConfig(config)
+  if err != nil {
+    return nil, err
+  }
+  return NewForClientset(danmClient), nil
+}
+
+// NewForClientset returns a Client using an already existing DANM clientset, e.g. the one of the embedding controller
+func NewForClientset(danmClient danmclientset.Interface) Client {
+  return &client{danmClient: danmClient}
+}
+
+// IsPoolExhausted tells if an allocation failed because the network has no free address left
+func IsPoolExhausted(err error) bool {
+  return ipam.IsPoolExhausted(err)
+}
+
+func (sdkClient *client) GetNetwork(namespace, name string) (Network, error) {
+  dnet, err := sdkClient.danmClient.DanmV1().DanmNets(namespace).Get(name, meta_v1.GetOptions{})
+  if err != nil {
+    return Network{}, err
+  }
+  return toNetwork(dnet), nil
+}
+
+func (sdkClient *client) ListNetworks(namespace string) ([]Network, error) {
+  nets, err := sdkClient.danmClient.DanmV1().DanmNets(namespace).List(meta_v1.ListOptions{})
+  if err != nil {
+    return nil, err
+  }
+  networks := make([]Network, 0, len(nets.Items))
+  for i := range nets.Items {
+    networks = append(networks, toNetwork(&nets.Items[i]))
+  }
+  return networks, nil
+}
+
+func (sdkClient *client) Allocate(namespace, network string, request AllocationRequest) (Allocation, error) {
+  dnet, err := sdkClient.danmClient.DanmV1().DanmNets(namespace).Get(network, meta_v1.GetOptions{})
+  if err != nil {
+    return Allocation{}, err
+  }
+  if request.Ip4 == "" && request.Ip6 == "" {
+    return Allocation{}, errors.New("neither IPv4, nor IPv6 address is requested from network:" + network)
+  }
+  ip4, ip6, macAddress, err := ipam.Reserve(sdkClient.danmClient, *dnet, request.Ip4, request.Ip6)
+  if err != nil {
+    return Allocation{}, err
+  }
+  return Allocation{Ip4: ip4, Ip6: ip6, MacAddress: macAddress}, nil
+}
+
+func (sdkClient *client) Release(namespace, network string, allocation Allocation) error {
+  dnet, err := sdkClient.danmClient.DanmV1().DanmNets(namespace).Get(network, meta_v1.GetOptions{})
+  if err != nil {
+    return err
+  }
+  err = ipam.Free(sdkClient.danmClient, *dnet, allocation.Ip4)
+  if err != nil {
+    return errors.New("IPv4 address:" + allocation.Ip4 + " cannot be released because:" + err.Error())
+  }
+  err = ipam.Free(sdkClient.danmClient, *dnet, allocation.Ip6)
+  if err != nil {
+    return errors.New("IPv6 address:" + allocation.Ip6 + " cannot be released because:" + err.Error())
+  }
+  return nil
+}
+
+func (sdkClient *client) GetEndpointsOfPod(namespace, pod string) ([]Endpoint, error) {
+  eps, err := sdkClient.danmClient.DanmV1().DanmEps(namespace).List(meta_v1.ListOptions{})
+  if err != nil {
+    return nil, err
+  }
+  var endpoints []Endpoint
+  for i := range eps.Items {
+    if eps.Items[i].Spec.Pod == pod {
+      endpoints = append(endpoints, toEndpoint(&eps.Items[i]))
+    }
+  }
+  return endpoints, nil
+}
+
+func (sdkClient *client) FindEndpointByIp(namespace, network, ip string) (*Endpoint, error) {
+  eps, err := sdkClient.danmClient.DanmV1().DanmEps(namespace).List(meta_v1.ListOptions{})
+  if err != nil {
+    return nil, err
+  }
+  for i := range eps.Items {
+    ep := toEndpoint(&eps.Items[i])
+    if ep.Network == network && (isSameIp(ep.Ip4, ip) || isSameIp(ep.Ip6, ip)) {
+      return &ep, nil
+    }
+  }
+  return nil, nil
+}
+
+func toNetwork(dnet *danmtypes.DanmNet) Network {
+  return Network {
+    Name: dnet.ObjectMeta.Name,
+    Namespace: dnet.ObjectMeta.Namespace,
+    NetworkID: dnet.Spec.NetworkID,
+    Type: netspec.GetNetworkType(dnet),
+    Cidr: dnet.Spec.Options.Cidr,
+    Net6: dnet.Spec.Options.Net6,
+    HostInterface: netspec.GetHostInterface(dnet),
+    Valid: dnet.Spec.Validation == "True",
+  }
+}
+
+func toEndpoint(ep *danmtypes.DanmEp) Endpoint {
+  return Endpoint {
+    Name: ep.ObjectMeta.Name,
+    Namespace: ep.ObjectMeta.Namespace,
+    Pod: ep.Spec.Pod,
+    Host: ep.Spec.Host,
+    Network: ep.Spec.NetworkID,
+    Interface: ep.Spec.Iface.Name,
+    Ip4: ep.Spec.Iface.Address,
+    Ip6: ep.Spec.Iface.AddressIPv6,
+    MacAddress: ep.Spec.Iface.MacAddress,
+    Plugin: getPlugin(ep),
+  }
+}
+
+func getPlugin(ep *danmtypes.DanmEp) string {
+  if ep.Spec.Delegate == nil {
+    return ""
+  }
+  return ep.Spec.Delegate.Plugin
+}
+
+// isSameIp compares an address stored in CIDR notation with an address given with, or without prefix length
+func isSameIp(stored, ip string) bool {
+  if stored == "" || ip == "" {
+    return false
+  }
+  storedIp := net.ParseIP(strings.Split(stored, "/")[0])
+  return storedIp != nil && storedIp.Equal(net.ParseIP(strings.Split(ip, "/")[0]))
+}
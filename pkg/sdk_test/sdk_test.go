@@ -0,0 +1,112 @@
+package sdk_test
+
+import (
+  "testing"
+  meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+  danmtypes "github.com/nokia/danm/pkg/crd/apis/danm/v1"
+  "github.com/nokia/danm/pkg/loadtest"
+  "github.com/nokia/danm/pkg/sdk"
+  "github.com/nokia/danm/pkg/stubs"
+)
+
+var testEps = []danmtypes.DanmEp {
+  {
+    ObjectMeta: meta_v1.ObjectMeta{Name: "web-eth0", Namespace: "default"},
+    Spec: danmtypes.DanmEpSpec{NetworkID: loadtest.NetworkName, Pod: "web", Iface: danmtypes.DanmEpIface{Name: "eth0", Address: "10.20.0.5/24", AddressIPv6: "2001:db8::5/64"}},
+  },
+  {
+    ObjectMeta: meta_v1.ObjectMeta{Name: "web-eth1", Namespace: "default"},
+    Spec: danmtypes.DanmEpSpec{NetworkID: "other", Pod: "web", Iface: danmtypes.DanmEpIface{Name: "eth1", Address: "10.30.0.5/24"}},
+  },
+  {
+    ObjectMeta: meta_v1.ObjectMeta{Name: "db-eth0", Namespace: "default"},
+    Spec: danmtypes.DanmEpSpec{NetworkID: loadtest.NetworkName, Pod: "db", Iface: danmtypes.DanmEpIface{Name: "eth0", Address: "10.20.0.6/24"}},
+  },
+}
+
+func newClient(t *testing.T) sdk.Client {
+  dnet, err := loadtest.NewNetwork("10.20.0.0/24")
+  if err != nil {
+    t.Fatalf("Test network cannot be created because:%v", err)
+  }
+  return sdk.NewForClientset(stubs.NewFakeApiServer(0, []danmtypes.DanmNet{*dnet}, testEps))
+}
+
+func TestGetNetwork(t *testing.T) {
+  client := newClient(t)
+  network, err := client.GetNetwork("default", loadtest.NetworkName)
+  if err != nil {
+    t.Fatalf("Network cannot be resolved because:%v", err)
+  }
+  if network.Type != "ipvlan" || network.Cidr != "10.20.0.0/24" || !network.Valid {
+    t.Errorf("Network is not resolved correctly:%+v", network)
+  }
+  _, err = client.GetNetwork("default", "missing")
+  if err == nil {
+    t.Errorf("Non-existing network was resolved")
+  }
+}
+
+func TestAllocateAndRelease(t *testing.T) {
+  client := newClient(t)
+  first, err := client.Allocate("default", loadtest.NetworkName, sdk.AllocationRequest{Ip4: sdk.RequestDynamic})
+  if err != nil {
+    t.Fatalf("Address cannot be allocated because:%v", err)
+  }
+  second, err := client.Allocate("default", loadtest.NetworkName, sdk.AllocationRequest{Ip4: sdk.RequestDynamic})
+  if err != nil {
+    t.Fatalf("Address cannot be allocated because:%v", err)
+  }
+  if first.Ip4 == "" || first.Ip4 == second.Ip4 {
+    t.Fatalf("Same address:%s was allocated twice", first.Ip4)
+  }
+  err = client.Release("default", loadtest.NetworkName, first)
+  if err != nil {
+    t.Fatalf("Address cannot be released because:%v", err)
+  }
+  third, err := client.Allocate("default", loadtest.NetworkName, sdk.AllocationRequest{Ip4: sdk.RequestDynamic})
+  if err != nil {
+    t.Fatalf("Address cannot be allocated because:%v", err)
+  }
+  if third.Ip4 != first.Ip4 {
+    t.Errorf("Released address:%s was not reused, got:%s", first.Ip4, third.Ip4)
+  }
+  _, err = client.Allocate("default", loadtest.NetworkName, sdk.AllocationRequest{})
+  if err == nil {
+    t.Errorf("Empty allocation request was accepted")
+  }
+}
+
+func TestEndpointLookup(t *testing.T) {
+  client := newClient(t)
+  endpoints, err := client.GetEndpointsOfPod("default", "web")
+  if err != nil {
+    t.Fatalf("Endpoints cannot be listed because:%v", err)
+  }
+  if len(endpoints) != 2 {
+    t.Errorf("Pod has %d endpoints, expected:2", len(endpoints))
+  }
+  lookupTcs := []struct {
+    tcName string
+    network string
+    ip string
+    expectedEp string
+  }{
+    {"ip4WithPrefix", loadtest.NetworkName, "10.20.0.6/24", "db-eth0"},
+    {"ip4WithoutPrefix", loadtest.NetworkName, "10.20.0.5", "web-eth0"},
+    {"ip6", loadtest.NetworkName, "2001:db8::5", "web-eth0"},
+    {"otherNetwork", "other", "10.20.0.5", ""},
+    {"unusedIp", loadtest.NetworkName, "10.20.0.7", ""},
+  }
+  for _, tc := range lookupTcs {
+    t.Run(tc.tcName, func(t *testing.T) {
+      ep, err := client.FindEndpointByIp("default", tc.network, tc.ip)
+      if err != nil {
+        t.Fatalf("Endpoint lookup failed with error:%v", err)
+      }
+      if (ep == nil && tc.expectedEp != "") || (ep != nil && ep.Name != tc.expectedEp) {
+        t.Errorf("Lookup returned:%+v, expected:%s", ep, tc.expectedEp)
+      }
+    })
+  }
+}
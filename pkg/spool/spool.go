@@ -0,0 +1,174 @@
+package spool
+
+import (
+  "encoding/json"
+  "errors"
+  "io/ioutil"
+  "log"
+  "os"
+  "path/filepath"
+  "strings"
+  "time"
+  apierrors "k8s.io/apimachinery/pkg/api/errors"
+  meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+  "k8s.io/apimachinery/pkg/types"
+  danmtypes "github.com/nokia/danm/pkg/crd/apis/danm/v1"
+  danmclientset "github.com/nokia/danm/pkg/crd/client/clientset/versioned"
+  "github.com/nokia/danm/pkg/cnidel"
+  "github.com/nokia/danm/pkg/ipam"
+)
+
+const (
+  // DefaultDir is the host directory the CNI hands the DanmEps of torn down interfaces over to netwatcher through
+  DefaultDir = "/var/lib/danm/cleanup"
+  recordSuffix = ".json"
+)
+
+// Record identifies a DanmEp whose interface was already deleted, but whose address, and API object still need to be cleaned up
+type Record struct {
+  Namespace string `json:"namespace"`
+  Name string `json:"name"`
+  UID types.UID `json:"uid"`
+  NetworkID string `json:"networkId"`
+  Address string `json:"address,omitempty"`
+  // EpDeleted is set once the DanmEp was deleted by the Worker, so only the address remains to be freed
+  EpDeleted bool `json:"epDeleted,omitempty"`
+}
+
+// Push persists the cleanup record of the DanmEp into the spool directory
+// The record is written atomically, so the Worker never reads partial records
+func Push(dir string, ep danmtypes.DanmEp) error {
+  err := os.MkdirAll(dir, 0700)
+  if err != nil {
+    return errors.New("spool directory:" + dir + " cannot be created because:" + err.Error())
+  }
+  record := Record {
+    Namespace: ep.ObjectMeta.Namespace,
+    Name: ep.ObjectMeta.Name,
+    UID: ep.ObjectMeta.UID,
+    NetworkID: ep.Spec.NetworkID,
+    Address: ep.Spec.Iface.Address,
+  }
+  return writeRecord(filepath.Join(dir, string(ep.ObjectMeta.UID) + recordSuffix), record)
+}
+
+func writeRecord(path string, record Record) error {
+  content, err := json.Marshal(record)
+  if err != nil {
+    return err
+  }
+  err = ioutil.WriteFile(path + ".tmp", content, 0600)
+  if err != nil {
+    return errors.New("cleanup record of DanmEp:" + record.Name + " cannot be written because:" + err.Error())
+  }
+  return os.Rename(path + ".tmp", path)
+}
+
+// Worker frees the addresses, and deletes the DanmEps spooled by the CNI on the local host
+type Worker struct {
+  client danmclientset.Interface
+  dir string
+  host string
+  interval time.Duration
+}
+
+// NewWorker initializes and returns a new Worker object
+func NewWorker(client danmclientset.Interface, dir string, interval time.Duration) (*Worker, error) {
+  host, err := os.Hostname()
+  if err != nil {
+    return nil, err
+  }
+  return &Worker{client: client, dir: dir, host: host, interval: interval}, nil
+}
+
+// Run processes the spool periodically until the stop channel is closed
+// Records which cannot be processed are kept, and retried in the next period
+func (worker *Worker) Run(stop <-chan struct{}) {
+  ticker := time.NewTicker(worker.interval)
+  defer ticker.Stop()
+  for {
+    worker.ProcessAll()
+    select {
+    case <-stop:
+      return
+    case <-ticker.C:
+    }
+  }
+}
+
+// ProcessAll cleans up all the DanmEps currently in the spool
+func (worker *Worker) ProcessAll() {
+  files, err := ioutil.ReadDir(worker.dir)
+  if err != nil {
+    if !os.IsNotExist(err) {
+      log.Println("ERROR: Cleanup spool:" + worker.dir + " cannot be read because:" + err.Error())
+    }
+    return
+  }
+  for _, file := range files {
+    if !strings.HasSuffix(file.Name(), recordSuffix) {
+      continue
+    }
+    path := filepath.Join(worker.dir, file.Name())
+    err = worker.process(path)
+    if err != nil {
+      log.Println("ERROR: Cleanup of spooled DanmEp:" + file.Name() + " failed, will be retried. Error:" + err.Error())
+      continue
+    }
+    os.Remove(path)
+  }
+}
+
+// process deletes the DanmEp before freeing its address, so the address is never freed twice, even if it was re-allocated in between
+func (worker *Worker) process(path string) error {
+  content, err := ioutil.ReadFile(path)
+  if err != nil {
+    return err
+  }
+  var record Record
+  err = json.Unmarshal(content, &record)
+  if err != nil {
+    log.Println("ERROR: Corrupt cleanup record:" + path + " is dropped")
+    return nil
+  }
+  if !record.EpDeleted {
+    ep, err := worker.client.DanmV1().DanmEps(record.Namespace).Get(record.Name, meta_v1.GetOptions{})
+    if apierrors.IsNotFound(err) {
+      //Somebody else already cleaned the DanmEp up, together with its address
+      return nil
+    } else if err != nil {
+      return err
+    }
+    //Records are only trusted for the exact DanmEp of the local host the CNI tore down, never for a recreated one
+    if ep.ObjectMeta.UID != record.UID || ep.Spec.Host != worker.host {
+      log.Println("INFO: Cleanup record of DanmEp:" + record.Name + " does not match the current object, it is dropped")
+      return nil
+    }
+    err = worker.client.DanmV1().DanmEps(record.Namespace).Delete(record.Name, &meta_v1.DeleteOptions{Preconditions: &meta_v1.Preconditions{UID: &record.UID}})
+    if err != nil && !apierrors.IsNotFound(err) {
+      return errors.New("DanmEp cannot be deleted because:" + err.Error())
+    }
+    record.EpDeleted = true
+    err = writeRecord(path, record)
+    if err != nil {
+      return err
+    }
+  }
+  if record.Address == "" {
+    return nil
+  }
+  netInfo, err := worker.client.DanmV1().DanmNets(record.Namespace).Get(record.NetworkID, meta_v1.GetOptions{})
+  if apierrors.IsNotFound(err) {
+    return nil
+  } else if err != nil {
+    return err
+  }
+  if !cnidel.IsDanmIpamUsed(netInfo) {
+    return nil
+  }
+  err = ipam.Free(worker.client, *netInfo, record.Address)
+  if err != nil {
+    return errors.New("address:" + record.Address + " cannot be freed because:" + err.Error())
+  }
+  return nil
+}
@@ -0,0 +1,75 @@
+package spool_test
+
+import (
+  "io/ioutil"
+  "os"
+  "testing"
+  meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+  danmtypes "github.com/nokia/danm/pkg/crd/apis/danm/v1"
+  "github.com/nokia/danm/pkg/ipam"
+  "github.com/nokia/danm/pkg/loadtest"
+  "github.com/nokia/danm/pkg/spool"
+  "github.com/nokia/danm/pkg/stubs"
+)
+
+func setupSpool(t *testing.T) (string, *stubs.FakeApiServer, *danmtypes.DanmEp) {
+  dir, err := ioutil.TempDir("", "spool")
+  if err != nil {
+    t.Fatalf("temporary directory cannot be created:%v", err)
+  }
+  dnet, _ := loadtest.NewNetwork("10.0.0.0/24")
+  server := stubs.NewFakeApiServer(0, []danmtypes.DanmNet{*dnet}, nil)
+  dnet, _ = server.DanmV1().DanmNets(dnet.Namespace).Get(dnet.Name, meta_v1.GetOptions{})
+  ip4, _, _, err := ipam.Reserve(server, *dnet, "dynamic", "")
+  if err != nil {
+    t.Fatalf("address cannot be reserved:%v", err)
+  }
+  host, _ := os.Hostname()
+  ep := &danmtypes.DanmEp {
+    ObjectMeta: meta_v1.ObjectMeta{Name: "ep1", Namespace: dnet.Namespace, UID: "uid1"},
+    Spec: danmtypes.DanmEpSpec{NetworkID: dnet.Spec.NetworkID, NetworkType: "ipvlan", Host: host, Iface: danmtypes.DanmEpIface{Address: ip4}},
+  }
+  ep, err = server.DanmV1().DanmEps(ep.Namespace).Create(ep)
+  if err != nil {
+    t.Fatalf("DanmEp cannot be created:%v", err)
+  }
+  return dir, server, ep
+}
+
+func TestProcessFreesAddressAndDeletesEp(t *testing.T) {
+  dir, server, ep := setupSpool(t)
+  defer os.RemoveAll(dir)
+  err := spool.Push(dir, *ep)
+  if err != nil {
+    t.Fatalf("Push failed with error:%v", err)
+  }
+  worker, _ := spool.NewWorker(server, dir, 0)
+  worker.ProcessAll()
+  if _, err = server.DanmV1().DanmEps(ep.Namespace).Get(ep.Name, meta_v1.GetOptions{}); err == nil {
+    t.Errorf("Spooled DanmEp was expected to be deleted")
+  }
+  if files, _ := ioutil.ReadDir(dir); len(files) != 0 {
+    t.Errorf("Processed record was expected to be removed from the spool, %d files remained", len(files))
+  }
+  dnet, _ := server.DanmV1().DanmNets(ep.Namespace).Get(loadtest.NetworkName, meta_v1.GetOptions{})
+  reused, _, _, _ := ipam.Reserve(server, *dnet, "dynamic", "")
+  if reused != ep.Spec.Iface.Address {
+    t.Errorf("Address:%s of the spooled DanmEp was expected to be freed, got:%s", ep.Spec.Iface.Address, reused)
+  }
+}
+
+func TestProcessIgnoresRecreatedEp(t *testing.T) {
+  dir, server, ep := setupSpool(t)
+  defer os.RemoveAll(dir)
+  stale := *ep
+  stale.ObjectMeta.UID = "uid0"
+  spool.Push(dir, stale)
+  worker, _ := spool.NewWorker(server, dir, 0)
+  worker.ProcessAll()
+  if _, err := server.DanmV1().DanmEps(ep.Namespace).Get(ep.Name, meta_v1.GetOptions{}); err != nil {
+    t.Errorf("DanmEp recreated with the same name was expected to be kept, got error:%v", err)
+  }
+  if files, _ := ioutil.ReadDir(dir); len(files) != 0 {
+    t.Errorf("Stale record was expected to be dropped, %d files remained", len(files))
+  }
+}
@@ -0,0 +1,92 @@
+package sriov
+
+import (
+  "errors"
+  "os"
+  "os/exec"
+  "path/filepath"
+  "strings"
+  "syscall"
+  "github.com/vishvananda/netlink"
+)
+
+var (
+  // LockDir is the directory of the lock files serializing VF allocations of the same PF
+  LockDir = "/var/run"
+)
+
+// PfLock is an exclusive, host-wide lock of a Physical Function
+type PfLock struct {
+  file *os.File
+}
+
+// LockPhysicalFunction blocks until no other CNI invocation of this host allocates VFs from the same PF
+// The lock is needed to tell which VF was moved into the Pod by the SRIOV plugin, by comparing the free VFs before and after the delegation
+func LockPhysicalFunction(pfName string) (*PfLock, error) {
+  file, err := os.OpenFile(filepath.Join(LockDir, "danm-sriov-" + pfName + ".lock"), os.O_CREATE|os.O_RDWR, 0600)
+  if err != nil {
+    return nil, errors.New("lock file of host device:" + pfName + " cannot be opened because:" + err.Error())
+  }
+  err = syscall.Flock(int(file.Fd()), syscall.LOCK_EX)
+  if err != nil {
+    file.Close()
+    return nil, errors.New("host device:" + pfName + " cannot be locked because:" + err.Error())
+  }
+  return &PfLock{file: file}, nil
+}
+
+// Unlock releases the lock of the Physical Function
+func (lock *PfLock) Unlock() {
+  syscall.Flock(int(lock.file.Fd()), syscall.LOCK_UN)
+  lock.file.Close()
+}
+
+// GetTakenVirtualFunction returns the VF which was free before, but not anymore
+func GetTakenVirtualFunction(freeBefore, freeAfter []VirtualFunction) (*VirtualFunction, error) {
+  for _, before := range freeBefore {
+    isStillFree := false
+    for _, after := range freeAfter {
+      if before.Index == after.Index {
+        isStillFree = true
+        break
+      }
+    }
+    if !isStillFree {
+      return &before, nil
+    }
+  }
+  return nil, errors.New("VF moved into the Pod cannot be identified")
+}
+
+// AttachRepresentor connects the representor of a VF to a Linux, or an Open vSwitch bridge of the host
+// Traffic between the VF, and the other ports of the bridge is then switched by the NIC, once the flows are offloaded
+func AttachRepresentor(representor, bridge string) error {
+  repLink, err := netlink.LinkByName(representor)
+  if err != nil {
+    return errors.New("representor:" + representor + " cannot be found because:" + err.Error())
+  }
+  bridgeLink, err := netlink.LinkByName(bridge)
+  if err != nil {
+    return errors.New("offload bridge:" + bridge + " cannot be found because:" + err.Error())
+  }
+  switch bridgeLink.Type() {
+  case "bridge":
+    err = netlink.LinkSetMasterByIndex(repLink, bridgeLink.Attrs().Index)
+  case "openvswitch":
+    var output []byte
+    output, err = exec.Command("ovs-vsctl", "--may-exist", "add-port", bridge, representor).CombinedOutput()
+    if err != nil {
+      err = errors.New(strings.TrimSpace(string(output)))
+    }
+  default:
+    return errors.New("offload bridge:" + bridge + " is neither a Linux, nor an Open vSwitch bridge")
+  }
+  if err != nil {
+    return errors.New("representor:" + representor + " cannot be attached to bridge:" + bridge + " because:" + err.Error())
+  }
+  err = netlink.LinkSetUp(repLink)
+  if err != nil {
+    return errors.New("representor:" + representor + " cannot be set up because:" + err.Error())
+  }
+  return nil
+}
@@ -0,0 +1,109 @@
+package sriov
+
+import (
+  "errors"
+  "io/ioutil"
+  "log"
+  "os"
+  "path/filepath"
+  "strconv"
+  "strings"
+  "syscall"
+)
+
+// Policies of selecting the PF of an SRIOV network spanning multiple PFs
+const (
+  // SelectionLeastLoaded selects the PF with the most free VFs
+  SelectionLeastLoaded = "least-loaded"
+  // SelectionRoundRobin selects the PFs one after the other on every node
+  SelectionRoundRobin = "round-robin"
+  // SelectionStrict always selects the first PF, and never spreads VFs to the others
+  SelectionStrict = "strict"
+)
+
+type candidate struct {
+  pf *PhysicalFunction
+  freeVfs int
+}
+
+// SelectPhysicalFunction returns the PF of the devices the next VF of the network shall be allocated from
+// PFs without free VFs are never selected. Round-robin state is kept per network in LockDir
+func SelectPhysicalFunction(devices []string, policy, network string) (*PhysicalFunction, error) {
+  if policy == SelectionStrict {
+    devices = devices[:1]
+  }
+  var candidates []candidate
+  for _, device := range devices {
+    pf, err := GetPhysicalFunction(device)
+    if err != nil {
+      if len(devices) == 1 {
+        return nil, err
+      }
+      log.Println("INFO: host device:" + device + " is skipped from VF selection because:" + err.Error())
+      candidates = append(candidates, candidate{})
+      continue
+    }
+    freeVfs, err := pf.GetFreeVirtualFunctions()
+    if err != nil {
+      return nil, err
+    }
+    if len(devices) == 1 && len(freeVfs) == 0 {
+      return nil, errors.New("host device:" + device + " has no free VFs left, " + strconv.Itoa(pf.NumVfs) + " out of " + strconv.Itoa(pf.TotalVfs) + " VFs are enabled")
+    }
+    candidates = append(candidates, candidate{pf: pf, freeVfs: len(freeVfs)})
+  }
+  var selected *PhysicalFunction
+  var err error
+  if policy == SelectionRoundRobin {
+    selected, err = selectNext(candidates, network)
+  } else {
+    selected = selectLeastLoaded(candidates)
+  }
+  if err != nil {
+    return nil, err
+  }
+  if selected == nil {
+    return nil, errors.New("none of the host devices:" + strings.Join(devices, ",") + " has free VFs left")
+  }
+  return selected, nil
+}
+
+func selectLeastLoaded(candidates []candidate) *PhysicalFunction {
+  var selected *candidate
+  for i, cand := range candidates {
+    if cand.freeVfs > 0 && (selected == nil || cand.freeVfs > selected.freeVfs) {
+      selected = &candidates[i]
+    }
+  }
+  if selected == nil {
+    return nil
+  }
+  return selected.pf
+}
+
+// selectNext selects the first PF with free VFs after the one selected last time for the network
+// The state file is locked, so concurrent CNI invocations advance the state one after the other
+func selectNext(candidates []candidate, network string) (*PhysicalFunction, error) {
+  file, err := os.OpenFile(filepath.Join(LockDir, "danm-sriov-rr-" + network), os.O_CREATE|os.O_RDWR, 0600)
+  if err != nil {
+    return nil, errors.New("round-robin state of network:" + network + " cannot be opened because:" + err.Error())
+  }
+  defer file.Close()
+  err = syscall.Flock(int(file.Fd()), syscall.LOCK_EX)
+  if err != nil {
+    return nil, errors.New("round-robin state of network:" + network + " cannot be locked because:" + err.Error())
+  }
+  defer syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+  content, _ := ioutil.ReadAll(file)
+  next, _ := strconv.Atoi(strings.TrimSpace(string(content)))
+  for i := range candidates {
+    index := (next + i) % len(candidates)
+    if candidates[index].freeVfs == 0 {
+      continue
+    }
+    file.Truncate(0)
+    file.WriteAt([]byte(strconv.Itoa(index + 1)), 0)
+    return candidates[index].pf, nil
+  }
+  return nil, nil
+}
@@ -0,0 +1,210 @@
+package sriov
+
+import (
+  "errors"
+  "io/ioutil"
+  "os"
+  "path/filepath"
+  "regexp"
+  "sort"
+  "strconv"
+  "strings"
+)
+
+const (
+  VendorIntel = "0x8086"
+  VendorMellanox = "0x15b3"
+  VendorBroadcom = "0x14e4"
+)
+
+var (
+  // SysClassNet is the sysfs directory network devices are discovered from, tests can point it to a fake tree
+  SysClassNet = "/sys/class/net"
+  // Kernels before 5.0 name mlx5 representors by the VF index only, newer mlx5, bnxt, and ice drivers use the pf<PF>vf<VF> format
+  representorPortName = regexp.MustCompile(`^(?:c\d+)?(?:pf(\d+)vf)?(\d+)$`)
+  uplinkPortName = regexp.MustCompile(`^p(\d+)$`)
+)
+
+// PhysicalFunction describes an SR-IOV capable network device of the host
+type PhysicalFunction struct {
+  Name string
+  PciAddress string
+  Vendor string
+  TotalVfs int
+  NumVfs int
+  // SwitchId is only set when the eswitch of the NIC is in switchdev mode
+  SwitchId string
+  // PortIndex is the index of the uplink port on a multi-port NIC, or -1 if the driver does not report it
+  PortIndex int
+  devPort string
+}
+
+// VirtualFunction describes one VF of a PhysicalFunction
+type VirtualFunction struct {
+  Index int
+  PciAddress string
+  Driver string
+  // Name is the kernel network device of the VF in the host network namespace
+  // It is empty when the VF was already moved into a container, or is bound to a userspace driver
+  Name string
+}
+
+// GetPhysicalFunction discovers the SR-IOV attributes of the named host device
+// An error is returned if the device does not exist, or it is not an SR-IOV Physical Function
+func GetPhysicalFunction(name string) (*PhysicalFunction, error) {
+  devicePath := filepath.Join(SysClassNet, name, "device")
+  totalVfs, err := readInt(filepath.Join(devicePath, "sriov_totalvfs"))
+  if err != nil {
+    return nil, errors.New("host device:" + name + " is not an SR-IOV Physical Function")
+  }
+  numVfs, err := readInt(filepath.Join(devicePath, "sriov_numvfs"))
+  if err != nil {
+    return nil, errors.New("number of VFs of host device:" + name + " cannot be read because:" + err.Error())
+  }
+  pciAddress, err := getPciAddress(devicePath)
+  if err != nil {
+    return nil, errors.New("PCI address of host device:" + name + " cannot be determined because:" + err.Error())
+  }
+  pf := PhysicalFunction {
+    Name: name,
+    PciAddress: pciAddress,
+    Vendor: readString(filepath.Join(devicePath, "vendor")),
+    TotalVfs: totalVfs,
+    NumVfs: numVfs,
+    //Reading phys_switch_id fails with EOPNOTSUPP when the NIC is in legacy mode
+    SwitchId: readString(filepath.Join(SysClassNet, name, "phys_switch_id")),
+    PortIndex: -1,
+    devPort: readString(filepath.Join(SysClassNet, name, "dev_port")),
+  }
+  match := uplinkPortName.FindStringSubmatch(readString(filepath.Join(SysClassNet, name, "phys_port_name")))
+  if match != nil {
+    pf.PortIndex, _ = strconv.Atoi(match[1])
+  }
+  return &pf, nil
+}
+
+// IsSwitchdev tells if VF traffic of the PF can be handled through representor interfaces
+func (pf *PhysicalFunction) IsSwitchdev() bool {
+  return pf.SwitchId != ""
+}
+
+// GetVirtualFunctions returns all the enabled VFs of the PF, ordered by their index
+func (pf *PhysicalFunction) GetVirtualFunctions() ([]VirtualFunction, error) {
+  devicePath := filepath.Join(SysClassNet, pf.Name, "device")
+  vfLinks, err := filepath.Glob(filepath.Join(devicePath, "virtfn*"))
+  if err != nil {
+    return nil, errors.New("VFs of host device:" + pf.Name + " cannot be listed because:" + err.Error())
+  }
+  var vfs []VirtualFunction
+  for _, vfLink := range vfLinks {
+    index, err := strconv.Atoi(strings.TrimPrefix(filepath.Base(vfLink), "virtfn"))
+    if err != nil {
+      continue
+    }
+    pciAddress, err := getPciAddress(vfLink)
+    if err != nil {
+      return nil, errors.New("PCI address of VF:" + strconv.Itoa(index) + " of host device:" + pf.Name + " cannot be determined because:" + err.Error())
+    }
+    vfs = append(vfs, VirtualFunction {
+      Index: index,
+      PciAddress: pciAddress,
+      Driver: getDriver(vfLink),
+      Name: pf.getVfNetDevice(vfLink),
+    })
+  }
+  sort.Slice(vfs, func(i, j int) bool {
+    return vfs[i].Index < vfs[j].Index
+  })
+  return vfs, nil
+}
+
+// GetFreeVirtualFunctions returns the VFs still having a kernel network device in the host network namespace
+// VFs bound to userspace drivers are never reported as free, as their usage cannot be determined from sysfs
+func (pf *PhysicalFunction) GetFreeVirtualFunctions() ([]VirtualFunction, error) {
+  vfs, err := pf.GetVirtualFunctions()
+  if err != nil {
+    return nil, err
+  }
+  var freeVfs []VirtualFunction
+  for _, vf := range vfs {
+    if vf.Name != "" {
+      freeVfs = append(freeVfs, vf)
+    }
+  }
+  return freeVfs, nil
+}
+
+// GetRepresentor returns the name of the host interface representing the VF on the eswitch of a switchdev mode NIC
+func (pf *PhysicalFunction) GetRepresentor(vfIndex int) (string, error) {
+  if !pf.IsSwitchdev() {
+    return "", errors.New("host device:" + pf.Name + " is not in switchdev mode")
+  }
+  devices, err := ioutil.ReadDir(SysClassNet)
+  if err != nil {
+    return "", errors.New("host network devices cannot be listed because:" + err.Error())
+  }
+  for _, device := range devices {
+    if device.Name() == pf.Name || readString(filepath.Join(SysClassNet, device.Name(), "phys_switch_id")) != pf.SwitchId {
+      continue
+    }
+    match := representorPortName.FindStringSubmatch(readString(filepath.Join(SysClassNet, device.Name(), "phys_port_name")))
+    if match == nil {
+      continue
+    }
+    if match[1] != "" && pf.PortIndex != -1 && match[1] != strconv.Itoa(pf.PortIndex) {
+      continue
+    }
+    if match[2] == strconv.Itoa(vfIndex) {
+      return device.Name(), nil
+    }
+  }
+  return "", errors.New("representor of VF:" + strconv.Itoa(vfIndex) + " of host device:" + pf.Name + " cannot be found")
+}
+
+// getVfNetDevice returns the kernel network device of the VF
+// mlx4 exposes both ports of a dual-port NIC through the same VF PCI function, so the netdev belonging to the same port as the PF is selected
+func (pf *PhysicalFunction) getVfNetDevice(vfLink string) string {
+  netDevices, err := ioutil.ReadDir(filepath.Join(vfLink, "net"))
+  if err != nil || len(netDevices) == 0 {
+    return ""
+  }
+  if len(netDevices) > 1 && pf.Vendor == VendorMellanox {
+    for _, netDevice := range netDevices {
+      if readString(filepath.Join(vfLink, "net", netDevice.Name(), "dev_port")) == pf.devPort {
+        return netDevice.Name()
+      }
+    }
+  }
+  return netDevices[0].Name()
+}
+
+func getPciAddress(deviceLink string) (string, error) {
+  devicePath, err := filepath.EvalSymlinks(deviceLink)
+  if err != nil {
+    return "", err
+  }
+  return filepath.Base(devicePath), nil
+}
+
+func getDriver(deviceLink string) string {
+  driverPath, err := filepath.EvalSymlinks(filepath.Join(deviceLink, "driver"))
+  if err != nil {
+    return ""
+  }
+  return filepath.Base(driverPath)
+}
+
+func readString(path string) string {
+  content, err := ioutil.ReadFile(path)
+  if err != nil {
+    return ""
+  }
+  return strings.TrimSpace(string(content))
+}
+
+func readInt(path string) (int, error) {
+  if _, err := os.Stat(path); err != nil {
+    return 0, err
+  }
+  return strconv.Atoi(readString(path))
+}
@@ -0,0 +1,179 @@
+package sriov_test
+
+import (
+  "io/ioutil"
+  "os"
+  "path/filepath"
+  "testing"
+  "github.com/nokia/danm/pkg/sriov"
+)
+
+// setupSysfs builds a fake /sys tree with a dual-port Mellanox NIC in switchdev mode, and an Intel NIC in legacy mode
+func setupSysfs(t *testing.T) string {
+  root, err := ioutil.TempDir("", "sriov")
+  if err != nil {
+    t.Fatalf("temporary directory cannot be created:%v", err)
+  }
+  classNet := filepath.Join(root, "class", "net")
+  files := map[string]string {
+    "devices/0000:03:00.0/sriov_totalvfs": "8",
+    "devices/0000:03:00.0/sriov_numvfs": "2",
+    "devices/0000:03:00.0/vendor": "0x15b3",
+    "devices/0000:03:00.2/net/ens3f0v0/dev_port": "0",
+    "devices/0000:03:00.2/net/ens3f1v0/dev_port": "1",
+    "devices/0000:03:00.3/net/.keep": "",
+    "devices/0000:05:00.0/sriov_totalvfs": "64",
+    "devices/0000:05:00.0/sriov_numvfs": "1",
+    "devices/0000:05:00.0/vendor": "0x8086",
+    "devices/0000:05:02.0/net/ens5v0/dev_port": "0",
+    "devices/0000:07:00.0/vendor": "0x8086",
+    "devices/drivers/mlx5_core/.keep": "",
+    "class/net/ens3f1/phys_switch_id": "abcd",
+    "class/net/ens3f1/phys_port_name": "p1",
+    "class/net/ens3f1/dev_port": "1",
+    "class/net/eth_rep0/phys_switch_id": "abcd",
+    "class/net/eth_rep0/phys_port_name": "pf0vf0",
+    "class/net/eth_rep1/phys_switch_id": "abcd",
+    "class/net/eth_rep1/phys_port_name": "pf1vf0",
+    "class/net/eth_rep2/phys_switch_id": "abcd",
+    "class/net/eth_rep2/phys_port_name": "pf1vf1",
+    "class/net/ens5/dev_port": "0",
+    "class/net/ens7/dev_port": "0",
+  }
+  for file, content := range files {
+    path := filepath.Join(root, file)
+    os.MkdirAll(filepath.Dir(path), 0755)
+    if filepath.Base(path) != ".keep" {
+      ioutil.WriteFile(path, []byte(content), 0644)
+    }
+  }
+  links := map[string]string {
+    "class/net/ens3f1/device": "devices/0000:03:00.0",
+    "class/net/ens5/device": "devices/0000:05:00.0",
+    "class/net/ens7/device": "devices/0000:07:00.0",
+    "devices/0000:03:00.0/virtfn0": "devices/0000:03:00.2",
+    "devices/0000:03:00.0/virtfn1": "devices/0000:03:00.3",
+    "devices/0000:03:00.2/driver": "devices/drivers/mlx5_core",
+    "devices/0000:05:00.0/virtfn0": "devices/0000:05:02.0",
+  }
+  for link, target := range links {
+    os.Symlink(filepath.Join(root, target), filepath.Join(root, link))
+  }
+  sriov.SysClassNet = classNet
+  return root
+}
+
+func TestGetPhysicalFunction(t *testing.T) {
+  root := setupSysfs(t)
+  defer os.RemoveAll(root)
+  pf, err := sriov.GetPhysicalFunction("ens3f1")
+  if err != nil {
+    t.Fatalf("PF discovery failed with error:%v", err)
+  }
+  if pf.PciAddress != "0000:03:00.0" || pf.TotalVfs != 8 || pf.NumVfs != 2 || pf.Vendor != sriov.VendorMellanox || !pf.IsSwitchdev() || pf.PortIndex != 1 {
+    t.Errorf("Discovered PF:%+v does not match with expectation", *pf)
+  }
+  pf, err = sriov.GetPhysicalFunction("ens5")
+  if err != nil || pf.IsSwitchdev() || pf.PortIndex != -1 {
+    t.Errorf("Discovered legacy mode PF:%+v, error:%v does not match with expectation", pf, err)
+  }
+  _, err = sriov.GetPhysicalFunction("ens7")
+  if err == nil {
+    t.Errorf("Host device without SR-IOV capability was discovered as a PF")
+  }
+  _, err = sriov.GetPhysicalFunction("nonexistent")
+  if err == nil {
+    t.Errorf("Non-existent host device was discovered as a PF")
+  }
+}
+
+func TestGetVirtualFunctions(t *testing.T) {
+  root := setupSysfs(t)
+  defer os.RemoveAll(root)
+  pf, _ := sriov.GetPhysicalFunction("ens3f1")
+  vfs, err := pf.GetVirtualFunctions()
+  if err != nil {
+    t.Fatalf("VF discovery failed with error:%v", err)
+  }
+  if len(vfs) != 2 {
+    t.Fatalf("Number of discovered VFs:%d does not match with expectation", len(vfs))
+  }
+  if vfs[0].PciAddress != "0000:03:00.2" || vfs[0].Name != "ens3f1v0" || vfs[0].Driver != "mlx5_core" {
+    t.Errorf("Discovered VF:%+v does not match with expectation, netdev of the PF's port was expected", vfs[0])
+  }
+  if vfs[1].Name != "" {
+    t.Errorf("VF already moved to a container was discovered with netdev:%s", vfs[1].Name)
+  }
+  freeVfs, _ := pf.GetFreeVirtualFunctions()
+  if len(freeVfs) != 1 || freeVfs[0].Index != 0 {
+    t.Errorf("Free VFs:%+v do not match with expectation", freeVfs)
+  }
+}
+
+func TestGetRepresentor(t *testing.T) {
+  root := setupSysfs(t)
+  defer os.RemoveAll(root)
+  pf, _ := sriov.GetPhysicalFunction("ens3f1")
+  representor, err := pf.GetRepresentor(1)
+  if err != nil || representor != "eth_rep2" {
+    t.Errorf("Representor:%s, error:%v does not match with expectation", representor, err)
+  }
+  representor, err = pf.GetRepresentor(0)
+  if err != nil || representor != "eth_rep1" {
+    t.Errorf("Representor of the other port was returned:%s, error:%v", representor, err)
+  }
+  _, err = pf.GetRepresentor(5)
+  if err == nil {
+    t.Errorf("Representor was found for a non-existent VF")
+  }
+  legacyPf, _ := sriov.GetPhysicalFunction("ens5")
+  _, err = legacyPf.GetRepresentor(0)
+  if err == nil {
+    t.Errorf("Representor was found for a PF in legacy mode")
+  }
+}
+
+func TestGetTakenVirtualFunction(t *testing.T) {
+  before := []sriov.VirtualFunction{sriov.VirtualFunction{Index: 0}, sriov.VirtualFunction{Index: 2}, sriov.VirtualFunction{Index: 3}}
+  after := []sriov.VirtualFunction{sriov.VirtualFunction{Index: 0}, sriov.VirtualFunction{Index: 3}}
+  vf, err := sriov.GetTakenVirtualFunction(before, after)
+  if err != nil || vf.Index != 2 {
+    t.Errorf("Taken VF:%+v, error:%v does not match with expectation", vf, err)
+  }
+  _, err = sriov.GetTakenVirtualFunction(after, after)
+  if err == nil {
+    t.Errorf("Taken VF was identified, although all VFs are still free")
+  }
+}
+
+func TestSelectPhysicalFunction(t *testing.T) {
+  root := setupSysfs(t)
+  defer os.RemoveAll(root)
+  sriov.LockDir = root
+  //ens5 gets a second free VF, so it is less loaded than ens3f1
+  os.MkdirAll(filepath.Join(root, "devices/0000:05:02.1/net/ens5v1"), 0755)
+  os.Symlink(filepath.Join(root, "devices/0000:05:02.1"), filepath.Join(root, "devices/0000:05:00.0/virtfn1"))
+  pf, err := sriov.SelectPhysicalFunction([]string{"ens3f1", "ens5"}, sriov.SelectionLeastLoaded, "net1")
+  if err != nil || pf.Name != "ens5" {
+    t.Errorf("Least loaded PF was expected to be selected, got:%+v, error:%v", pf, err)
+  }
+  pf, err = sriov.SelectPhysicalFunction([]string{"ens3f1", "ens5"}, sriov.SelectionStrict, "net1")
+  if err != nil || pf.Name != "ens3f1" {
+    t.Errorf("First PF was expected to be selected with strict affinity, got:%+v, error:%v", pf, err)
+  }
+  var selected []string
+  for i := 0; i < 3; i++ {
+    pf, err = sriov.SelectPhysicalFunction([]string{"ens7", "ens3f1", "ens5"}, sriov.SelectionRoundRobin, "net1")
+    if err != nil {
+      t.Fatalf("Round-robin selection failed with error:%v", err)
+    }
+    selected = append(selected, pf.Name)
+  }
+  if selected[0] != "ens3f1" || selected[1] != "ens5" || selected[2] != "ens3f1" {
+    t.Errorf("PFs with free VFs were expected to be selected one after the other, got:%v", selected)
+  }
+  _, err = sriov.SelectPhysicalFunction([]string{"ens7", "nonexistent"}, sriov.SelectionLeastLoaded, "net1")
+  if err == nil {
+    t.Errorf("PF was selected, although none of the host devices has free VFs")
+  }
+}
@@ -19,6 +19,22 @@ func (client *ClientStub) DanmEps(namespace string) client.DanmEpInterface {
   return newEpClientStub(client.testEps)
 }
 
+func (client *ClientStub) DanmNetReports() client.DanmNetReportInterface {
+  return nil
+}
+
+func (client *ClientStub) DanmNodeCapabilities() client.DanmNodeCapabilityInterface {
+  return nil
+}
+
+func (client *ClientStub) DanmIPReservations(namespace string) client.DanmIPReservationInterface {
+  return nil
+}
+
+func (client *ClientStub) DanmNetAllocations(namespace string) client.DanmNetAllocationInterface {
+  return nil
+}
+
 func (c *ClientStub) RESTClient() rest.Interface {
   return nil
 }
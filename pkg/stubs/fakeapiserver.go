@@ -0,0 +1,553 @@
+package stubs
+
+import (
+  "encoding/json"
+  "errors"
+  "strconv"
+  "sync"
+  "sync/atomic"
+  "time"
+  apierrors "k8s.io/apimachinery/pkg/api/errors"
+  "k8s.io/apimachinery/pkg/api/meta"
+  meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+  "k8s.io/apimachinery/pkg/runtime"
+  "k8s.io/apimachinery/pkg/runtime/schema"
+  types "k8s.io/apimachinery/pkg/types"
+  watch "k8s.io/apimachinery/pkg/watch"
+  discovery "k8s.io/client-go/discovery"
+  rest "k8s.io/client-go/rest"
+  danmtypes "github.com/nokia/danm/pkg/crd/apis/danm/v1"
+  client "github.com/nokia/danm/pkg/crd/client/clientset/versioned/typed/danm/v1"
+)
+
+var (
+  danmNetResource = schema.GroupResource{Group: danmtypes.SchemeGroupVersion.Group, Resource: "danmnets"}
+  danmEpResource = schema.GroupResource{Group: danmtypes.SchemeGroupVersion.Group, Resource: "danmeps"}
+  danmNetAllocationResource = schema.GroupResource{Group: danmtypes.SchemeGroupVersion.Group, Resource: "danmnetallocations"}
+)
+
+// FakeApiServer is an in-memory DANM clientset storing DanmNets, DanmEps, and DanmNetAllocations
+// Unlike ClientSetStub it enforces optimistic locking exactly like the K8s API server does,
+// and it can inject conflicts, errors, and latency, so optimistic concurrency handling can be tested without a real API server
+// It also serves watches, so informers, and the controllers built on them can run against it
+type FakeApiServer struct {
+  // Latency is added to every request, simulating the round-trip time to the API server
+  Latency time.Duration
+  mux sync.Mutex
+  objects map[schema.GroupResource]map[string]runtime.Object
+  resourceVersion int
+  injectedConflicts int
+  injectedErrors int
+  injectedError error
+  gets uint64
+  updates uint64
+  conflicts uint64
+  watchers map[schema.GroupResource]*watch.Broadcaster
+  droppedEvents int
+}
+
+// NewFakeApiServer returns a fake API server storing the given objects, and answering every request after the given latency
+func NewFakeApiServer(latency time.Duration, nets []danmtypes.DanmNet, eps []danmtypes.DanmEp) *FakeApiServer {
+  server := &FakeApiServer {
+    Latency: latency,
+    objects: map[schema.GroupResource]map[string]runtime.Object {
+      danmNetResource: make(map[string]runtime.Object),
+      danmEpResource: make(map[string]runtime.Object),
+      danmNetAllocationResource: make(map[string]runtime.Object),
+    },
+    watchers: make(map[schema.GroupResource]*watch.Broadcaster),
+  }
+  for i := range nets {
+    server.create(danmNetResource, nets[i].ObjectMeta.Namespace, &nets[i])
+  }
+  for i := range eps {
+    server.create(danmEpResource, eps[i].ObjectMeta.Namespace, &eps[i])
+  }
+  return server
+}
+
+// InjectConflicts makes the next n updates fail with an optimistic lock conflict, even if they refer to the latest resource version
+func (server *FakeApiServer) InjectConflicts(n int) {
+  server.mux.Lock()
+  defer server.mux.Unlock()
+  server.injectedConflicts = n
+}
+
+// InjectErrors makes the next n requests of any kind fail with the given error, e.g. apierrors.NewServiceUnavailable
+func (server *FakeApiServer) InjectErrors(n int, err error) {
+  server.mux.Lock()
+  defer server.mux.Unlock()
+  server.injectedErrors = n
+  server.injectedError = err
+}
+
+// DropWatchEvents makes the next n watch events of any resource lost, simulating e.g. a broken watch connection
+// Informers keep serving the stale state of the dropped objects, as the watches of the fake API server never expire
+func (server *FakeApiServer) DropWatchEvents(n int) {
+  server.mux.Lock()
+  defer server.mux.Unlock()
+  server.droppedEvents = n
+}
+
+// Stats returns the number of served reads, successful updates, and updates rejected because of a conflict
+func (server *FakeApiServer) Stats() (uint64, uint64, uint64) {
+  return atomic.LoadUint64(&server.gets), atomic.LoadUint64(&server.updates), atomic.LoadUint64(&server.conflicts)
+}
+
+func (server *FakeApiServer) Discovery() discovery.DiscoveryInterface {
+  return nil
+}
+
+func (server *FakeApiServer) DanmV1() client.DanmV1Interface {
+  return fakeDanmV1{server: server}
+}
+
+func (server *FakeApiServer) Danm() client.DanmV1Interface {
+  return fakeDanmV1{server: server}
+}
+
+// begin simulates the latency of the request, then locks the store
+// It returns the injected error, if the request shall fail
+func (server *FakeApiServer) begin() error {
+  time.Sleep(server.Latency)
+  server.mux.Lock()
+  if server.injectedErrors > 0 {
+    server.injectedErrors--
+    return server.injectedError
+  }
+  return nil
+}
+
+func (server *FakeApiServer) create(resource schema.GroupResource, namespace string, obj runtime.Object) (runtime.Object, error) {
+  accessor, _ := meta.Accessor(obj)
+  key := namespace + "/" + accessor.GetName()
+  if _, ok := server.objects[resource][key]; ok {
+    return nil, apierrors.NewAlreadyExists(resource, accessor.GetName())
+  }
+  return server.store(resource, key, obj, watch.Added), nil
+}
+
+func (server *FakeApiServer) update(resource schema.GroupResource, namespace string, obj runtime.Object) (runtime.Object, error) {
+  accessor, _ := meta.Accessor(obj)
+  key := namespace + "/" + accessor.GetName()
+  stored, ok := server.objects[resource][key]
+  if !ok {
+    return nil, apierrors.NewNotFound(resource, accessor.GetName())
+  }
+  storedAccessor, _ := meta.Accessor(stored)
+  if server.injectedConflicts > 0 || storedAccessor.GetResourceVersion() != accessor.GetResourceVersion() {
+    if server.injectedConflicts > 0 {
+      server.injectedConflicts--
+    }
+    atomic.AddUint64(&server.conflicts, 1)
+    return nil, apierrors.NewConflict(resource, accessor.GetName(), errors.New(danmtypes.OptimisticLockErrorMsg))
+  }
+  atomic.AddUint64(&server.updates, 1)
+  return server.store(resource, key, obj, watch.Modified), nil
+}
+
+func (server *FakeApiServer) store(resource schema.GroupResource, key string, obj runtime.Object, eventType watch.EventType) runtime.Object {
+  server.resourceVersion++
+  newObj := obj.DeepCopyObject()
+  accessor, _ := meta.Accessor(newObj)
+  accessor.SetResourceVersion(strconv.Itoa(server.resourceVersion))
+  server.objects[resource][key] = newObj
+  server.notify(resource, eventType, newObj)
+  return newObj.DeepCopyObject()
+}
+
+func (server *FakeApiServer) get(resource schema.GroupResource, namespace, name string) (runtime.Object, error) {
+  atomic.AddUint64(&server.gets, 1)
+  stored, ok := server.objects[resource][namespace + "/" + name]
+  if !ok {
+    return nil, apierrors.NewNotFound(resource, name)
+  }
+  return stored.DeepCopyObject(), nil
+}
+
+// patch applies a JSON merge patch to the stored object
+// Like the K8s API server, it refuses the patch with a conflict if it sets a UID, or resource version different from the stored one
+func (server *FakeApiServer) patch(resource schema.GroupResource, namespace, name string, pt types.PatchType, data []byte, patched runtime.Object) (runtime.Object, error) {
+  if pt != types.MergePatchType {
+    return nil, errors.New("Only JSON merge patches are supported by the fake API server")
+  }
+  key := namespace + "/" + name
+  stored, ok := server.objects[resource][key]
+  if !ok {
+    return nil, apierrors.NewNotFound(resource, name)
+  }
+  storedJson, err := json.Marshal(stored)
+  if err != nil {
+    return nil, err
+  }
+  var original, patch map[string]interface{}
+  if err = json.Unmarshal(storedJson, &original); err != nil {
+    return nil, err
+  }
+  if err = json.Unmarshal(data, &patch); err != nil {
+    return nil, apierrors.NewBadRequest("invalid merge patch:" + err.Error())
+  }
+  storedAccessor, _ := meta.Accessor(stored)
+  if patchMeta, ok := patch["metadata"].(map[string]interface{}); ok {
+    if uid, ok := patchMeta["uid"].(string); ok && uid != string(storedAccessor.GetUID()) {
+      atomic.AddUint64(&server.conflicts, 1)
+      return nil, apierrors.NewConflict(resource, name, errors.New("Precondition failed: UID in precondition: " + uid + ", UID in object meta: " + string(storedAccessor.GetUID())))
+    }
+    if version, ok := patchMeta["resourceVersion"].(string); ok && version != storedAccessor.GetResourceVersion() {
+      atomic.AddUint64(&server.conflicts, 1)
+      return nil, apierrors.NewConflict(resource, name, errors.New(danmtypes.OptimisticLockErrorMsg))
+    }
+  }
+  mergedJson, err := json.Marshal(mergePatch(original, patch))
+  if err != nil {
+    return nil, err
+  }
+  if err = json.Unmarshal(mergedJson, patched); err != nil {
+    return nil, err
+  }
+  atomic.AddUint64(&server.updates, 1)
+  return server.store(resource, key, patched, watch.Modified), nil
+}
+
+// mergePatch applies an RFC 7386 JSON merge patch: objects are merged recursively, null values delete, everything else replaces
+func mergePatch(original interface{}, patch interface{}) interface{} {
+  patchMap, isPatchMap := patch.(map[string]interface{})
+  if !isPatchMap {
+    return patch
+  }
+  originalMap, isOriginalMap := original.(map[string]interface{})
+  if !isOriginalMap {
+    originalMap = make(map[string]interface{})
+  }
+  for key, value := range patchMap {
+    if value == nil {
+      delete(originalMap, key)
+      continue
+    }
+    originalMap[key] = mergePatch(originalMap[key], value)
+  }
+  return originalMap
+}
+
+func (server *FakeApiServer) delete(resource schema.GroupResource, namespace, name string, options *meta_v1.DeleteOptions) error {
+  key := namespace + "/" + name
+  stored, ok := server.objects[resource][key]
+  if !ok {
+    return apierrors.NewNotFound(resource, name)
+  }
+  storedAccessor, _ := meta.Accessor(stored)
+  if options != nil && options.Preconditions != nil && options.Preconditions.UID != nil && *options.Preconditions.UID != storedAccessor.GetUID() {
+    return apierrors.NewConflict(resource, name, errors.New("Precondition failed: UID in precondition: " + string(*options.Preconditions.UID) + ", UID in object meta: " + string(storedAccessor.GetUID())))
+  }
+  delete(server.objects[resource], key)
+  server.notify(resource, watch.Deleted, stored)
+  return nil
+}
+
+// watch returns a watch of the resource in the namespace, or in all namespaces if it is empty
+// Watches only see the changes made after they were started
+func (server *FakeApiServer) watch(resource schema.GroupResource, namespace string) watch.Interface {
+  broadcaster, ok := server.watchers[resource]
+  if !ok {
+    broadcaster = watch.NewBroadcaster(100, watch.DropIfChannelFull)
+    server.watchers[resource] = broadcaster
+  }
+  return watch.Filter(broadcaster.Watch(), func(event watch.Event) (watch.Event, bool) {
+    accessor, err := meta.Accessor(event.Object)
+    return event, err == nil && (namespace == "" || accessor.GetNamespace() == namespace)
+  })
+}
+
+func (server *FakeApiServer) notify(resource schema.GroupResource, eventType watch.EventType, obj runtime.Object) {
+  broadcaster, ok := server.watchers[resource]
+  if !ok {
+    return
+  }
+  if server.droppedEvents > 0 {
+    server.droppedEvents--
+    return
+  }
+  broadcaster.Action(eventType, obj.DeepCopyObject())
+}
+
+func (server *FakeApiServer) list(resource schema.GroupResource, namespace string) []runtime.Object {
+  var objs []runtime.Object
+  for _, stored := range server.objects[resource] {
+    accessor, _ := meta.Accessor(stored)
+    if namespace == "" || accessor.GetNamespace() == namespace {
+      objs = append(objs, stored.DeepCopyObject())
+    }
+  }
+  return objs
+}
+
+type fakeDanmV1 struct {
+  server *FakeApiServer
+}
+
+func (fake fakeDanmV1) DanmNets(namespace string) client.DanmNetInterface {
+  return fakeNetClient{server: fake.server, namespace: namespace}
+}
+
+func (fake fakeDanmV1) DanmEps(namespace string) client.DanmEpInterface {
+  return fakeEpClient{server: fake.server, namespace: namespace}
+}
+
+func (fake fakeDanmV1) DanmNetReports() client.DanmNetReportInterface {
+  return nil
+}
+
+func (fake fakeDanmV1) DanmNodeCapabilities() client.DanmNodeCapabilityInterface {
+  return nil
+}
+
+func (fake fakeDanmV1) DanmIPReservations(namespace string) client.DanmIPReservationInterface {
+  return nil
+}
+
+func (fake fakeDanmV1) DanmNetAllocations(namespace string) client.DanmNetAllocationInterface {
+  return fakeAllocClient{server: fake.server, namespace: namespace}
+}
+
+func (fake fakeDanmV1) RESTClient() rest.Interface {
+  return nil
+}
+
+type fakeNetClient struct {
+  server *FakeApiServer
+  namespace string
+}
+
+func (netClient fakeNetClient) Create(obj *danmtypes.DanmNet) (*danmtypes.DanmNet, error) {
+  defer netClient.server.mux.Unlock()
+  if err := netClient.server.begin(); err != nil {
+    return nil, err
+  }
+  created, err := netClient.server.create(danmNetResource, netClient.namespace, obj)
+  if err != nil {
+    return nil, err
+  }
+  return created.(*danmtypes.DanmNet), nil
+}
+
+func (netClient fakeNetClient) Update(obj *danmtypes.DanmNet) (*danmtypes.DanmNet, error) {
+  defer netClient.server.mux.Unlock()
+  if err := netClient.server.begin(); err != nil {
+    return nil, err
+  }
+  updated, err := netClient.server.update(danmNetResource, netClient.namespace, obj)
+  if err != nil {
+    return nil, err
+  }
+  return updated.(*danmtypes.DanmNet), nil
+}
+
+func (netClient fakeNetClient) Delete(name string, options *meta_v1.DeleteOptions) error {
+  defer netClient.server.mux.Unlock()
+  if err := netClient.server.begin(); err != nil {
+    return err
+  }
+  return netClient.server.delete(danmNetResource, netClient.namespace, name, options)
+}
+
+func (netClient fakeNetClient) DeleteCollection(options *meta_v1.DeleteOptions, listOptions meta_v1.ListOptions) error {
+  return errors.New("DeleteCollection is not supported by the fake API server")
+}
+
+func (netClient fakeNetClient) Get(name string, options meta_v1.GetOptions) (*danmtypes.DanmNet, error) {
+  defer netClient.server.mux.Unlock()
+  if err := netClient.server.begin(); err != nil {
+    return nil, err
+  }
+  stored, err := netClient.server.get(danmNetResource, netClient.namespace, name)
+  if err != nil {
+    return nil, err
+  }
+  return stored.(*danmtypes.DanmNet), nil
+}
+
+func (netClient fakeNetClient) List(opts meta_v1.ListOptions) (*danmtypes.DanmNetList, error) {
+  defer netClient.server.mux.Unlock()
+  if err := netClient.server.begin(); err != nil {
+    return nil, err
+  }
+  netList := danmtypes.DanmNetList{}
+  for _, stored := range netClient.server.list(danmNetResource, netClient.namespace) {
+    netList.Items = append(netList.Items, *stored.(*danmtypes.DanmNet))
+  }
+  return &netList, nil
+}
+
+func (netClient fakeNetClient) Watch(opts meta_v1.ListOptions) (watch.Interface, error) {
+  defer netClient.server.mux.Unlock()
+  if err := netClient.server.begin(); err != nil {
+    return nil, err
+  }
+  return netClient.server.watch(danmNetResource, netClient.namespace), nil
+}
+
+func (netClient fakeNetClient) Patch(name string, pt types.PatchType, data []byte, subresources ...string) (*danmtypes.DanmNet, error) {
+  return nil, errors.New("Patch is not supported by the fake API server")
+}
+
+type fakeEpClient struct {
+  server *FakeApiServer
+  namespace string
+}
+
+func (epClient fakeEpClient) Create(obj *danmtypes.DanmEp) (*danmtypes.DanmEp, error) {
+  defer epClient.server.mux.Unlock()
+  if err := epClient.server.begin(); err != nil {
+    return nil, err
+  }
+  created, err := epClient.server.create(danmEpResource, epClient.namespace, obj)
+  if err != nil {
+    return nil, err
+  }
+  return created.(*danmtypes.DanmEp), nil
+}
+
+func (epClient fakeEpClient) Update(obj *danmtypes.DanmEp) (*danmtypes.DanmEp, error) {
+  defer epClient.server.mux.Unlock()
+  if err := epClient.server.begin(); err != nil {
+    return nil, err
+  }
+  updated, err := epClient.server.update(danmEpResource, epClient.namespace, obj)
+  if err != nil {
+    return nil, err
+  }
+  return updated.(*danmtypes.DanmEp), nil
+}
+
+func (epClient fakeEpClient) Delete(name string, options *meta_v1.DeleteOptions) error {
+  defer epClient.server.mux.Unlock()
+  if err := epClient.server.begin(); err != nil {
+    return err
+  }
+  return epClient.server.delete(danmEpResource, epClient.namespace, name, options)
+}
+
+func (epClient fakeEpClient) DeleteCollection(options *meta_v1.DeleteOptions, listOptions meta_v1.ListOptions) error {
+  return errors.New("DeleteCollection is not supported by the fake API server")
+}
+
+func (epClient fakeEpClient) Get(name string, options meta_v1.GetOptions) (*danmtypes.DanmEp, error) {
+  defer epClient.server.mux.Unlock()
+  if err := epClient.server.begin(); err != nil {
+    return nil, err
+  }
+  stored, err := epClient.server.get(danmEpResource, epClient.namespace, name)
+  if err != nil {
+    return nil, err
+  }
+  return stored.(*danmtypes.DanmEp), nil
+}
+
+func (epClient fakeEpClient) List(opts meta_v1.ListOptions) (*danmtypes.DanmEpList, error) {
+  defer epClient.server.mux.Unlock()
+  if err := epClient.server.begin(); err != nil {
+    return nil, err
+  }
+  epList := danmtypes.DanmEpList{}
+  for _, stored := range epClient.server.list(danmEpResource, epClient.namespace) {
+    epList.Items = append(epList.Items, *stored.(*danmtypes.DanmEp))
+  }
+  return &epList, nil
+}
+
+func (epClient fakeEpClient) Watch(opts meta_v1.ListOptions) (watch.Interface, error) {
+  defer epClient.server.mux.Unlock()
+  if err := epClient.server.begin(); err != nil {
+    return nil, err
+  }
+  return epClient.server.watch(danmEpResource, epClient.namespace), nil
+}
+
+func (epClient fakeEpClient) Patch(name string, pt types.PatchType, data []byte, subresources ...string) (*danmtypes.DanmEp, error) {
+  defer epClient.server.mux.Unlock()
+  if err := epClient.server.begin(); err != nil {
+    return nil, err
+  }
+  patched, err := epClient.server.patch(danmEpResource, epClient.namespace, name, pt, data, &danmtypes.DanmEp{})
+  if err != nil {
+    return nil, err
+  }
+  return patched.(*danmtypes.DanmEp), nil
+}
+
+type fakeAllocClient struct {
+  server *FakeApiServer
+  namespace string
+}
+
+func (allocClient fakeAllocClient) Create(obj *danmtypes.DanmNetAllocation) (*danmtypes.DanmNetAllocation, error) {
+  defer allocClient.server.mux.Unlock()
+  if err := allocClient.server.begin(); err != nil {
+    return nil, err
+  }
+  created, err := allocClient.server.create(danmNetAllocationResource, allocClient.namespace, obj)
+  if err != nil {
+    return nil, err
+  }
+  return created.(*danmtypes.DanmNetAllocation), nil
+}
+
+func (allocClient fakeAllocClient) Update(obj *danmtypes.DanmNetAllocation) (*danmtypes.DanmNetAllocation, error) {
+  defer allocClient.server.mux.Unlock()
+  if err := allocClient.server.begin(); err != nil {
+    return nil, err
+  }
+  updated, err := allocClient.server.update(danmNetAllocationResource, allocClient.namespace, obj)
+  if err != nil {
+    return nil, err
+  }
+  return updated.(*danmtypes.DanmNetAllocation), nil
+}
+
+func (allocClient fakeAllocClient) Delete(name string, options *meta_v1.DeleteOptions) error {
+  defer allocClient.server.mux.Unlock()
+  if err := allocClient.server.begin(); err != nil {
+    return err
+  }
+  return allocClient.server.delete(danmNetAllocationResource, allocClient.namespace, name, options)
+}
+
+func (allocClient fakeAllocClient) DeleteCollection(options *meta_v1.DeleteOptions, listOptions meta_v1.ListOptions) error {
+  return errors.New("DeleteCollection is not supported by the fake API server")
+}
+
+func (allocClient fakeAllocClient) Get(name string, options meta_v1.GetOptions) (*danmtypes.DanmNetAllocation, error) {
+  defer allocClient.server.mux.Unlock()
+  if err := allocClient.server.begin(); err != nil {
+    return nil, err
+  }
+  stored, err := allocClient.server.get(danmNetAllocationResource, allocClient.namespace, name)
+  if err != nil {
+    return nil, err
+  }
+  return stored.(*danmtypes.DanmNetAllocation), nil
+}
+
+func (allocClient fakeAllocClient) List(opts meta_v1.ListOptions) (*danmtypes.DanmNetAllocationList, error) {
+  defer allocClient.server.mux.Unlock()
+  if err := allocClient.server.begin(); err != nil {
+    return nil, err
+  }
+  allocList := danmtypes.DanmNetAllocationList{}
+  for _, stored := range allocClient.server.list(danmNetAllocationResource, allocClient.namespace) {
+    allocList.Items = append(allocList.Items, *stored.(*danmtypes.DanmNetAllocation))
+  }
+  return &allocList, nil
+}
+
+func (allocClient fakeAllocClient) Watch(opts meta_v1.ListOptions) (watch.Interface, error) {
+  defer allocClient.server.mux.Unlock()
+  if err := allocClient.server.begin(); err != nil {
+    return nil, err
+  }
+  return allocClient.server.watch(danmNetAllocationResource, allocClient.namespace), nil
+}
+
+func (allocClient fakeAllocClient) Patch(name string, pt types.PatchType, data []byte, subresources ...string) (*danmtypes.DanmNetAllocation, error) {
+  return nil, errors.New("Patch is not supported by the fake API server")
+}
@@ -0,0 +1,72 @@
+package stubs
+
+import (
+  "sync"
+  danmtypes "github.com/nokia/danm/pkg/crd/apis/danm/v1"
+)
+
+// FakeRuntime is a container runtime with a scripted sandbox lifecycle
+// Sandboxes are started, and stopped explicitly by the test, and the runtime can be restarted, losing some of its sandboxes meanwhile
+// Its IsContainerAlive method can replace the real runtime check of the cleaner
+type FakeRuntime struct {
+  mux sync.Mutex
+  sandboxes map[string]bool
+  isRestarting bool
+  inspections map[string]int
+}
+
+// NewFakeRuntime returns a fake runtime already running the sandboxes with the given container IDs
+func NewFakeRuntime(cids ...string) *FakeRuntime {
+  runtime := &FakeRuntime{sandboxes: make(map[string]bool), inspections: make(map[string]int)}
+  for _, cid := range cids {
+    runtime.sandboxes[cid] = true
+  }
+  return runtime
+}
+
+// StartSandbox starts the sandbox with the given container ID
+func (runtime *FakeRuntime) StartSandbox(cid string) {
+  runtime.mux.Lock()
+  defer runtime.mux.Unlock()
+  runtime.sandboxes[cid] = true
+}
+
+// StopSandbox stops, and removes the sandbox with the given container ID
+func (runtime *FakeRuntime) StopSandbox(cid string) {
+  runtime.mux.Lock()
+  defer runtime.mux.Unlock()
+  delete(runtime.sandboxes, cid)
+}
+
+// BeginRestart makes the runtime unavailable
+// Like the inspection of a container fails while the real runtime is down, no sandbox is reported alive until the restart finishes
+func (runtime *FakeRuntime) BeginRestart() {
+  runtime.mux.Lock()
+  defer runtime.mux.Unlock()
+  runtime.isRestarting = true
+}
+
+// FinishRestart makes the runtime available again, without the sandboxes lost during the restart
+func (runtime *FakeRuntime) FinishRestart(lostCids ...string) {
+  runtime.mux.Lock()
+  defer runtime.mux.Unlock()
+  for _, cid := range lostCids {
+    delete(runtime.sandboxes, cid)
+  }
+  runtime.isRestarting = false
+}
+
+// IsContainerAlive tells whether the sandbox of the DanmEp is running
+func (runtime *FakeRuntime) IsContainerAlive(ep danmtypes.DanmEp) bool {
+  runtime.mux.Lock()
+  defer runtime.mux.Unlock()
+  runtime.inspections[ep.Spec.CID]++
+  return !runtime.isRestarting && runtime.sandboxes[ep.Spec.CID]
+}
+
+// Inspections returns how many times the sandbox with the given container ID was inspected
+func (runtime *FakeRuntime) Inspections(cid string) int {
+  runtime.mux.Lock()
+  defer runtime.mux.Unlock()
+  return runtime.inspections[cid]
+}
@@ -1,4 +1,4 @@
-package main
+package svccontroller
 
 import (
 	"fmt"
@@ -7,15 +7,17 @@ import (
 	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/apimachinery/pkg/util/wait"
 	coreinformers "k8s.io/client-go/informers/core/v1"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/scheme"
 	corelisters "k8s.io/client-go/listers/core/v1"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
 	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/client-go/util/workqueue"
-	"strings"
 	"time"
 
 	danmv1 "github.com/nokia/danm/pkg/crd/apis/danm/v1"
@@ -38,6 +40,7 @@ type Controller struct {
 	danmepLister  danmlisters.DanmEpLister
 	danmepSynced  cache.InformerSynced
 	workqueue     workqueue.RateLimitingInterface
+	recorder      record.EventRecorder
 }
 
 func NewController(
@@ -50,6 +53,9 @@ func NewController(
 
 	danmscheme.AddToScheme(scheme.Scheme)
 	glog.Info("Creating event broadcaster")
+	eventBroadcaster := record.NewBroadcaster()
+	eventBroadcaster.StartLogging(glog.Infof)
+	eventBroadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: kubeclient.CoreV1().Events("")})
 
 	controller := &Controller{
 		kubeclient:    kubeclient,
@@ -63,6 +69,7 @@ func NewController(
 		danmepLister:  danmepInformer.Lister(),
 		danmepSynced:  danmepInformer.Informer().HasSynced,
 		workqueue:     workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "Endpoints"),
+		recorder:      eventBroadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: "danm-svcwatcher"}),
 	}
 
 	glog.Info("Setting up event handlers")
@@ -310,9 +317,9 @@ func (c *Controller) MakeNewEps(svc *corev1.Service, des []*danmv1.DanmEp) (core
 			ResourceVersion: pod.ResourceVersion,
 		}
 		if PodReady(pod) || svc.Annotations[TolerateUnreadyEps] == "true" {
-			epAddrs = append(epAddrs, corev1.EndpointAddress{IP: strings.Split(de.Spec.Iface.Address, "/")[0], TargetRef: targetRef})
+			epAddrs = append(epAddrs, corev1.EndpointAddress{IP: GetEndpointIp(de), TargetRef: targetRef})
 		} else {
-			notReadyEpAddrs = append(epAddrs, corev1.EndpointAddress{IP: strings.Split(de.Spec.Iface.Address, "/")[0], TargetRef: targetRef})
+			notReadyEpAddrs = append(epAddrs, corev1.EndpointAddress{IP: GetEndpointIp(de), TargetRef: targetRef})
 		}
 	}
 	for _, svcPort := range svc.Spec.Ports {
@@ -351,7 +358,7 @@ func (c *Controller) addDanmep(obj interface{}) {
 	glog.Infof("addDanmep is called: %s %s", obj.(*danmv1.DanmEp).GetName(), obj.(*danmv1.DanmEp).GetNamespace())
 
 	de := obj.(*danmv1.DanmEp)
-	ipAddr := strings.Split(de.Spec.Iface.Address, "/")[0]
+	ipAddr := GetEndpointIp(de)
 	sel := labels.Everything()
 	servicesList, err := c.serviceLister.List(sel)
 	if err != nil {
@@ -396,7 +403,7 @@ func (c *Controller) updateDanmep(old, new interface{}) {
 func (c *Controller) delDanmep(obj interface{}) {
 	glog.Infof("updateDanmep is called: %s %s", obj.(*danmv1.DanmEp).GetName(), obj.(*danmv1.DanmEp).GetNamespace())
 	de := obj.(*danmv1.DanmEp)
-	ipAddr := strings.Split(de.Spec.Iface.Address, "/")[0]
+	ipAddr := GetEndpointIp(de)
 	deNs := de.Namespace
 	var epList []*corev1.Endpoints
 	sel := labels.Everything()
@@ -500,11 +507,17 @@ func (c *Controller) updatePod(old, new interface{}) {
 			return
 		}
 		for _, de := range desList {
-			deNew := de.DeepCopy()
-			if deNew.Spec.Pod == podName && deNew.Namespace == podNs {
-				deLabels := newPod.Labels
-				deNew.SetLabels(deLabels)
-				c.danmclient.Danm().DanmEps(deNew.Namespace).Update(deNew)
+			if de.Spec.Pod == podName && de.Namespace == podNs {
+				// labels are patched, so the phase set by the CNI concurrently is not overwritten with a stale copy
+				patch, err := LabelPatch(de.GetLabels(), newPod.Labels)
+				if err != nil {
+					glog.Errorf("updatePod: label patch of danmep %s: %s", de.Name, err)
+					continue
+				}
+				_, err = c.danmclient.Danm().DanmEps(de.Namespace).Patch(de.Name, types.MergePatchType, patch)
+				if err != nil {
+					glog.Errorf("updatePod: patch danmep %s: %s", de.Name, err)
+				}
 			}
 		}
 	}
@@ -532,6 +545,13 @@ func (c *Controller) addSvc(obj interface{}) {
 	selectorMap, svcNet, err := GetDanmSvcAnnotations(annotations)
 	if err != nil {
 		glog.Errorf("addSvc: get anno %s", err)
+		if IsStrict(svc) {
+			c.recorder.Event(svc, corev1.EventTypeWarning, ServiceMisconfiguredReason, "Invalid "+danmSelector+" annotation: "+err.Error())
+		}
+		return
+	}
+	if IsStrict(svc) && (len(selectorMap) == 0 || svcNet == "") {
+		c.recorder.Event(svc, corev1.EventTypeWarning, ServiceMisconfiguredReason, "Both the "+danmSelector+", and the "+danmNetwork+" annotations are needed to track the Pods of the Service")
 		return
 	}
 	if len(selectorMap) > 0 && svcNet != "" {
@@ -549,6 +569,28 @@ func (c *Controller) addSvc(obj interface{}) {
 		}
 		epFound := FindEpsForSvc(e, svcName, svcNs)
 		c.CreateModifyEndpoints(svc, epFound, deList)
+		if IsStrict(svc) {
+			c.reportUntrackedPods(svc, selectorMap, svcNet, deList)
+		}
+	}
+}
+
+// reportUntrackedPods records a Warning Event on the strict Service, and on its every selected Pod which has no DanmEp in the network of the Service
+func (c *Controller) reportUntrackedPods(svc *corev1.Service, selectorMap map[string]string, svcNet string, deList []*danmv1.DanmEp) {
+	pods, err := c.podLister.Pods(svc.Namespace).List(labels.SelectorFromSet(selectorMap))
+	if err != nil {
+		glog.Errorf("reportUntrackedPods: get pods %s", err)
+		return
+	}
+	untracked := FindUntrackedPods(pods, deList, svcNet)
+	for _, pod := range untracked {
+		c.recorder.Eventf(pod, corev1.EventTypeWarning, UntrackedPodReason, "Pod is selected by Service %s, but it has no interface in network %s", svc.Name, svcNet)
+	}
+	if len(untracked) > 0 {
+		c.recorder.Eventf(svc, corev1.EventTypeWarning, UntrackedPodReason, "%d out of %d selected Pods have no interface in network %s, so they are missing from the Endpoints", len(untracked), len(pods), svcNet)
+	}
+	if len(pods) == 0 {
+		c.recorder.Eventf(svc, corev1.EventTypeWarning, UntrackedPodReason, "No Pod is selected by %s, the Endpoints are empty", danmSelector)
 	}
 }
 
@@ -1,4 +1,4 @@
-package main
+package svccontroller
 
 import (
 	"encoding/json"
@@ -6,12 +6,22 @@ import (
 	corev1 "k8s.io/api/core/v1"
 	danmv1 "github.com/nokia/danm/pkg/crd/apis/danm/v1"
 	"reflect"
+	"strings"
 )
 
 const danmSelector = "danm.k8s.io/selector"
 const danmNetwork = "danm.k8s.io/network"
 const TolerateUnreadyEps = "service.alpha.kubernetes.io/tolerate-unready-endpoints"
 
+// DanmStrict makes svcwatcher report every Pod of the Service it cannot track with a Warning Event, instead of silently leaving it out of the Endpoints
+const DanmStrict = "danm.k8s.io/strict"
+
+// Reasons of the Warning Events recorded for strict Services
+const (
+	ServiceMisconfiguredReason = "DanmServiceMisconfigured"
+	UntrackedPodReason         = "DanmPodUntracked"
+)
+
 func IsContain(ep, svc map[string]string) bool {
 	epFit := true
 	for k, v := range svc {
@@ -137,3 +147,50 @@ func MatchExistingSvc(de *danmv1.DanmEp, servicesList []*corev1.Service) []*core
 	return svcList
 }
 
+
+// GetEndpointIp returns the address of the DanmEp published in Endpoints: its IPv4 address, or its IPv6 address on IPv6-only networks
+func GetEndpointIp(de *danmv1.DanmEp) string {
+	address := de.Spec.Iface.Address
+	if address == "" {
+		address = de.Spec.Iface.AddressIPv6
+	}
+	return strings.Split(address, "/")[0]
+}
+
+// LabelPatch returns a JSON merge patch setting the labels of an object to newLabels
+// Labels not present in newLabels anymore are explicitly removed, all other fields of the object are left untouched
+func LabelPatch(oldLabels, newLabels map[string]string) ([]byte, error) {
+	patchLabels := make(map[string]interface{})
+	for key := range oldLabels {
+		if _, ok := newLabels[key]; !ok {
+			patchLabels[key] = nil
+		}
+	}
+	for key, value := range newLabels {
+		patchLabels[key] = value
+	}
+	return json.Marshal(map[string]interface{}{"metadata": map[string]interface{}{"labels": patchLabels}})
+}
+
+// IsStrict tells if the Service requested strict tracking of its Pods
+func IsStrict(svc *corev1.Service) bool {
+	return svc.Annotations[DanmStrict] == "true"
+}
+
+// FindUntrackedPods returns the Pods selected by the Service which have no DanmEp in the network of the Service
+func FindUntrackedPods(pods []*corev1.Pod, des []*danmv1.DanmEp, svcNet string) []*corev1.Pod {
+	var untracked []*corev1.Pod
+	for _, pod := range pods {
+		tracked := false
+		for _, de := range des {
+			if de.Namespace == pod.Namespace && de.Spec.Pod == pod.Name && de.Spec.NetworkID == svcNet {
+				tracked = true
+				break
+			}
+		}
+		if !tracked {
+			untracked = append(untracked, pod)
+		}
+	}
+	return untracked
+}
@@ -0,0 +1,51 @@
+package svccontroller_test
+
+import (
+	"testing"
+
+	danmv1 "github.com/nokia/danm/pkg/crd/apis/danm/v1"
+	"github.com/nokia/danm/pkg/svccontroller"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func newPod(name string) *corev1.Pod {
+	return &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"}}
+}
+
+func newEp(pod, network string) *danmv1.DanmEp {
+	return &danmv1.DanmEp{
+		ObjectMeta: metav1.ObjectMeta{Name: pod + "-" + network, Namespace: "default"},
+		Spec:       danmv1.DanmEpSpec{Pod: pod, NetworkID: network},
+	}
+}
+
+func TestIsStrict(t *testing.T) {
+	svc := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{}}}
+	if svccontroller.IsStrict(svc) {
+		t.Errorf("Service without annotation was found strict")
+	}
+	svc.Annotations[svccontroller.DanmStrict] = "false"
+	if svccontroller.IsStrict(svc) {
+		t.Errorf("Service with disabled strict mode was found strict")
+	}
+	svc.Annotations[svccontroller.DanmStrict] = "true"
+	if !svccontroller.IsStrict(svc) {
+		t.Errorf("Service with enabled strict mode was not found strict")
+	}
+}
+
+func TestFindUntrackedPods(t *testing.T) {
+	pods := []*corev1.Pod{newPod("tracked"), newPod("otherNet"), newPod("noEp")}
+	des := []*danmv1.DanmEp{newEp("tracked", "internal"), newEp("otherNet", "external")}
+	otherNsEp := newEp("noEp", "internal")
+	otherNsEp.Namespace = "other"
+	des = append(des, otherNsEp)
+	untracked := svccontroller.FindUntrackedPods(pods, des, "internal")
+	if len(untracked) != 2 || untracked[0].Name != "otherNet" || untracked[1].Name != "noEp" {
+		t.Errorf("Unexpected untracked Pods:%v", untracked)
+	}
+	if len(svccontroller.FindUntrackedPods(pods[:1], des, "internal")) != 0 {
+		t.Errorf("Tracked Pod was reported untracked")
+	}
+}
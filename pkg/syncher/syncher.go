@@ -3,6 +3,7 @@ package syncher
 import (
   "errors"
   "fmt"
+  "sort"
   "strings"
   "sync"
   "time"
@@ -72,18 +73,53 @@ func (synch *Syncher) mergeErrorMessages() error {
   return fmt.Errorf(strings.Join(aggregatedErrors, "\n"))
 }
 
-func (synch *Syncher) MergeCniResults() *current.Result {
+// MergeCniResults aggregates the results of the successful CNI operations in the order of the networks of the Pod, so its first network provides its primary addresses
+// The IPs of every network are listed primary IP family first, as container runtimes report the first IP of the result as the IP of the Pod
+func (synch *Syncher) MergeCniResults(networks []string, isIpv6Primary bool) *current.Result {
+  results := make([]cniOpResult, len(synch.cniResults))
+  copy(results, synch.cniResults)
+  sort.SliceStable(results, func(i, j int) bool {
+    return getPosition(networks, results[i].cniName) < getPosition(networks, results[j].cniName)
+  })
   aggregatedCniRes := current.Result{}
-  for _, cniRes := range synch.cniResults {
-    if cniRes.cniResult != nil {
-      aggregatedCniRes.Interfaces = append(aggregatedCniRes.Interfaces, cniRes.cniResult.Interfaces...)
-      aggregatedCniRes.IPs = append(aggregatedCniRes.IPs, cniRes.cniResult.IPs...)
-      aggregatedCniRes.Routes = append(aggregatedCniRes.Routes, cniRes.cniResult.Routes...)
+  for _, cniRes := range results {
+    if cniRes.cniResult == nil {
+      continue
+    }
+    ifaceOffset := len(aggregatedCniRes.Interfaces)
+    aggregatedCniRes.Interfaces = append(aggregatedCniRes.Interfaces, cniRes.cniResult.Interfaces...)
+    ips := make([]*current.IPConfig, 0, len(cniRes.cniResult.IPs))
+    for _, ip := range cniRes.cniResult.IPs {
+      ipCopy := *ip
+      //Interface indexes point into the Interfaces of the merged result from now on
+      if ip.Interface != nil {
+        ifaceIndex := *ip.Interface + ifaceOffset
+        ipCopy.Interface = &ifaceIndex
+      }
+      ips = append(ips, &ipCopy)
     }
+    sort.SliceStable(ips, func(i, j int) bool {
+      return isPrimaryFamily(ips[i], isIpv6Primary) && !isPrimaryFamily(ips[j], isIpv6Primary)
+    })
+    aggregatedCniRes.IPs = append(aggregatedCniRes.IPs, ips...)
+    aggregatedCniRes.Routes = append(aggregatedCniRes.Routes, cniRes.cniResult.Routes...)
   }
   return &aggregatedCniRes
 }
 
+func getPosition(networks []string, network string) int {
+  for i, name := range networks {
+    if name == network {
+      return i
+    }
+  }
+  return len(networks)
+}
+
+func isPrimaryFamily(ip *current.IPConfig, isIpv6Primary bool) bool {
+  return (ip.Address.IP.To4() == nil) == isIpv6Primary
+}
+
 func (synch *Syncher) WasAnyOperationErroneous() bool {
   if len(synch.cniResults) == 0 {
     return false
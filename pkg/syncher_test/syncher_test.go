@@ -0,0 +1,52 @@
+package syncher_test
+
+import (
+  "testing"
+  "github.com/containernetworking/cni/pkg/types"
+  "github.com/containernetworking/cni/pkg/types/current"
+  "github.com/nokia/danm/pkg/syncher"
+)
+
+func newResult(ifaceName string, ips ...string) *current.Result {
+  result := &current.Result{Interfaces: []*current.Interface{{Name: ifaceName}}}
+  for _, ip := range ips {
+    address, _ := types.ParseCIDR(ip)
+    ifaceIndex := 0
+    result.IPs = append(result.IPs, &current.IPConfig{Address: *address, Interface: &ifaceIndex})
+  }
+  return result
+}
+
+func TestMergeCniResults(t *testing.T) {
+  mergeTcs := []struct {
+    tcName string
+    isIpv6Primary bool
+    expectedIps []string
+  }{
+    {"ipv4Primary", false, []string{"10.0.0.2/24", "2001:db8::2/64", "192.168.1.2/24"}},
+    {"ipv6Primary", true, []string{"2001:db8::2/64", "10.0.0.2/24", "192.168.1.2/24"}},
+  }
+  for _, tc := range mergeTcs {
+    t.Run(tc.tcName, func(t *testing.T) {
+      synch := syncher.NewSyncher(2)
+      //Results are pushed in the order the operations finish, not in the order of the networks
+      synch.PushResult("internal", nil, newResult("internal-ep", "192.168.1.2/24"))
+      synch.PushResult("primary", nil, newResult("primary-ep", "2001:db8::2/64", "10.0.0.2/24"))
+      merged := synch.MergeCniResults([]string{"primary", "internal"}, tc.isIpv6Primary)
+      if len(merged.Interfaces) != 2 || merged.Interfaces[0].Name != "primary-ep" {
+        t.Fatalf("Interfaces of the merged result are not in the order of the networks")
+      }
+      if len(merged.IPs) != len(tc.expectedIps) {
+        t.Fatalf("Number of merged IPs:%d does not match with expected:%d", len(merged.IPs), len(tc.expectedIps))
+      }
+      for i, ip := range merged.IPs {
+        if ip.Address.String() != tc.expectedIps[i] {
+          t.Errorf("IP:%s at position:%d does not match with expected:%s", ip.Address.String(), i, tc.expectedIps[i])
+        }
+      }
+      if *merged.IPs[2].Interface != 1 {
+        t.Errorf("Interface index:%d of the IP of the second network does not point to its interface", *merged.IPs[2].Interface)
+      }
+    })
+  }
+}
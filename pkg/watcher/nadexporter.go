@@ -0,0 +1,33 @@
+package watcher
+
+import (
+  "errors"
+  "flag"
+  "k8s.io/client-go/dynamic"
+  "k8s.io/client-go/kubernetes"
+  danmclientset "github.com/nokia/danm/pkg/crd/client/clientset/versioned"
+  "github.com/nokia/danm/pkg/nadexport"
+)
+
+func runNadexporter(opts *Options, flags *flag.FlagSet, args []string) error {
+  flags.Parse(args)
+  config, err := opts.GetClientConfig()
+  if err != nil {
+    return errors.New("Parsing kubeconfig failed with error:" + err.Error())
+  }
+  kubeClient, err := kubernetes.NewForConfig(config)
+  if err != nil {
+    return errors.New("Creation of K8s client failed with error:" + err.Error())
+  }
+  danmClient, err := danmclientset.NewForConfig(config)
+  if err != nil {
+    return errors.New("Creation of DANM client failed with error:" + err.Error())
+  }
+  dynClient, err := dynamic.NewForConfig(config)
+  if err != nil {
+    return errors.New("Creation of dynamic client failed with error:" + err.Error())
+  }
+  opts.ServeMetrics()
+  exporter := nadexport.NewExporter(danmClient, dynClient)
+  return RunAsLeader(kubeClient, "danm-nad-exporter", exporter.Run)
+}
@@ -0,0 +1,264 @@
+package watcher
+
+import (
+  "context"
+  "errors"
+  "flag"
+  "log"
+  "os"
+  "strings"
+  "time"
+  meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+  kubeinformers "k8s.io/client-go/informers"
+  "k8s.io/client-go/kubernetes"
+  "k8s.io/client-go/rest"
+  "k8s.io/client-go/tools/cache"
+  "github.com/nokia/danm/pkg/allocmigration"
+  "github.com/nokia/danm/pkg/arpproxy"
+  "github.com/nokia/danm/pkg/bootbarrier"
+  "github.com/nokia/danm/pkg/cleaner"
+  "github.com/nokia/danm/pkg/danmnet"
+  "github.com/nokia/danm/pkg/eprepair"
+  "github.com/nokia/danm/pkg/ipreservation"
+  "github.com/nokia/danm/pkg/neighbor"
+  "github.com/nokia/danm/pkg/nodecap"
+  "github.com/nokia/danm/pkg/reachability"
+  "github.com/nokia/danm/pkg/spool"
+  danmclientset "github.com/nokia/danm/pkg/crd/client/clientset/versioned"
+)
+
+func watchRes(controller cache.Controller) {
+  stop := make(chan struct{})
+  go controller.Run(stop)
+}
+
+func startProber(config *rest.Config, sampleSize int, interval time.Duration) error {
+  client, err := danmclientset.NewForConfig(config)
+  if err != nil {
+    return err
+  }
+  prober, err := reachability.NewProber(client, sampleSize, interval)
+  if err != nil {
+    return err
+  }
+  go prober.Run(make(chan struct{}))
+  return nil
+}
+
+func startCleanupWorker(config *rest.Config, interval time.Duration) error {
+  client, err := danmclientset.NewForConfig(config)
+  if err != nil {
+    return err
+  }
+  worker, err := spool.NewWorker(client, spool.DefaultDir, interval)
+  if err != nil {
+    return err
+  }
+  go worker.Run(make(chan struct{}))
+  return nil
+}
+
+func startRepairer(config *rest.Config, timeout time.Duration) error {
+  client, err := danmclientset.NewForConfig(config)
+  if err != nil {
+    return err
+  }
+  repairer, err := eprepair.NewRepairer(client, timeout)
+  if err != nil {
+    return err
+  }
+  go repairer.Run(make(chan struct{}))
+  return nil
+}
+
+// publishCapabilities probes the capabilities of the local host, and records them in its DanmNodeCapability
+func publishCapabilities(config *rest.Config) error {
+  client, err := danmclientset.NewForConfig(config)
+  if err != nil {
+    return err
+  }
+  host, err := os.Hostname()
+  if err != nil {
+    return err
+  }
+  nodeCap := nodecap.Probe(nodecap.DefaultPaths)
+  if !nodeCap.Features.Ipvlan {
+    log.Println("ERROR: the ipvlan kernel module is not available on node:" + host + ", Pods cannot be connected to IPVLAN networks here")
+  }
+  if nodeCap.RuntimeSocket == "" {
+    log.Println("ERROR: no container runtime socket is found on node:" + host + ", IPVLAN interfaces cannot be created here")
+  }
+  return nodecap.Publish(client, host, nodeCap)
+}
+
+// startCleaner embeds the cleaner, watching only the Pods of the local host
+func startCleaner(config *rest.Config, cleanerConfig cleaner.Config) error {
+  danmClient, err := danmclientset.NewForConfig(config)
+  if err != nil {
+    return err
+  }
+  kubeClient, err := kubernetes.NewForConfig(config)
+  if err != nil {
+    return err
+  }
+  host, err := os.Hostname()
+  if err != nil {
+    return err
+  }
+  kubeInformerFactory := kubeinformers.NewFilteredSharedInformerFactory(kubeClient, time.Minute*10, meta_v1.NamespaceAll, func(opts *meta_v1.ListOptions) {
+    opts.FieldSelector = "spec.nodeName=" + host
+  })
+  cleanerConfig.DanmClient = danmClient
+  cleanerConfig.KubeClient = kubeClient
+  cleanerConfig.KubeInformerFactory = kubeInformerFactory
+  cleanerConfig.Host = host
+  epCleaner, err := cleaner.New(cleanerConfig)
+  if err != nil {
+    return err
+  }
+  return epCleaner.Start(context.Background())
+}
+
+func getPriorityNamespaces(list string) []string {
+  var namespaces []string
+  for _, namespace := range strings.Split(list, ",") {
+    namespace = strings.TrimSpace(namespace)
+    if namespace != "" {
+      namespaces = append(namespaces, namespace)
+    }
+  }
+  return namespaces
+}
+
+func runNetwatcher(opts *Options, flags *flag.FlagSet, args []string) error {
+  numOfWorkers := flags.Int("workers", 10, "Number of DanmNets processed in parallel. Operations touching the same host device are always serialized.")
+  statusBatchInterval := flags.Duration("status-batch-interval", time.Second, "Write the validity of DanmNets to the API in batches with this interval, keeping only the latest update of every DanmNet. Validity is written immediately if set to 0.")
+  statusBatchSize := flags.Int("status-batch-size", 50, "Maximum number of DanmNets whose validity is written to the API in one --status-batch-interval.")
+  allocFormat := flags.String("alloc-format", allocmigration.CurrentFormat, "Format the allocation record of all DanmNets is migrated to at start-up.")
+  tenantConfigPath := flags.String("tenantconfig", "", "Path to a JSON file restricting which host devices, network types, VLANs, and VxLANs the DanmNets of a namespace can use.")
+  reservedConfigPath := flags.String("reservedconfig", "", "Path to a JSON file listing the IPv4 addresses, and CIDR offsets never allocated to Pods from any DanmNet, e.g. DNS VIPs, and gateways.")
+  shadowRules := flags.String("shadow-rules", "", "Comma separated list of DanmNet validation rules which only log, and count the networks they would find invalid in the danm_validation_shadow_rejections_total metric, instead of invalidating them. One of: " + strings.Join(danmnet.ShadowableRules, ", ") + ".")
+  shadowUntil := flags.String("shadow-until", "", "RFC3339 timestamp after which the rules listed in --shadow-rules are enforced again. The rules stay in shadow mode until netwatcher is restarted without --shadow-rules if not set.")
+  allocRollback := flags.Bool("alloc-rollback", false, "Roll back the last allocation format migration of all DanmNets at start-up, instead of migrating them.")
+  probeInterval := flags.Duration("probe-interval", 0, "Probe the reachability of a sample of remote DanmEp addresses of every network with this interval. Probing is disabled if not set.")
+  probeSample := flags.Int("probe-sample", 5, "Maximum number of DanmEp addresses probed per network in every probing cycle.")
+  cleanupInterval := flags.Duration("cleanup-interval", time.Second, "Interval of freeing the addresses, and deleting the DanmEps handed over by CNI invocations configured with async_cleanup.")
+  arpProxy := flags.Bool("arp-proxy", false, "Answer ARP requests, and Neighbor Solicitations on the host interface of IPVLAN networks enabling proxy_arp on behalf of the Pods running on other nodes.")
+  repairTimeout := flags.Duration("repair-timeout", time.Minute*5, "Complete, or roll back the DanmEps of the host stuck in the Creating phase for longer than this. Repair is disabled if set to 0.")
+  cleanerInterval := flags.Duration("cleaner-interval", 0, "Delete the DanmEps of the host whose Pod, and container do not exist anymore, and free their addresses with this interval. The cleaner is disabled if not set.")
+  cleanerGracePeriod := flags.Duration("cleaner-grace-period", cleaner.DefaultGracePeriod, "Minimum age of the DanmEps deleted by the cleaner.")
+  cleanerMaxDeletes := flags.Int("max-deletes-per-cycle", cleaner.DefaultMaxDeletesPerCycle, "The cleaner deletes nothing, and records a warning Event on the Node if it finds more stale DanmEps than this in one cycle.")
+  cleanerIgnoreMaxDeletes := flags.Bool("ignore-max-deletes", false, "Let the cleaner delete any number of stale DanmEps in one cycle, e.g. to clean up after a mass node failure.")
+  cleanerWatchPods := flags.Bool("cleaner-watch-pods", false, "Start the cleaner, and also clean up the DanmEps of a Pod of the host shortly after it is deleted, or terminates.")
+  cleanerSkipRuntime := flags.Bool("cleaner-skip-runtime-check", false, "The cleaner decides only based on the Pods in the K8s API, without querying the container runtime.")
+  cleanerPriorityNamespaces := flags.String("cleaner-priority-namespaces", "kube-system", "Comma separated list of namespaces whose stale DanmEps are cleaned up first in every cycle of the cleaner, in the order of the list.")
+  cleanerCheckpointAnnotation := flags.String("cleaner-checkpoint-annotation", "danm.k8s.io/checkpointed", "The cleaner never deletes the DanmEps of Pods, or the DanmEps annotated with this key, e.g. because their sandbox was checkpointed, and can be restored later. Disabled if empty.")
+  cleanerCheckpointLabel := flags.String("cleaner-checkpoint-label", "", "The cleaner never deletes the DanmEps of Pods, or the DanmEps labeled with this key. Disabled if empty.")
+  bootBarrier := flags.Bool("boot-barrier", false, "Start the cleaner, and open the boot barrier in " + bootbarrier.DefaultPath + " once the DanmEps created before the boot of the host are cleaned up. CNI ADDs configured with boot_barrier_timeout wait for the barrier.")
+  probeCapabilities := flags.Bool("probe-capabilities", true, "Detect the kernel features, container runtime socket, and NICs of the host at start-up, and record them in the DanmNodeCapability of the node. The CNI refuses to connect Pods to networks the node does not support.")
+  flags.Parse(args)
+  config, err := opts.GetClientConfig()
+  if err != nil {
+    return errors.New("Parsing kubeconfig failed with error:" + err.Error())
+  }
+  if *probeCapabilities {
+    //Without a DanmNodeCapability the CNI skips validation, so the netwatcher can still serve the node
+    err = publishCapabilities(config)
+    if err != nil {
+      log.Println("ERROR: publishing the capabilities of the node failed with error:" + err.Error())
+    }
+  }
+  var tenantConfig *danmnet.TenantConfig
+  if *tenantConfigPath != "" {
+    tenantConfig, err = danmnet.LoadTenantConfig(*tenantConfigPath)
+    if err != nil {
+      return err
+    }
+  }
+  var reservedAddresses *danmnet.ReservedAddresses
+  if *reservedConfigPath != "" {
+    reservedAddresses, err = danmnet.LoadReservedAddresses(*reservedConfigPath)
+    if err != nil {
+      return err
+    }
+  }
+  var shadow *danmnet.ShadowConfig
+  if *shadowRules != "" {
+    var until time.Time
+    if *shadowUntil != "" {
+      until, err = time.Parse(time.RFC3339, *shadowUntil)
+      if err != nil {
+        return errors.New("Parsing --shadow-until failed with error:" + err.Error())
+      }
+    }
+    shadow, err = danmnet.NewShadowConfig(strings.Split(*shadowRules, ","), until)
+    if err != nil {
+      return err
+    }
+  }
+  netHandler, err := danmnet.NewHandler(config, danmnet.HandlerOptions{NumOfWorkers: *numOfWorkers, TenantConfig: tenantConfig, ReservedAddresses: reservedAddresses, Shadow: shadow, StatusBatchInterval: *statusBatchInterval, StatusBatchSize: *statusBatchSize})
+  if err != nil {
+    return errors.New("Creation of K8s DanmNet Controller failed with error:" + err.Error())
+  }
+  netHandler.MigrateAllocations(*allocFormat, *allocRollback)
+  netHandler.CollectOrphanedHostInterfaces()
+  watchRes(netHandler.CreateController())
+  reservationHandler, err := ipreservation.NewHandler(config)
+  if err != nil {
+    return errors.New("Creation of K8s DanmIPReservation Controller failed with error:" + err.Error())
+  }
+  watchRes(reservationHandler.CreateController())
+  neighborHandler, err := neighbor.NewHandler(config)
+  if err != nil {
+    return errors.New("Creation of K8s DanmEp Controller failed with error:" + err.Error())
+  }
+  watchRes(neighborHandler.CreateController())
+  if *arpProxy {
+    proxyHandler, err := arpproxy.NewHandler(config)
+    if err != nil {
+      return errors.New("Creation of K8s DanmEp Controller failed with error:" + err.Error())
+    }
+    watchRes(proxyHandler.CreateController())
+  }
+  if *probeInterval > 0 {
+    err = startProber(config, *probeSample, *probeInterval)
+    if err != nil {
+      return errors.New("Creation of reachability prober failed with error:" + err.Error())
+    }
+  }
+  err = startCleanupWorker(config, *cleanupInterval)
+  if err != nil {
+    return errors.New("Creation of DanmEp cleanup worker failed with error:" + err.Error())
+  }
+  if *repairTimeout > 0 {
+    err = startRepairer(config, *repairTimeout)
+    if err != nil {
+      return errors.New("Creation of DanmEp repairer failed with error:" + err.Error())
+    }
+  }
+  if *cleanerInterval > 0 || *cleanerWatchPods || *bootBarrier {
+    var barrier string
+    if *bootBarrier {
+      barrier = bootbarrier.DefaultPath
+    }
+    err = startCleaner(config, cleaner.Config {
+      Interval: *cleanerInterval,
+      GracePeriod: *cleanerGracePeriod,
+      MaxDeletesPerCycle: *cleanerMaxDeletes,
+      IgnoreMaxDeletes: *cleanerIgnoreMaxDeletes,
+      WatchPods: *cleanerWatchPods,
+      SkipRuntimeCheck: *cleanerSkipRuntime,
+      PriorityNamespaces: getPriorityNamespaces(*cleanerPriorityNamespaces),
+      BootBarrier: barrier,
+      CheckpointAnnotation: *cleanerCheckpointAnnotation,
+      CheckpointLabel: *cleanerCheckpointLabel,
+    })
+    if err != nil {
+      return errors.New("Creation of DanmEp cleaner failed with error:" + err.Error())
+    }
+  }
+  opts.ServeMetrics()
+
+  // Wait forever
+  select {}
+}
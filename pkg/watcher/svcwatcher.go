@@ -0,0 +1,47 @@
+package watcher
+
+import (
+  "errors"
+  "flag"
+  "time"
+  "github.com/golang/glog"
+  kubeinformers "k8s.io/client-go/informers"
+  "k8s.io/client-go/kubernetes"
+  danmclientset "github.com/nokia/danm/pkg/crd/client/clientset/versioned"
+  danminformers "github.com/nokia/danm/pkg/crd/client/informers/externalversions"
+  "github.com/nokia/danm/pkg/svccontroller"
+)
+
+func runSvcwatcher(opts *Options, flags *flag.FlagSet, args []string) error {
+  // "kubeconfig" is kept for backward compatibility of existing svcwatcher manifests
+  flags.StringVar(&opts.KubeConfig, "kubeconfig", "", "Deprecated alias of --kubeconf.")
+  flags.Parse(args)
+  config, err := opts.GetClientConfig()
+  if err != nil {
+    return errors.New("Parsing kubeconfig failed with error:" + err.Error())
+  }
+  kubeClient, err := kubernetes.NewForConfig(config)
+  if err != nil {
+    return errors.New("Creation of K8s client failed with error:" + err.Error())
+  }
+  danmClient, err := danmclientset.NewForConfig(config)
+  if err != nil {
+    return errors.New("Creation of DANM client failed with error:" + err.Error())
+  }
+  kubeInformerFactory := kubeinformers.NewSharedInformerFactory(kubeClient, time.Second*30)
+  danmInformerFactory := danminformers.NewSharedInformerFactory(danmClient, time.Second*30)
+  controller := svccontroller.NewController(kubeClient, danmClient,
+    kubeInformerFactory.Core().V1().Pods(),
+    kubeInformerFactory.Core().V1().Services(),
+    kubeInformerFactory.Core().V1().Endpoints(),
+    danmInformerFactory.Danm().V1().DanmEps())
+  opts.ServeMetrics()
+  return RunAsLeader(kubeClient, "danm-svc-controller", func(stop <-chan struct{}) {
+    go kubeInformerFactory.Start(stop)
+    go danmInformerFactory.Start(stop)
+    err := controller.Run(10, stop)
+    if err != nil {
+      glog.Fatalf("Error running controller: %s", err.Error())
+    }
+  })
+}
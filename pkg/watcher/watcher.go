@@ -0,0 +1,168 @@
+package watcher
+
+import (
+  "errors"
+  "flag"
+  "log"
+  "net/http"
+  "os"
+  "path/filepath"
+  "sort"
+  "time"
+  "github.com/prometheus/client_golang/prometheus/promhttp"
+  "github.com/nokia/danm/pkg/apimetrics"
+  corev1 "k8s.io/api/core/v1"
+  "k8s.io/client-go/kubernetes"
+  "k8s.io/client-go/kubernetes/scheme"
+  v1core "k8s.io/client-go/kubernetes/typed/core/v1"
+  "k8s.io/client-go/rest"
+  "k8s.io/client-go/tools/clientcmd"
+  "k8s.io/client-go/tools/leaderelection"
+  "k8s.io/client-go/tools/leaderelection/resourcelock"
+  "k8s.io/client-go/tools/record"
+)
+
+const (
+  lockNamespace = "kube-system"
+)
+
+// Command is a DANM Kubernetes controller which can be started as a subcommand of the multi-call binary
+type Command struct {
+  Description string
+  // Run parses the command line arguments of the component, and runs it until it fails
+  Run func(opts *Options, flags *flag.FlagSet, args []string) error
+}
+
+var commands = map[string]Command {
+  "netwatcher": Command{Description: "Creates host interfaces, and serves DanmIPReservations on every node", Run: runNetwatcher},
+  "svcwatcher": Command{Description: "Provisions the Endpoints of Services selecting DanmEps", Run: runSvcwatcher},
+  "nadexporter": Command{Description: "Exports DanmNets as NetworkAttachmentDefinitions", Run: runNadexporter},
+}
+
+// Options contains the command line arguments understood by every component
+type Options struct {
+  KubeConfig string
+  MetricsAddr string
+  // Component is the name of the running component, its K8s API operations are accounted under this name
+  Component string
+}
+
+// Main starts the component named by the binary (busybox style, e.g. through a symlink), or by the first argument
+func Main(args []string) {
+  name := filepath.Base(args[0])
+  if _, ok := commands[name]; !ok {
+    if len(args) < 2 {
+      printUsage()
+      os.Exit(-1)
+    }
+    name, args = args[1], args[1:]
+  }
+  Run(name, args[1:])
+}
+
+// Run starts the named component with the given command line arguments, and exits if it fails
+func Run(name string, args []string) {
+  log.SetOutput(os.Stdout)
+  command, ok := commands[name]
+  if !ok {
+    printUsage()
+    os.Exit(-1)
+  }
+  log.Println("Starting DANM " + name + "...")
+  opts := &Options{Component: name}
+  flags := flag.CommandLine
+  flags.StringVar(&opts.KubeConfig, "kubeconf", "", "Path to a kube config. Only required if out-of-cluster.")
+  flags.StringVar(&opts.MetricsAddr, "metrics-addr", "", "Address the Prometheus metrics, and the /healthz endpoint are served on (e.g. :9101). Not served if not set.")
+  err := apimetrics.Register()
+  if err != nil {
+    log.Println("ERROR: " + err.Error() + " , exiting")
+    os.Exit(-1)
+  }
+  err = command.Run(opts, flags, args)
+  if err != nil {
+    log.Println("ERROR: " + err.Error() + " , exiting")
+    os.Exit(-1)
+  }
+}
+
+func printUsage() {
+  names := make([]string, 0, len(commands))
+  for name := range commands {
+    names = append(names, name)
+  }
+  sort.Strings(names)
+  log.Println("Usage: danmwatcher <command> [arguments], where command is one of:")
+  for _, name := range names {
+    log.Println("  " + name + ": " + commands[name].Description)
+  }
+}
+
+// GetClientConfig returns the REST config built from the kube config of the component, or the in-cluster config if none was given
+// The API operations of the clients built from the config are accounted in the metrics of the component
+func (opts *Options) GetClientConfig() (*rest.Config, error) {
+  var config *rest.Config
+  var err error
+  if opts.KubeConfig != "" {
+    config, err = clientcmd.BuildConfigFromFlags("", opts.KubeConfig)
+  } else {
+    config, err = rest.InClusterConfig()
+  }
+  if err != nil {
+    return nil, err
+  }
+  apimetrics.InstrumentConfig(opts.Component, config)
+  return config, nil
+}
+
+// ServeMetrics serves the Prometheus metrics, and a liveness probe endpoint of the component if it was requested
+func (opts *Options) ServeMetrics() {
+  if opts.MetricsAddr == "" {
+    return
+  }
+  mux := http.NewServeMux()
+  mux.Handle("/metrics", promhttp.Handler())
+  mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+    w.Write([]byte("ok"))
+  })
+  go func() {
+    log.Println("ERROR: Metrics server stopped with error:" + http.ListenAndServe(opts.MetricsAddr, mux).Error())
+  }()
+}
+
+// RunAsLeader runs the function only while the component instance holds the named lock
+// The component exits when the leadership is lost, so it can be restarted with a clean state
+func RunAsLeader(kubeClient kubernetes.Interface, lockName string, run func(stop <-chan struct{})) error {
+  hostname, err := os.Hostname()
+  if err != nil {
+    return errors.New("OS.Hostname returned error:" + err.Error())
+  }
+  lock, err := resourcelock.New(resourcelock.EndpointsResourceLock, lockNamespace, lockName, kubeClient.CoreV1(),
+    resourcelock.ResourceLockConfig {
+      Identity: hostname,
+      EventRecorder: createRecorder(kubeClient, lockName),
+    })
+  if err != nil {
+    return errors.New("creation of leader election lock failed with error:" + err.Error())
+  }
+  leaderelection.RunOrDie(leaderelection.LeaderElectionConfig {
+    Lock: lock,
+    LeaseDuration: 10 * time.Second,
+    RenewDeadline: 5 * time.Second,
+    RetryPeriod: 3 * time.Second,
+    Callbacks: leaderelection.LeaderCallbacks {
+      OnStartedLeading: run,
+      OnStoppedLeading: func() {
+        log.Println("ERROR: Leadership lost, exiting")
+        os.Exit(-1)
+      },
+    },
+  })
+  return errors.New("leader election of lock:" + lockName + " ended")
+}
+
+func createRecorder(kubeClient kubernetes.Interface, component string) record.EventRecorder {
+  eventBroadcaster := record.NewBroadcaster()
+  eventBroadcaster.StartLogging(log.Printf)
+  eventBroadcaster.StartRecordingToSink(&v1core.EventSinkImpl{Interface: kubeClient.CoreV1().Events(lockNamespace)})
+  return eventBroadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: component})
+}